@@ -0,0 +1,137 @@
+package yamp
+
+import (
+	"errors"
+	"fmt"
+)
+
+// node is a node in the syntax tree of an expression.
+type node interface {
+	// span returns the location of the subexpression represented by the node.
+	span() Span
+}
+
+type numberNode struct {
+	value  float64
+	symbol string
+	sp     Span
+}
+
+func (n numberNode) span() Span { return n.sp }
+
+type variableNode struct {
+	name string
+	sp   Span
+}
+
+func (n variableNode) span() Span { return n.sp }
+
+type operatorNode struct {
+	op       Operator
+	opSpan   Span // location of the operator symbol
+	operands []node
+	sp       Span
+}
+
+func (n operatorNode) span() Span { return n.sp }
+
+type callNode struct {
+	fn     Function
+	fnSpan Span // location of the function name
+	args   []node
+	sp     Span
+}
+
+func (n callNode) span() Span { return n.sp }
+
+// parse builds a syntax tree from tokens in reverse polish notation.
+func parse(rpn []spannedToken) (root node, err error) {
+	if len(rpn) == 0 {
+		return nil, errors.New(errEmptyExpression)
+	}
+
+	var stack []node
+	for _, tok := range rpn {
+		switch t := tok.Token.(type) {
+		case Number:
+			var v float64
+			if v, err = t.Value(); err != nil {
+				return nil, err
+			}
+			stack = append(stack, numberNode{value: v, symbol: t.String(), sp: tok.span})
+		case Variable:
+			stack = append(stack, variableNode{name: t.Name(), sp: tok.span})
+		case subtree:
+			stack = append(stack, t.n)
+		case Operator:
+			n := operandCount(t)
+			if len(stack) < n {
+				return nil, errors.New(errMalformedExpression)
+			}
+
+			operands := make([]node, n)
+			copy(operands, stack[len(stack)-n:])
+			stack = append(stack[:len(stack)-n], derivativeNotation(operatorNode{
+				op:       t,
+				opSpan:   tok.span,
+				operands: operands,
+				sp:       unionSpans(tok.span, operands),
+			}))
+		case Function:
+			if !AcceptsArgs(t, tok.argc) {
+				return nil, SyntaxError{
+					Message:  fmt.Sprintf(errArgumentCount, t, tok.span.Start, describeNumArgs(t), tok.argc),
+					Token:    t.String(),
+					Position: tok.span.Start,
+				}
+			}
+			if len(stack) < tok.argc {
+				return nil, errors.New(errMalformedExpression)
+			}
+
+			args := make([]node, tok.argc)
+			copy(args, stack[len(stack)-tok.argc:])
+			if _, ok := args[0].(variableNode); !ok && (t.Type() == Sum || t.Type() == Product) {
+				return nil, SyntaxError{
+					Message:  fmt.Sprintf(errIndexVariable, t, tok.span.Start),
+					Token:    t.String(),
+					Position: args[0].span().Start,
+				}
+			}
+			if err = checkCalculusArgs(t, tok.span, args); err != nil {
+				return nil, err
+			}
+			stack = append(stack[:len(stack)-tok.argc], callNode{
+				fn:     t,
+				fnSpan: tok.span,
+				args:   args,
+				sp:     unionSpans(tok.span, args),
+			})
+		default:
+			return nil, errors.New(errMalformedExpression)
+		}
+	}
+
+	if len(stack) != 1 {
+		return nil, errors.New(errMalformedExpression)
+	}
+	return stack[0], nil
+}
+
+// operandCount returns the number of operands op takes in reverse polish notation.
+func operandCount(op Operator) int {
+	switch {
+	case op.Type() == ConditionalElse:
+		return 3
+	case IsUnaryOp(op):
+		return 1
+	}
+	return 2
+}
+
+func unionSpans(span Span, nodes []node) Span {
+	for _, n := range nodes {
+		span = span.union(n.span())
+	}
+	return span
+}
@@ -0,0 +1,86 @@
+package yamp
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parse(t *testing.T) {
+	tests := []struct {
+		name     string
+		rpn      []spannedToken
+		wantRoot node
+		wantErr  error
+	}{
+		{
+			name: "an operator should take its operands as children",
+			rpn: []spannedToken{
+				{Token: NewNumber("1"), span: Span{0, 1}},
+				{Token: NewVariable("x"), span: Span{4, 5}},
+				{Token: NewOperator(Addition), span: Span{2, 3}},
+			},
+			wantRoot: operatorNode{
+				op:     NewOperator(Addition),
+				opSpan: Span{2, 3},
+				operands: []node{
+					numberNode{value: 1, symbol: "1", sp: Span{0, 1}},
+					variableNode{name: "x", sp: Span{4, 5}},
+				},
+				sp: Span{0, 5},
+			},
+		},
+		{
+			name: "a function should take its arguments as children",
+			rpn: []spannedToken{
+				{Token: NewNumber("1"), span: Span{10, 11}},
+				{Token: NewNumber("2"), span: Span{13, 14}},
+				{Token: NewFunction(Piecewise), span: Span{0, 9}, argc: 2},
+			},
+			wantRoot: callNode{
+				fn:     NewFunction(Piecewise),
+				fnSpan: Span{0, 9},
+				args: []node{
+					numberNode{value: 1, symbol: "1", sp: Span{10, 11}},
+					numberNode{value: 2, symbol: "2", sp: Span{13, 14}},
+				},
+				sp: Span{0, 14},
+			},
+		},
+		{
+			name:    "an empty expression should produce an error",
+			rpn:     nil,
+			wantErr: errors.New(errEmptyExpression),
+		},
+		{
+			name:    "an operator without enough operands should produce an error",
+			rpn:     withSpans(NewNumber("1"), NewOperator(Addition)),
+			wantErr: errors.New(errMalformedExpression),
+		},
+		{
+			name:    "leftover operands should produce an error",
+			rpn:     withSpans(NewNumber("1"), NewNumber("2")),
+			wantErr: errors.New(errMalformedExpression),
+		},
+		{
+			name: "a function with the wrong number of arguments should produce an error",
+			rpn: []spannedToken{
+				{Token: NewNumber("1")},
+				{Token: NewFunction(If), argc: 1},
+			},
+			wantErr: SyntaxError{
+				Message: fmt.Sprintf(errArgumentCount, "if", 0, "3 arguments", 1),
+				Token:   "if",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotRoot, err := parse(tt.rpn)
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.wantRoot, gotRoot)
+		})
+	}
+}
@@ -0,0 +1,455 @@
+package yamp
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+)
+
+// batchChunkSize is the number of rows evaluated together, which bounds the size of intermediate results.
+const batchChunkSize = 1024
+
+type errorPolicy int
+
+// Ways of handling rows that fail to evaluate or evaluate to NaN
+const (
+	// FailOnError stops at the first failed row and returns a RowError. Rows before it are written.
+	FailOnError errorPolicy = iota + 1
+	// SkipOnError leaves the output of failed rows unchanged, and returns the RowErrors of every failed row.
+	SkipOnError
+	// NaNOnError sets the output of failed rows to NaN, and returns the RowErrors of every failed row.
+	NaNOnError
+)
+
+// BatchOption configures how a batch is evaluated.
+type BatchOption func(*batchOptions)
+
+type batchOptions struct {
+	errorPolicy errorPolicy
+	workers     int
+}
+
+func newBatchOptions(opts ...BatchOption) batchOptions {
+	o := batchOptions{errorPolicy: FailOnError, workers: runtime.GOMAXPROCS(0)}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithErrorPolicy sets how rows that fail to evaluate or evaluate to NaN are handled. The default is FailOnError.
+func WithErrorPolicy(policy errorPolicy) BatchOption {
+	return func(o *batchOptions) {
+		o.errorPolicy = policy
+	}
+}
+
+// WithWorkers sets the number of goroutines used by EvaluateBatchParallel. The default is GOMAXPROCS.
+func WithWorkers(n int) BatchOption {
+	return func(o *batchOptions) {
+		if n > 0 {
+			o.workers = n
+		}
+	}
+}
+
+// EvaluateBatch evaluates a program for every row of the given columns, writing the result of row i
+// to out[i]. Columns are named after the variables of the program and must have len(out) rows.
+//
+// Programs built by Compile are evaluated one operator at a time over chunks of rows, which amortizes
+// the cost of dispatching each operator. Conditionals only evaluate their branches for the rows that
+// take them, so the results match those of Run. Other programs are run row by row.
+func EvaluateBatch(p Program, columns map[string][]float64, out []float64, opts ...BatchOption) error {
+	o := newBatchOptions(opts...)
+
+	cols, err := bindColumns(p, columns, len(out))
+	if err != nil {
+		return err
+	}
+	var errs RowErrors
+	if prog, ok := p.(*program); ok {
+		errs = newBatchEvaluator(prog, cols).run(0, out, o.errorPolicy)
+	} else {
+		errs = runRows(p, cols, 0, out, o.errorPolicy)
+	}
+	return batchError(errs, o.errorPolicy)
+}
+
+// batchError returns the error of a batch with the given failed rows, which is the first of them
+// under FailOnError.
+func batchError(errs RowErrors, policy errorPolicy) error {
+	switch {
+	case len(errs) == 0:
+		return nil
+	case policy == FailOnError:
+		return errs[0]
+	default:
+		return errs
+	}
+}
+
+// bindColumns orders the columns by the variable slots of a program.
+func bindColumns(p Program, columns map[string][]float64, rows int) (cols [][]float64, err error) {
+	names := p.Variables()
+	cols = make([][]float64, len(names))
+	for i, name := range names {
+		col, ok := columns[name]
+		if !ok {
+			return nil, fmt.Errorf(errMissingColumn, name)
+		}
+		if len(col) != rows {
+			return nil, fmt.Errorf(errColumnLength, name, len(col), rows)
+		}
+		cols[i] = col
+	}
+	return cols, nil
+}
+
+// runRows runs a program row by row on the rows starting at start, writing the results to out. It
+// returns the errors of the failed rows, and stops at the first of them under FailOnError.
+func runRows(p Program, cols [][]float64, start int, out []float64, policy errorPolicy) (errs RowErrors) {
+	vars := make([]float64, len(cols))
+	for i := range out {
+		for j, col := range cols {
+			vars[j] = col[start+i]
+		}
+		v, err := p.Run(vars)
+		if commitRow(start+i, v, err, &out[i], policy, &errs) && policy == FailOnError {
+			return errs
+		}
+	}
+	return errs
+}
+
+// commitRow writes the result of a row to dst according to the error policy. It adds the error of
+// a failed row to errs and reports whether the row failed.
+func commitRow(row int, v float64, err error, dst *float64, policy errorPolicy, errs *RowErrors) bool {
+	if err == nil && math.IsNaN(v) {
+		err = errors.New(errNaNResult)
+	}
+	if err == nil {
+		*dst = v
+		return false
+	}
+
+	if policy == NaNOnError {
+		*dst = math.NaN()
+	}
+	*errs = append(*errs, RowError{Row: row, Err: err})
+	return true
+}
+
+// batchEvaluator evaluates the syntax tree of a compiled program over chunks of rows. Booleans are
+// represented as 1 and 0. Each evaluation is given a mask of the rows it applies to; rows outside
+// of the mask or that already failed are left unspecified.
+type batchEvaluator struct {
+	prog *program
+	cols [][]float64
+
+	start int     // first row of the current chunk
+	errs  []error // errors of the rows in the current chunk
+
+	// scratch buffers, which are taken and released in LIFO order
+	floats     [][]float64
+	usedFloats int
+	masks      [][]bool
+	usedMasks  int
+}
+
+func newBatchEvaluator(prog *program, cols [][]float64) *batchEvaluator {
+	return &batchEvaluator{prog: prog, cols: cols, errs: make([]error, batchChunkSize)}
+}
+
+// run evaluates the rows starting at start, writing the results to out. It returns the errors of the
+// failed rows, and stops at the first of them under FailOnError.
+func (be *batchEvaluator) run(start int, out []float64, policy errorPolicy) (errs RowErrors) {
+	for chunk := 0; chunk < len(out); chunk += batchChunkSize {
+		n := len(out) - chunk
+		if n > batchChunkSize {
+			n = batchChunkSize
+		}
+		be.start = start + chunk
+		be.errs = be.errs[:n]
+		for i := range be.errs {
+			be.errs[i] = nil
+		}
+
+		all, res := be.mask(n), be.buffer(n)
+		for i := range all {
+			all[i] = true
+		}
+		be.eval(be.prog.tree, all, res)
+
+		for i := range res {
+			if commitRow(be.start+i, res[i], be.errs[i], &out[chunk+i], policy, &errs) && policy == FailOnError {
+				be.releaseBuffer()
+				be.releaseMask()
+				return errs
+			}
+		}
+		be.releaseBuffer()
+		be.releaseMask()
+	}
+	return errs
+}
+
+func (be *batchEvaluator) buffer(n int) []float64 {
+	if be.usedFloats == len(be.floats) {
+		be.floats = append(be.floats, make([]float64, batchChunkSize))
+	}
+	be.usedFloats++
+	return be.floats[be.usedFloats-1][:n]
+}
+
+func (be *batchEvaluator) releaseBuffer() {
+	be.usedFloats--
+}
+
+func (be *batchEvaluator) mask(n int) []bool {
+	if be.usedMasks == len(be.masks) {
+		be.masks = append(be.masks, make([]bool, batchChunkSize))
+	}
+	be.usedMasks++
+	return be.masks[be.usedMasks-1][:n]
+}
+
+func (be *batchEvaluator) releaseMask() {
+	be.usedMasks--
+}
+
+// live checks whether row i is in the mask and has not failed.
+func (be *batchEvaluator) live(active []bool, i int) bool {
+	return active[i] && be.errs[i] == nil
+}
+
+func (be *batchEvaluator) eval(n node, active []bool, out []float64) {
+	switch n := n.(type) {
+	case numberNode:
+		for i := range out {
+			out[i] = n.value
+		}
+	case variableNode:
+		col := be.cols[be.prog.slots[n.name]]
+		copy(out, col[be.start:be.start+len(out)])
+	case operatorNode:
+		be.evalOperator(n, active, out)
+	case callNode:
+		be.evalCall(n, active, out)
+	}
+}
+
+func (be *batchEvaluator) evalOperator(n operatorNode, active []bool, out []float64) {
+	typ := n.op.Type()
+	switch typ {
+	case ConditionalElse:
+		be.choose(n.operands[:1], n.operands[1:], active, out, nil)
+		return
+	case And, Or:
+		be.eval(n.operands[0], active, out)
+		// "false && x" is false and "true || x" is true regardless of x
+		rest := be.mask(len(out))
+		for i := range rest {
+			rest[i] = be.live(active, i) && (out[i] != 0) == (typ == And)
+		}
+		right := be.buffer(len(out))
+		be.eval(n.operands[1], rest, right)
+		for i, ok := range rest {
+			if ok {
+				out[i] = right[i]
+			}
+		}
+		be.releaseBuffer()
+		be.releaseMask()
+		return
+	case Not:
+		be.eval(n.operands[0], active, out)
+		for i := range out {
+			out[i] = boolToFloat(out[i] == 0)
+		}
+		return
+	}
+
+	if len(n.operands) == 1 {
+		be.eval(n.operands[0], active, out)
+		for i := range out {
+			if be.live(active, i) {
+				out[i] = be.apply(n, out[i], 0, i)
+			}
+		}
+		return
+	}
+
+	relative := (typ == Addition || typ == Subtraction) &&
+		be.prog.opts.percentMode == CalculatorPercent && isOperatorNodeOf(n.operands[1], Percent)
+	right := n.operands[1]
+	if relative {
+		right = right.(operatorNode).operands[0]
+	}
+
+	be.eval(n.operands[0], active, out)
+	r := be.buffer(len(out))
+	be.eval(right, active, r)
+
+	// arithmetic cannot fail, so it runs over every row without checking the mask
+	switch {
+	case relative && typ == Addition:
+		for i := range out {
+			out[i] += out[i] * r[i] / 100
+		}
+	case relative:
+		for i := range out {
+			out[i] += out[i] * -r[i] / 100
+		}
+	case typ == Addition:
+		for i := range out {
+			out[i] += r[i]
+		}
+	case typ == Subtraction:
+		for i := range out {
+			out[i] -= r[i]
+		}
+	case typ == Multiplication:
+		for i := range out {
+			out[i] *= r[i]
+		}
+	case typ == Division:
+		for i := range out {
+			out[i] /= r[i]
+		}
+	case typ == Less || typ == LessEqual || typ == Greater || typ == GreaterEqual || typ == Equal || typ == NotEqual:
+		for i := range out {
+			out[i] = boolToFloat(compareFloat(typ, out[i], r[i]))
+		}
+	default:
+		for i := range out {
+			if be.live(active, i) {
+				out[i] = be.apply(n, out[i], r[i], i)
+			}
+		}
+	}
+	be.releaseBuffer()
+}
+
+// apply applies a numeric operator to the operands of row i, recording its error if it fails.
+func (be *batchEvaluator) apply(n operatorNode, a, b float64, i int) float64 {
+	if isBitwiseOperator(n.op.Type()) {
+		if !fitsInt64(a) {
+			be.errs[i] = integerOperandError(n, 0, a)
+			return 0
+		}
+		if n.op.Arity() == Binary && !fitsInt64(b) {
+			be.errs[i] = integerOperandError(n, 1, b)
+			return 0
+		}
+	}
+	res, err := applyFloat(n.op, a, b, be.prog.opts.moduloMode)
+	be.errs[i] = err
+	return res
+}
+
+func (be *batchEvaluator) evalCall(n callNode, active []bool, out []float64) {
+	switch n.fn.Type() {
+	case If:
+		be.choose(n.args[:1], n.args[1:], active, out, nil)
+	case Piecewise:
+		var conds, values []node
+		for i := 0; i+1 < len(n.args); i += 2 {
+			conds = append(conds, n.args[i])
+			values = append(values, n.args[i+1])
+		}
+		if len(n.args)%2 == 1 {
+			values = append(values, n.args[len(n.args)-1])
+		}
+		be.choose(conds, values, active, out, &n)
+	case Diff, Integral:
+		x, err := expandCalculus(n, be.prog.opts)
+		if err != nil {
+			for i := range out {
+				if be.live(active, i) {
+					be.errs[i] = err
+				}
+			}
+			return
+		}
+		be.eval(x, active, out)
+	case Sum, Product:
+		// the terms depend on the row, so each row runs the compiled call on its own
+		c := &compiler{evalOptions: be.prog.opts, slots: be.prog.slots, names: be.prog.names}
+		f, err := c.compileSeries(n)
+		vars := make([]float64, len(be.cols))
+		for i := range out {
+			if !be.live(active, i) {
+				continue
+			}
+			if err != nil {
+				be.errs[i] = err
+				continue
+			}
+			for j, col := range be.cols {
+				vars[j] = col[be.start+i]
+			}
+			out[i], be.errs[i] = f.num(vars)
+		}
+	case Popcount, Clz:
+		be.eval(n.args[0], active, out)
+		for i, a := range out {
+			if !be.live(active, i) {
+				continue
+			}
+			if !fitsInt64(a) {
+				be.errs[i] = TypeError{
+					Message: fmt.Sprintf(errIntegerArgument, 1, n.fn, n.fnSpan.Start, NewNumericValue(a)),
+					Span:    n.args[0].span(),
+				}
+				continue
+			}
+			out[i] = float64(bitCount64(n.fn.Type(), int64(a)))
+		}
+	}
+}
+
+// choose evaluates a chain of conditionals that picks the value after the first true condition,
+// or the last value if none are true. If there is no last value, rows that match no condition
+// fail with the error of fn.
+func (be *batchEvaluator) choose(conds, values []node, active []bool, out []float64, fn *callNode) {
+	n := len(out)
+	remaining, taken := be.mask(n), be.mask(n)
+	copy(remaining, active)
+	cond, val := be.buffer(n), be.buffer(n)
+
+	pick := func(value node, rows []bool) {
+		be.eval(value, rows, val)
+		for i, ok := range rows {
+			if ok {
+				out[i] = val[i]
+			}
+		}
+	}
+
+	for k, c := range conds {
+		be.eval(c, remaining, cond)
+		for i := range taken {
+			taken[i] = be.live(remaining, i) && cond[i] != 0
+			if taken[i] {
+				remaining[i] = false
+			}
+		}
+		pick(values[k], taken)
+	}
+
+	if len(values) > len(conds) {
+		pick(values[len(conds)], remaining)
+	} else {
+		for i := range remaining {
+			if be.live(remaining, i) {
+				be.errs[i] = fmt.Errorf(errNoMatchingPiece, fn.fn, fn.fnSpan.Start)
+			}
+		}
+	}
+
+	be.releaseBuffer()
+	be.releaseBuffer()
+	be.releaseMask()
+	be.releaseMask()
+}
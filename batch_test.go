@@ -0,0 +1,186 @@
+package yamp
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluateBatch(t *testing.T) {
+	// enough rows to span several chunks
+	rows := 2*batchChunkSize + 10
+	columns := map[string][]float64{
+		"x": make([]float64, rows),
+		"y": make([]float64, rows),
+	}
+	for i := 0; i < rows; i++ {
+		columns["x"][i] = float64(i%23 - 11)
+		columns["y"][i] = float64(i%7) / 2
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		opts []EvalOption
+	}{
+		{"arithmetic follows precedence", "1 + 2x * y ^ 2 - x / 4", nil},
+		{"postfix operators are supported", "x! + 50%", nil},
+		{"the ternary conditional only fails on the rows that take a failing branch", "x >= 0 ? x! : -1", nil},
+		{"logical operators short-circuit", "y > 1 && x > 0 || not (x == 3) ? 1 : 0", nil},
+		{"if picks a branch", "if(x < 0, -x, y)", nil},
+		{"piecewise falls back to its default", "piecewise(x < -5, -1, x > 5, 1, 0)", nil},
+		{"piecewise without a default fails on unmatched rows", "piecewise(x < 0, -x, y > 1, y)", nil},
+		{"modulo follows the selected mode", "x mod 3 + x // 3", []EvalOption{WithModuloMode(TruncatedModulo)}},
+		{"calculator percentages are relative", "x + y% - 5%", []EvalOption{WithPercentMode(CalculatorPercent)}},
+		{"bitwise operators and functions are supported", "(x << 4 | 3) xor ~x & 255 + popcount(x) + clz(x)", nil},
+		{"sums and products are evaluated row by row", "sum(k, 1, y, x k) + prod(k, x, 2, k + y)", nil},
+		{"derivatives and integrals are expanded", "diff(x^3 y, x, 2) + integrate(x^2, x, 0, y)", nil},
+		{"non-integer bitwise operands fail", "y & 1", nil},
+		{"NaN results fail", "0 / (x - x)", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Compile(tt.expr, tt.opts...)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			want := make([]float64, rows)
+			wantErrs := runRows(p, bindTestColumns(p, columns), 0, want, NaNOnError)
+
+			got := make([]float64, rows)
+			err = EvaluateBatch(p, columns, got, WithErrorPolicy(NaNOnError))
+			assert.Equal(t, batchError(wantErrs, NaNOnError), err)
+			assertSameFloats(t, want, got)
+		})
+	}
+}
+
+func TestEvaluateBatch_errorPolicies(t *testing.T) {
+	columns := map[string][]float64{"x": {2, -1, 3, -2}}
+
+	tests := []struct {
+		name    string
+		policy  errorPolicy
+		want    []float64
+		wantErr error
+	}{
+		{
+			name:    "fail stops at the first failed row",
+			policy:  FailOnError,
+			want:    []float64{2, 7, 7, 7},
+			wantErr: RowError{Row: 1, Err: fmt.Errorf(errFactorialNegativeInt, -1.0)},
+		},
+		{
+			name:   "skip leaves failed rows unchanged",
+			policy: SkipOnError,
+			want:   []float64{2, 7, 6, 7},
+			wantErr: RowErrors{
+				{Row: 1, Err: fmt.Errorf(errFactorialNegativeInt, -1.0)},
+				{Row: 3, Err: fmt.Errorf(errFactorialNegativeInt, -2.0)},
+			},
+		},
+		{
+			name:   "NaN marks failed rows",
+			policy: NaNOnError,
+			want:   []float64{2, math.NaN(), 6, math.NaN()},
+			wantErr: RowErrors{
+				{Row: 1, Err: fmt.Errorf(errFactorialNegativeInt, -1.0)},
+				{Row: 3, Err: fmt.Errorf(errFactorialNegativeInt, -2.0)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Compile("x!")
+			if !assert.NoError(t, err) {
+				return
+			}
+			bc, err := CompileBytecode("x!")
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			// bytecode is run row by row, but must follow the same policy
+			for _, prog := range []Program{p, bc} {
+				out := []float64{7, 7, 7, 7}
+				err = EvaluateBatch(prog, columns, out, WithErrorPolicy(tt.policy))
+				assert.Equal(t, tt.wantErr, err)
+				assertSameFloats(t, tt.want, out)
+			}
+		})
+	}
+}
+
+func TestEvaluateBatch_columnErrors(t *testing.T) {
+	p, err := Compile("x + y")
+	assert.NoError(t, err)
+
+	out := make([]float64, 2)
+	err = EvaluateBatch(p, map[string][]float64{"x": {1, 2}}, out)
+	assert.Equal(t, fmt.Errorf(errMissingColumn, "y"), err)
+
+	err = EvaluateBatch(p, map[string][]float64{"x": {1, 2}, "y": {1}}, out)
+	assert.Equal(t, fmt.Errorf(errColumnLength, "y", 1, 2), err)
+}
+
+func TestRowError_Unwrap(t *testing.T) {
+	err := RowError{Row: 3, Err: errors.New("boom")}
+	assert.EqualError(t, err, "row 3: boom")
+	assert.Equal(t, errors.New("boom"), errors.Unwrap(err))
+}
+
+func TestRowErrors_Error(t *testing.T) {
+	errs := RowErrors{{Row: 3, Err: errors.New("boom")}}
+	assert.EqualError(t, errs, "row 3: boom")
+
+	errs = append(errs, RowError{Row: 5, Err: errors.New("bang")}, RowError{Row: 8, Err: errors.New("bang")})
+	assert.EqualError(t, errs, "row 3: boom (and 2 more rows)")
+}
+
+func BenchmarkEvaluateBatch(b *testing.B) {
+	p, err := Compile("x > 0 ? (x^2 + 3x*y - 4) / 7 : -y")
+	if err != nil {
+		b.Fatal(err)
+	}
+	rows := 4 * batchChunkSize
+	columns := map[string][]float64{"x": make([]float64, rows), "y": make([]float64, rows)}
+	for i := 0; i < rows; i++ {
+		columns["x"][i] = float64(i - rows/2)
+		columns["y"][i] = 4
+	}
+	out := make([]float64, rows)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err = EvaluateBatch(p, columns, out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func bindTestColumns(p Program, columns map[string][]float64) [][]float64 {
+	cols := make([][]float64, len(p.Variables()))
+	for i, name := range p.Variables() {
+		cols[i] = columns[name]
+	}
+	return cols
+}
+
+// assertSameFloats compares two slices, treating NaNs as equal.
+func assertSameFloats(t *testing.T, want, got []float64) {
+	t.Helper()
+	if !assert.Len(t, got, len(want)) {
+		return
+	}
+	for i := range want {
+		if math.IsNaN(want[i]) {
+			assert.True(t, math.IsNaN(got[i]), "row %d: got %v, want NaN", i, got[i])
+		} else {
+			assert.Equal(t, want[i], got[i], "row %d", i)
+		}
+	}
+}
@@ -58,6 +58,7 @@ type bracketDepth struct {
 
 type bracketStack struct {
 	stack []bracketDepth
+	calls map[int]bool // indices of brackets that start a function call
 }
 
 func (s *bracketStack) increment(idx int, b Bracket) {
@@ -68,6 +69,15 @@ func (s *bracketStack) increment(idx int, b Bracket) {
 	})
 }
 
+// incrementCall is like increment, but marks the bracket as the start of a function call.
+func (s *bracketStack) incrementCall(idx int, b Bracket) {
+	s.increment(idx, b)
+	if s.calls == nil {
+		s.calls = make(map[int]bool)
+	}
+	s.calls[idx] = true
+}
+
 func (s *bracketStack) decrement(idx int, b Bracket) {
 	s.stack = append(s.stack, bracketDepth{
 		index: idx,
@@ -83,6 +93,28 @@ func (s bracketStack) depth() int {
 	return s.stack[len(s.stack)-1].depth
 }
 
+// innermost returns the left bracket that opened the current depth. If no bracket is open, ok will be false.
+func (s bracketStack) innermost() (res bracketDepth, ok bool) {
+	curr := s.depth()
+	if curr == 0 {
+		return bracketDepth{}, false
+	}
+
+	for i := len(s.stack) - 1; i >= 0; i-- {
+		if s.stack[i].depth == curr && s.stack[i].b.IsLeft() {
+			return s.stack[i], true
+		}
+	}
+	return bracketDepth{}, false
+}
+
+// inCall checks whether the innermost open bracket belongs to a function call.
+func (s bracketStack) inCall() bool {
+	b, ok := s.innermost()
+	return ok && s.calls[b.index]
+}
+
 func (s *bracketStack) clear() {
 	s.stack = nil
+	s.calls = nil
 }
@@ -133,3 +133,49 @@ func Test_depthStack_clear(t *testing.T) {
 		})
 	}
 }
+
+func Test_depthStack_innermost(t *testing.T) {
+	tests := []struct {
+		name   string
+		stack  []bracketDepth
+		want   bracketDepth
+		wantOk bool
+	}{
+		{"no bracket should be open on an empty stack", nil, bracketDepth{}, false},
+		{"no bracket should be open once all are closed", []bracketDepth{{0, 1, LeftParen}, {1, 0, RightParen}}, bracketDepth{}, false},
+		{
+			name:   "the innermost open bracket should be returned",
+			stack:  []bracketDepth{{0, 1, LeftParen}, {1, 2, LeftParen}},
+			want:   bracketDepth{1, 2, LeftParen},
+			wantOk: true,
+		},
+		{
+			name:   "closed brackets should be skipped",
+			stack:  []bracketDepth{{0, 1, LeftParen}, {1, 2, LeftParen}, {2, 1, RightParen}},
+			want:   bracketDepth{0, 1, LeftParen},
+			wantOk: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := bracketStack{stack: tt.stack}
+			got, ok := s.innermost()
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_depthStack_inCall(t *testing.T) {
+	s := bracketStack{}
+	assert.False(t, s.inCall())
+
+	s.incrementCall(0, LeftParen)
+	assert.True(t, s.inCall())
+
+	s.increment(3, LeftParen)
+	assert.False(t, s.inCall())
+
+	s.decrement(4, RightParen)
+	assert.True(t, s.inCall())
+}
@@ -0,0 +1,564 @@
+package yamp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Bytecode is a compiled expression in the form of instructions for a stack-based virtual machine.
+// Unlike a Program built by Compile, Bytecode can be serialized with MarshalBinary and loaded again
+// with LoadBytecode without parsing the expression. Bytecode is immutable and safe for concurrent use.
+//
+// The virtual machine has no loops, so expressions calling sum or prod cannot be compiled into
+// Bytecode. Such expressions can still be compiled into a Program with Compile.
+type Bytecode interface {
+	Program
+	// Disassemble returns a human-readable listing of the instructions, one per line.
+	Disassemble() string
+	// MarshalBinary encodes the bytecode into a binary form.
+	MarshalBinary() ([]byte, error)
+}
+
+var _ Bytecode = (*bytecode)(nil)
+
+type opcode byte
+
+// Instructions of the virtual machine. Booleans are represented as 1 and 0 on the stack.
+const (
+	opConst       opcode = iota + 1 // opConst pushes the constant at index arg.
+	opLoad                          // opLoad pushes the variable in slot arg.
+	opApply                         // opApply applies the numeric operator with code arg to the operands on top of the stack.
+	opCompare                       // opCompare applies the comparison operator with code arg to the top two values.
+	opNot                           // opNot negates the boolean on top of the stack.
+	opRelPercent                    // opRelPercent adds (arg 1) or subtracts (arg -1) the top value as a percentage of the one below.
+	opPopcount                      // opPopcount replaces the top value with its number of one bits.
+	opClz                           // opClz replaces the top value with its number of leading zero bits.
+	opJump                          // opJump continues at instruction arg.
+	opJumpIfFalse                   // opJumpIfFalse pops a boolean and continues at instruction arg if it is false.
+	opNoMatch                       // opNoMatch fails because no piece of a piecewise function matched.
+)
+
+func (o opcode) String() string {
+	switch o {
+	case opConst:
+		return "const"
+	case opLoad:
+		return "load"
+	case opApply:
+		return "apply"
+	case opCompare:
+		return "compare"
+	case opNot:
+		return "not"
+	case opRelPercent:
+		return "relpct"
+	case opPopcount:
+		return "popcount"
+	case opClz:
+		return "clz"
+	case opJump:
+		return "jump"
+	case opJumpIfFalse:
+		return "jumpf"
+	case opNoMatch:
+		return "nomatch"
+	}
+	return "<?>"
+}
+
+// operatorCodes numbers the operators of opApply and opCompare instructions. The codes are part of
+// the serialized format, so they must stay the same when operator types are added or reordered.
+var operatorCodes = [...]opType{
+	1:  Addition,
+	2:  Subtraction,
+	3:  Multiplication,
+	4:  Division,
+	5:  Power,
+	6:  Plus,
+	7:  Minus,
+	8:  Factorial,
+	9:  DoubleFactorial,
+	10: Percent,
+	11: Modulo,
+	12: FloorDivision,
+	13: Remainder,
+	14: BitwiseAnd,
+	15: BitwiseOr,
+	16: BitwiseXor,
+	17: BitwiseNot,
+	18: ShiftLeft,
+	19: ShiftRight,
+	20: Less,
+	21: LessEqual,
+	22: Greater,
+	23: GreaterEqual,
+	24: Equal,
+	25: NotEqual,
+}
+
+// moduloModeCodes numbers the modulo modes in the serialized format.
+var moduloModeCodes = [...]moduloMode{
+	1: FlooredModulo,
+	2: TruncatedModulo,
+	3: EuclideanModulo,
+}
+
+// operatorCode returns the code of an operator type, or 0 if it has none.
+func operatorCode(typ opType) int {
+	for code, t := range operatorCodes {
+		if t == typ && code > 0 {
+			return code
+		}
+	}
+	return 0
+}
+
+func isComparison(typ opType) bool {
+	switch typ {
+	case Less, LessEqual, Greater, GreaterEqual, Equal, NotEqual:
+		return true
+	}
+	return false
+}
+
+type instruction struct {
+	code opcode
+	arg  int
+	sp   Span     // location of the token the instruction originated from
+	op   Operator // operator of opApply and opCompare instructions, resolved from arg, or nil if arg is not a code
+}
+
+type bytecode struct {
+	expr       string
+	moduloMode moduloMode
+	names      []string
+	consts     []float64
+	code       []instruction
+	maxStack   int
+}
+
+// CompileBytecode parses an expression and compiles it into Bytecode. Expressions are checked
+// the same way as in Compile. Calls of sum and prod are not supported and result in a TypeError
+// pointing at the function name; use Compile for such expressions.
+func CompileBytecode(expr string, opts ...EvalOption) (Bytecode, error) {
+	o := newEvalOptions(opts...)
+	if o.numberMode != FloatMode {
+		return nil, errors.New(errCompileNumberMode)
+	}
+
+	root, err := (&expression{expr: expr}).parse(o.reg)
+	if err != nil {
+		return nil, err
+	}
+
+	// the closure compiler checks the types and assigns the variable slots
+	c := &compiler{evalOptions: o, slots: make(map[string]int)}
+	f, err := c.compile(root)
+	if err != nil {
+		return nil, err
+	}
+	if f.num == nil {
+		return nil, TypeError{
+			Message: fmt.Sprintf(errResultType, NumericValue, BooleanValue),
+			Span:    root.span(),
+		}
+	}
+
+	if call, ok := findCall(root, Sum, Product); ok {
+		return nil, TypeError{Message: fmt.Sprintf(errBytecodeFunction, call.fn, call.fnSpan.Start), Span: call.fnSpan}
+	}
+
+	e := &emitter{
+		compiler: c,
+		b:        &bytecode{expr: expr, moduloMode: o.moduloMode, names: c.names},
+		consts:   make(map[float64]int),
+	}
+	e.emit(root)
+	if err = e.b.verify(); err != nil {
+		return nil, err
+	}
+	return e.b, nil
+}
+
+// findCall returns the first call of one of the given functions in a syntax tree.
+func findCall(n node, types ...fnType) (call callNode, ok bool) {
+	switch n := n.(type) {
+	case operatorNode:
+		for _, o := range n.operands {
+			if call, ok = findCall(o, types...); ok {
+				return call, true
+			}
+		}
+	case callNode:
+		for _, t := range types {
+			if n.fn.Type() == t {
+				return n, true
+			}
+		}
+		for _, a := range n.args {
+			if call, ok = findCall(a, types...); ok {
+				return call, true
+			}
+		}
+	}
+	return callNode{}, false
+}
+
+// emitter emits the instructions of type-checked syntax trees.
+type emitter struct {
+	*compiler
+	b      *bytecode
+	consts map[float64]int
+}
+
+func (e *emitter) add(code opcode, arg int, sp Span) (pc int) {
+	e.b.code = append(e.b.code, newInstruction(code, arg, sp))
+	return len(e.b.code) - 1
+}
+
+// patch makes the jump at pc continue at the next instruction to be emitted.
+func (e *emitter) patch(pc int) {
+	e.b.code[pc].arg = len(e.b.code)
+}
+
+func (e *emitter) constant(v float64, sp Span) {
+	i, ok := e.consts[v]
+	if !ok {
+		i = len(e.b.consts)
+		e.consts[v] = i
+		e.b.consts = append(e.b.consts, v)
+	}
+	e.add(opConst, i, sp)
+}
+
+// choose emits a chain of conditionals that picks the value after the first true condition,
+// or the last value if none are true. A nil last value fails with opNoMatch.
+func (e *emitter) choose(conds, values []node, sp Span) {
+	var ends []int
+	for i, cond := range conds {
+		e.emit(cond)
+		next := e.add(opJumpIfFalse, 0, cond.span())
+		e.emit(values[i])
+		ends = append(ends, e.add(opJump, 0, sp))
+		e.patch(next)
+	}
+	if len(values) > len(conds) {
+		e.emit(values[len(conds)])
+	} else {
+		e.add(opNoMatch, 0, sp)
+	}
+	for _, pc := range ends {
+		e.patch(pc)
+	}
+}
+
+func (e *emitter) emit(n node) {
+	switch n := n.(type) {
+	case numberNode:
+		e.constant(n.value, n.sp)
+	case variableNode:
+		e.add(opLoad, e.slots[n.name], n.sp)
+	case operatorNode:
+		e.emitOperator(n)
+	case callNode:
+		e.emitCall(n)
+	}
+}
+
+func (e *emitter) emitOperator(n operatorNode) {
+	switch n.op.Type() {
+	case ConditionalElse:
+		e.choose(n.operands[:1], n.operands[1:], n.opSpan)
+		return
+	case And:
+		// a && b is a ? b : false
+		e.emit(n.operands[0])
+		next := e.add(opJumpIfFalse, 0, n.operands[0].span())
+		e.emit(n.operands[1])
+		end := e.add(opJump, 0, n.opSpan)
+		e.patch(next)
+		e.constant(0, n.opSpan)
+		e.patch(end)
+		return
+	case Or:
+		// a || b is a ? true : b
+		e.emit(n.operands[0])
+		next := e.add(opJumpIfFalse, 0, n.operands[0].span())
+		e.constant(1, n.opSpan)
+		end := e.add(opJump, 0, n.opSpan)
+		e.patch(next)
+		e.emit(n.operands[1])
+		e.patch(end)
+		return
+	case Not:
+		e.emit(n.operands[0])
+		e.add(opNot, 0, n.opSpan)
+		return
+	case Addition, Subtraction:
+		if e.percentMode == CalculatorPercent && isOperatorNodeOf(n.operands[1], Percent) {
+			e.emit(n.operands[0])
+			e.emit(n.operands[1].(operatorNode).operands[0])
+			sign := 1
+			if n.op.Type() == Subtraction {
+				sign = -1
+			}
+			e.add(opRelPercent, sign, n.opSpan)
+			return
+		}
+	}
+
+	for _, o := range n.operands {
+		e.emit(o)
+	}
+	if isComparison(n.op.Type()) {
+		e.add(opCompare, operatorCode(n.op.Type()), n.opSpan)
+	} else {
+		e.add(opApply, operatorCode(n.op.Type()), n.opSpan)
+	}
+}
+
+func (e *emitter) emitCall(n callNode) {
+	switch n.fn.Type() {
+	case If:
+		e.choose(n.args[:1], n.args[1:], n.fnSpan)
+	case Piecewise:
+		var conds, values []node
+		for i := 0; i+1 < len(n.args); i += 2 {
+			conds = append(conds, n.args[i])
+			values = append(values, n.args[i+1])
+		}
+		if len(n.args)%2 == 1 {
+			values = append(values, n.args[len(n.args)-1])
+		}
+		e.choose(conds, values, n.fnSpan)
+	case Popcount:
+		e.emit(n.args[0])
+		e.add(opPopcount, 0, n.fnSpan)
+	case Clz:
+		e.emit(n.args[0])
+		e.add(opClz, 0, n.fnSpan)
+	case Diff, Integral:
+		// the compiler has expanded the call already, so this cannot fail
+		x, _ := expandCalculus(n, e.evalOptions)
+		e.emit(x)
+	}
+}
+
+func newInstruction(code opcode, arg int, sp Span) instruction {
+	in := instruction{code: code, arg: arg, sp: sp}
+	if (code == opApply || code == opCompare) && arg > 0 && arg < len(operatorCodes) {
+		in.op = NewOperator(operatorCodes[arg])
+	}
+	return in
+}
+
+// Variables implements the Program interface.
+func (b *bytecode) Variables() []string {
+	return append([]string(nil), b.names...)
+}
+
+func (b *bytecode) String() string {
+	return b.expr
+}
+
+// Disassemble implements the Bytecode interface.
+func (b *bytecode) Disassemble() string {
+	var sb strings.Builder
+	for pc, in := range b.code {
+		line := fmt.Sprintf("%04d  %-8s", pc, in.code)
+		switch in.code {
+		case opConst:
+			line += fmt.Sprintf(" %v", b.consts[in.arg])
+		case opLoad:
+			line += " " + b.names[in.arg]
+		case opApply, opCompare:
+			line += " " + in.op.String()
+		case opRelPercent:
+			line += fmt.Sprintf(" %+d", in.arg)
+		case opJump, opJumpIfFalse:
+			line += fmt.Sprintf(" %04d", in.arg)
+		}
+		sb.WriteString(strings.TrimRight(line, " "))
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// bytecodeMagic starts every serialized Bytecode, followed by the format version. Version 1 stored
+// operator types and modulo modes as their constant values, which changed whenever one was added.
+const (
+	bytecodeMagic   = "yampbc"
+	bytecodeVersion = 2
+)
+
+// MarshalBinary implements the Bytecode interface.
+func (b *bytecode) MarshalBinary() ([]byte, error) {
+	var w bytecodeWriter
+	w.buf.WriteString(bytecodeMagic)
+	w.buf.WriteByte(bytecodeVersion)
+	for code, mode := range moduloModeCodes {
+		if mode == b.moduloMode && code > 0 {
+			w.buf.WriteByte(byte(code))
+		}
+	}
+	w.string(b.expr)
+
+	w.uvarint(uint64(len(b.names)))
+	for _, name := range b.names {
+		w.string(name)
+	}
+	w.uvarint(uint64(len(b.consts)))
+	for _, v := range b.consts {
+		var bits [8]byte
+		binary.LittleEndian.PutUint64(bits[:], math.Float64bits(v))
+		w.buf.Write(bits[:])
+	}
+	w.uvarint(uint64(len(b.code)))
+	for _, in := range b.code {
+		w.buf.WriteByte(byte(in.code))
+		w.varint(int64(in.arg))
+		w.uvarint(uint64(in.sp.Start))
+		w.uvarint(uint64(in.sp.End))
+	}
+	return w.buf.Bytes(), nil
+}
+
+// bytecodeWriter encodes the fields of serialized Bytecode.
+type bytecodeWriter struct {
+	buf bytes.Buffer
+	tmp [binary.MaxVarintLen64]byte
+}
+
+func (w *bytecodeWriter) uvarint(v uint64) {
+	n := binary.PutUvarint(w.tmp[:], v)
+	w.buf.Write(w.tmp[:n])
+}
+
+func (w *bytecodeWriter) varint(v int64) {
+	n := binary.PutVarint(w.tmp[:], v)
+	w.buf.Write(w.tmp[:n])
+}
+
+func (w *bytecodeWriter) string(s string) {
+	w.uvarint(uint64(len(s)))
+	w.buf.WriteString(s)
+}
+
+// LoadBytecode decodes Bytecode produced by MarshalBinary. The instructions are verified,
+// so corrupted or hand-crafted data results in an error rather than a misbehaving program.
+func LoadBytecode(data []byte) (Bytecode, error) {
+	if !bytes.HasPrefix(data, []byte(bytecodeMagic)) {
+		return nil, fmt.Errorf(errBytecodeFormat, "missing header")
+	}
+	r := &bytecodeReader{data: data[len(bytecodeMagic):]}
+	if v := r.byte(); v != bytecodeVersion {
+		return nil, fmt.Errorf(errBytecodeFormat, fmt.Sprintf("unsupported version %d", v))
+	}
+
+	b := &bytecode{}
+	if mode := int(r.byte()); mode > 0 && mode < len(moduloModeCodes) {
+		b.moduloMode = moduloModeCodes[mode]
+	} else if r.err == nil {
+		return nil, fmt.Errorf(errBytecodeFormat, fmt.Sprintf("unknown modulo mode %d", mode))
+	}
+	b.expr = r.string()
+	b.names = make([]string, r.count())
+	for i := range b.names {
+		b.names[i] = r.string()
+	}
+	b.consts = make([]float64, r.count())
+	for i := range b.consts {
+		b.consts[i] = math.Float64frombits(r.uint64())
+	}
+	b.code = make([]instruction, r.count())
+	for i := range b.code {
+		code, arg := opcode(r.byte()), int(r.varint())
+		sp := Span{Start: int(r.uvarint()), End: int(r.uvarint())}
+		b.code[i] = newInstruction(code, arg, sp)
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(r.data) > 0 {
+		return nil, fmt.Errorf(errBytecodeFormat, "trailing data")
+	}
+	if err := b.verify(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// bytecodeReader decodes the fields of serialized Bytecode, remembering the first error.
+type bytecodeReader struct {
+	data []byte
+	err  error
+}
+
+func (r *bytecodeReader) fail() {
+	if r.err == nil {
+		r.err = fmt.Errorf(errBytecodeFormat, "unexpected end of data")
+	}
+	r.data = nil
+}
+
+func (r *bytecodeReader) byte() byte {
+	if len(r.data) < 1 {
+		r.fail()
+		return 0
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b
+}
+
+func (r *bytecodeReader) uint64() uint64 {
+	if len(r.data) < 8 {
+		r.fail()
+		return 0
+	}
+	v := binary.LittleEndian.Uint64(r.data)
+	r.data = r.data[8:]
+	return v
+}
+
+func (r *bytecodeReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *bytecodeReader) varint() int64 {
+	v, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+// count reads the length of a list, which cannot exceed the remaining data.
+func (r *bytecodeReader) count() int {
+	n := r.uvarint()
+	if n > uint64(len(r.data)) {
+		r.fail()
+		return 0
+	}
+	return int(n)
+}
+
+func (r *bytecodeReader) string() string {
+	n := r.count()
+	s := string(r.data[:n])
+	r.data = r.data[n:]
+	return s
+}
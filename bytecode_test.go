@@ -0,0 +1,180 @@
+package yamp
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompileBytecode(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		opts []EvalOption
+		vars Variables
+	}{
+		{"arithmetic follows precedence", "1 + 2 * 3 ^ 2", nil, nil},
+		{"variables are read from their slots", "2x + y / x", nil, Variables{"x": 4, "y": 6}},
+		{"postfix operators are supported", "3! + 4!! + 50%", nil, nil},
+		{"the ternary conditional picks a branch", "x > 1 ? x * 2 : -x", nil, Variables{"x": 3}},
+		{"'&&' short-circuits", "x > 1 && x < 2 ? 1 : 0", nil, Variables{"x": 3}},
+		{"'||' short-circuits", "x > 1 || x < 2 ? 1 : 0", nil, Variables{"x": 3}},
+		{"logical negation is supported", "not (x == 3) ? 1 : 0", nil, Variables{"x": 3}},
+		{"boolean equality is supported", "(x > 1) != (x > 2) ? 1 : 0", nil, Variables{"x": 3}},
+		{"if picks a branch", "if(x < 0, -x, x)", nil, Variables{"x": -5}},
+		{"piecewise falls back to its default", "piecewise(x < 0, -1, x > 10, 1, 0)", nil, Variables{"x": 5}},
+		{"piecewise picks the first matching piece", "piecewise(x < 0, -1, x > 1, 1)", nil, Variables{"x": 5}},
+		{"modulo follows the selected mode", "x mod 3 + x // 3", []EvalOption{WithModuloMode(TruncatedModulo)}, Variables{"x": -7}},
+		{"calculator percentages are relative", "x + 10% - 5%", []EvalOption{WithPercentMode(CalculatorPercent)}, Variables{"x": 200}},
+		{"bitwise operators and functions are supported", "(x << 4 | 3) xor ~x & 255 + popcount(x) + clz(x)", nil, Variables{"x": 5}},
+		{"derivatives and integrals are expanded", "d/dx(x^3) + integrate(x y, y, 0, x)", nil, Variables{"x": 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := NewExpression(tt.expr).EvaluateWith(tt.vars, tt.opts...)
+			assert.NoError(t, err)
+
+			b, err := CompileBytecode(tt.expr, tt.opts...)
+			if !assert.NoError(t, err) {
+				return
+			}
+			slots := make([]float64, len(b.Variables()))
+			for i, name := range b.Variables() {
+				slots[i] = tt.vars[name]
+			}
+			got, err := b.Run(slots)
+			assert.NoError(t, err)
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
+func TestCompileBytecode_errors(t *testing.T) {
+	_, err := CompileBytecode("1 + (2 < 3)")
+	assert.Equal(t, TypeError{
+		Message: fmt.Sprintf(errOperandType, "+", 2, NumericValue, BooleanValue),
+		Span:    Span{Start: 5, End: 10},
+	}, err)
+
+	_, err = CompileBytecode("1", WithNumberMode(BigIntMode))
+	assert.Equal(t, errors.New(errCompileNumberMode), err)
+
+	_, err = CompileBytecode("2 * sum(k, 1, n, k)")
+	assert.Equal(t, TypeError{
+		Message: fmt.Sprintf(errBytecodeFunction, "sum", 4),
+		Span:    Span{Start: 4, End: 7},
+	}, err)
+}
+
+func Test_bytecode_Disassemble(t *testing.T) {
+	b, err := CompileBytecode("not (x > 0) ? -x * 2 : popcount(x)")
+	assert.NoError(t, err)
+	assert.Equal(t, ""+
+		"0000  load     x\n"+
+		"0001  const    0\n"+
+		"0002  compare  >\n"+
+		"0003  not\n"+
+		"0004  jumpf    0010\n"+
+		"0005  load     x\n"+
+		"0006  apply    -\n"+
+		"0007  const    2\n"+
+		"0008  apply    *\n"+
+		"0009  jump     0012\n"+
+		"0010  load     x\n"+
+		"0011  popcount\n",
+		b.Disassemble())
+}
+
+func Test_bytecode_MarshalBinary(t *testing.T) {
+	b, err := CompileBytecode("piecewise(x < 0, -x, x mod 3)", WithModuloMode(EuclideanModulo))
+	assert.NoError(t, err)
+
+	data, err := b.MarshalBinary()
+	assert.NoError(t, err)
+
+	loaded, err := LoadBytecode(data)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, b, loaded)
+	assert.Equal(t, "piecewise(x < 0, -x, x mod 3)", loaded.String())
+
+	got, err := loaded.Run([]float64{7})
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, got)
+}
+
+func Test_bytecode_MarshalBinary_golden(t *testing.T) {
+	b, err := CompileBytecode("x < 2 ? -x : x mod 3", WithModuloMode(EuclideanModulo))
+	assert.NoError(t, err)
+
+	// the format must not change, or bytecode serialized by earlier releases can no longer be loaded
+	want := []byte{
+		'y', 'a', 'm', 'p', 'b', 'c', 2, // header and version
+		3, // EuclideanModulo
+		20, 'x', ' ', '<', ' ', '2', ' ', '?', ' ', '-', 'x', ' ', ':', ' ', 'x', ' ', 'm', 'o', 'd', ' ', '3',
+		1, 1, 'x', // names
+		2, 0, 0, 0, 0, 0, 0, 0, 0x40, 0, 0, 0, 0, 0, 0, 0x08, 0x40, // constants 2 and 3
+		10,         // instructions, each with an opcode, a zigzag-encoded argument and a span
+		2, 0, 0, 1, // load x
+		1, 0, 4, 5, // const 2
+		4, 40, 2, 3, // compare <, whose code is 20
+		10, 14, 0, 5, // jumpf 0007
+		2, 0, 9, 10, // load x
+		3, 14, 8, 9, // apply -, whose code is 7
+		9, 20, 6, 7, // jump 0010
+		2, 0, 13, 14, // load x
+		1, 2, 19, 20, // const 3
+		3, 22, 15, 18, // apply mod, whose code is 11
+	}
+	data, err := b.MarshalBinary()
+	assert.NoError(t, err)
+	assert.Equal(t, want, data)
+
+	loaded, err := LoadBytecode(want)
+	assert.NoError(t, err)
+	assert.Equal(t, b, loaded)
+}
+
+func TestLoadBytecode_errors(t *testing.T) {
+	b, err := CompileBytecode("x + 1")
+	assert.NoError(t, err)
+	data, err := b.MarshalBinary()
+	assert.NoError(t, err)
+
+	// header, version, modulo mode, expression, names, constants, then the code
+	codeStart := len(bytecodeMagic) + 2 + 6 + 3 + 9 + 1
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{"data without the header is rejected", []byte("hello"), "missing header"},
+		{"unknown versions are rejected", replaceByte(data, len(bytecodeMagic), 9), "unsupported version 9"},
+		{"truncated data is rejected", data[:len(data)-1], "unexpected end of data"},
+		{"trailing data is rejected", append(append([]byte(nil), data...), 0), "trailing data"},
+		{"unknown opcodes are rejected", replaceByte(data, codeStart, 99), "instruction 0: unknown opcode 99"},
+		{"out of range variables are rejected", replaceByte(data, codeStart+1, 2), "instruction 0: variable slot 1 out of range"},
+		{"stack underflows are rejected", replaceByte(data, codeStart, byte(opNot)), "instruction 0: stack underflow"},
+		{"unknown modulo modes are rejected", replaceByte(data, len(bytecodeMagic)+1, 77), "unknown modulo mode 77"},
+		{"unknown operators are rejected", replaceByte(data, codeStart+9, 120), "instruction 2: unknown operator 60"},
+		{"comparisons cannot be applied", replaceByte(data, codeStart+9, 40), "instruction 2: < is a comparison"},
+		{"only comparisons can be compared", replaceByte(data, codeStart+8, byte(opCompare)), "instruction 2: + is not a comparison"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadBytecode(tt.data)
+			assert.Nil(t, got)
+			assert.EqualError(t, err, fmt.Sprintf(errBytecodeFormat, tt.wantErr))
+		})
+	}
+}
+
+func replaceByte(data []byte, i int, b byte) []byte {
+	data = append([]byte(nil), data...)
+	data[i] = b
+	return data
+}
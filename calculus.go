@@ -0,0 +1,206 @@
+package yamp
+
+import (
+	"fmt"
+	"math"
+)
+
+// checkCalculusArgs checks that diff and integrate name a variable, and that the order of diff is a
+// non-negative integer.
+func checkCalculusArgs(fn Function, sp Span, args []node) error {
+	if fn.Type() != Diff && fn.Type() != Integral {
+		return nil
+	}
+	if _, ok := args[1].(variableNode); !ok {
+		return SyntaxError{
+			Message:  fmt.Sprintf(errVariableArgument, fn, sp.Start),
+			Token:    fn.String(),
+			Position: args[1].span().Start,
+		}
+	}
+	if fn.Type() == Diff && len(args) == 3 {
+		if v, ok := constantValue(args[2]); !ok || v < 0 || v != math.Trunc(v) || math.IsInf(v, 0) {
+			return SyntaxError{
+				Message:  fmt.Sprintf(errDerivativeOrder, fn, sp.Start, formatNode(args[2])),
+				Token:    fn.String(),
+				Position: args[2].span().Start,
+			}
+		}
+	}
+	return nil
+}
+
+// derivativeNotation rewrites d/dx(f), which is parsed as the product of d/dx and f, into diff(f, x).
+// The parentheses are required, so that "d/dx x" stays a product, and a factor before d is kept, as
+// in "2 d/dx(f)".
+func derivativeNotation(n operatorNode) node {
+	// the multiplication is implied, and its right operand starts after the '('
+	if n.op.Type() != Multiplication || n.opSpan.Start != n.opSpan.End || n.operands[1].span().Start <= n.opSpan.Start {
+		return n
+	}
+	ratio, ok := n.operands[0].(operatorNode)
+	if !ok || ratio.op.Type() != Division {
+		return n
+	}
+	dx, ok := ratio.operands[1].(variableNode)
+	if !ok || len(dx.name) < 2 || dx.name[0] != 'd' {
+		return n
+	}
+	d := ratio.operands[0]
+	factor, hasFactor := d.(operatorNode)
+	if hasFactor = hasFactor && factor.op.Type() == Multiplication; hasFactor {
+		d = factor.operands[1]
+	}
+	if v, ok := d.(variableNode); !ok || v.name != "d" {
+		return n
+	}
+
+	f := n.operands[1]
+	x := variableNode{name: dx.name[1:], sp: Span{Start: dx.sp.Start + 1, End: dx.sp.End}}
+	fnSpan := Span{Start: d.span().Start, End: dx.sp.End}
+	call := callNode{fn: NewFunction(Diff), fnSpan: fnSpan, args: []node{f, x}, sp: fnSpan.union(f.span())}
+	if !hasFactor {
+		return call
+	}
+	factor.operands = []node{factor.operands[0], call}
+	factor.sp = factor.operands[0].span().union(call.sp)
+	return factor
+}
+
+// expandCalculus replaces the calls of diff and integrate in a syntax tree by the expressions they stand
+// for, innermost first: diff by the derivative of its argument, and integrate by the difference of the
+// antiderivative of its argument at its bounds.
+func expandCalculus(n node, o evalOptions) (res node, err error) {
+	switch n := n.(type) {
+	case operatorNode:
+		operands := make([]node, len(n.operands))
+		for i, operand := range n.operands {
+			if operands[i], err = expandCalculus(operand, o); err != nil {
+				return nil, err
+			}
+		}
+		n.operands = operands
+		return n, nil
+	case callNode:
+		args := make([]node, len(n.args))
+		for i, a := range n.args {
+			if args[i], err = expandCalculus(a, o); err != nil {
+				return nil, err
+			}
+		}
+		n.args = args
+
+		switch n.fn.Type() {
+		case Diff:
+			name := n.args[1].(variableNode).name
+			order := 1
+			if len(n.args) == 3 {
+				order = int(n.args[2].(numberNode).value)
+			}
+			res = n.args[0]
+			for i := 0; i < order; i++ {
+				if res, err = differentiate(res, name, o); err != nil {
+					return nil, err
+				}
+			}
+			return res, nil
+		case Integral:
+			name := n.args[1].(variableNode).name
+			f, err := integrate(n.args[0], name, newEvaluator(nil, o))
+			if err != nil {
+				return nil, err
+			}
+			lo, hi := substitute(f, name, n.args[2]), substitute(f, name, n.args[3])
+			return arithmetic(Subtraction, hi, lo, n.sp), nil
+		}
+		return n, nil
+	}
+	return n, nil
+}
+
+// substitute replaces the variable by value in a syntax tree, except where it is bound. Arithmetic is
+// rebuilt so that constants are folded.
+func substitute(n node, name string, value node) node {
+	switch n := n.(type) {
+	case variableNode:
+		if n.name == name {
+			return value
+		}
+	case operatorNode:
+		operands := make([]node, len(n.operands))
+		for i, operand := range n.operands {
+			operands[i] = substitute(operand, name, value)
+		}
+		switch typ := n.op.Type(); typ {
+		case Addition, Subtraction:
+			if isOperatorNodeOf(operands[1], Percent) {
+				break // which may be relative, and must not be folded as a sum
+			}
+			return arithmetic(typ, operands[0], operands[1], n.sp)
+		case Multiplication, Division, Power:
+			return arithmetic(typ, operands[0], operands[1], n.sp)
+		case Minus:
+			return negation(operands[0], n.sp)
+		}
+		n.operands = operands
+		return n
+	case callNode:
+		// the bound variable of sums, products and integrals is not substituted in the terms or integrand
+		// it appears in
+		var bound []int
+		switch n.fn.Type() {
+		case Sum, Product:
+			bound = []int{0, 3}
+		case Integral:
+			bound = []int{1, 0}
+		}
+		args := append([]node(nil), n.args...)
+	Args:
+		for i, a := range n.args {
+			if len(bound) > 0 && n.args[bound[0]].(variableNode).name == name {
+				for _, j := range bound {
+					if i == j {
+						continue Args
+					}
+				}
+			}
+			args[i] = substitute(a, name, value)
+		}
+		n.args = args
+		return n
+	}
+	return n
+}
+
+// compileCalculus type-checks the arguments of diff or integrate, and compiles the expression the call
+// stands for.
+func (c *compiler) compileCalculus(n callNode) (res compiled, err error) {
+	// the arguments are checked apart, so that variables the expansion drops do not take slots
+	check := &compiler{evalOptions: c.evalOptions, slots: make(map[string]int), locals: append([]string(nil), c.locals...)}
+	args := []int{0}
+	if n.fn.Type() == Integral {
+		check.locals = append(check.locals, n.args[1].(variableNode).name)
+		args = append(args, 2, 3)
+	}
+	for _, i := range args {
+		if i == 2 {
+			check.locals = check.locals[:len(check.locals)-1] // the bounds are outside the integral
+		}
+		var f compiled
+		if f, err = check.compile(n.args[i]); err != nil {
+			return compiled{}, err
+		}
+		if f.num == nil {
+			return compiled{}, TypeError{
+				Message: fmt.Sprintf(errArgumentType, i+1, n.fn, n.fnSpan.Start, NumericValue, BooleanValue),
+				Span:    n.args[i].span(),
+			}
+		}
+	}
+
+	x, err := expandCalculus(n, c.evalOptions)
+	if err != nil {
+		return compiled{}, err
+	}
+	return c.compile(x)
+}
@@ -0,0 +1,125 @@
+package yamp
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_evaluator_calculus(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		vars Variables
+		want float64
+	}{
+		{"diff differentiates at the value of the variable", "diff(x^3, x)", Variables{"x": 2}, 12},
+		{"diff takes an order", "diff(x^3, x, 2) + diff(x^3, x, 0)", Variables{"x": 2}, 20},
+		{"d/dx is diff", "d/dx(x^3 - y x)", Variables{"x": 2, "y": 1}, 11},
+		{"d/dx keeps a factor", "2 d/dx(x^2)", Variables{"x": 3}, 12},
+		{"d/dx can be nested", "d/dx(d/dx(x^4))", Variables{"x": 1}, 12},
+		{"d/dx without parentheses is a product", "d/dx x", Variables{"d": 6, "dx": 2, "x": 3}, 9},
+		{"explicit products are not d/dx", "d/dx * (x)", Variables{"d": 6, "dx": 2, "x": 3}, 9},
+		{"integrate integrates between its bounds", "integrate(x^2, x, 0, 3)", nil, 9},
+		{"the variable of integration is bound", "integrate(x^2, x, 0, 3) + x", Variables{"x": 1}, 10},
+		{"bounds may use the variable outside", "integrate(x y, y, 0, x)", Variables{"x": 2}, 4},
+		{"integrands may be derivatives", "integrate(diff(x^3, x), x, 1, 2)", nil, 7},
+		{"sums may integrate their index", "sum(k, 1, 3, integrate(k x, x, 0, 1))", nil, 3},
+		{"sums may be differentiated", "diff(sum(k, 1, 3, k x^2), x)", Variables{"x": 1}, 12},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewExpression(tt.expr).EvaluateWith(tt.vars)
+			if assert.NoError(t, err) {
+				assert.InDelta(t, tt.want, got, 1e-12)
+			}
+
+			p, err := Compile(tt.expr)
+			if !assert.NoError(t, err) {
+				return
+			}
+			slots := make([]float64, len(p.Variables()))
+			for i, name := range p.Variables() {
+				slots[i] = tt.vars[name]
+			}
+			got, err = p.Run(slots)
+			if assert.NoError(t, err) {
+				assert.InDelta(t, tt.want, got, 1e-12)
+			}
+		})
+	}
+}
+
+func Test_evaluator_calculus_errors(t *testing.T) {
+	tests := []struct {
+		name       string
+		expr       string
+		wantErr    error
+		compileErr error // if it differs from the evaluation error
+	}{
+		{
+			name:    "diff needs a variable",
+			expr:    "diff(x, 2)",
+			wantErr: SyntaxError{Message: fmt.Sprintf(errVariableArgument, "diff", 0), Token: "diff", Position: 8},
+		},
+		{
+			name:    "integrate needs a variable",
+			expr:    "integrate(x, 2x, 0, 1)",
+			wantErr: SyntaxError{Message: fmt.Sprintf(errVariableArgument, "integrate", 0), Token: "integrate", Position: 13},
+		},
+		{
+			name:    "orders must be integers",
+			expr:    "diff(x, x, 1.5)",
+			wantErr: SyntaxError{Message: fmt.Sprintf(errDerivativeOrder, "diff", 0, "1.5"), Token: "diff", Position: 11},
+		},
+		{
+			name:    "orders must be literals",
+			expr:    "diff(x, x, n)",
+			wantErr: SyntaxError{Message: fmt.Sprintf(errDerivativeOrder, "diff", 0, "n"), Token: "diff", Position: 11},
+		},
+		{"derivatives must exist", "diff(x mod 2, x)", fmt.Errorf(errNotDifferentiable, "mod", 7, "x"), nil},
+		{"integrals must have an antiderivative", "integrate(1/x, x, 1, 2)", fmt.Errorf(errIntegralLogarithm, "/", 11, "x"), nil},
+		{
+			name:       "integrands must be numeric",
+			expr:       "diff(x > 1, x)",
+			wantErr:    fmt.Errorf(errNotDifferentiable, ">", 7, "x"),
+			compileErr: TypeError{Message: fmt.Sprintf(errArgumentType, 1, "diff", 0, NumericValue, BooleanValue), Span: Span{Start: 5, End: 10}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewExpression(tt.expr).Evaluate()
+			assert.Equal(t, tt.wantErr, err)
+
+			if tt.compileErr == nil {
+				tt.compileErr = tt.wantErr
+			}
+			_, err = Compile(tt.expr)
+			assert.Equal(t, tt.compileErr, err)
+		})
+	}
+}
+
+func Test_substitute(t *testing.T) {
+	tests := []struct {
+		name  string
+		expr  string
+		value string
+		want  string
+	}{
+		{"constants are folded", "x ^ 2 / 2 + y * x", "2", "2 + y * 2"},
+		{"values may be expressions", "x ^ 2 - x", "y + 1", "(y + 1) ^ 2 - (y + 1)"},
+		{"sums bind their index", "sum(x, x, 3, x) + sum(k, 1, x, k x)", "2", "sum(x, 2, 3, x) + sum(k, 1, 2, k * 2)"},
+		{"integrals bind their variable", "integrate(x, x, 0, x)", "2", "integrate(x, x, 0, 2)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := (&expression{expr: tt.expr}).parse(defaultTokenRegistry)
+			assert.NoError(t, err)
+			v, err := (&expression{expr: tt.value}).parse(defaultTokenRegistry)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, formatNode(substitute(n, "x", v)))
+		})
+	}
+}
@@ -0,0 +1,21 @@
+// Command yamp-lsp is a language server for formula files, which contain a single yamp expression.
+// It speaks the Language Server Protocol over standard input and output, and provides diagnostics,
+// hover, completion, signature help and formatting.
+//
+// Constants, whose values are shown on hover, are passed in the initializationOptions of the
+// initialize request:
+//
+//	{"constants": {"rate": 0.05}}
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	if err := newServer(os.Stdin, os.Stdout).serve(); err != nil {
+		fmt.Fprintln(os.Stderr, "yamp-lsp:", err)
+		os.Exit(1)
+	}
+}
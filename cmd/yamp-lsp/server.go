@@ -0,0 +1,478 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nickylogan/yamp"
+)
+
+// defaultConstants are the constants known without being passed in the initialize request.
+var defaultConstants = yamp.Variables{
+	"pi": math.Pi,
+	"π":  math.Pi,
+	"e":  math.E,
+}
+
+// server is a language server for formula files. It handles one message at a time, so that edits
+// are applied in the order they are sent.
+type server struct {
+	conn        *conn
+	docs        map[string]yamp.Document
+	functions   yamp.FunctionRegistry
+	constants   yamp.Variables
+	initialized bool
+	shutdown    bool
+}
+
+func newServer(r io.Reader, w io.Writer) *server {
+	return &server{
+		conn:      newConn(r, w),
+		docs:      make(map[string]yamp.Document),
+		functions: yamp.DefaultFunctions(),
+		constants: make(yamp.Variables),
+	}
+}
+
+// serve handles messages until the client sends the exit notification. It fails if the connection
+// does, or if the client exits without shutting the server down first.
+func (s *server) serve() error {
+	for {
+		content, err := s.conn.read()
+		if err == io.EOF {
+			return errors.New("the connection was closed before the exit notification")
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err = json.Unmarshal(content, &req); err != nil {
+			err = &rpcError{Code: codeParseError, Message: err.Error()}
+		} else if req.Method == "" {
+			err = &rpcError{Code: codeInvalidRequest, Message: "the request has no method"}
+		}
+		if err != nil {
+			if err = s.reply(nil, nil, err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if req.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("the client exited without shutting down the server")
+			}
+			return nil
+		}
+
+		result, err := s.handle(req)
+		if req.ID != nil {
+			err = s.reply(req.ID, result, err)
+		} else {
+			err = s.notificationFailed(err)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// handle handles a request or notification. It returns an *rpcError if the message is at fault,
+// and any other error if the connection failed.
+func (s *server) handle(req request) (result interface{}, err error) {
+	if !s.initialized && req.Method != "initialize" {
+		return nil, &rpcError{Code: codeServerNotInitialized, Message: "the server is not initialized"}
+	}
+
+	switch req.Method {
+	case "initialize":
+		return s.initialize(req.Params)
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		return nil, s.didOpen(req.Params)
+	case "textDocument/didChange":
+		return nil, s.didChange(req.Params)
+	case "textDocument/didClose":
+		return nil, s.didClose(req.Params)
+	case "textDocument/hover":
+		return s.hover(req.Params)
+	case "textDocument/completion":
+		return s.completion(req.Params)
+	case "textDocument/signatureHelp":
+		return s.signatureHelp(req.Params)
+	case "textDocument/formatting":
+		return s.formatting(req.Params)
+	}
+	return nil, &rpcError{Code: codeMethodNotFound, Message: fmt.Sprintf("method %q is not supported", req.Method)}
+}
+
+// reply sends the response to a request.
+func (s *server) reply(id *json.RawMessage, result interface{}, err error) error {
+	resp := response{JSONRPC: "2.0", ID: id}
+	if err != nil {
+		rerr, ok := err.(*rpcError)
+		if !ok {
+			return err
+		}
+		resp.Error = rerr
+	} else {
+		raw, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		resp.Result = (*json.RawMessage)(&raw)
+	}
+	return s.conn.write(resp)
+}
+
+// notificationFailed logs the error of a notification in the client, since notifications have no
+// response. Notifications the server does not support are ignored.
+func (s *server) notificationFailed(err error) error {
+	rerr, ok := err.(*rpcError)
+	if !ok {
+		return err
+	}
+	if rerr.Code == codeMethodNotFound {
+		return nil
+	}
+	return s.notify("window/logMessage", logMessageParams{Type: messageError, Message: rerr.Message})
+}
+
+func (s *server) notify(method string, params interface{}) error {
+	return s.conn.write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (s *server) initialize(params json.RawMessage) (interface{}, error) {
+	var p initializeParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	for name, v := range defaultConstants {
+		s.constants[name] = v
+	}
+	for name, v := range p.InitializationOptions.Constants {
+		s.constants[name] = v
+	}
+	s.initialized = true
+
+	res := initializeResult{ServerInfo: serverInfo{Name: "yamp-lsp"}}
+	res.Capabilities.TextDocumentSync = syncIncremental
+	res.Capabilities.HoverProvider = true
+	res.Capabilities.SignatureHelpProvider.TriggerCharacters = []string{"(", ","}
+	res.Capabilities.DocumentFormattingProvider = true
+	return res, nil
+}
+
+func (s *server) didOpen(params json.RawMessage) error {
+	var p didOpenParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return err
+	}
+	doc := yamp.NewDocument(p.TextDocument.Text)
+	s.docs[p.TextDocument.URI] = doc
+	return s.publishDiagnostics(p.TextDocument.URI, doc)
+}
+
+// didChange applies the changes of a document in order. Each change replaces a range, which is only
+// tokenized and parsed again together with its surroundings, or the whole document.
+func (s *server) didChange(params json.RawMessage) error {
+	var p didChangeParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return err
+	}
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range p.ContentChanges {
+		if c.Range == nil {
+			doc = yamp.NewDocument(c.Text)
+			continue
+		}
+		edit := yamp.Edit{Span: rangeSpan(doc.String(), *c.Range), Text: c.Text}
+		if doc, err = doc.Apply(edit); err != nil {
+			return &rpcError{Code: codeInvalidParams, Message: err.Error()}
+		}
+	}
+	s.docs[p.TextDocument.URI] = doc
+	return s.publishDiagnostics(p.TextDocument.URI, doc)
+}
+
+func (s *server) didClose(params json.RawMessage) error {
+	var p didCloseParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return err
+	}
+	delete(s.docs, p.TextDocument.URI)
+	// clear the diagnostics of the closed document
+	return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+		URI:         p.TextDocument.URI,
+		Diagnostics: []diagnostic{},
+	})
+}
+
+func (s *server) publishDiagnostics(uri string, doc yamp.Document) error {
+	text := doc.String()
+	diags := make([]diagnostic, 0)
+	for _, d := range doc.Diagnostics() {
+		diags = append(diags, diagnostic{
+			Range:    spanRange(text, d.Span),
+			Severity: severityError,
+			Source:   "yamp",
+			Message:  d.Message,
+		})
+	}
+	return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: diags})
+}
+
+func (s *server) document(uri string) (yamp.Document, error) {
+	doc, ok := s.docs[uri]
+	if !ok {
+		return nil, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("document %q is not open", uri)}
+	}
+	return doc, nil
+}
+
+// hover shows the innermost subexpression at the position, along with its value if it only uses
+// constants, or otherwise its type.
+func (s *server) hover(params json.RawMessage) (interface{}, error) {
+	var p textDocumentPositionParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	text := doc.String()
+	sub, ok := doc.SubexpressionAt(runeIndex(text, p.Position), s.constants)
+	if !ok {
+		return nil, nil
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "```\n%s\n```\n", string([]rune(text)[sub.Span.Start:sub.Span.End]))
+	switch {
+	case sub.Value != nil:
+		fmt.Fprintf(&sb, "%s = %s", sub.Type, sub.Value)
+	case sub.Err != nil:
+		sb.WriteString(sub.Err.Error())
+	default:
+		sb.WriteString(sub.Type.String())
+	}
+	return &hover{
+		Contents: markupContent{Kind: "markdown", Value: sb.String()},
+		Range:    spanRange(text, sub.Span),
+	}, nil
+}
+
+// completion suggests the functions and constants, and the variables used elsewhere in the document.
+func (s *server) completion(params json.RawMessage) (interface{}, error) {
+	var p textDocumentPositionParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]completionItem, 0)
+	for name, fn := range s.functions {
+		label, _ := signature(fn)
+		items = append(items, completionItem{Label: name, Kind: completionFunction, Detail: label})
+	}
+	for name, v := range s.constants {
+		items = append(items, completionItem{
+			Label:  name,
+			Kind:   completionConstant,
+			Detail: strconv.FormatFloat(v, 'g', -1, 64),
+		})
+	}
+
+	text := doc.String()
+	typing := wordAt(text, runeIndex(text, p.Position))
+	for name, n := range variables(text) {
+		// the word being typed is not a variable yet
+		if _, ok := s.constants[name]; ok || (name == typing && n == 1) {
+			continue
+		}
+		items = append(items, completionItem{Label: name, Kind: completionVariable})
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+	return items, nil
+}
+
+// signatureHelp shows the arguments of the innermost function call around the position.
+func (s *server) signatureHelp(params json.RawMessage) (interface{}, error) {
+	var p textDocumentPositionParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	text := doc.String()
+	fn, arg, ok := enclosingCall(string([]rune(text)[:runeIndex(text, p.Position)]))
+	if !ok {
+		return nil, nil
+	}
+	label, args := signature(fn)
+	if arg >= len(args) {
+		arg = len(args) - 1
+	}
+	return &signatureHelp{
+		Signatures:      []signatureInformation{{Label: label, Parameters: args}},
+		ActiveParameter: arg,
+	}, nil
+}
+
+// formatting formats the whole document, unless it is invalid.
+func (s *server) formatting(params json.RawMessage) (interface{}, error) {
+	var p documentFormattingParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	text := doc.String()
+	formatted, err := yamp.Format(text)
+	if err != nil {
+		// the diagnostics already report why
+		return []textEdit{}, nil
+	}
+	if strings.HasSuffix(text, "\n") {
+		formatted += "\n"
+	}
+	if formatted == text {
+		return []textEdit{}, nil
+	}
+	end := positionAt(text, utf8.RuneCountInString(text))
+	return []textEdit{{Range: textRange{End: end}, NewText: formatted}}, nil
+}
+
+// signature describes how fn is called, with a parameter for each argument. Optional arguments are
+// in brackets, and functions that accept any number of arguments end with "...".
+func signature(fn yamp.Function) (label string, params []parameterInformation) {
+	min, max := fn.NumArgs()
+	n := max
+	if max < 0 {
+		n = min
+	}
+
+	names := make([]string, 0, n+1)
+	for i := 1; i <= n; i++ {
+		if i > min {
+			names = append(names, fmt.Sprintf("[x%d]", i))
+		} else {
+			names = append(names, fmt.Sprintf("x%d", i))
+		}
+	}
+	if max < 0 {
+		names = append(names, "...")
+	}
+
+	params = make([]parameterInformation, len(names))
+	for i, name := range names {
+		params[i] = parameterInformation{Label: name}
+	}
+	return fmt.Sprintf("%s(%s)", fn, strings.Join(names, ", ")), params
+}
+
+// enclosingCall returns the innermost function call that is still open at the end of expr, and the
+// index of the argument that expr ends in.
+func enclosingCall(expr string) (fn yamp.Function, arg int, ok bool) {
+	type call struct {
+		fn  yamp.Function // nil for brackets that are not calls
+		arg int
+	}
+	var (
+		calls   []call
+		pending yamp.Function
+	)
+
+	// a token is only returned once the tokenizer knows what follows it, so an operand is appended to
+	// complete the last one. Tokens before an error are still returned, and expr usually ends in one.
+	st := yamp.NewStreamTokenizer(strings.NewReader(expr + "0"))
+	for {
+		t, err := st.Next()
+		if err != nil {
+			break
+		}
+		switch t := t.(type) {
+		case yamp.Function:
+			pending = t
+			continue
+		case yamp.Bracket:
+			if t.IsLeft() {
+				calls = append(calls, call{fn: pending})
+			} else if len(calls) > 0 {
+				calls = calls[:len(calls)-1]
+			}
+		default:
+			if t == yamp.Token(yamp.ArgSeparator) && len(calls) > 0 {
+				calls[len(calls)-1].arg++
+			}
+		}
+		pending = nil
+	}
+
+	for i := len(calls) - 1; i >= 0; i-- {
+		if calls[i].fn != nil {
+			return calls[i].fn, calls[i].arg, true
+		}
+	}
+	return nil, 0, false
+}
+
+// variables counts the uses of each variable in expr, up to its first error.
+func variables(expr string) map[string]int {
+	res := make(map[string]int)
+	st := yamp.NewStreamTokenizer(strings.NewReader(expr))
+	for {
+		t, err := st.Next()
+		if err != nil {
+			return res
+		}
+		if v, ok := t.(yamp.Variable); ok {
+			res[v.Name()]++
+		}
+	}
+}
+
+// wordAt returns the word that contains or ends at the rune at index.
+func wordAt(text string, index int) string {
+	runes := []rune(text)
+	isWord := func(r rune) bool {
+		return yamp.IsLetter(r) || yamp.IsDigit(r)
+	}
+
+	start, end := index, index
+	for start > 0 && isWord(runes[start-1]) {
+		start--
+	}
+	for end < len(runes) && isWord(runes[end]) {
+		end++
+	}
+	return string(runes[start:end])
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testURI = "file:///tmp/test.formula"
+
+// message is any message sent by the server.
+type message struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+// client talks to a server over a pair of pipes, as an editor does over the standard streams of the
+// server process.
+type client struct {
+	t        *testing.T
+	conn     *conn
+	messages chan message
+	// notifications that were received while waiting for a response
+	notifications []message
+	nextID        int
+	done          chan error
+}
+
+func newClient(t *testing.T) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+
+	c := &client{
+		t:        t,
+		conn:     newConn(clientIn, clientOut),
+		messages: make(chan message, 16),
+		done:     make(chan error, 1),
+	}
+	go func() {
+		c.done <- newServer(serverIn, serverOut).serve()
+		serverOut.Close()
+	}()
+	go func() {
+		defer close(c.messages)
+		for {
+			content, err := c.conn.read()
+			if err != nil {
+				return
+			}
+			var m message
+			if err = json.Unmarshal(content, &m); err != nil {
+				t.Errorf("invalid message %s: %v", content, err)
+				return
+			}
+			c.messages <- m
+		}
+	}()
+	return c
+}
+
+// newInitializedClient creates a client that has initialized its server and opened a document.
+func newInitializedClient(t *testing.T, text string) *client {
+	c := newClient(t)
+	err := c.call("initialize", map[string]interface{}{
+		"initializationOptions": map[string]interface{}{"constants": map[string]float64{"rate": 0.5}},
+	}, nil)
+	assert.Nil(t, err)
+	c.notify("initialized", struct{}{})
+	c.notify("textDocument/didOpen", didOpenParams{TextDocument: textDocumentItem{URI: testURI, Text: text}})
+	c.diagnostics()
+	return c
+}
+
+// call sends a request and decodes the result of its response into result.
+func (c *client) call(method string, params, result interface{}) *rpcError {
+	c.t.Helper()
+	c.nextID++
+	id := json.RawMessage(strconv.Itoa(c.nextID))
+	c.write(request{JSONRPC: "2.0", ID: &id, Method: method, Params: mustMarshal(c.t, params)})
+
+	for {
+		m := c.receive()
+		if m.ID == nil {
+			c.notifications = append(c.notifications, m)
+			continue
+		}
+		assert.Equal(c.t, c.nextID, *m.ID)
+		if m.Error != nil {
+			return m.Error
+		}
+		if result != nil {
+			assert.NoError(c.t, json.Unmarshal(m.Result, result))
+		}
+		return nil
+	}
+}
+
+func (c *client) notify(method string, params interface{}) {
+	c.t.Helper()
+	c.write(request{JSONRPC: "2.0", Method: method, Params: mustMarshal(c.t, params)})
+}
+
+func (c *client) write(req request) {
+	c.t.Helper()
+	if err := c.conn.write(req); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// notification waits for the next notification of a method.
+func (c *client) notification(method string) json.RawMessage {
+	c.t.Helper()
+	for i, m := range c.notifications {
+		if m.Method == method {
+			c.notifications = append(c.notifications[:i], c.notifications[i+1:]...)
+			return m.Params
+		}
+	}
+	for {
+		m := c.receive()
+		if m.Method == method {
+			return m.Params
+		}
+		c.notifications = append(c.notifications, m)
+	}
+}
+
+// diagnostics waits for the next diagnostics of the test document.
+func (c *client) diagnostics() []diagnostic {
+	c.t.Helper()
+	var p publishDiagnosticsParams
+	assert.NoError(c.t, json.Unmarshal(c.notification("textDocument/publishDiagnostics"), &p))
+	assert.Equal(c.t, testURI, p.URI)
+	return p.Diagnostics
+}
+
+func (c *client) receive() message {
+	c.t.Helper()
+	select {
+	case m, ok := <-c.messages:
+		if !ok {
+			c.t.Fatal("the server closed the connection")
+		}
+		return m
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("timed out waiting for the server")
+	}
+	return message{}
+}
+
+// close shuts the server down and waits for it to exit.
+func (c *client) close() error {
+	c.t.Helper()
+	assert.Nil(c.t, c.call("shutdown", nil, nil))
+	c.notify("exit", nil)
+	return <-c.done
+}
+
+func mustMarshal(t *testing.T, v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func Test_server_lifecycle(t *testing.T) {
+	c := newClient(t)
+	err := c.call("textDocument/hover", textDocumentPositionParams{}, nil)
+	assert.Equal(t, &rpcError{Code: codeServerNotInitialized, Message: "the server is not initialized"}, err)
+
+	var res initializeResult
+	assert.Nil(t, c.call("initialize", struct{}{}, &res))
+	assert.Equal(t, syncIncremental, res.Capabilities.TextDocumentSync)
+	assert.True(t, res.Capabilities.HoverProvider)
+	assert.True(t, res.Capabilities.DocumentFormattingProvider)
+
+	err = c.call("workspace/symbol", struct{}{}, nil)
+	assert.Equal(t, codeMethodNotFound, err.Code)
+
+	// unsupported notifications are ignored, but failed ones are logged
+	c.notify("$/cancelRequest", struct{}{})
+	c.notify("textDocument/didClose", didCloseParams{})
+	c.notify("textDocument/didChange", didChangeParams{TextDocument: textDocumentIdentifier{URI: testURI}})
+	var log logMessageParams
+	assert.NoError(t, json.Unmarshal(c.notification("window/logMessage"), &log))
+	assert.Equal(t, logMessageParams{Type: messageError, Message: `document "` + testURI + `" is not open`}, log)
+
+	assert.NoError(t, c.close())
+}
+
+func Test_server_exitWithoutShutdown(t *testing.T) {
+	c := newInitializedClient(t, "1")
+	c.notify("exit", nil)
+	assert.EqualError(t, <-c.done, "the client exited without shutting down the server")
+}
+
+func Test_server_diagnostics(t *testing.T) {
+	c := newInitializedClient(t, "1 + 2 *")
+	defer c.close()
+
+	change := func(changes ...contentChange) []diagnostic {
+		c.notify("textDocument/didChange", didChangeParams{
+			TextDocument:   textDocumentIdentifier{URI: testURI},
+			ContentChanges: changes,
+		})
+		return c.diagnostics()
+	}
+	at := func(line, char int) position {
+		return position{Line: line, Character: char}
+	}
+
+	// the text is replaced, so its diagnostics are published again
+	want := []diagnostic{{
+		Range:    textRange{Start: at(0, 6), End: at(0, 7)},
+		Severity: severityError,
+		Source:   "yamp",
+		Message:  "operator '*' at index 7 expects a right operand",
+	}}
+	assert.Equal(t, want, change(contentChange{Text: "1 + 2 *"}))
+
+	// "1 + 2 *" => "1 + 2 *\n3"
+	assert.Empty(t, change(contentChange{Range: &textRange{Start: at(0, 7), End: at(0, 7)}, Text: "\n3"}))
+
+	// "1 + 2 *\n3" => "𝑥 + 2 *\n3 )", where "𝑥" takes two UTF-16 code units
+	want = []diagnostic{{
+		Range:    textRange{Start: at(1, 2), End: at(1, 3)},
+		Severity: severityError,
+		Source:   "yamp",
+		Message:  "the ')' at index 10 is missing a matching '('",
+	}}
+	assert.Equal(t, want, change(
+		contentChange{Range: &textRange{Start: at(0, 0), End: at(0, 1)}, Text: "𝑥"},
+		contentChange{Range: &textRange{Start: at(1, 1), End: at(1, 1)}, Text: " )"},
+	))
+
+	c.notify("textDocument/didClose", didCloseParams{TextDocument: textDocumentIdentifier{URI: testURI}})
+	assert.Empty(t, c.diagnostics())
+}
+
+func Test_server_hover(t *testing.T) {
+	tests := []struct {
+		name string
+		char int
+		want *hover
+	}{
+		{
+			name: "constants are evaluated",
+			char: 0,
+			want: &hover{
+				Contents: markupContent{Kind: "markdown", Value: "```\nrate\n```\nnumeric = 0.5"},
+				Range:    textRange{End: position{Character: 4}},
+			},
+		},
+		{
+			name: "subexpressions with variables show their type",
+			char: 15,
+			want: &hover{
+				Contents: markupContent{Kind: "markdown", Value: "```\nrate * (x + 1) > π\n```\nboolean"},
+				Range:    textRange{End: position{Character: 18}},
+			},
+		},
+		{
+			name: "operators belong to their operation",
+			char: 5,
+			want: &hover{
+				Contents: markupContent{Kind: "markdown", Value: "```\nrate * (x + 1)\n```\nnumeric"},
+				Range:    textRange{End: position{Character: 14}},
+			},
+		},
+		{name: "whitespace after the expression has nothing", char: 19},
+	}
+
+	c := newInitializedClient(t, "rate * (x + 1) > π ")
+	defer c.close()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *hover
+			err := c.call("textDocument/hover", textDocumentPositionParams{
+				TextDocument: textDocumentIdentifier{URI: testURI},
+				Position:     position{Character: tt.char},
+			}, &got)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_server_completion(t *testing.T) {
+	c := newInitializedClient(t, "rate * x + y + y + clz(xs)")
+	defer c.close()
+
+	var got []completionItem
+	// "xs" is being typed, so it is not suggested as a variable
+	err := c.call("textDocument/completion", textDocumentPositionParams{
+		TextDocument: textDocumentIdentifier{URI: testURI},
+		Position:     position{Character: 25},
+	}, &got)
+	assert.Nil(t, err)
+
+	want := []completionItem{
+		{Label: "clz", Kind: completionFunction, Detail: "clz(x1)"},
+		{Label: "diff", Kind: completionFunction, Detail: "diff(x1, x2, [x3])"},
+		{Label: "e", Kind: completionConstant, Detail: "2.718281828459045"},
+		{Label: "if", Kind: completionFunction, Detail: "if(x1, x2, x3)"},
+		{Label: "integrate", Kind: completionFunction, Detail: "integrate(x1, x2, x3, x4)"},
+		{Label: "pi", Kind: completionConstant, Detail: "3.141592653589793"},
+		{Label: "piecewise", Kind: completionFunction, Detail: "piecewise(x1, x2, ...)"},
+		{Label: "popcount", Kind: completionFunction, Detail: "popcount(x1)"},
+		{Label: "prod", Kind: completionFunction, Detail: "prod(x1, x2, x3, x4)"},
+		{Label: "rate", Kind: completionConstant, Detail: "0.5"},
+		{Label: "sum", Kind: completionFunction, Detail: "sum(x1, x2, x3, x4)"},
+		{Label: "x", Kind: completionVariable},
+		{Label: "y", Kind: completionVariable},
+		{Label: "Π", Kind: completionFunction, Detail: "prod(x1, x2, x3, x4)"},
+		{Label: "Σ", Kind: completionFunction, Detail: "sum(x1, x2, x3, x4)"},
+		{Label: "π", Kind: completionConstant, Detail: "3.141592653589793"},
+	}
+	assert.Equal(t, want, got)
+}
+
+func Test_server_signatureHelp(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want *signatureHelp
+	}{
+		{
+			name: "the first argument is active in an empty call",
+			text: "1 + if(",
+			want: &signatureHelp{
+				Signatures: []signatureInformation{{
+					Label:      "if(x1, x2, x3)",
+					Parameters: []parameterInformation{{Label: "x1"}, {Label: "x2"}, {Label: "x3"}},
+				}},
+			},
+		},
+		{
+			name: "separators move to the next argument",
+			text: "if(x < 1, (2 + 3), ",
+			want: &signatureHelp{
+				Signatures: []signatureInformation{{
+					Label:      "if(x1, x2, x3)",
+					Parameters: []parameterInformation{{Label: "x1"}, {Label: "x2"}, {Label: "x3"}},
+				}},
+				ActiveParameter: 2,
+			},
+		},
+		{
+			name: "the innermost call is shown",
+			text: "if(x, popcount((y",
+			want: &signatureHelp{
+				Signatures: []signatureInformation{{
+					Label:      "popcount(x1)",
+					Parameters: []parameterInformation{{Label: "x1"}},
+				}},
+			},
+		},
+		{
+			name: "extra arguments of variadic functions are the last parameter",
+			text: "piecewise(x > 0, 1, x < 0, ",
+			want: &signatureHelp{
+				Signatures: []signatureInformation{{
+					Label:      "piecewise(x1, x2, ...)",
+					Parameters: []parameterInformation{{Label: "x1"}, {Label: "x2"}, {Label: "..."}},
+				}},
+				ActiveParameter: 2,
+			},
+		},
+		{name: "closed calls have no signature", text: "clz(1) + (2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newInitializedClient(t, tt.text)
+			defer c.close()
+
+			var got *signatureHelp
+			err := c.call("textDocument/signatureHelp", textDocumentPositionParams{
+				TextDocument: textDocumentIdentifier{URI: testURI},
+				Position:     position{Character: len(tt.text)},
+			}, &got)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_server_formatting(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []textEdit
+	}{
+		{
+			name: "the whole document is replaced",
+			text: "if(x<0,-x,\n  x)*2 y\n",
+			want: []textEdit{{
+				Range:   textRange{End: position{Line: 2}},
+				NewText: "if(x < 0, -x, x) * 2y\n",
+			}},
+		},
+		{name: "formatted documents are left as they are", text: "2x + 1", want: []textEdit{}},
+		{name: "invalid documents are left as they are", text: "2x +", want: []textEdit{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newInitializedClient(t, tt.text)
+			defer c.close()
+
+			var got []textEdit
+			err := c.call("textDocument/formatting", documentFormattingParams{
+				TextDocument: textDocumentIdentifier{URI: testURI},
+			}, &got)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import "github.com/nickylogan/yamp"
+
+// runeIndex converts a position in text into a rune index, which is how yamp locates tokens.
+// Positions past the end of a line are moved to its end, and positions past the last line to the
+// end of text.
+func runeIndex(text string, pos position) int {
+	line, char, i := 0, 0, 0
+	for _, r := range text {
+		if line == pos.Line && (char >= pos.Character || r == '\n' || r == '\r') {
+			return i
+		}
+		if r == '\n' {
+			line, char = line+1, 0
+		} else {
+			char += utf16Len(r)
+		}
+		i++
+	}
+	return i
+}
+
+// positionAt converts a rune index into a position in text.
+func positionAt(text string, index int) position {
+	var pos position
+	i := 0
+	for _, r := range text {
+		if i == index {
+			break
+		}
+		if r == '\n' {
+			pos.Line, pos.Character = pos.Line+1, 0
+		} else {
+			pos.Character += utf16Len(r)
+		}
+		i++
+	}
+	return pos
+}
+
+// spanRange converts a span of runes into a range in text.
+func spanRange(text string, sp yamp.Span) textRange {
+	return textRange{Start: positionAt(text, sp.Start), End: positionAt(text, sp.End)}
+}
+
+// rangeSpan converts a range in text into a span of runes.
+func rangeSpan(text string, r textRange) yamp.Span {
+	return yamp.Span{Start: runeIndex(text, r.Start), End: runeIndex(text, r.End)}
+}
+
+// utf16Len returns the number of UTF-16 code units that encode r.
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
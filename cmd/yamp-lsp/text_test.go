@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_runeIndex(t *testing.T) {
+	const text = "a𝑥b\r\nπ + 1\n"
+	tests := []struct {
+		name string
+		pos  position
+		want int
+	}{
+		{"the start of the text", position{}, 0},
+		{"runes outside the BMP take two code units", position{Character: 3}, 2},
+		{"positions within a surrogate pair move past it", position{Character: 2}, 2},
+		{"the start of a line after CRLF", position{Line: 1}, 5},
+		{"runes inside the BMP take one code unit", position{Line: 1, Character: 1}, 6},
+		{"positions past the end of a line move to its end", position{Line: 0, Character: 10}, 3},
+		{"the last line may be empty", position{Line: 2}, 11},
+		{"positions past the last line move to the end", position{Line: 5, Character: 1}, 11},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, runeIndex(text, tt.pos))
+		})
+	}
+}
+
+func Test_positionAt(t *testing.T) {
+	const text = "a𝑥b\r\nπ + 1\n"
+	tests := []struct {
+		name  string
+		index int
+		want  position
+	}{
+		{"the start of the text", 0, position{}},
+		{"runes outside the BMP take two code units", 2, position{Character: 3}},
+		{"carriage returns end the line", 3, position{Character: 4}},
+		{"the start of a line", 5, position{Line: 1}},
+		{"the end of the text", 11, position{Line: 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, positionAt(text, tt.index))
+			assert.Equal(t, tt.index, runeIndex(text, tt.want))
+		})
+	}
+}
@@ -0,0 +1,315 @@
+package yamp
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// differentiate returns the derivative of a numeric syntax tree with respect to a variable. The derivative
+// is a syntax tree too, which is simplified as it is built so that constant subexpressions are folded.
+//
+// Arithmetic operators, percentages and powers with constant exponents are supported, as well
+// as conditionals, whose derivative is the derivative of the branch they take. Any other operator or
+// function is only supported if its operands do not depend on the variable.
+func differentiate(n node, name string, o evalOptions) (res node, err error) {
+	if !dependsOn(n, name) {
+		return constantNode(0, n.span()), nil
+	}
+
+	switch n := n.(type) {
+	case variableNode:
+		return constantNode(1, n.sp), nil
+	case operatorNode:
+		return differentiateOperator(n, name, o)
+	case callNode:
+		return differentiateCall(n, name, o)
+	}
+	return nil, notDifferentiableError(n, name)
+}
+
+func differentiateOperator(n operatorNode, name string, o evalOptions) (res node, err error) {
+	if n.op.Type() == ConditionalElse {
+		return differentiateBranches(n, n.operands[1:], name, o)
+	}
+	if (n.op.Type() == Addition || n.op.Type() == Subtraction) && o.percentMode == CalculatorPercent &&
+		isOperatorNodeOf(n.operands[1], Percent) {
+		return differentiateRelativePercent(n, name, o)
+	}
+
+	switch n.op.Type() {
+	case Plus, Minus, Percent, Addition, Subtraction, Multiplication, Division, Power:
+	default:
+		return nil, notDifferentiableError(n, name)
+	}
+
+	d := make([]node, len(n.operands))
+	for i, operand := range n.operands {
+		if d[i], err = differentiate(operand, name, o); err != nil {
+			return nil, err
+		}
+	}
+
+	sp := n.sp
+	switch n.op.Type() {
+	case Plus:
+		return d[0], nil
+	case Minus:
+		return negation(d[0], sp), nil
+	case Percent:
+		return arithmetic(Division, d[0], constantNode(100, sp), sp), nil
+	case Addition, Subtraction:
+		return arithmetic(n.op.Type(), d[0], d[1], sp), nil
+	case Multiplication:
+		u, v := n.operands[0], n.operands[1]
+		return arithmetic(Addition, arithmetic(Multiplication, d[0], v, sp), arithmetic(Multiplication, u, d[1], sp), sp), nil
+	case Division:
+		// (u/v)' = (u'v - uv') / v^2
+		u, v := n.operands[0], n.operands[1]
+		num := arithmetic(Subtraction, arithmetic(Multiplication, d[0], v, sp), arithmetic(Multiplication, u, d[1], sp), sp)
+		return arithmetic(Division, num, arithmetic(Power, v, constantNode(2, sp), sp), sp), nil
+	}
+
+	// (u^c)' = c u^(c-1) u', since exponents that depend on the variable would need a logarithm
+	u, c := n.operands[0], n.operands[1]
+	if dependsOn(c, name) {
+		return nil, notDifferentiableError(n, name)
+	}
+	exp := arithmetic(Subtraction, c, constantNode(1, sp), sp)
+	return arithmetic(Multiplication, arithmetic(Multiplication, c, arithmetic(Power, u, exp, sp), sp), d[0], sp), nil
+}
+
+// differentiateRelativePercent differentiates "a + b%" and "a - b%" in CalculatorPercent mode, which are
+// a (1 + b/100) and a (1 - b/100).
+func differentiateRelativePercent(n operatorNode, name string, o evalOptions) (res node, err error) {
+	sp := n.sp
+	a, b := n.operands[0], n.operands[1].(operatorNode).operands[0]
+	da, err := differentiate(a, name, o)
+	if err != nil {
+		return nil, err
+	}
+	db, err := differentiate(b, name, o)
+	if err != nil {
+		return nil, err
+	}
+
+	// (a (1 ± b/100))' = a' (1 ± b/100) ± a b'/100
+	typ := n.op.Type()
+	factor := arithmetic(typ, constantNode(1, sp), arithmetic(Division, b, constantNode(100, sp), sp), sp)
+	term := arithmetic(Division, arithmetic(Multiplication, a, db, sp), constantNode(100, sp), sp)
+	return arithmetic(typ, arithmetic(Multiplication, da, factor, sp), term, sp), nil
+}
+
+func differentiateCall(n callNode, name string, o evalOptions) (res node, err error) {
+	switch n.fn.Type() {
+	case If:
+		return differentiateBranches(n, n.args[1:], name, o)
+	case Piecewise:
+		// conditions are at even indices, except for the default value
+		var values []int
+		for i := 1; i < len(n.args); i += 2 {
+			values = append(values, i)
+		}
+		if len(n.args)%2 == 1 {
+			values = append(values, len(n.args)-1)
+		}
+		args := append([]node(nil), n.args...)
+		for _, i := range values {
+			if args[i], err = differentiate(n.args[i], name, o); err != nil {
+				return nil, err
+			}
+		}
+		n.args = args
+		return n, nil
+	case Sum:
+		// the derivative of a sum is the sum of the derivatives of its terms, if its bounds are constant
+		if dependsOn(n.args[1], name) || dependsOn(n.args[2], name) {
+			break
+		}
+		args := append([]node(nil), n.args...)
+		if args[3], err = differentiate(n.args[3], name, o); err != nil {
+			return nil, err
+		}
+		n.args = args
+		return n, nil
+	case Diff, Integral:
+		e, err := expandCalculus(n, o)
+		if err != nil {
+			return nil, err
+		}
+		return differentiate(e, name, o)
+	}
+	return nil, notDifferentiableError(n, name)
+}
+
+// differentiateBranches differentiates a conditional by differentiating the values it chooses from,
+// which are the last operands or arguments of n.
+func differentiateBranches(n node, branches []node, name string, o evalOptions) (res node, err error) {
+	d := make([]node, len(branches))
+	for i, b := range branches {
+		if d[i], err = differentiate(b, name, o); err != nil {
+			return nil, err
+		}
+	}
+
+	switch n := n.(type) {
+	case operatorNode:
+		n.operands = append([]node{n.operands[0]}, d...)
+		return n, nil
+	case callNode:
+		n.args = append([]node{n.args[0]}, d...)
+		return n, nil
+	}
+	return nil, notDifferentiableError(n, name)
+}
+
+func notDifferentiableError(n node, name string) error {
+	switch n := n.(type) {
+	case operatorNode:
+		return fmt.Errorf(errNotDifferentiable, n.op, n.opSpan.Start, name)
+	case callNode:
+		return fmt.Errorf(errNotDifferentiable, n.fn, n.fnSpan.Start, name)
+	}
+	return fmt.Errorf(errNotDifferentiable, "?", n.span().Start, name)
+}
+
+// dependsOn checks whether the variable appears in the tree of n.
+func dependsOn(n node, name string) bool {
+	switch n := n.(type) {
+	case variableNode:
+		return n.name == name
+	case operatorNode:
+		for _, o := range n.operands {
+			if dependsOn(o, name) {
+				return true
+			}
+		}
+	case callNode:
+		if t := n.fn.Type(); (t == Sum || t == Product) && n.args[0].(variableNode).name == name {
+			// the index is bound within the terms
+			return dependsOn(n.args[1], name) || dependsOn(n.args[2], name)
+		}
+		if n.fn.Type() == Integral && n.args[1].(variableNode).name == name {
+			// and the variable of integration within the integrand
+			return dependsOn(n.args[2], name) || dependsOn(n.args[3], name)
+		}
+		for _, a := range n.args {
+			if dependsOn(a, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// constantNode creates a number node for a value that does not appear in the expression.
+func constantNode(v float64, sp Span) numberNode {
+	return numberNode{value: v, symbol: strconv.FormatFloat(v, 'g', -1, 64), sp: sp}
+}
+
+// constantValue returns the value of n if it is a number node.
+func constantValue(n node) (v float64, ok bool) {
+	num, ok := n.(numberNode)
+	return num.value, ok
+}
+
+// negation builds -a, folding constants.
+func negation(a node, sp Span) node {
+	if v, ok := constantValue(a); ok {
+		return constantNode(-v, sp)
+	}
+	if isOperatorNodeOf(a, Minus) {
+		return a.(operatorNode).operands[0]
+	}
+	return operatorNode{op: NewOperator(Minus), opSpan: sp, operands: []node{a}, sp: sp}
+}
+
+// negated returns -n if n is a negative constant or a product or quotient whose leading factor is one, or
+// a negation, so that sums can subtract it instead. Negated percentages are left alone, as subtracting
+// them would make them relative in CalculatorPercent mode.
+func negated(n node) (res node, ok bool) {
+	if v, ok := constantValue(n); ok {
+		return constantNode(-v, n.span()), v < 0
+	}
+	op, ok := n.(operatorNode)
+	if !ok {
+		return nil, false
+	}
+	switch op.op.Type() {
+	case Minus:
+		return op.operands[0], !isOperatorNodeOf(op.operands[0], Percent)
+	case Multiplication, Division:
+		if res, ok = negated(op.operands[0]); ok {
+			op.operands = []node{res, op.operands[1]}
+			return op, true
+		}
+	}
+	return nil, false
+}
+
+// arithmetic builds a binary arithmetic operation, folding constants and dropping identities so that
+// derivatives do not grow needlessly.
+func arithmetic(typ opType, a, b node, sp Span) node {
+	x, aConst := constantValue(a)
+	y, bConst := constantValue(b)
+	if aConst && bConst {
+		v, _ := applyFloat(NewOperator(typ), x, y, FlooredModulo)
+		return constantNode(v, sp)
+	}
+
+	switch typ {
+	case Addition:
+		if aConst && x == 0 {
+			return b
+		}
+		if bConst && y == 0 {
+			return a
+		}
+		if m, ok := negated(b); ok {
+			return arithmetic(Subtraction, a, m, sp)
+		}
+	case Subtraction:
+		if aConst && x == 0 {
+			return negation(b, sp)
+		}
+		if bConst && y == 0 {
+			return a
+		}
+		if m, ok := negated(b); ok {
+			return arithmetic(Addition, a, m, sp)
+		}
+	case Multiplication:
+		if aConst && x == 0 || bConst && y == 0 {
+			return constantNode(0, sp)
+		}
+		if aConst && x == 1 {
+			return b
+		}
+		if bConst && y == 1 {
+			return a
+		}
+		if aConst && x == -1 {
+			return negation(b, sp)
+		}
+		if d, ok := b.(operatorNode); ok && d.op.Type() == Division {
+			// a (1 / d) is a / d
+			if v, ok := constantValue(d.operands[0]); ok && v == 1 {
+				return arithmetic(Division, a, d.operands[1], sp)
+			}
+		}
+	case Division:
+		if aConst && x == 0 {
+			return constantNode(0, sp)
+		}
+		if bConst && y == 1 {
+			return a
+		}
+	case Power:
+		if bConst && y == 0 {
+			return constantNode(1, sp)
+		}
+		if bConst && y == 1 {
+			return a
+		}
+	}
+	return operatorNode{op: NewOperator(typ), opSpan: sp, operands: []node{a, b}, sp: sp}
+}
@@ -0,0 +1,104 @@
+package yamp
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_differentiate(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		opts []EvalOption
+		want string // the derivative with respect to x
+	}{
+		{"constants vanish", "y! + 3", nil, "0"},
+		{"sums are differentiated term by term", "x + y - x", nil, "0"},
+		{"the product rule is applied", "x * y * x", nil, "2x * y"},
+		{"the quotient rule is applied", "1 / x", nil, "-1 / x^2"},
+		{"constant exponents follow the power rule", "3x^4 - x^-1", nil, "12x^3 + x^-2"},
+		{"signs and percentages are linear", "-x + +x%", nil, "-0.99"},
+		{"relative percentages are products", "x^2 - x%", []EvalOption{WithPercentMode(CalculatorPercent)}, "2x * (1 - x/100) - x^2/100"},
+		{"the ternary conditional differentiates its branches", "x < 0 ? -x^2 : x^3", nil, "x < 0 ? -2x : 3x^2"},
+		{"if differentiates its branches", "if(x < 0, y, 2x)", nil, "if(x < 0, 0, 2)"},
+		{"piecewise differentiates its values", "piecewise(x < 0, -x, x > 1, x^2, x)", nil, "piecewise(x < 0, -1, x > 1, 2x, 1)"},
+		{"sums with constant bounds differentiate their terms", "sum(k, 1, y, k x^2)", nil, "sum(k, 1, y, 2k x)"},
+		{"the index of a sum is not the variable", "sum(x, 1, 3, x y)", nil, "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newEvalOptions(tt.opts...)
+			root, err := (&expression{expr: tt.expr}).parse(o.reg)
+			if !assert.NoError(t, err) {
+				return
+			}
+			d, err := differentiate(root, "x", o)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			// the derivative is compared with the expected one at a few points
+			fs, vars, err := bindFunctions(o, []string{"x", "y"}, nil, d)
+			if !assert.NoError(t, err) {
+				return
+			}
+			want, err := Compile(tt.want)
+			if !assert.NoError(t, err) {
+				return
+			}
+			for _, x := range []float64{-2.5, -1, 0.5, 1.5, 3} {
+				vars[0], vars[1] = x, 3
+				got, err := fs[0](vars)
+				assert.NoError(t, err)
+
+				slots := make([]float64, len(want.Variables()))
+				for i, name := range want.Variables() {
+					slots[i] = map[string]float64{"x": x, "y": 3}[name]
+				}
+				w, err := want.Run(slots)
+				assert.NoError(t, err)
+				assert.InDelta(t, w, got, 1e-12, "at x = %v", x)
+			}
+		})
+	}
+}
+
+func Test_differentiate_simplifies(t *testing.T) {
+	root, err := (&expression{expr: "2x + 3"}).parse(defaultTokenRegistry)
+	assert.NoError(t, err)
+	d, err := differentiate(root, "x", newEvalOptions())
+	assert.NoError(t, err)
+	assert.Equal(t, constantNode(2, Span{Start: 0, End: 6}), d)
+}
+
+func Test_differentiate_errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr error
+	}{
+		{"factorials are not differentiable", "2 * x!", fmt.Errorf(errNotDifferentiable, "!", 5, "x")},
+		{"exponents must not depend on the variable", "2^x", fmt.Errorf(errNotDifferentiable, "^", 1, "x")},
+		{"bit counts are not differentiable", "popcount(x)", fmt.Errorf(errNotDifferentiable, "popcount", 0, "x")},
+		{"the bounds of sums must not depend on the variable", "sum(k, 1, x, k)", fmt.Errorf(errNotDifferentiable, "sum", 0, "x")},
+		{"products are not differentiable", "prod(k, 1, 3, x)", fmt.Errorf(errNotDifferentiable, "prod", 0, "x")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := (&expression{expr: tt.expr}).parse(defaultTokenRegistry)
+			assert.NoError(t, err)
+			_, err = differentiate(root, "x", newEvalOptions())
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+func Test_centralDifference(t *testing.T) {
+	df := centralDifference(func(x float64) (float64, error) { return math.Sin(x), nil })
+	got, err := df(1)
+	assert.NoError(t, err)
+	assert.InDelta(t, math.Cos(1), got, 1e-9)
+}
@@ -0,0 +1,563 @@
+package yamp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Edit replaces the text within Span by Text.
+type Edit struct {
+	Span Span
+	Text string
+}
+
+// Diagnostic describes a problem at a location in an expression.
+type Diagnostic struct {
+	Span    Span
+	Message string
+}
+
+// Subexpression describes a subexpression of a Document.
+type Subexpression struct {
+	Span Span
+	// Type is the type of the subexpression's value, or zero if its operands have unexpected types.
+	Type valueType
+	// Value is the value of the subexpression, or nil if it uses variables that have no value or
+	// fails to evaluate.
+	Value Value
+	// Err is the error that prevented the subexpression from being checked or evaluated, if any.
+	Err error
+}
+
+// Document is an expression that is edited over time, such as in an editor. It keeps the tokens and
+// syntax tree of the expression, so that an edit only tokenizes and parses again the region it
+// affects. Tokens and subtrees outside of that region are reused, although their positions are
+// still shifted.
+type Document interface {
+	// Diagnostics returns the problems in the expression, which are empty if it is valid.
+	Diagnostics() []Diagnostic
+	// Apply returns the document that results from an edit. The receiver is not modified.
+	Apply(edit Edit) (Document, error)
+	// SubexpressionAt returns the innermost subexpression that contains the rune at pos, evaluated
+	// with vars. It returns false if the expression has errors or pos is outside of it.
+	SubexpressionAt(pos int, vars Variables) (sub Subexpression, ok bool)
+	String() string
+}
+
+var _ Document = (*document)(nil)
+
+type document struct {
+	reg    TokenRegistry
+	text   string
+	length int  // number of runes in text
+	ascii  bool // whether rune and byte offsets into text are the same
+
+	tokens []Token
+	spans  []Span
+	lexErr error // error that stopped the tokenizer, in which case later tokens are missing
+	root   node  // nil if the expression has errors
+	err    error
+
+	// for tests: the region that was tokenized again, and the number of subtrees that were reused
+	relexed Span
+	reused  int
+}
+
+// NewDocument creates a Document for an expression.
+func NewDocument(expr string) Document {
+	return NewDocumentWithRegistry(expr, defaultTokenRegistry)
+}
+
+// NewDocumentWithRegistry creates a Document for an expression whose tokens are recognized by reg.
+func NewDocumentWithRegistry(expr string, reg TokenRegistry) Document {
+	d := &document{reg: reg}
+	d.setText(expr)
+
+	s := &scanner{reg: reg}
+	s.initialize(expr)
+	d.lex(s, nil, Edit{})
+	d.parse(nil, 0, len(d.tokens), 0)
+	return d
+}
+
+// Diagnostics implements the Document interface.
+func (d *document) Diagnostics() []Diagnostic {
+	if d.err == nil {
+		return nil
+	}
+	return []Diagnostic{newDiagnostic(d.err, d.length)}
+}
+
+// Apply implements the Document interface.
+func (d *document) Apply(edit Edit) (Document, error) {
+	sp := edit.Span
+	if sp.Start < 0 || sp.Start > sp.End || sp.End > d.length {
+		return nil, fmt.Errorf(errEditSpan, sp.Start, sp.End, d.length)
+	}
+
+	nd := &document{reg: d.reg}
+	nd.setText(d.text[:d.offset(sp.Start)] + edit.Text + d.text[d.offset(sp.End):])
+
+	s, restart := d.restart(nd.text, sp.Start)
+	suffix, tokenDelta := nd.lex(s, d, edit)
+	nd.parse(d, restart, suffix, tokenDelta)
+	return nd, nil
+}
+
+// SubexpressionAt implements the Document interface.
+func (d *document) SubexpressionAt(pos int, vars Variables) (sub Subexpression, ok bool) {
+	if d.root == nil {
+		return Subexpression{}, false
+	}
+	n, ok := innermostNode(d.root, pos)
+	if !ok {
+		return Subexpression{}, false
+	}
+
+	sub.Span = d.balance(n.span())
+	o := newEvalOptions(WithTokenRegistry(d.reg))
+	c := &compiler{evalOptions: o, slots: make(map[string]int)}
+	f, err := c.compile(n)
+	if err != nil {
+		sub.Err = err
+		return sub, true
+	}
+	sub.Type = f.typ()
+
+	for _, name := range c.names {
+		if _, ok := vars[name]; !ok {
+			return sub, true
+		}
+	}
+	sub.Value, sub.Err = newEvaluator(vars, o).eval(n)
+	return sub, true
+}
+
+// balance widens sp over the brackets around it that are closed or opened within it, as in
+// "x + 1)" => "(x + 1)".
+func (d *document) balance(sp Span) Span {
+	first := sort.Search(len(d.tokens), func(i int) bool { return d.spans[i].Start >= sp.Start })
+	last := first
+	open, closed := 0, 0
+	for ; last < len(d.tokens) && d.spans[last].End <= sp.End; last++ {
+		b, ok := d.tokens[last].(Bracket)
+		switch {
+		case !ok:
+		case b.IsLeft():
+			open++
+		case open > 0:
+			open--
+		default:
+			closed++
+		}
+	}
+
+	for ; closed > 0 && first > 0 && isBracket(d.tokens[first-1], true); closed-- {
+		first--
+		sp.Start = d.spans[first].Start
+	}
+	for ; open > 0 && last < len(d.tokens) && isBracket(d.tokens[last], false); open-- {
+		sp.End = d.spans[last].End
+		last++
+	}
+	return sp
+}
+
+func (d *document) String() string {
+	return d.text
+}
+
+func (d *document) setText(text string) {
+	d.text = text
+	d.length = utf8.RuneCountInString(text)
+	d.ascii = d.length == len(text)
+}
+
+// offset converts a rune index into a byte offset.
+func (d *document) offset(index int) int {
+	if d.ascii {
+		return index
+	}
+	offset := 0
+	for ; index > 0; index-- {
+		_, size := utf8.DecodeRuneInString(d.text[offset:])
+		offset += size
+	}
+	return offset
+}
+
+// restart returns a scanner for text, the edited text of d, that resumes scanning after the last
+// token that ends before pos, along with the index of that token. The token is still pending in the
+// scanner, since whatever follows it may change it, as in "1" => "12".
+func (d *document) restart(text string, pos int) (s *scanner, index int) {
+	s = &scanner{reg: d.reg}
+	s.initialize(text)
+
+	i := sort.Search(len(d.tokens), func(i int) bool { return d.spans[i].End >= pos })
+	for i--; i >= 0; i-- {
+		sp := d.spans[i]
+		if sp.Start == sp.End {
+			continue // inserted multiplication
+		}
+		// numbers separated by whitespace are joined, so their symbols do not match the text
+		if _, ok := d.tokens[i].(Number); ok && d.text[d.offset(sp.Start):d.offset(sp.End)] != d.tokens[i].String() {
+			continue
+		}
+		break
+	}
+	if i < 0 {
+		return s, 0
+	}
+
+	s.tokens = append(s.tokens, d.tokens[:i]...)
+	s.spans = append(s.spans, d.spans[:i]...)
+	for j := 0; j <= i; j++ {
+		_ = s.replayBracket(d.tokens, d.spans, j)
+	}
+
+	sp := d.spans[i]
+	start, end := d.offset(sp.Start), d.offset(sp.End)
+	s.currState = tokenState(d.tokens[i])
+	s.currSymbol = text[start:end]
+	s.currStart = sp.Start
+	s.symbolOffset = start
+	s.currIndex = sp.End
+	s.currOffset = end
+	return s, i
+}
+
+// lex scans the rest of the text with s. If old is given, scanning stops once the scanner is back in
+// sync with the tokens of old after the edit, and the remaining tokens of old are reused. The index of
+// the first reused token and the difference between its index in d and in old are returned.
+func (d *document) lex(s *scanner, old *document, edit Edit) (suffix, tokenDelta int) {
+	d.relexed.Start = s.currIndex
+	editEnd := edit.Span.Start + utf8.RuneCountInString(edit.Text)
+	delta := editEnd - edit.Span.End
+
+	for s.currOffset < len(s.expr) {
+		if old != nil && old.lexErr == nil && s.currIndex >= editEnd && s.currSymbol != "" {
+			if p, ok := old.pendingToken(s, delta, edit.Span.End); ok {
+				d.relexed.End = s.currIndex
+				return d.splice(s, old, p, delta)
+			}
+		}
+		if err := s.step(); err != nil {
+			d.tokens, d.spans, d.lexErr, d.err = s.tokens, s.spans, err, err
+			d.relexed.End = s.currIndex
+			return len(d.tokens), 0
+		}
+	}
+	d.relexed.End = s.currIndex
+
+	if err := s.finish(); err != nil {
+		d.lexErr, d.err = err, err
+	}
+	d.tokens, d.spans = s.tokens, s.spans
+	return len(d.tokens), 0
+}
+
+// pendingToken checks whether the scanner, which is about to scan the text that follows an edit, is
+// in the state the tokenizer of d was in at the same place, shifted by delta. If so, it returns the
+// index of the token that is pending in both. Tokens that start before editEnd are never matched, as
+// their text may have changed.
+func (d *document) pendingToken(s *scanner, delta, editEnd int) (p int, ok bool) {
+	pos := s.currIndex - delta
+	next := sort.Search(len(d.tokens), func(i int) bool { return d.spans[i].Start >= pos })
+	if next == len(d.tokens) || d.spans[next].Start != pos {
+		return 0, false
+	}
+	for p = next - 1; p >= 0 && d.spans[p].Start == d.spans[p].End; p-- {
+	}
+	if p < 0 || d.spans[p].Start < editEnd || d.spans[p].Start+delta != s.currStart {
+		return 0, false
+	}
+	return p, tokenState(d.tokens[p]) == s.currState
+}
+
+// splice completes the tokens of d with the tokens of old from index p, shifted by delta. The
+// brackets of those tokens are checked again, since the brackets before them may have changed.
+func (d *document) splice(s *scanner, old *document, p, delta int) (suffix, tokenDelta int) {
+	suffix = len(s.tokens)
+	tokenDelta = suffix - p
+
+	d.tokens = append(s.tokens, old.tokens[p:]...)
+	d.spans = s.spans
+	for _, sp := range old.spans[p:] {
+		d.spans = append(d.spans, Span{Start: sp.Start + delta, End: sp.End + delta})
+	}
+
+	for i := suffix + 1; i < len(d.tokens); i++ {
+		if err := s.replayBracket(d.tokens, d.spans, i); err != nil {
+			d.lexErr, d.err = err, err
+			// only keep tokens that are known to be complete
+			d.tokens, d.spans = d.tokens[:i-1], d.spans[:i-1]
+			return len(d.tokens), 0
+		}
+	}
+	if err := s.checkParenDepth(); err != nil {
+		d.lexErr, d.err = err, err
+	}
+	return suffix, tokenDelta
+}
+
+// parse builds the syntax tree of d. The subtrees of old for the brackets and function calls in the
+// tokens before restart, and from suffix on, are reused.
+func (d *document) parse(old *document, restart, suffix, tokenDelta int) {
+	if d.lexErr != nil {
+		return
+	}
+
+	infix := make([]spannedToken, 0, len(d.tokens))
+	for i := 0; i < len(d.tokens); i++ {
+		if old != nil && old.root != nil {
+			if n, end, ok := d.reuse(old, i, restart, suffix, tokenDelta); ok {
+				infix = append(infix, spannedToken{Token: subtree{n}, span: n.span()})
+				d.reused++
+				i = end
+				continue
+			}
+		}
+		infix = append(infix, spannedToken{Token: d.tokens[i], span: d.spans[i]})
+	}
+
+	rpn, err := (&expression{expr: d.text}).toRPN(infix)
+	if err == nil {
+		d.root, err = parse(rpn)
+	}
+	d.err = err
+}
+
+// reuse looks for the subtree of old for the bracket or function call that starts with the token at
+// index i. It returns the subtree, shifted to its position in d, and the index of the closing bracket.
+func (d *document) reuse(old *document, i, restart, suffix, tokenDelta int) (n node, end int, ok bool) {
+	open := i
+	if isFunction(d.tokens[i]) {
+		open++
+	} else if i > 0 && isFunction(d.tokens[i-1]) {
+		return nil, 0, false // the call is reused as a whole
+	}
+	if open >= len(d.tokens) || d.tokens[open] != LeftParen {
+		return nil, 0, false
+	}
+
+	end = matchingBracket(d.tokens, open)
+	shift := 0 // difference between the indices of the tokens in d and in old
+	switch {
+	case end >= 0 && end < restart:
+	case end >= 0 && i >= suffix:
+		shift = tokenDelta
+	default:
+		return nil, 0, false
+	}
+
+	// function calls span their name and arguments, while brackets only span their contents
+	sp := Span{Start: old.spans[i-shift].Start, End: old.spans[end-shift-1].End}
+	if i == open {
+		sp.Start = old.spans[open-shift+1].Start
+	}
+	if n, ok = findNode(old.root, sp); !ok {
+		return nil, 0, false
+	}
+	return shiftNode(n, d.spans[i].Start-old.spans[i-shift].Start), end, true
+}
+
+// subtree is a token that stands for an already parsed subexpression.
+type subtree struct {
+	n node
+}
+
+func (t subtree) String() string {
+	return ""
+}
+
+// replayBracket updates the brackets of a scanner for the token at index i, which was tokenized
+// before, returning the error the scanner would have returned for it.
+func (s *scanner) replayBracket(tokens []Token, spans []Span, i int) error {
+	pos := spans[i].Start
+	switch tokens[i] {
+	case LeftParen:
+		if i > 0 && isFunction(tokens[i-1]) {
+			s.parenDepth.incrementCall(pos, LeftParen)
+		} else {
+			s.parenDepth.increment(pos, LeftParen)
+		}
+	case RightParen:
+		if s.parenDepth.depth() == 0 {
+			return SyntaxError{
+				Message:  fmt.Sprintf(errUnmatchedRightParen, pos),
+				Token:    ")",
+				Position: pos,
+			}
+		}
+		s.parenDepth.decrement(pos, RightParen)
+	case ArgSeparator:
+		if !s.parenDepth.inCall() {
+			return SyntaxError{
+				Message:  fmt.Sprintf(errMisplacedSeparator, pos),
+				Token:    tokens[i].String(),
+				Position: pos,
+			}
+		}
+	}
+	return nil
+}
+
+// tokenState returns the state the tokenizer is in while tok is pending.
+func tokenState(tok Token) int {
+	switch t := tok.(type) {
+	case Number:
+		if strings.ContainsRune(t.String(), '.') {
+			return tokenDecimal
+		}
+		return tokenInteger
+	case Variable:
+		return tokenVariable
+	case Function:
+		return tokenFunction
+	case Bracket:
+		if t.IsLeft() {
+			return tokenLeftParen
+		}
+		return tokenRightParen
+	case separator:
+		return tokenSeparator
+	case Operator:
+		switch {
+		case IsUnaryOp(t) && IsRightAssocOp(t):
+			return tokenLeftUnaryOp
+		case IsUnaryOp(t):
+			return tokenRightUnaryOp
+		}
+		return tokenBinaryOp
+	}
+	return tokenNothing
+}
+
+func isFunction(t Token) bool {
+	_, ok := t.(Function)
+	return ok
+}
+
+// matchingBracket returns the index of the bracket that closes the one at index open, or -1 if it is
+// never closed.
+func matchingBracket(tokens []Token, open int) int {
+	depth := 0
+	for i := open; i < len(tokens); i++ {
+		switch tokens[i] {
+		case LeftParen:
+			depth++
+		case RightParen:
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// findNode returns the outermost node in the tree of n that spans sp.
+func findNode(n node, sp Span) (node, bool) {
+	for {
+		if n.span() == sp {
+			return n, true
+		}
+		var children []node
+		switch n := n.(type) {
+		case operatorNode:
+			children = n.operands
+		case callNode:
+			children = n.args
+		}
+
+		found := false
+		for _, c := range children {
+			if csp := c.span(); csp.Start <= sp.Start && sp.End <= csp.End {
+				n, found = c, true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+}
+
+// isBracket checks whether t is a left or right bracket.
+func isBracket(t Token, left bool) bool {
+	b, ok := t.(Bracket)
+	return ok && b.IsLeft() == left
+}
+
+// innermostNode returns the innermost node in the tree of n that contains the rune at pos.
+func innermostNode(n node, pos int) (node, bool) {
+	if sp := n.span(); pos < sp.Start || pos >= sp.End {
+		return nil, false
+	}
+	for {
+		var children []node
+		switch n := n.(type) {
+		case operatorNode:
+			children = n.operands
+		case callNode:
+			children = n.args
+		}
+
+		found := false
+		for _, c := range children {
+			if sp := c.span(); sp.Start <= pos && pos < sp.End {
+				n, found = c, true
+				break
+			}
+		}
+		if !found {
+			return n, true
+		}
+	}
+}
+
+// shiftNode returns a copy of n whose spans are moved by delta.
+func shiftNode(n node, delta int) node {
+	if delta == 0 {
+		return n
+	}
+	shift := func(sp Span) Span {
+		return Span{Start: sp.Start + delta, End: sp.End + delta}
+	}
+	shiftAll := func(nodes []node) []node {
+		res := make([]node, len(nodes))
+		for i, c := range nodes {
+			res[i] = shiftNode(c, delta)
+		}
+		return res
+	}
+
+	switch n := n.(type) {
+	case numberNode:
+		n.sp = shift(n.sp)
+		return n
+	case variableNode:
+		n.sp = shift(n.sp)
+		return n
+	case operatorNode:
+		n.opSpan, n.sp, n.operands = shift(n.opSpan), shift(n.sp), shiftAll(n.operands)
+		return n
+	case callNode:
+		n.fnSpan, n.sp, n.args = shift(n.fnSpan), shift(n.sp), shiftAll(n.args)
+		return n
+	}
+	return n
+}
+
+// newDiagnostic describes an error in an expression with the given number of runes.
+func newDiagnostic(err error, length int) Diagnostic {
+	sp := Span{Start: 0, End: length}
+	switch e := err.(type) {
+	case SyntaxError:
+		sp = Span{Start: e.Position, End: e.Position + utf8.RuneCountInString(e.Token)}
+	case TypeError:
+		sp = e.Span
+	}
+	return Diagnostic{Span: sp, Message: err.Error()}
+}
@@ -0,0 +1,259 @@
+package yamp
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDocument(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		want []Diagnostic
+	}{
+		{
+			name: "valid expressions have no diagnostics",
+			expr: "2x + sqrt(y) * (3 - z)!",
+		},
+		{
+			name: "syntax errors span their token",
+			expr: "1 + 2 * ",
+			want: []Diagnostic{{Span: Span{Start: 7, End: 8}, Message: fmt.Sprintf(errNoRightOperand, "*", 8)}},
+		},
+		{
+			name: "parsing errors are reported",
+			expr: "x ? 1",
+			want: []Diagnostic{{Span: Span{Start: 2, End: 3}, Message: fmt.Sprintf(errUnmatchedCondition, 2)}},
+		},
+		{
+			name: "errors without a position span the whole expression",
+			expr: "  ",
+			want: []Diagnostic{{Span: Span{Start: 0, End: 2}, Message: errEmptyExpression}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDocument(tt.expr)
+			assert.Equal(t, tt.expr, d.String())
+			assert.Equal(t, tt.want, d.Diagnostics())
+		})
+	}
+}
+
+func Test_document_Apply(t *testing.T) {
+	tests := []struct {
+		name     string
+		expr     string
+		edit     Edit
+		wantExpr string
+	}{
+		{"digits extend the number before them", "12 + x", Edit{Span{Start: 2, End: 2}, "3"}, "123 + x"},
+		{"numbers separated by whitespace are joined", "1  + x", Edit{Span{Start: 3, End: 4}, "2"}, "1  2 x"},
+		{"operators are extended", "x < y", Edit{Span{Start: 3, End: 3}, "="}, "x <= y"},
+		{"unary operators become binary", "x - y", Edit{Span{Start: 0, End: 1}, ""}, " - y"},
+		{"brackets can be unbalanced", "(x + 1) * (y - 2)", Edit{Span{Start: 6, End: 7}, ""}, "(x + 1 * (y - 2)"},
+		{"brackets can be balanced again", "(x + 1 * (y - 2)", Edit{Span{Start: 6, End: 6}, ")"}, "(x + 1) * (y - 2)"},
+		{"separators can leave a call", "f(x) + max(1, 2)", Edit{Span{Start: 10, End: 11}, ""}, "f(x) + max1, 2)"},
+		{"functions become variables", "sqrt(2) + 1", Edit{Span{Start: 0, End: 4}, "sq"}, "sq(2) + 1"},
+		{"words become operators", "5 mo 3", Edit{Span{Start: 4, End: 4}, "d"}, "5 mod 3"},
+		{"non-ASCII text is edited by rune", "π * r ^ 2 ≠ 0", Edit{Span{Start: 4, End: 5}, "τ"}, "π * τ ^ 2 ≠ 0"},
+		{"the whole expression can be replaced", "1 + 2", Edit{Span{Start: 0, End: 5}, "x"}, "x"},
+		{"edits can empty the expression", "1 + 2", Edit{Span{Start: 0, End: 5}, ""}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewDocument(tt.expr).Apply(tt.edit)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tt.wantExpr, got.String())
+			assertSameDocument(t, NewDocument(tt.wantExpr).(*document), got.(*document))
+		})
+	}
+}
+
+func Test_document_Apply_errors(t *testing.T) {
+	d := NewDocument("1 + 2")
+	for _, sp := range []Span{{Start: -1, End: 0}, {Start: 3, End: 2}, {Start: 0, End: 6}} {
+		got, err := d.Apply(Edit{Span: sp, Text: "x"})
+		assert.Nil(t, got)
+		assert.EqualError(t, err, fmt.Sprintf(errEditSpan, sp.Start, sp.End, 5))
+	}
+}
+
+func Test_document_Apply_reuse(t *testing.T) {
+	terms := make([]string, 200)
+	for i := range terms {
+		terms[i] = fmt.Sprintf("(x - %d) * sqrt(y + %d)", i, i)
+	}
+	expr := strings.Join(terms, " + ")
+	d := NewDocument(expr).(*document)
+
+	// change "(x - 100)" into "(x - 1000)"
+	pos := strings.Index(expr, "(x - 100)") + len("(x - 100")
+	got, err := d.Apply(Edit{Span: Span{Start: pos, End: pos}, Text: "0"})
+	assert.NoError(t, err)
+	nd := got.(*document)
+	assertSameDocument(t, NewDocument(nd.text).(*document), nd)
+
+	// only the number and its neighbours are tokenized again
+	assert.Less(t, nd.relexed.End-nd.relexed.Start, 10)
+	// every other bracket and call is reused
+	assert.Equal(t, 2*len(terms)-1, nd.reused)
+}
+
+func Test_document_SubexpressionAt(t *testing.T) {
+	vars := Variables{"x": 2}
+	tests := []struct {
+		name string
+		expr string
+		pos  int
+		want Subexpression
+		ok   bool
+	}{
+		{
+			name: "operands are the innermost subexpressions",
+			expr: "1 + x * 3",
+			pos:  4,
+			want: Subexpression{Span: Span{Start: 4, End: 5}, Type: NumericValue, Value: NewNumericValue(2)},
+			ok:   true,
+		},
+		{
+			name: "operators belong to their operation",
+			expr: "1 + x * 3",
+			pos:  6,
+			want: Subexpression{Span: Span{Start: 4, End: 9}, Type: NumericValue, Value: NewNumericValue(6)},
+			ok:   true,
+		},
+		{
+			name: "conditions are boolean",
+			expr: "if(x < 1, 2, 3)",
+			pos:  5,
+			want: Subexpression{Span: Span{Start: 3, End: 8}, Type: BooleanValue, Value: NewBooleanValue(false)},
+			ok:   true,
+		},
+		{
+			name: "variables without values are not evaluated",
+			expr: "x + y",
+			pos:  2,
+			want: Subexpression{Span: Span{Start: 0, End: 5}, Type: NumericValue},
+			ok:   true,
+		},
+		{
+			name: "evaluation errors are reported",
+			expr: "(x - 3)!",
+			pos:  7,
+			want: Subexpression{
+				Span: Span{Start: 0, End: 8},
+				Type: NumericValue,
+				Err:  fmt.Errorf(errFactorialNegativeInt, float64(-1)),
+			},
+			ok: true,
+		},
+		{
+			name: "type errors are reported",
+			expr: "x + (x < 1)",
+			pos:  2,
+			want: Subexpression{
+				Span: Span{Start: 0, End: 11},
+				Err: TypeError{
+					Message: fmt.Sprintf(errOperandType, "+", 2, NumericValue, BooleanValue),
+					Span:    Span{Start: 5, End: 10},
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "brackets around subexpressions are included",
+			expr: "(x + 1) * 2 + if(x, 1, 2)",
+			pos:  9,
+			want: Subexpression{Span: Span{Start: 0, End: 11}, Type: NumericValue, Value: NewNumericValue(6)},
+			ok:   true,
+		},
+		{
+			name: "calls include their closing bracket",
+			expr: "(x + 1) * 2 + if(x > 1, 1, 2)",
+			pos:  15,
+			want: Subexpression{Span: Span{Start: 14, End: 29}, Type: NumericValue, Value: NewNumericValue(1)},
+			ok:   true,
+		},
+		{name: "positions outside of the expression have none", expr: "x + 1 ", pos: 5},
+		{name: "invalid expressions have none", expr: "x + ", pos: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := NewDocument(tt.expr).SubexpressionAt(tt.pos, vars)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_document_Apply_random(t *testing.T) {
+	snippets := []string{
+		"1", "23", ".", "4.5", "x", "y", "π", " ", "  ", "+", "-", "*", "/", "^", "!", "%", "<", "=", "<=", "&&",
+		"?", ":", "(", ")", ",", "sqrt(", "max(", "if(", "mod", "not", "2(x)", "(y+1)", "f(1, 2)",
+	}
+	bases := []string{
+		"",
+		"2x + sqrt(y) * (3 - z)!",
+		"max(1, 2, (x + 1) * 3) mod 4 - if(x < 0, -x, x)",
+		"x > 1 ? (y + 2)(y - 2) : π^2 / 4.5",
+		"1 2 3 + 4 .5",
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for _, base := range bases {
+		d := NewDocument(base).(*document)
+		for n := 0; n < 300; n++ {
+			start := r.Intn(d.length + 1)
+			end := start
+			if r.Intn(3) == 0 {
+				end += r.Intn(d.length - start + 1)
+			}
+			text := ""
+			if r.Intn(4) != 0 {
+				text = snippets[r.Intn(len(snippets))]
+			}
+
+			edit := Edit{Span: Span{Start: start, End: end}, Text: text}
+			got, err := d.Apply(edit)
+			if !assert.NoError(t, err) {
+				return
+			}
+			nd := got.(*document)
+
+			want := []rune(d.text)
+			want = append(append(append([]rune(nil), want[:start]...), []rune(text)...), want[end:]...)
+			if !assert.Equal(t, string(want), nd.text) ||
+				!assertSameDocument(t, NewDocument(nd.text).(*document), nd, "after %+v on %q", edit, d.text) {
+				return
+			}
+			d = nd
+
+			// most edits leave errors, which limit what can be reused, so start over now and then
+			if d.err != nil && r.Intn(3) == 0 {
+				d = NewDocument(base).(*document)
+			}
+		}
+	}
+}
+
+// assertSameDocument checks that an edited document matches one that was parsed from scratch.
+func assertSameDocument(t *testing.T, want, got *document, msgAndArgs ...interface{}) bool {
+	t.Helper()
+	ok := assert.Equal(t, want.length, got.length, msgAndArgs...)
+	ok = ok && assert.Equal(t, utf8.RuneCountInString(got.text), got.length, msgAndArgs...)
+	ok = ok && assert.Equal(t, want.err, got.err, msgAndArgs...)
+	ok = ok && assert.Equal(t, want.root, got.root, msgAndArgs...)
+	if want.lexErr == nil {
+		ok = ok && assert.Equal(t, want.tokens, got.tokens, msgAndArgs...)
+		ok = ok && assert.Equal(t, want.spans, got.spans, msgAndArgs...)
+	}
+	return ok
+}
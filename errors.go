@@ -1,5 +1,7 @@
 package yamp
 
+import "fmt"
+
 const (
 	errNaN                 = "'%s' is not a number"
 	errUnknownSymbol       = "unknown symbol '%s' at index %d"
@@ -10,6 +12,92 @@ const (
 	errEmptyParen          = "cannot allow an empty parentheses on index %d"
 	errNoRightOperand      = "operator '%s' at index %d expects a right operand"
 	errNoLeftOperand       = "operator '%s' at index %d requires a left operand"
+	errUnmatchedCondition  = "the '?' at index %d is missing a matching ':'"
+	errUnmatchedElse       = "the ':' at index %d is missing a matching '?'"
+	errFunctionCall        = "function '%s' at index %d must be followed by '('"
+	errMisplacedSeparator  = "the ',' at index %d must be inside a function call"
+	errEmptyArgument       = "missing function argument at index %d"
+	errArgumentCount       = "function '%s' at index %d expects %s, got %d"
+	errIndexVariable       = "the first argument of '%s' at index %d must be a variable"
+	errVariableArgument    = "the second argument of '%s' at index %d must be a variable"
+	errDerivativeOrder     = "the order of '%s' at index %d must be a non-negative integer, got %s"
+)
+
+const (
+	errEmptyExpression       = "cannot evaluate an empty expression"
+	errMalformedExpression   = "malformed expression"
+	errUnknownOperator       = "unknown operator '%s'"
+	errUnknownFunction       = "unknown function '%s'"
+	errFactorialNegativeInt  = "factorial is undefined for negative integer %v"
+	errDoubleFactorialDomain = "double factorial is only defined for integers greater than or equal to -1, got %v"
+	errOperandType           = "operator '%s' at index %d expects %s operands, got %s"
+	errComparedTypes         = "operator '%s' at index %d cannot compare %s with %s"
+	errConditionType         = "the condition of '?' at index %d must be boolean, got %s"
+	errArgumentType          = "argument %d of '%s' at index %d must be %s, got %s"
+	errResultType            = "expected a %s result, got %s"
+	errUndefinedVariable     = "undefined variable '%s' at index %d"
+	errNoMatchingPiece       = "none of the conditions of '%s' at index %d are satisfied"
+	errIntegerOperand        = "operator '%s' at index %d expects 64-bit integer operands, got %s"
+	errIntegerArgument       = "argument %d of '%s' at index %d must be a 64-bit integer, got %s"
+	errIntegerLiteral        = "number '%s' at index %d is not an integer"
+	errIntegerVariable       = "variable '%s' at index %d must be an integer, got %v"
+	errIntegerModeOperator   = "operator '%s' at index %d is not supported in integer mode"
+	errInt64Overflow         = "'%s' at index %d overflows int64"
+	errIntegerTooLarge       = "the result of '%s' would exceed %d bits"
+	errDivisionByZero        = "integer division by zero"
+	errNegativeExponent      = "integer exponents must not be negative, got %s"
+	errNegativeShift         = "shift counts must not be negative, got %s"
+	errPopcountNegative      = "popcount of negative %s is undefined for big integers"
+	errClzWidth              = "clz is undefined for big integers, which have no fixed width"
+	errCompileNumberMode     = "only FloatMode expressions can be compiled"
+	errBranchTypes           = "the branches of '%s' at index %d must have the same type, got %s and %s"
+	errSlotCount             = "the program has %d variables, got %d values"
+	errBytecodeFormat        = "invalid bytecode: %s"
+	errMissingColumn         = "missing column for variable '%s'"
+	errColumnLength          = "column '%s' has %d rows, expected %d"
+	errNaNResult             = "the result is NaN"
+	errEditSpan              = "cannot apply an edit at %d-%d to an expression of length %d"
+	errEquation              = "the '=' at index %d can only appear at the top of an equation passed to Solve"
+	errNotDifferentiable     = "cannot differentiate '%s' at index %d with respect to '%s'"
+	errUnboundVariable       = "no value is given for variable '%s'"
+	errIdentity              = "the equation holds for every value of '%s'"
+	errNoOptimizedVariables  = "at least one variable must be optimized"
+	errOptimizedTwice        = "variable '%s' is optimized twice"
+	errBoundsVariable        = "bounds are given for '%s', which is not optimized"
+	errMethodDimensions      = "%s optimizes a single variable, got %d"
+	errOptimizeMethod        = "unknown optimization method %d"
+	errSeriesBound           = "the bounds of '%s' at index %d must be integers between -2^53 and 2^53, got %v"
+	errSeriesTerms           = "'%s' at index %d has %v terms, more than %d"
+	errInfiniteProduct       = "'%s' at index %d cannot multiply infinitely many terms"
+	errSeriesDiverges        = "the infinite '%s' at index %d does not converge"
+	errSeriesUnsettled       = "the infinite '%s' at index %d did not settle within %d terms, as it converges too slowly or diverges"
+	errSeriesTerm            = "term %v of the infinite '%s' at index %d is %v"
+	errBytecodeFunction      = "function '%s' at index %d is not supported in bytecode"
+	errUnsupportedIntegral   = "unsupported integral: cannot integrate '%s' at index %d with respect to '%s'"
+	errIntegralLogarithm     = "unsupported integral: integrating '%s' at index %d with respect to '%s' needs a logarithm"
+	errLimitDirection        = "unknown limit direction %d"
+	errLimitSide             = "%v cannot be approached %s"
+	errLimitUndefined        = "the expression is undefined near %v %s"
+	errLimitSides            = "the limits at %v from below and above differ: %v and %v"
+	errSeriesOrder           = "the order of a series must not be negative, got %d"
+	errSeriesPoint           = "a series cannot be expanded around %v"
+	errSeriesUndefined       = "derivative %d of the expression is undefined at %v"
+	errSeriesSize            = "the derivatives of the expression grow too large to expand it beyond order %d"
+	errNoUnknowns            = "at least one variable must be solved for"
+	errSolvedTwice           = "variable '%s' is solved for twice"
+	errNonlinear             = "the equation at index %d is not linear in '%s'"
+	errLinearCoefficient     = "the coefficients of the equation at index %d are not finite"
+	errInconsistent          = "the system of equations has no solution"
+	errLinearInexact         = "'%s' at index %d cannot be computed exactly"
+	errODEMethod             = "unknown ODE method %d"
+	errODEEquation           = "the equation at index %d must be of the form \"y' = expression\""
+	errODETime               = "'%s' is the time and cannot have an equation"
+	errODEVariable           = "variable '%s' has two equations"
+	errODEInitial            = "no initial value is given for '%s'"
+	errODESteps              = "the integration took %d steps and stopped at t = %v"
+	errODEStep               = "the step size became too small at t = %v"
+	errODENotFinite          = "the solution is not finite at t = %v"
+	errODENewton             = "the implicit method did not converge at t = %v"
 )
 
 var _ error = (*SyntaxError)(nil)
@@ -24,3 +112,44 @@ type SyntaxError struct {
 func (s SyntaxError) Error() string {
 	return s.Message
 }
+
+var _ error = (*TypeError)(nil)
+
+// TypeError stores an error caused by a value of an unexpected type.
+type TypeError struct {
+	Message string
+	Span    Span
+}
+
+func (e TypeError) Error() string {
+	return e.Message
+}
+
+var _ error = (*RowError)(nil)
+
+// RowError stores an error that occurred while evaluating a row of a batch.
+type RowError struct {
+	Row int
+	Err error
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("row %d: %v", e.Row, e.Err)
+}
+
+// Unwrap returns the error of the row.
+func (e RowError) Unwrap() error {
+	return e.Err
+}
+
+var _ error = (RowErrors)(nil)
+
+// RowErrors stores the errors of every failed row of a batch, ordered by row.
+type RowErrors []RowError
+
+func (e RowErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%v (and %d more rows)", e[0], len(e)-1)
+}
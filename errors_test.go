@@ -30,3 +30,8 @@ func TestSyntaxError_Error(t *testing.T) {
 		})
 	}
 }
+
+func TestTypeError_Error(t *testing.T) {
+	e := TypeError{Message: "abc", Span: Span{Start: 1, End: 2}}
+	assert.Equal(t, "abc", e.Error())
+}
@@ -0,0 +1,455 @@
+package yamp
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// EvalOption configures how an expression is evaluated.
+type EvalOption func(*evalOptions)
+
+type evalOptions struct {
+	reg         TokenRegistry
+	percentMode percentMode
+	moduloMode  moduloMode
+	numberMode  numberMode
+}
+
+func newEvalOptions(opts ...EvalOption) evalOptions {
+	o := evalOptions{
+		reg:         defaultTokenRegistry,
+		percentMode: SpreadsheetPercent,
+		moduloMode:  FlooredModulo,
+		numberMode:  FloatMode,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithTokenRegistry sets the registry used to tokenize the expression. The default registry
+// recognizes the operators in DefaultOperators and the functions in DefaultFunctions.
+func WithTokenRegistry(reg TokenRegistry) EvalOption {
+	return func(o *evalOptions) {
+		o.reg = reg
+	}
+}
+
+type percentMode int
+
+// Ways of evaluating the '%' operator
+const (
+	// SpreadsheetPercent evaluates x% as x/100 everywhere, so 200 + 10% is 200.1.
+	SpreadsheetPercent percentMode = iota + 1
+	// CalculatorPercent evaluates a percentage on the right of '+' or '-' relative to the left
+	// operand like handheld calculators do, so 200 + 10% is 220. Elsewhere, x% is x/100.
+	CalculatorPercent
+)
+
+// WithPercentMode sets how the '%' operator is evaluated. The default is SpreadsheetPercent.
+func WithPercentMode(mode percentMode) EvalOption {
+	return func(o *evalOptions) {
+		o.percentMode = mode
+	}
+}
+
+type moduloMode int
+
+// Sign conventions of the 'mod' and '//' operators. In every mode, a == b*(a // b) + (a mod b).
+const (
+	// FlooredModulo rounds the quotient towards negative infinity, so the result of 'mod' has the
+	// sign of the divisor: -7 mod 3 is 2 and 7 mod -3 is -2.
+	FlooredModulo moduloMode = iota + 1
+	// TruncatedModulo rounds the quotient towards zero, so the result of 'mod' has the sign of the
+	// dividend: -7 mod 3 is -1 and 7 mod -3 is 1. This matches 'rem'.
+	TruncatedModulo
+	// EuclideanModulo picks the quotient that makes the result of 'mod' non-negative:
+	// -7 mod 3 is 2 and 7 mod -3 is 1.
+	EuclideanModulo
+)
+
+// WithModuloMode sets the sign convention of the 'mod' and '//' operators. The default is FlooredModulo.
+func WithModuloMode(mode moduloMode) EvalOption {
+	return func(o *evalOptions) {
+		o.moduloMode = mode
+	}
+}
+
+type numberMode int
+
+// Ways of representing numbers during evaluation
+const (
+	// FloatMode evaluates numbers as float64. Bitwise operators, popcount and clz accept operands with
+	// integral values that fit in an int64.
+	FloatMode numberMode = iota + 1
+	// Int64Mode evaluates numbers as 64-bit integers that wrap around on overflow like machine registers.
+	// Literals and variables must be integers, '/' truncates towards zero, and '%' is not supported.
+	Int64Mode
+	// BigIntMode evaluates numbers as arbitrary-precision integers. It follows the rules of Int64Mode
+	// except that results never wrap around, and clz is not supported since integers have no fixed width.
+	BigIntMode
+)
+
+// WithNumberMode sets how numbers are represented during evaluation. The default is FloatMode.
+func WithNumberMode(mode numberMode) EvalOption {
+	return func(o *evalOptions) {
+		o.numberMode = mode
+	}
+}
+
+// evaluator evaluates syntax trees.
+type evaluator struct {
+	evalOptions
+	vars Variables
+}
+
+func newEvaluator(vars Variables, opts evalOptions) *evaluator {
+	return &evaluator{
+		evalOptions: opts,
+		vars:        vars,
+	}
+}
+
+func (ev *evaluator) eval(n node) (res Value, err error) {
+	switch n := n.(type) {
+	case numberNode:
+		if ev.numberMode != FloatMode {
+			return ev.integerLiteral(n)
+		}
+		return NewNumericValue(n.value), nil
+	case variableNode:
+		v, ok := ev.vars[n.name]
+		if !ok {
+			return nil, fmt.Errorf(errUndefinedVariable, n.name, n.sp.Start)
+		}
+		if ev.numberMode != FloatMode {
+			return ev.integerVariable(n, v)
+		}
+		return NewNumericValue(v), nil
+	case operatorNode:
+		return ev.evalOperator(n)
+	case callNode:
+		return ev.evalCall(n)
+	}
+	return nil, errors.New(errMalformedExpression)
+}
+
+// evalOperator evaluates an operator node. The ternary conditional, '&&' and '||' only evaluate
+// the operands they need.
+func (ev *evaluator) evalOperator(n operatorNode) (res Value, err error) {
+	switch n.op.Type() {
+	case Equation:
+		return nil, equationError(n)
+	case ConditionalElse:
+		var cond Value
+		if cond, err = ev.eval(n.operands[0]); err != nil {
+			return nil, err
+		}
+		if cond.Type() != BooleanValue {
+			return nil, TypeError{
+				Message: fmt.Sprintf(errConditionType, n.opSpan.Start, cond.Type()),
+				Span:    n.operands[0].span(),
+			}
+		}
+		if cond.Bool() {
+			return ev.eval(n.operands[1])
+		}
+		return ev.eval(n.operands[2])
+	case And, Or:
+		for _, o := range n.operands {
+			var v Value
+			if v, err = ev.eval(o); err != nil {
+				return nil, err
+			}
+			if v.Type() != BooleanValue {
+				return nil, operandTypeError(n, o, BooleanValue, v.Type())
+			}
+			// "false && x" is false and "true || x" is true regardless of x
+			if v.Bool() == (n.op.Type() == Or) {
+				return v, nil
+			}
+		}
+		return NewBooleanValue(n.op.Type() == And), nil
+	case Percent:
+		if ev.numberMode != FloatMode {
+			return nil, TypeError{
+				Message: fmt.Sprintf(errIntegerModeOperator, n.op, n.opSpan.Start),
+				Span:    n.opSpan,
+			}
+		}
+	case Addition, Subtraction:
+		if ev.percentMode == CalculatorPercent && ev.numberMode == FloatMode && isOperatorNodeOf(n.operands[1], Percent) {
+			return ev.evalRelativePercent(n)
+		}
+	}
+
+	args := make([]Value, len(n.operands))
+	for i, o := range n.operands {
+		if args[i], err = ev.eval(o); err != nil {
+			return nil, err
+		}
+	}
+	if err = checkOperandTypes(n, args); err != nil {
+		return nil, err
+	}
+	return ev.applyOperator(n.op, args...)
+}
+
+// evalRelativePercent evaluates "a + b%" and "a - b%" as adding or subtracting b percent of a.
+func (ev *evaluator) evalRelativePercent(n operatorNode) (res Value, err error) {
+	pct := n.operands[1].(operatorNode)
+
+	args := make([]Value, 2)
+	if args[0], err = ev.eval(n.operands[0]); err != nil {
+		return nil, err
+	}
+	if args[1], err = ev.eval(pct.operands[0]); err != nil {
+		return nil, err
+	}
+	if err = checkOperandTypes(n, args); err != nil {
+		return nil, err
+	}
+
+	a, b := args[0].Number(), args[1].Number()
+	if n.op.Type() == Subtraction {
+		b = -b
+	}
+	return NewNumericValue(a + a*b/100), nil
+}
+
+// equationError reports an equation that is evaluated instead of solved.
+func equationError(n operatorNode) error {
+	return SyntaxError{
+		Message:  fmt.Sprintf(errEquation, n.opSpan.Start),
+		Token:    n.op.String(),
+		Position: n.opSpan.Start,
+	}
+}
+
+func isOperatorNodeOf(n node, typ opType) bool {
+	o, ok := n.(operatorNode)
+	return ok && o.op.Type() == typ
+}
+
+// checkOperandTypes checks whether the operands are of the type the operator expects.
+func checkOperandTypes(n operatorNode, args []Value) error {
+	want := NumericValue
+	switch n.op.Type() {
+	case Equal, NotEqual:
+		if args[0].Type() != args[1].Type() {
+			return TypeError{
+				Message: fmt.Sprintf(errComparedTypes, n.op, n.opSpan.Start, args[0].Type(), args[1].Type()),
+				Span:    n.operands[1].span(),
+			}
+		}
+		return nil
+	case Not:
+		want = BooleanValue
+	}
+
+	for i, v := range args {
+		if v.Type() != want && !(want == NumericValue && v.Type() == IntegerValue) {
+			return operandTypeError(n, n.operands[i], want, v.Type())
+		}
+	}
+
+	// bitwise operators work on the two's complement representation of int64 operands in FloatMode
+	if isBitwiseOperator(n.op.Type()) {
+		for i, v := range args {
+			if v.Type() == NumericValue && !fitsInt64(v.Number()) {
+				return TypeError{
+					Message: fmt.Sprintf(errIntegerOperand, n.op, n.opSpan.Start, v),
+					Span:    n.operands[i].span(),
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func operandTypeError(n operatorNode, operand node, want, got valueType) error {
+	return TypeError{
+		Message: fmt.Sprintf(errOperandType, n.op, n.opSpan.Start, want, got),
+		Span:    operand.span(),
+	}
+}
+
+// evalCall evaluates a function call. Conditional functions only evaluate the arguments they need.
+func (ev *evaluator) evalCall(n callNode) (res Value, err error) {
+	switch n.fn.Type() {
+	case If:
+		var cond bool
+		if cond, err = ev.evalCondition(n, 0); err != nil {
+			return nil, err
+		}
+		if cond {
+			return ev.eval(n.args[1])
+		}
+		return ev.eval(n.args[2])
+	case Sum, Product:
+		return ev.evalSeries(n)
+	case Diff, Integral:
+		var e node
+		if e, err = expandCalculus(n, ev.evalOptions); err != nil {
+			return nil, err
+		}
+		return ev.eval(e)
+	case Piecewise:
+		for i := 0; i+1 < len(n.args); i += 2 {
+			var cond bool
+			if cond, err = ev.evalCondition(n, i); err != nil {
+				return nil, err
+			}
+			if cond {
+				return ev.eval(n.args[i+1])
+			}
+		}
+		// an odd number of arguments ends with a default value
+		if len(n.args)%2 == 1 {
+			return ev.eval(n.args[len(n.args)-1])
+		}
+		return nil, fmt.Errorf(errNoMatchingPiece, n.fn, n.fnSpan.Start)
+	case Popcount, Clz:
+		return ev.evalBitCount(n)
+	}
+	return nil, fmt.Errorf(errUnknownFunction, n.fn)
+}
+
+// evalCondition evaluates the i-th argument of a function call, which must be boolean.
+func (ev *evaluator) evalCondition(n callNode, i int) (res bool, err error) {
+	v, err := ev.eval(n.args[i])
+	if err != nil {
+		return false, err
+	}
+	if v.Type() != BooleanValue {
+		return false, TypeError{
+			Message: fmt.Sprintf(errArgumentType, i+1, n.fn, n.fnSpan.Start, BooleanValue, v.Type()),
+			Span:    n.args[i].span(),
+		}
+	}
+	return v.Bool(), nil
+}
+
+// applyOperator applies op to its operands, which are given in the order they appear in the expression.
+// The operands are expected to be of the types the operator accepts.
+func (ev *evaluator) applyOperator(op Operator, args ...Value) (res Value, err error) {
+	if len(args) > 0 && args[0].Type() == IntegerValue {
+		return ev.applyIntegerOperator(op, args...)
+	}
+
+	switch op.Type() {
+	case Less, LessEqual, Greater, GreaterEqual:
+		return NewBooleanValue(compareFloat(op.Type(), args[0].Number(), args[1].Number())), nil
+	case Equal:
+		return NewBooleanValue(equal(args[0], args[1])), nil
+	case NotEqual:
+		return NewBooleanValue(!equal(args[0], args[1])), nil
+	case Not:
+		return NewBooleanValue(!args[0].Bool()), nil
+	case Plus:
+		return args[0], nil
+	}
+
+	var a, b, num float64
+	a = args[0].Number()
+	if len(args) > 1 {
+		b = args[1].Number()
+	}
+	if num, err = applyFloat(op, a, b, ev.moduloMode); err != nil {
+		return nil, err
+	}
+	return NewNumericValue(num), nil
+}
+
+// applyFloat applies a numeric operator to float operands. Unary operators ignore b.
+func applyFloat(op Operator, a, b float64, mode moduloMode) (res float64, err error) {
+	switch op.Type() {
+	case Addition:
+		return a + b, nil
+	case Subtraction:
+		return a - b, nil
+	case Multiplication:
+		return a * b, nil
+	case Division:
+		return a / b, nil
+	case Power:
+		return math.Pow(a, b), nil
+	case Plus:
+		return a, nil
+	case Minus:
+		return -a, nil
+	case Percent:
+		return a / 100, nil
+	case Modulo:
+		_, mod := divMod(a, b, mode)
+		return mod, nil
+	case FloorDivision:
+		div, _ := divMod(a, b, mode)
+		return div, nil
+	case Remainder:
+		return math.Mod(a, b), nil
+	case Factorial:
+		return factorial(a)
+	case DoubleFactorial:
+		return doubleFactorial(a)
+	case BitwiseAnd, BitwiseOr, BitwiseXor, BitwiseNot, ShiftLeft, ShiftRight:
+		var z int64
+		if z, err = applyBitwise64(op, int64(a), int64(b)); err != nil {
+			return 0, err
+		}
+		return float64(z), nil
+	}
+	return 0, fmt.Errorf(errUnknownOperator, op.String())
+}
+
+// compareFloat applies a comparison operator to float operands.
+func compareFloat(typ opType, a, b float64) bool {
+	switch typ {
+	case Less:
+		return a < b
+	case LessEqual:
+		return a <= b
+	case Greater:
+		return a > b
+	case GreaterEqual:
+		return a >= b
+	case Equal:
+		return a == b
+	}
+	return a != b
+}
+
+// divMod divides a by b into an integer quotient and a remainder following the given sign convention,
+// such that a == b*div + mod.
+func divMod(a, b float64, mode moduloMode) (div, mod float64) {
+	// math.Mod truncates, and is exact unlike a - b*div
+	mod = math.Mod(a, b)
+	if mod != 0 {
+		switch mode {
+		case FlooredModulo:
+			if (mod < 0) != (b < 0) {
+				mod += b
+			}
+		case EuclideanModulo:
+			if mod < 0 {
+				mod += math.Abs(b)
+			}
+		}
+	}
+
+	div = math.Round((a - mod) / b)
+	return
+}
+
+// equal checks whether two values of the same type are equal.
+func equal(a, b Value) bool {
+	switch a.Type() {
+	case BooleanValue:
+		return a.Bool() == b.Bool()
+	case IntegerValue:
+		return a.Int().Cmp(b.Int()) == 0
+	}
+	return a.Number() == b.Number()
+}
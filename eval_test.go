@@ -0,0 +1,177 @@
+package yamp
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_evaluator_eval(t *testing.T) {
+	tests := []struct {
+		name    string
+		rpn     []Token
+		vars    Variables
+		wantRes Value
+		wantErr error
+	}{
+		{
+			name:    "a binary operator consumes two operands",
+			rpn:     []Token{NewNumber("6"), NewNumber("3"), NewOperator(Division)},
+			wantRes: NewNumericValue(2),
+		},
+		{
+			name:    "the ternary conditional consumes three operands",
+			rpn:     []Token{NewNumber("1"), NewNumber("2"), NewOperator(Less), NewNumber("3"), NewNumber("4"), NewOperator(ConditionalElse)},
+			wantRes: NewNumericValue(3),
+		},
+		{
+			name:    "variables are resolved from the given values",
+			rpn:     []Token{NewVariable("x"), NewNumber("2"), NewOperator(Multiplication)},
+			vars:    Variables{"x": 4},
+			wantRes: NewNumericValue(8),
+		},
+		{
+			name:    "undefined variables produce an error",
+			rpn:     []Token{NewVariable("x")},
+			wantErr: fmt.Errorf(errUndefinedVariable, "x", 0),
+		},
+		{
+			name:    "division by zero follows IEEE 754",
+			rpn:     []Token{NewNumber("1"), NewNumber("0"), NewOperator(Division)},
+			wantRes: NewNumericValue(math.Inf(1)),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := parse(withSpans(tt.rpn...))
+			assert.NoError(t, err)
+
+			gotRes, err := newEvaluator(tt.vars, newEvalOptions()).eval(root)
+			if tt.wantErr != nil {
+				assert.EqualError(t, err, tt.wantErr.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantRes, gotRes)
+		})
+	}
+}
+
+func Test_evaluator_percent(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		mode percentMode
+		want float64
+	}{
+		{"a percentage is divided by 100", "50%", SpreadsheetPercent, 0.5},
+		{"a percentage binds tighter than a power", "2^50%", SpreadsheetPercent, math.Sqrt2},
+		{"a percentage is absolute on the right of '+' in spreadsheet mode", "200 + 10%", SpreadsheetPercent, 200.1},
+		{"a percentage is relative on the right of '+' in calculator mode", "200 + 10%", CalculatorPercent, 220},
+		{"a percentage is relative on the right of '-' in calculator mode", "200 - 10%", CalculatorPercent, 180},
+		{"a percentage is absolute on the right of '*' in calculator mode", "200 * 10%", CalculatorPercent, 20},
+		{"a percentage is absolute on the left of '+' in calculator mode", "10% + 200", CalculatorPercent, 200.1},
+		{"only a direct percentage operand is relative in calculator mode", "200 + 10% * 2", CalculatorPercent, 200.2},
+		{"the left operand can be any expression in calculator mode", "(100 + 100) + 5% + 5%", CalculatorPercent, 220.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewExpression(tt.expr).Evaluate(WithPercentMode(tt.mode))
+			assert.NoError(t, err)
+			assert.InDelta(t, tt.want, got, 1e-9)
+		})
+	}
+}
+
+func Test_evaluator_percent_defaultMode(t *testing.T) {
+	got, err := NewExpression("200 + 10%").Evaluate()
+	assert.NoError(t, err)
+	assert.InDelta(t, 200.1, got, 1e-9)
+}
+
+func Test_evaluator_percent_typeError(t *testing.T) {
+	_, err := NewExpression("(1 < 2) + 10%").Evaluate(WithPercentMode(CalculatorPercent))
+	assert.Equal(t, TypeError{
+		Message: fmt.Sprintf(errOperandType, "+", 8, NumericValue, BooleanValue),
+		Span:    Span{Start: 1, End: 6},
+	}, err)
+}
+
+func Test_divMod(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    float64
+		mode    moduloMode
+		wantDiv float64
+		wantMod float64
+	}{
+		{"floored division of positive operands", 7, 3, FlooredModulo, 2, 1},
+		{"floored division of a negative dividend", -7, 3, FlooredModulo, -3, 2},
+		{"floored division of a negative divisor", 7, -3, FlooredModulo, -3, -2},
+		{"floored division of negative operands", -7, -3, FlooredModulo, 2, -1},
+		{"truncated division of positive operands", 7, 3, TruncatedModulo, 2, 1},
+		{"truncated division of a negative dividend", -7, 3, TruncatedModulo, -2, -1},
+		{"truncated division of a negative divisor", 7, -3, TruncatedModulo, -2, 1},
+		{"truncated division of negative operands", -7, -3, TruncatedModulo, 2, -1},
+		{"euclidean division of positive operands", 7, 3, EuclideanModulo, 2, 1},
+		{"euclidean division of a negative dividend", -7, 3, EuclideanModulo, -3, 2},
+		{"euclidean division of a negative divisor", 7, -3, EuclideanModulo, -2, 1},
+		{"euclidean division of negative operands", -7, -3, EuclideanModulo, 3, 2},
+		{"exact division has no remainder", -6, 3, FlooredModulo, -2, 0},
+		{"non-integer operands are supported", 5.5, 2, FlooredModulo, 2, 1.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			div, mod := divMod(tt.a, tt.b, tt.mode)
+			assert.Equal(t, tt.wantDiv, div)
+			assert.Equal(t, tt.wantMod, mod)
+			assert.Equal(t, tt.a, tt.b*div+mod)
+		})
+	}
+}
+
+func Test_divMod_byZero(t *testing.T) {
+	div, mod := divMod(1, 0, FlooredModulo)
+	assert.True(t, math.IsNaN(div))
+	assert.True(t, math.IsNaN(mod))
+}
+
+func Test_evaluator_modulo(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		opts []EvalOption
+		want float64
+	}{
+		{"'mod' is floored by default", "-7 mod 3", nil, 2},
+		{"'//' is floored by default", "-7 // 3", nil, -3},
+		{"'mod' follows the selected mode", "-7 mod 3", []EvalOption{WithModuloMode(TruncatedModulo)}, -1},
+		{"'//' follows the selected mode", "7 // -3", []EvalOption{WithModuloMode(EuclideanModulo)}, -2},
+		{"'rem' always takes the sign of the dividend", "-7 rem 3", []EvalOption{WithModuloMode(EuclideanModulo)}, -1},
+		{"'mod' has the same precedence as '*'", "2 * 7 mod 4", nil, 2},
+		{"'//' is not mistaken for two divisions", "9 // 2 / 2", nil, 2},
+		{"'%' is a percentage by default", "50 % 3", nil, 1.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewExpression(tt.expr).Evaluate(tt.opts...)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_evaluator_moduloRegistry(t *testing.T) {
+	ops := DefaultOperators()
+	ops["%"] = []Operator{NewOperator(Modulo)}
+	reg := NewTokenRegistry(ops, DefaultFunctions())
+
+	got, err := NewExpression("-7 % 3").Evaluate(WithTokenRegistry(reg))
+	assert.NoError(t, err)
+	assert.Equal(t, 2.0, got)
+
+	_, err = NewExpression("50%").Evaluate(WithTokenRegistry(reg))
+	assert.EqualError(t, err, fmt.Sprintf(errNoRightOperand, "%", 3))
+}
@@ -1,9 +1,17 @@
 package yamp
 
+import "fmt"
+
 // Expression represents a mathematical expression
 type Expression interface {
-	// Evaluate evaluates the expression into a result.
-	Evaluate() (res float64, err error)
+	// Evaluate evaluates the expression into a numerical result.
+	Evaluate(opts ...EvalOption) (res float64, err error)
+	// EvaluateValue evaluates the expression into a typed result, which is either numeric or boolean.
+	EvaluateValue(opts ...EvalOption) (res Value, err error)
+	// EvaluateWith is like Evaluate, but resolves variables from vars.
+	EvaluateWith(vars Variables, opts ...EvalOption) (res float64, err error)
+	// EvaluateValueWith is like EvaluateValue, but resolves variables from vars.
+	EvaluateValueWith(vars Variables, opts ...EvalOption) (res Value, err error)
 	String() string
 }
 
@@ -20,33 +28,92 @@ func NewExpression(expr string) Expression {
 }
 
 // Evaluate implements the Expression interface.
-func (e *expression) Evaluate() (res float64, err error) {
-	t := NewTokenizer()
+func (e *expression) Evaluate(opts ...EvalOption) (res float64, err error) {
+	return e.EvaluateWith(nil, opts...)
+}
+
+// EvaluateValue implements the Expression interface.
+func (e *expression) EvaluateValue(opts ...EvalOption) (res Value, err error) {
+	return e.EvaluateValueWith(nil, opts...)
+}
+
+// EvaluateWith implements the Expression interface.
+func (e *expression) EvaluateWith(vars Variables, opts ...EvalOption) (res float64, err error) {
+	o := newEvalOptions(opts...)
+
+	root, err := e.parse(o.reg)
+	if err != nil {
+		return 0, err
+	}
 
-	tokens, err := t.Tokenize(e.expr)
+	v, err := newEvaluator(vars, o).eval(root)
 	if err != nil {
 		return 0, err
 	}
 
-	rpn := e.toRPN(tokens)
-	return e.eval(rpn)
+	if v.Type() == BooleanValue {
+		return 0, TypeError{
+			Message: fmt.Sprintf(errResultType, NumericValue, v.Type()),
+			Span:    root.span(),
+		}
+	}
+	return v.Number(), nil
+}
+
+// EvaluateValueWith implements the Expression interface.
+func (e *expression) EvaluateValueWith(vars Variables, opts ...EvalOption) (res Value, err error) {
+	o := newEvalOptions(opts...)
+
+	root, err := e.parse(o.reg)
+	if err != nil {
+		return nil, err
+	}
+	return newEvaluator(vars, o).eval(root)
+}
+
+// parse tokenizes the expression using reg and builds its syntax tree.
+func (e *expression) parse(reg TokenRegistry) (root node, err error) {
+	t := newTokenizer(reg)
+
+	tokens, spans, err := t.tokenize(e.expr)
+	if err != nil {
+		return nil, err
+	}
+
+	infix := make([]spannedToken, len(tokens))
+	for i := range tokens {
+		infix[i] = spannedToken{Token: tokens[i], span: spans[i]}
+	}
+
+	rpn, err := e.toRPN(infix)
+	if err != nil {
+		return nil, err
+	}
+	return parse(rpn)
+}
+
+// spannedToken is a token along with its location in the expression.
+type spannedToken struct {
+	Token
+	span Span
+	argc int // number of arguments, for function calls in reverse polish notation
 }
 
 type tokenStack struct {
-	ts []Token
+	ts []spannedToken
 }
 
-func (s tokenStack) top() Token {
+func (s *tokenStack) top() spannedToken {
 	if len(s.ts) == 0 {
-		return nil
+		return spannedToken{}
 	}
 
 	return s.ts[len(s.ts)-1]
 }
 
-func (s tokenStack) pop() Token {
+func (s *tokenStack) pop() spannedToken {
 	if len(s.ts) == 0 {
-		return nil
+		return spannedToken{}
 	}
 
 	t := s.top()
@@ -55,20 +122,146 @@ func (s tokenStack) pop() Token {
 	return t
 }
 
-func (s tokenStack) push(t Token) {
+func (s *tokenStack) push(t spannedToken) {
 	s.ts = append(s.ts, t)
 }
 
-func (s tokenStack) len() int {
+func (s *tokenStack) len() int {
 	return len(s.ts)
 }
 
-func (e *expression) toRPN(tokens []Token) (rpn []Token) {
+// toRPN converts infix tokens into reverse polish notation using the shunting-yard algorithm.
+// The tokens are expected to be produced by a Tokenizer without errors.
+//
+// The ternary conditional a ? b : c is emitted as a single ConditionalElse operator that takes
+// three operands, spanning the '?' it originated from. Functions are emitted after their arguments,
+// along with the number of arguments they were called with.
+func (e *expression) toRPN(tokens []spannedToken) (rpn []spannedToken, err error) {
+	var ops tokenStack
+	var argc []int // argument counts of the function calls being parsed
+
+	for i, tok := range tokens {
+		switch t := tok.Token.(type) {
+		case Number, Variable, subtree:
+			rpn = append(rpn, tok)
+		case Function:
+			ops.push(tok)
+		case separator:
+			for ops.len() > 0 {
+				if b, ok := ops.top().Token.(Bracket); ok && b.IsLeft() {
+					break
+				}
+				if err = checkUnmatchedCondition(ops.top()); err != nil {
+					return nil, err
+				}
+				rpn = append(rpn, ops.pop())
+			}
+			argc[len(argc)-1]++
+		case Operator:
+			// prefix operators apply to what comes after them, so nothing can be popped yet.
+			if IsUnaryOp(t) && IsRightAssocOp(t) {
+				ops.push(tok)
+				continue
+			}
+
+			// ':' closes the innermost '?', much like a right parenthesis.
+			if t.Type() == ConditionalElse {
+				for ops.len() > 0 && !isOperatorOf(ops.top().Token, Conditional) {
+					if b, ok := ops.top().Token.(Bracket); ok && b.IsLeft() {
+						break
+					}
+					rpn = append(rpn, ops.pop())
+				}
+				if !isOperatorOf(ops.top().Token, Conditional) {
+					return nil, SyntaxError{
+						Message:  fmt.Sprintf(errUnmatchedElse, tok.span.Start),
+						Token:    t.String(),
+						Position: tok.span.Start,
+					}
+				}
+				cond := ops.pop()
+				ops.push(spannedToken{Token: t, span: cond.span})
+				continue
+			}
+
+			for ops.len() > 0 {
+				top, ok := ops.top().Token.(Operator)
+				if !ok || top.Type() == Conditional || !takesPrecedence(top, t) {
+					break
+				}
+				rpn = append(rpn, ops.pop())
+			}
+
+			// postfix operators already have their operand in the output.
+			if IsUnaryOp(t) {
+				rpn = append(rpn, tok)
+			} else {
+				ops.push(tok)
+			}
+		case Bracket:
+			if t.IsLeft() {
+				if i > 0 {
+					if _, ok := tokens[i-1].Token.(Function); ok {
+						argc = append(argc, 1)
+					}
+				}
+				ops.push(tok)
+				continue
+			}
+
+			for ops.len() > 0 {
+				if b, ok := ops.top().Token.(Bracket); ok && b.IsLeft() {
+					break
+				}
+				if err = checkUnmatchedCondition(ops.top()); err != nil {
+					return nil, err
+				}
+				rpn = append(rpn, ops.pop())
+			}
+			ops.pop()
+
+			if _, ok := ops.top().Token.(Function); ok {
+				fn := ops.pop()
+				fn.argc = argc[len(argc)-1]
+				argc = argc[:len(argc)-1]
+				rpn = append(rpn, fn)
+			}
+		}
+	}
+
+	for ops.len() > 0 {
+		if err = checkUnmatchedCondition(ops.top()); err != nil {
+			return nil, err
+		}
+		rpn = append(rpn, ops.pop())
+	}
 	return
 }
 
-func (e *expression) eval(rpn []Token) (res float64, err error) {
-	return
+// takesPrecedence checks whether the operator top, which is already on the operator stack,
+// must be applied before the incoming operator op.
+func takesPrecedence(top, op Operator) bool {
+	if top.Precedence() != op.Precedence() {
+		return top.Precedence() > op.Precedence()
+	}
+	return IsLeftAssocOp(op)
+}
+
+func isOperatorOf(t Token, typ opType) bool {
+	op, ok := t.(Operator)
+	return ok && op.Type() == typ
+}
+
+// checkUnmatchedCondition returns an error if tok is a '?' that was never closed by a ':'.
+func checkUnmatchedCondition(tok spannedToken) error {
+	if !isOperatorOf(tok.Token, Conditional) {
+		return nil
+	}
+	return SyntaxError{
+		Message:  fmt.Sprintf(errUnmatchedCondition, tok.span.Start),
+		Token:    tok.String(),
+		Position: tok.span.Start,
+	}
 }
 
 func (e *expression) String() string {
@@ -0,0 +1,342 @@
+package yamp
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_expression_Evaluate(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantRes float64
+		wantErr error
+	}{
+		{"a single number evaluates to itself", "56", 56, nil},
+		{"addition and subtraction are left associative", "10 - 4 + 2", 8, nil},
+		{"multiplication binds tighter than addition", "2 + 3 * 4", 14, nil},
+		{"parentheses override precedence", "(2 + 3) * 4", 20, nil},
+		{"implicit multiplication is evaluated", "(2)(3)4", 24, nil},
+		{"division is left associative", "16 / 4 / 2", 2, nil},
+		{"powers are right associative", "2 ^ 3 ^ 2", 512, nil},
+		{"a unary minus binds looser than a power", "-2 ^ 2", -4, nil},
+		{"a unary minus is allowed in an exponent", "2 ^ -1", 0.5, nil},
+		{"unary signs can be chained", "5 +- -3", 8, nil},
+		{"factorial binds tighter than a unary minus", "-3!", -6, nil},
+		{"factorial binds tighter than a power", "2 ^ 3!", 64, nil},
+		{"factorial can be applied to a parenthesized expression", "(1 + 2)!", 6, nil},
+		{"factorial of a non-integer uses the Gamma function", "2.5!", 3.323350970447843, nil},
+		{"factorials can be chained", "(3!)!", 720, nil},
+		{"'!!' is a double factorial rather than two factorials", "7!!", 105, nil},
+		{"a double factorial can be followed by a factorial", "3!!!", 6, nil},
+		{
+			name:    "factorial of a negative integer produces an error",
+			expr:    "(-2)!",
+			wantErr: errors.New("factorial is undefined for negative integer -2"),
+		},
+		{
+			name:    "an empty expression produces an error",
+			expr:    "",
+			wantErr: errors.New(errEmptyExpression),
+		},
+		{
+			name:    "syntax errors are reported",
+			expr:    "5 *",
+			wantErr: SyntaxError{Message: fmt.Sprintf(errNoRightOperand, "*", 3)},
+		},
+		{
+			name:    "unmatched parentheses are reported",
+			expr:    "(5",
+			wantErr: SyntaxError{Message: fmt.Sprintf(errUnmatchedLeftParen, 0)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotRes, err := NewExpression(tt.expr).Evaluate()
+			if tt.wantErr != nil {
+				assert.EqualError(t, err, tt.wantErr.Error())
+				return
+			}
+			assert.NoError(t, err)
+			assert.InDelta(t, tt.wantRes, gotRes, 1e-12)
+		})
+	}
+}
+
+func Test_expression_EvaluateValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantRes Value
+		wantErr error
+	}{
+		{"a numeric expression evaluates to a numeric value", "1 + 2", NewNumericValue(3), nil},
+		{"'<' compares numbers", "1 < 2", NewBooleanValue(true), nil},
+		{"'<=' compares numbers", "2 <= 2", NewBooleanValue(true), nil},
+		{"'>' compares numbers", "1 > 2", NewBooleanValue(false), nil},
+		{"'>=' compares numbers", "1 >= 2", NewBooleanValue(false), nil},
+		{"'==' compares numbers", "4 / 2 == 2", NewBooleanValue(true), nil},
+		{"'!=' compares numbers", "3! != 6", NewBooleanValue(false), nil},
+		{"'==' compares booleans", "(1 < 2) == (3 < 4)", NewBooleanValue(true), nil},
+		{"comparisons bind tighter than equality", "1 < 2 == 2 < 1", NewBooleanValue(false), nil},
+		{"'&&' binds tighter than '||'", "1 > 2 && 1 > 2 || 1 < 2", NewBooleanValue(true), nil},
+		{"'not' negates a comparison", "not 1 == 2", NewBooleanValue(true), nil},
+		{"'not' binds tighter than '&&'", "not 1 < 2 && 1 < 2", NewBooleanValue(false), nil},
+		{"the ternary operator picks the first branch", "1 < 2 ? 10 : 20", NewNumericValue(10), nil},
+		{"the ternary operator picks the second branch", "1 > 2 ? 10 : 20", NewNumericValue(20), nil},
+		{"ternary branches bind looser than arithmetic", "1 > 2 ? 10 : 20 + 1", NewNumericValue(21), nil},
+		{"the ternary operator is right associative", "1 > 2 ? 1 : 2 > 1 ? 2 : 3", NewNumericValue(2), nil},
+		{"the ternary operator can be nested in the first branch", "1 < 2 ? 2 > 1 ? 1 : 2 : 3", NewNumericValue(1), nil},
+		{"the ternary operator can produce booleans", "1 < 2 ? 1 < 2 : 1 > 2", NewBooleanValue(true), nil},
+		{
+			name: "arithmetic on booleans produces a type error",
+			expr: "1 + (2 < 3)",
+			wantErr: TypeError{
+				Message: fmt.Sprintf(errOperandType, "+", 2, NumericValue, BooleanValue),
+				Span:    Span{Start: 5, End: 10},
+			},
+		},
+		{
+			name: "logical operators on numbers produce a type error",
+			expr: "1 < 2 && 3",
+			wantErr: TypeError{
+				Message: fmt.Sprintf(errOperandType, "&&", 6, BooleanValue, NumericValue),
+				Span:    Span{Start: 9, End: 10},
+			},
+		},
+		{
+			name: "comparing a number with a boolean produces a type error",
+			expr: "1 == (1 < 2)",
+			wantErr: TypeError{
+				Message: fmt.Sprintf(errComparedTypes, "==", 2, NumericValue, BooleanValue),
+				Span:    Span{Start: 6, End: 11},
+			},
+		},
+		{
+			name: "a numeric condition produces a type error",
+			expr: "1 ? 2 : 3",
+			wantErr: TypeError{
+				Message: fmt.Sprintf(errConditionType, 2, NumericValue),
+				Span:    Span{Start: 0, End: 1},
+			},
+		},
+		{
+			name: "a '?' without a ':' produces a syntax error",
+			expr: "(1 < 2 ? 3) : 4",
+			wantErr: SyntaxError{
+				Message:  fmt.Sprintf(errUnmatchedCondition, 7),
+				Token:    "?",
+				Position: 7,
+			},
+		},
+		{
+			name: "a ':' without a '?' produces a syntax error",
+			expr: "1 : 2",
+			wantErr: SyntaxError{
+				Message:  fmt.Sprintf(errUnmatchedElse, 2),
+				Token:    ":",
+				Position: 2,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotRes, err := NewExpression(tt.expr).EvaluateValue()
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.wantRes, gotRes)
+		})
+	}
+}
+
+func Test_expression_EvaluateValueWith(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		vars    Variables
+		wantRes Value
+		wantErr error
+	}{
+		{"variables are substituted", "x^2 + y", Variables{"x": 3, "y": 1}, NewNumericValue(10), nil},
+		{"a number followed by a variable is multiplied", "2x", Variables{"x": 3}, NewNumericValue(6), nil},
+		{"adjacent variables are multiplied", "x y", Variables{"x": 3, "y": 4}, NewNumericValue(12), nil},
+		{"if picks its second argument on true", "if(x == 0, 0, 1/x)", Variables{"x": 4}, NewNumericValue(0.25), nil},
+		{"if picks its third argument on false", "if(x == 0, 0, 1/x)", Variables{"x": 0}, NewNumericValue(0), nil},
+		{"if does not evaluate the untaken branch", "if(x < 0, (-1)!, x)", Variables{"x": 2}, NewNumericValue(2), nil},
+		{"if can be part of a larger expression", "2 if(x > 0, x, -x) + 1", Variables{"x": -3}, NewNumericValue(7), nil},
+		{"piecewise picks the first matching piece", "piecewise(x < 0, -x, x < 10, x^2, 100)", Variables{"x": -2}, NewNumericValue(2), nil},
+		{"piecewise checks pieces in order", "piecewise(x < 0, -x, x < 10, x^2, 100)", Variables{"x": 3}, NewNumericValue(9), nil},
+		{"piecewise falls back to its default", "piecewise(x < 0, -x, x < 10, x^2, 100)", Variables{"x": 30}, NewNumericValue(100), nil},
+		{"piecewise does not evaluate untaken pieces", "piecewise(x < 0, (-1)!, x)", Variables{"x": 2}, NewNumericValue(2), nil},
+		{"function calls can be nested", "if(x > 0, if(x > 1, 2, 1), 0)", Variables{"x": 5}, NewNumericValue(2), nil},
+		{"'&&' does not evaluate its right operand when the left is false", "x > 0 && (-1)! > 0", Variables{"x": 0}, NewBooleanValue(false), nil},
+		{"'||' does not evaluate its right operand when the left is true", "x > 0 || (-1)! > 0", Variables{"x": 1}, NewBooleanValue(true), nil},
+		{"the ternary operator does not evaluate the untaken branch", "x == 0 ? 0 : (-1)!", Variables{"x": 0}, NewNumericValue(0), nil},
+		{
+			name:    "undefined variables produce an error",
+			expr:    "1 + y",
+			wantErr: fmt.Errorf(errUndefinedVariable, "y", 4),
+		},
+		{
+			name:    "piecewise without a default produces an error when nothing matches",
+			expr:    "piecewise(x < 0, -x)",
+			vars:    Variables{"x": 1},
+			wantErr: fmt.Errorf(errNoMatchingPiece, "piecewise", 0),
+		},
+		{
+			name: "a numeric condition produces a type error",
+			expr: "if(x, 1, 2)",
+			vars: Variables{"x": 1},
+			wantErr: TypeError{
+				Message: fmt.Sprintf(errArgumentType, 1, "if", 0, BooleanValue, NumericValue),
+				Span:    Span{Start: 3, End: 4},
+			},
+		},
+		{
+			name: "calling a function with the wrong number of arguments produces an error",
+			expr: "if(x < 1, 2)",
+			wantErr: SyntaxError{
+				Message:  fmt.Sprintf(errArgumentCount, "if", 0, "3 arguments", 2),
+				Token:    "if",
+				Position: 0,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotRes, err := NewExpression(tt.expr).EvaluateValueWith(tt.vars)
+			if tt.wantErr != nil {
+				assert.EqualError(t, err, tt.wantErr.Error())
+				if _, ok := tt.wantErr.(TypeError); ok {
+					assert.Equal(t, tt.wantErr, err)
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantRes, gotRes)
+		})
+	}
+}
+
+func Test_expression_EvaluateWith(t *testing.T) {
+	res, err := NewExpression("piecewise(x < 0, -x, x)").EvaluateWith(Variables{"x": -5})
+	assert.NoError(t, err)
+	assert.Equal(t, 5.0, res)
+}
+
+func Test_expression_Evaluate_booleanResult(t *testing.T) {
+	_, err := NewExpression("1 < 2").Evaluate()
+	assert.Equal(t, TypeError{
+		Message: fmt.Sprintf(errResultType, NumericValue, BooleanValue),
+		Span:    Span{Start: 0, End: 5},
+	}, err)
+}
+
+// withSpans pairs each token with an empty span.
+func withSpans(tokens ...Token) []spannedToken {
+	res := make([]spannedToken, len(tokens))
+	for i, t := range tokens {
+		res[i] = spannedToken{Token: t}
+	}
+	return res
+}
+
+// withoutSpans strips the spans off tokens.
+func withoutSpans(tokens []spannedToken) []Token {
+	res := make([]Token, len(tokens))
+	for i, t := range tokens {
+		res[i] = t.Token
+	}
+	return res
+}
+
+func Test_expression_toRPN_argc(t *testing.T) {
+	e := &expression{}
+	rpn, err := e.toRPN(withSpans(
+		NewFunction(Piecewise), LeftParen,
+		NewNumber("1"), ArgSeparator,
+		NewFunction(If), LeftParen, NewNumber("2"), ArgSeparator, NewNumber("3"), ArgSeparator, NewNumber("4"), RightParen,
+		RightParen,
+	))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, rpn[4].argc)
+	assert.Equal(t, 2, rpn[5].argc)
+}
+
+func Test_expression_toRPN(t *testing.T) {
+	tests := []struct {
+		name    string
+		tokens  []Token
+		wantRPN []Token
+		wantErr error
+	}{
+		{
+			name:    "operators are emitted after their operands",
+			tokens:  []Token{NewNumber("1"), NewOperator(Addition), NewNumber("2")},
+			wantRPN: []Token{NewNumber("1"), NewNumber("2"), NewOperator(Addition)},
+		},
+		{
+			name: "parentheses are discarded",
+			tokens: []Token{
+				LeftParen, NewNumber("1"), NewOperator(Addition), NewNumber("2"), RightParen,
+				NewOperator(Multiplication), NewNumber("3"),
+			},
+			wantRPN: []Token{
+				NewNumber("1"), NewNumber("2"), NewOperator(Addition),
+				NewNumber("3"), NewOperator(Multiplication),
+			},
+		},
+		{
+			name:    "prefix operators are emitted after their operand",
+			tokens:  []Token{NewOperator(Minus), NewNumber("1")},
+			wantRPN: []Token{NewNumber("1"), NewOperator(Minus)},
+		},
+		{
+			name:    "postfix operators are emitted right after their operand",
+			tokens:  []Token{NewNumber("1"), NewOperator(Factorial), NewOperator(Addition), NewNumber("2")},
+			wantRPN: []Token{NewNumber("1"), NewOperator(Factorial), NewNumber("2"), NewOperator(Addition)},
+		},
+		{
+			name: "a ternary conditional is emitted as a single operator",
+			tokens: []Token{
+				NewNumber("1"), NewOperator(Conditional), NewNumber("2"),
+				NewOperator(ConditionalElse), NewNumber("3"),
+			},
+			wantRPN: []Token{NewNumber("1"), NewNumber("2"), NewNumber("3"), NewOperator(ConditionalElse)},
+		},
+		{
+			name: "a function is emitted after its arguments",
+			tokens: []Token{
+				NewFunction(If), LeftParen, NewVariable("x"), NewOperator(Less), NewNumber("1"), ArgSeparator,
+				NewNumber("2"), ArgSeparator, NewNumber("3"), RightParen, NewOperator(Addition), NewNumber("4"),
+			},
+			wantRPN: []Token{
+				NewVariable("x"), NewNumber("1"), NewOperator(Less), NewNumber("2"), NewNumber("3"),
+				NewFunction(If), NewNumber("4"), NewOperator(Addition),
+			},
+		},
+		{
+			name:    "a '?' without a ':' produces an error",
+			tokens:  []Token{NewNumber("1"), NewOperator(Conditional), NewNumber("2")},
+			wantErr: SyntaxError{Message: fmt.Sprintf(errUnmatchedCondition, 0), Token: "?"},
+		},
+		{
+			name:    "a ':' without a '?' produces an error",
+			tokens:  []Token{NewNumber("1"), NewOperator(ConditionalElse), NewNumber("2")},
+			wantErr: SyntaxError{Message: fmt.Sprintf(errUnmatchedElse, 0), Token: ":"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &expression{}
+			gotRPN, err := e.toRPN(withSpans(tt.tokens...))
+			assert.Equal(t, tt.wantErr, err)
+			if tt.wantErr != nil {
+				return
+			}
+			assert.Equal(t, tt.wantRPN, withoutSpans(gotRPN))
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package yamp
+
+import (
+	"fmt"
+	"math"
+)
+
+// maxFactorial is the largest integer whose factorial fits in a float64.
+const maxFactorial = 170
+
+// factorial computes x! for any real x using the Gamma function, i.e. x! = Γ(x+1).
+// Non-negative integers are computed by repeated multiplication so that the result
+// is exact whenever it is representable. Negative integers are poles of the Gamma
+// function and produce an error.
+func factorial(x float64) (res float64, err error) {
+	if isInteger(x) {
+		if x < 0 {
+			return 0, fmt.Errorf(errFactorialNegativeInt, x)
+		}
+		if x > maxFactorial {
+			return math.Inf(1), nil
+		}
+
+		res = 1
+		for i := 2.0; i <= x; i++ {
+			res *= i
+		}
+		return res, nil
+	}
+
+	return math.Gamma(x + 1), nil
+}
+
+// doubleFactorial computes x!!, the product of all integers from x down to 1 that
+// share the parity of x. By convention, 0!! and (-1)!! are both 1.
+func doubleFactorial(x float64) (res float64, err error) {
+	if !isInteger(x) || x < -1 {
+		return 0, fmt.Errorf(errDoubleFactorialDomain, x)
+	}
+
+	res = 1
+	for i := x; i > 1 && !math.IsInf(res, 1); i -= 2 {
+		res *= i
+	}
+	return res, nil
+}
+
+// isInteger checks whether x has no fractional part.
+func isInteger(x float64) bool {
+	return x == math.Trunc(x)
+}
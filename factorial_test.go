@@ -0,0 +1,87 @@
+package yamp
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_factorial(t *testing.T) {
+	type args struct {
+		x float64
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantRes float64
+		wantErr error
+	}{
+		{"0! should be 1", args{x: 0}, 1, nil},
+		{"1! should be 1", args{x: 1}, 1, nil},
+		{"5! should be 120", args{x: 5}, 120, nil},
+		{"20! should be exact", args{x: 20}, 2432902008176640000, nil},
+		{"0.5! should be half the square root of pi", args{x: 0.5}, math.Sqrt(math.Pi) / 2, nil},
+		{"-0.5! should be the square root of pi", args{x: -0.5}, math.Sqrt(math.Pi), nil},
+		{"factorials that overflow should be +Inf", args{x: 171}, math.Inf(1), nil},
+		{
+			name:    "factorials of negative integers should produce an error",
+			args:    args{x: -3},
+			wantRes: 0,
+			wantErr: errors.New("factorial is undefined for negative integer -3"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotRes, err := factorial(tt.args.x)
+			if tt.wantErr != nil {
+				assert.EqualError(t, err, tt.wantErr.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.InDelta(t, tt.wantRes, gotRes, 1e-12)
+		})
+	}
+}
+
+func Test_doubleFactorial(t *testing.T) {
+	type args struct {
+		x float64
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantRes float64
+		wantErr error
+	}{
+		{"-1!! should be 1", args{x: -1}, 1, nil},
+		{"0!! should be 1", args{x: 0}, 1, nil},
+		{"7!! should be 105", args{x: 7}, 105, nil},
+		{"8!! should be 384", args{x: 8}, 384, nil},
+		{"double factorials that overflow should be +Inf", args{x: 1000}, math.Inf(1), nil},
+		{
+			name:    "double factorials of integers below -1 should produce an error",
+			args:    args{x: -2},
+			wantRes: 0,
+			wantErr: errors.New("double factorial is only defined for integers greater than or equal to -1, got -2"),
+		},
+		{
+			name:    "double factorials of non-integers should produce an error",
+			args:    args{x: 2.5},
+			wantRes: 0,
+			wantErr: errors.New("double factorial is only defined for integers greater than or equal to -1, got 2.5"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotRes, err := doubleFactorial(tt.args.x)
+			if tt.wantErr != nil {
+				assert.EqualError(t, err, tt.wantErr.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantRes, gotRes)
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package yamp
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Format rewrites an expression in a consistent layout: binary operators are surrounded by single
+// spaces, separators are followed by one, and other whitespace is removed unless it keeps two tokens
+// apart, as in "x y". Symbols are written as they appear in the expression, except numbers, whose
+// digits are joined. Implied multiplication stays implied, as in "2x".
+func Format(expr string) (string, error) {
+	return FormatWithRegistry(expr, defaultTokenRegistry)
+}
+
+// FormatWithRegistry is like Format, but recognizes the tokens in reg.
+func FormatWithRegistry(expr string, reg TokenRegistry) (string, error) {
+	tokens, spans, err := newTokenizer(reg).tokenize(expr)
+	if err != nil {
+		return "", err
+	}
+
+	runes := []rune(expr)
+	var (
+		sb       strings.Builder
+		prev     Token
+		prevText string
+	)
+	for i, t := range tokens {
+		sp := spans[i]
+		if sp.Start == sp.End {
+			continue // inserted multiplication
+		}
+		text := string(runes[sp.Start:sp.End])
+		if _, ok := t.(Number); ok {
+			text = t.String()
+		}
+
+		if prev != nil && needsSpace(reg, prev, t, prevText, text) {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(text)
+		prev, prevText = t, text
+	}
+	return sb.String(), nil
+}
+
+// needsSpace checks whether a space is written between two consecutive tokens with the given texts.
+func needsSpace(reg TokenRegistry, prev, t Token, prevText, text string) bool {
+	if isBinaryOperator(prev) || isBinaryOperator(t) || prev == Token(ArgSeparator) {
+		return true
+	}
+
+	last, _ := utf8.DecodeLastRuneInString(prevText)
+	first, _ := utf8.DecodeRuneInString(text)
+	if _, ok := prev.(Operator); ok && reg.IsOperator(first) {
+		// keep operators that would be read as a longer one apart, as in "x! !"
+		return len(reg.matchOperator(prevText+text)) > len(prevText)
+	}
+	// keep words apart, as in "x y" and "not x", but not from the numbers that multiply them, as in "2x"
+	if _, ok := prev.(Number); ok {
+		return false
+	}
+	return isWordRune(reg, last) && isWordRune(reg, first)
+}
+
+func isBinaryOperator(t Token) bool {
+	op, ok := t.(Operator)
+	return ok && IsBinaryOp(op)
+}
+
+func isWordRune(reg TokenRegistry, r rune) bool {
+	return reg.IsLetter(r) || reg.IsDigit(r)
+}
+
+// formatNode writes a syntax tree as an expression in the layout of Format, with only the parentheses
+// that the precedence of its operators requires. Numbers are written in full, since the tokenizer
+// would read an exponent as a variable, and infinities and NaN are written as divisions.
+func formatNode(n node) string {
+	var sb strings.Builder
+	writeNode(&sb, n, 0)
+	return sb.String()
+}
+
+// writeNode writes n, in parentheses if it binds less tightly than prec.
+func writeNode(sb *strings.Builder, n node, prec int) {
+	if nodePrecedence(n) < prec {
+		sb.WriteByte('(')
+		defer sb.WriteByte(')')
+	}
+
+	switch n := n.(type) {
+	case numberNode:
+		switch {
+		case math.IsNaN(n.value):
+			sb.WriteString("(0/0)")
+		case math.IsInf(n.value, 1):
+			sb.WriteString("(1/0)")
+		case math.IsInf(n.value, -1):
+			sb.WriteString("(-1/0)")
+		default:
+			sb.WriteString(strconv.FormatFloat(n.value, 'f', -1, 64))
+		}
+	case variableNode:
+		sb.WriteString(n.name)
+	case callNode:
+		sb.WriteString(n.fn.String())
+		sb.WriteByte('(')
+		for i, a := range n.args {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			writeNode(sb, a, 0)
+		}
+		sb.WriteByte(')')
+	case operatorNode:
+		writeOperator(sb, n)
+	}
+}
+
+func writeOperator(sb *strings.Builder, n operatorNode) {
+	p := n.op.Precedence()
+	switch {
+	case n.op.Type() == ConditionalElse:
+		// the condition and the first branch are parsed as if they were in parentheses, except for
+		// conditionals, which would take the ':' as theirs
+		writeNode(sb, n.operands[0], p+1)
+		sb.WriteString(" ? ")
+		writeNode(sb, n.operands[1], p+1)
+		sb.WriteString(" : ")
+		writeNode(sb, n.operands[2], p)
+	case IsBinaryOp(n.op):
+		left, right := p, p+1
+		if IsRightAssocOp(n.op) {
+			left, right = p+1, p
+		}
+		writeNode(sb, n.operands[0], left)
+		if impliesMultiplication(n) {
+			writeNode(sb, n.operands[1], right)
+			return
+		}
+		sb.WriteString(" " + n.op.String() + " ")
+		writeNode(sb, n.operands[1], right)
+	case isPostfix(n.op.Type()):
+		writeNode(sb, n.operands[0], p+1)
+		sb.WriteString(n.op.String())
+	default:
+		sb.WriteString(n.op.String())
+		if n.op.Type() == Not && nodePrecedence(n.operands[0]) >= p {
+			sb.WriteByte(' ') // as Format keeps words apart
+		}
+		writeNode(sb, n.operands[0], p)
+	}
+}
+
+// nodePrecedence returns the precedence with which n binds to its surroundings.
+func nodePrecedence(n node) int {
+	switch n := n.(type) {
+	case numberNode:
+		if n.value < 0 && !math.IsInf(n.value, 0) {
+			return NewOperator(Minus).Precedence()
+		}
+	case operatorNode:
+		return n.op.Precedence()
+	}
+	return NewOperator(Factorial).Precedence() + 1
+}
+
+// impliesMultiplication checks whether a multiplication is written as in "2x" or "3x ^ 2", which is
+// when a non-negative number multiplies a variable or a power of one.
+func impliesMultiplication(n operatorNode) bool {
+	if n.op.Type() != Multiplication || nodePrecedence(n.operands[0]) < NewOperator(Minus).Precedence() {
+		return false
+	}
+	if _, ok := n.operands[0].(numberNode); !ok {
+		return false
+	}
+	right := n.operands[1]
+	if isOperatorNodeOf(right, Power) {
+		right = right.(operatorNode).operands[0]
+	}
+	_, ok := right.(variableNode)
+	return ok
+}
+
+func isPostfix(typ opType) bool {
+	return typ == Factorial || typ == DoubleFactorial || typ == Percent
+}
@@ -0,0 +1,110 @@
+package yamp
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		want    string
+		wantErr error
+	}{
+		{"binary operators are spaced", "1+2*3", "1 + 2 * 3", nil},
+		{"extra whitespace is removed", "  ( x   +1 )\n/ 2 ", "(x + 1) / 2", nil},
+		{"unary operators stay attached", "- x ! + ~ y", "-x! + ~y", nil},
+		{"unary operators follow binary ones", "x*-y", "x * -y", nil},
+		{"separators are followed by a space", "if(x<0,-x,x)", "if(x < 0, -x, x)", nil},
+		{"conditionals are spaced", "x>1?y:z", "x > 1 ? y : z", nil},
+		{"word operators are spaced", "not x && 5 mod 3", "not x && 5 mod 3", nil},
+		{"implied multiplication stays implied", "2 x (y + 1)(z)", "2x(y + 1)(z)", nil},
+		{"implied multiplication keeps words apart", "x y * x 2", "x y * x 2", nil},
+		{"unary operators are joined", "- -x + (x!) !", "--x + (x!)!", nil},
+		{"operators that would be joined are kept apart", "x! !", "x! !", nil},
+		{"numbers are joined", "1 2 + .5", "12 + .5", nil},
+		{"percentages stay attached", "50 % + 1", "50% + 1", nil},
+		{"non-ASCII symbols are kept", "π*r ^2", "π * r ^ 2", nil},
+		{"empty expressions are empty", "  ", "", nil},
+		{
+			name:    "invalid expressions are not formatted",
+			expr:    "1 + (2",
+			wantErr: SyntaxError{Message: fmt.Sprintf(errUnmatchedLeftParen, 4), Token: "(", Position: 4},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Format(tt.expr)
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.want, got)
+			if err != nil {
+				return
+			}
+
+			// formatting is idempotent and keeps the meaning of the expression
+			again, err := Format(got)
+			assert.NoError(t, err)
+			assert.Equal(t, got, again)
+			want, _ := NewTokenizer().Tokenize(tt.expr)
+			tokens, _ := NewTokenizer().Tokenize(got)
+			assert.Equal(t, want, tokens)
+		})
+	}
+}
+
+func Test_formatNode(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		want string
+	}{
+		{"binary operators are spaced", "1+2*3", "1 + 2 * 3"},
+		{"redundant parentheses are dropped", "((x + 1)) + (y * z)", "x + 1 + y * z"},
+		{"precedence keeps parentheses", "(x + 1) * (y - z)", "(x + 1) * (y - z)"},
+		{"left associativity keeps parentheses on the right", "a - (b - c) - d", "a - (b - c) - d"},
+		{"right associativity keeps parentheses on the left", "(a ^ b) ^ c ^ d", "(a ^ b) ^ c ^ d"},
+		{"numbers multiply variables implicitly", "2 * x + 3 * y ^ 2 + 4 * (x + 1)", "2x + 3y ^ 2 + 4 * (x + 1)"},
+		{"unary operators are attached", "-x! + - -y + ~z", "-x! + --y + ~z"},
+		{"word operators are spaced", "not (x && y) || not z", "not(x && y) || not z"},
+		{"negative bases are parenthesized", "(-x) ^ 2 - -x ^ 2", "(-x) ^ 2 - -x ^ 2"},
+		{"postfix operators parenthesize their operand", "(x + 1)! + (y!)! + 50%", "(x + 1)! + (y!)! + 50%"},
+		{"conditionals nest on the right", "a ? (b ? 1 : 2) : c ? 3 : 4", "a ? (b ? 1 : 2) : c ? 3 : 4"},
+		{"calls are written with their arguments", "sum(k, 1, n, k ^ 2) + if(x < 0, -x, x)", "sum(k, 1, n, k ^ 2) + if(x < 0, -x, x)"},
+		{"numbers are written in full", "123456789012 + 0.000001 + 1.50", "123456789012 + 0.000001 + 1.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := (&expression{expr: tt.expr}).parse(defaultTokenRegistry)
+			if !assert.NoError(t, err) {
+				return
+			}
+			got := formatNode(n)
+			assert.Equal(t, tt.want, got)
+
+			// the result is formatted and parses into the same tree, up to spans
+			formatted, err := Format(got)
+			assert.NoError(t, err)
+			assert.Equal(t, got, formatted)
+			again, err := (&expression{expr: got}).parse(defaultTokenRegistry)
+			if assert.NoError(t, err) {
+				assert.Equal(t, got, formatNode(again))
+			}
+		})
+	}
+
+	for _, tt := range []struct {
+		v    float64
+		want float64
+	}{{1e21, 1e21}, {-2.5, -2.5}, {math.Inf(1), math.Inf(1)}, {math.Inf(-1), math.Inf(-1)}} {
+		got, err := NewExpression(formatNode(constantNode(tt.v, Span{})) + " * 1").Evaluate()
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, got)
+	}
+	got, err := NewExpression(formatNode(constantNode(math.NaN(), Span{}))).Evaluate()
+	assert.NoError(t, err)
+	assert.True(t, math.IsNaN(got))
+}
@@ -0,0 +1,118 @@
+package yamp
+
+import "fmt"
+
+type fnType int
+
+// Built-in function types
+const (
+	If        fnType = iota + 1 // If returns its second argument if the first is true, otherwise its third.
+	Piecewise                   // Piecewise returns the value of the first piece whose condition is true.
+	Popcount                    // Popcount returns the number of one bits of an integer.
+	Clz                         // Clz returns the number of leading zero bits of a 64-bit integer.
+	// Sum adds up its last argument over the integers from its second argument to its third, which are
+	// bound in turn to the variable named by its first argument, as in sum(k, 1, n, k^2). The upper bound
+	// may be infinite, as in sum(k, 1, 1/0, 1/k^2), in which case the sum must converge quickly enough for
+	// the extrapolations of its first terms to settle.
+	Sum
+	// Product multiplies its last argument over an index range like Sum does.
+	Product
+	// Diff returns the derivative of its first argument with respect to the variable named by its second,
+	// at the current value of that variable, as in diff(x^3, x). An optional third argument, which must be
+	// a non-negative integer, gives the order of the derivative. Expressions can also write d/dx(x^3).
+	Diff
+	// Integral integrates its first argument with respect to the variable named by its second, from its
+	// third argument to its fourth, as in integrate(x^2, x, 0, 1). The variable is bound within the
+	// integrand, which must have an antiderivative.
+	Integral
+)
+
+// Function represents a function that can be called in an expression.
+type Function interface {
+	Token
+	Type() fnType // Type returns the function's type.
+	// NumArgs returns the minimum and maximum number of arguments the function accepts.
+	// A negative maximum means there is no upper limit.
+	NumArgs() (min, max int)
+}
+
+var _ Function = (*function)(nil)
+
+type function struct {
+	fnType fnType
+}
+
+// NewFunction creates a new Function.
+func NewFunction(fn fnType) Function {
+	return function{fnType: fn}
+}
+
+func (f function) String() string {
+	switch f.fnType {
+	case If:
+		return "if"
+	case Piecewise:
+		return "piecewise"
+	case Popcount:
+		return "popcount"
+	case Clz:
+		return "clz"
+	case Sum:
+		return "sum"
+	case Product:
+		return "prod"
+	case Diff:
+		return "diff"
+	case Integral:
+		return "integrate"
+	}
+	return "<?>"
+}
+
+// Type implements the Function interface.
+func (f function) Type() fnType {
+	return f.fnType
+}
+
+// NumArgs implements the Function interface.
+func (f function) NumArgs() (min, max int) {
+	switch f.fnType {
+	case If:
+		return 3, 3
+	case Piecewise:
+		return 2, -1
+	case Popcount, Clz:
+		return 1, 1
+	case Sum, Product, Integral:
+		return 4, 4
+	case Diff:
+		return 2, 3
+	}
+	return 0, -1
+}
+
+// AcceptsArgs is a utility function that checks whether a function can be called with n arguments.
+func AcceptsArgs(fn Function, n int) bool {
+	min, max := fn.NumArgs()
+	return n >= min && (max < 0 || n <= max)
+}
+
+// describeNumArgs describes the number of arguments a function accepts, e.g. "at least 2 arguments".
+func describeNumArgs(fn Function) string {
+	min, max := fn.NumArgs()
+
+	plural := func(n int) string {
+		if n == 1 {
+			return "1 argument"
+		}
+		return fmt.Sprintf("%d arguments", n)
+	}
+
+	switch {
+	case min == max:
+		return plural(min)
+	case max < 0:
+		return "at least " + plural(min)
+	}
+	return fmt.Sprintf("%d to %s", min, plural(max))
+}
@@ -0,0 +1,75 @@
+package yamp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_function_String(t *testing.T) {
+	tests := []struct {
+		name   string
+		fnType fnType
+		want   string
+	}{
+		{"it should return 'if' for an If function", If, "if"},
+		{"it should return 'piecewise' for a Piecewise function", Piecewise, "piecewise"},
+		{"it should return 'popcount' for a Popcount function", Popcount, "popcount"},
+		{"it should return 'clz' for a Clz function", Clz, "clz"},
+		{"it should return 'sum' for a Sum function", Sum, "sum"},
+		{"it should return 'prod' for a Product function", Product, "prod"},
+		{"it should return '<?>' for an unknown function", -1, "<?>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, NewFunction(tt.fnType).String())
+		})
+	}
+}
+
+func Test_function_NumArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		fnType  fnType
+		wantMin int
+		wantMax int
+	}{
+		{"If takes exactly 3 arguments", If, 3, 3},
+		{"Piecewise takes at least 2 arguments", Piecewise, 2, -1},
+		{"Popcount takes exactly 1 argument", Popcount, 1, 1},
+		{"Sum takes exactly 4 arguments", Sum, 4, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			min, max := NewFunction(tt.fnType).NumArgs()
+			assert.Equal(t, tt.wantMin, min)
+			assert.Equal(t, tt.wantMax, max)
+		})
+	}
+}
+
+func TestAcceptsArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   Function
+		n    int
+		want bool
+	}{
+		{"a fixed arity function accepts its arity", NewFunction(If), 3, true},
+		{"a fixed arity function rejects fewer arguments", NewFunction(If), 2, false},
+		{"a fixed arity function rejects more arguments", NewFunction(If), 4, false},
+		{"a variadic function accepts its minimum", NewFunction(Piecewise), 2, true},
+		{"a variadic function accepts any number above its minimum", NewFunction(Piecewise), 101, true},
+		{"a variadic function rejects fewer arguments than its minimum", NewFunction(Piecewise), 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, AcceptsArgs(tt.fn, tt.n))
+		})
+	}
+}
+
+func Test_describeNumArgs(t *testing.T) {
+	assert.Equal(t, "3 arguments", describeNumArgs(NewFunction(If)))
+	assert.Equal(t, "at least 2 arguments", describeNumArgs(NewFunction(Piecewise)))
+}
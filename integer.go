@@ -0,0 +1,344 @@
+package yamp
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"math/bits"
+	"strconv"
+)
+
+// maxIntegerBits limits the size of BigIntMode results that can grow without bound,
+// such as 2^n, 1 << n and n!.
+const maxIntegerBits = 1 << 20
+
+var (
+	twoTo63 = new(big.Int).Lsh(big.NewInt(1), 63)
+	twoTo64 = new(big.Int).Lsh(big.NewInt(1), 64)
+)
+
+// integerLiteral evaluates a number literal in an integer mode.
+func (ev *evaluator) integerLiteral(n numberNode) (res Value, err error) {
+	i, ok := new(big.Int).SetString(n.symbol, 10)
+	if !ok {
+		return nil, TypeError{
+			Message: fmt.Sprintf(errIntegerLiteral, n.symbol, n.sp.Start),
+			Span:    n.sp,
+		}
+	}
+	if ev.numberMode == Int64Mode && !i.IsInt64() {
+		return nil, fmt.Errorf(errInt64Overflow, n.symbol, n.sp.Start)
+	}
+	return NewIntegerValue(i), nil
+}
+
+// integerVariable converts the value of a variable in an integer mode.
+func (ev *evaluator) integerVariable(n variableNode, v float64) (res Value, err error) {
+	if math.IsInf(v, 0) || math.IsNaN(v) || !isInteger(v) {
+		return nil, TypeError{
+			Message: fmt.Sprintf(errIntegerVariable, n.name, n.sp.Start, v),
+			Span:    n.sp,
+		}
+	}
+	i, _ := big.NewFloat(v).Int(nil)
+	if ev.numberMode == Int64Mode && !i.IsInt64() {
+		return nil, fmt.Errorf(errInt64Overflow, n.name, n.sp.Start)
+	}
+	return NewIntegerValue(i), nil
+}
+
+// evalBitCount evaluates popcount and clz.
+func (ev *evaluator) evalBitCount(n callNode) (res Value, err error) {
+	v, err := ev.eval(n.args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var x int64
+	switch {
+	case v.Type() == BooleanValue:
+		return nil, TypeError{
+			Message: fmt.Sprintf(errArgumentType, 1, n.fn, n.fnSpan.Start, NumericValue, v.Type()),
+			Span:    n.args[0].span(),
+		}
+	case v.Type() == NumericValue && !fitsInt64(v.Number()):
+		return nil, TypeError{
+			Message: fmt.Sprintf(errIntegerArgument, 1, n.fn, n.fnSpan.Start, v),
+			Span:    n.args[0].span(),
+		}
+	case v.Type() == NumericValue:
+		x = int64(v.Number())
+	case ev.numberMode == BigIntMode:
+		return bigBitCount(n.fn, v.Int())
+	default:
+		x = v.Int().Int64()
+	}
+
+	count := bitCount64(n.fn.Type(), x)
+	if v.Type() == IntegerValue {
+		return NewIntegerValue(big.NewInt(int64(count))), nil
+	}
+	return NewNumericValue(float64(count)), nil
+}
+
+// bitCount64 applies popcount or clz to the two's complement representation of x.
+func bitCount64(fn fnType, x int64) int {
+	if fn == Popcount {
+		return bits.OnesCount64(uint64(x))
+	}
+	return bits.LeadingZeros64(uint64(x))
+}
+
+func bigBitCount(fn Function, x *big.Int) (res Value, err error) {
+	if fn.Type() == Clz {
+		return nil, errors.New(errClzWidth)
+	}
+	if x.Sign() < 0 {
+		return nil, fmt.Errorf(errPopcountNegative, x)
+	}
+	count := 0
+	for _, w := range x.Bits() {
+		count += bits.OnesCount(uint(w))
+	}
+	return NewIntegerValue(big.NewInt(int64(count))), nil
+}
+
+// applyIntegerOperator applies op to integer operands. In Int64Mode, results wrap around to 64 bits.
+func (ev *evaluator) applyIntegerOperator(op Operator, args ...Value) (res Value, err error) {
+	x := make([]*big.Int, len(args))
+	for i, a := range args {
+		x[i] = a.Int()
+	}
+	fixed := ev.numberMode == Int64Mode
+
+	z := new(big.Int)
+	switch op.Type() {
+	case Addition:
+		z.Add(x[0], x[1])
+	case Subtraction:
+		z.Sub(x[0], x[1])
+	case Multiplication:
+		z.Mul(x[0], x[1])
+	case Division, Remainder, Modulo, FloorDivision:
+		if x[1].Sign() == 0 {
+			return nil, errors.New(errDivisionByZero)
+		}
+		switch op.Type() {
+		case Division:
+			z.Quo(x[0], x[1])
+		case Remainder:
+			z.Rem(x[0], x[1])
+		case Modulo:
+			_, z = intDivMod(x[0], x[1], ev.moduloMode)
+		case FloorDivision:
+			z, _ = intDivMod(x[0], x[1], ev.moduloMode)
+		}
+	case Power:
+		if z, err = intPow(op, x[0], x[1], fixed); err != nil {
+			return nil, err
+		}
+	case Plus:
+		z.Set(x[0])
+	case Minus:
+		z.Neg(x[0])
+	case Factorial, DoubleFactorial:
+		if z, err = intFactorial(op, x[0]); err != nil {
+			return nil, err
+		}
+	case BitwiseAnd, BitwiseOr, BitwiseXor, BitwiseNot, ShiftLeft, ShiftRight:
+		if z, err = applyBitwise(op, x, fixed); err != nil {
+			return nil, err
+		}
+	case Less:
+		return NewBooleanValue(x[0].Cmp(x[1]) < 0), nil
+	case LessEqual:
+		return NewBooleanValue(x[0].Cmp(x[1]) <= 0), nil
+	case Greater:
+		return NewBooleanValue(x[0].Cmp(x[1]) > 0), nil
+	case GreaterEqual:
+		return NewBooleanValue(x[0].Cmp(x[1]) >= 0), nil
+	case Equal:
+		return NewBooleanValue(x[0].Cmp(x[1]) == 0), nil
+	case NotEqual:
+		return NewBooleanValue(x[0].Cmp(x[1]) != 0), nil
+	default:
+		return nil, fmt.Errorf(errUnknownOperator, op.String())
+	}
+
+	if fixed {
+		z = wrapInt64(z)
+	}
+	return NewIntegerValue(z), nil
+}
+
+// applyBitwise applies a bitwise operator to integers using two's complement semantics.
+// If fixed is set, the result is wrapped around to 64 bits.
+func applyBitwise(op Operator, x []*big.Int, fixed bool) (z *big.Int, err error) {
+	z = new(big.Int)
+	switch op.Type() {
+	case BitwiseAnd:
+		z.And(x[0], x[1])
+	case BitwiseOr:
+		z.Or(x[0], x[1])
+	case BitwiseXor:
+		z.Xor(x[0], x[1])
+	case BitwiseNot:
+		z.Not(x[0])
+	case ShiftLeft, ShiftRight:
+		if x[1].Sign() < 0 {
+			return nil, fmt.Errorf(errNegativeShift, x[1])
+		}
+		n := uint64(math.MaxUint64)
+		if x[1].IsUint64() {
+			n = x[1].Uint64()
+		}
+		if op.Type() == ShiftRight {
+			// shifting out every bit leaves 0 or -1
+			if bitLen := uint64(x[0].BitLen()); n > bitLen {
+				n = bitLen
+			}
+			z.Rsh(x[0], uint(n))
+			break
+		}
+		switch {
+		case x[0].Sign() == 0:
+			n = 0
+		case fixed && n > 64:
+			n = 64
+		case n > maxIntegerBits:
+			return nil, fmt.Errorf(errIntegerTooLarge, op, maxIntegerBits)
+		}
+		z.Lsh(x[0], uint(n))
+	default:
+		return nil, fmt.Errorf(errUnknownOperator, op.String())
+	}
+
+	if fixed {
+		z = wrapInt64(z)
+	}
+	return z, nil
+}
+
+// applyBitwise64 applies a bitwise operator to int64 operands. Unary operators ignore b.
+func applyBitwise64(op Operator, a, b int64) (res int64, err error) {
+	switch op.Type() {
+	case BitwiseAnd:
+		return a & b, nil
+	case BitwiseOr:
+		return a | b, nil
+	case BitwiseXor:
+		return a ^ b, nil
+	case BitwiseNot:
+		return ^a, nil
+	case ShiftLeft, ShiftRight:
+		if b < 0 {
+			return 0, fmt.Errorf(errNegativeShift, strconv.FormatInt(b, 10))
+		}
+		// Go shifts by 64 or more clear the value, or fill it with its sign bit
+		if op.Type() == ShiftLeft {
+			return a << uint64(b), nil
+		}
+		return a >> uint64(b), nil
+	}
+	return 0, fmt.Errorf(errUnknownOperator, op.String())
+}
+
+// intDivMod is the integer counterpart of divMod.
+func intDivMod(a, b *big.Int, mode moduloMode) (div, mod *big.Int) {
+	switch mode {
+	case EuclideanModulo:
+		return new(big.Int).DivMod(a, b, new(big.Int))
+	case TruncatedModulo:
+		return new(big.Int).QuoRem(a, b, new(big.Int))
+	}
+
+	div, mod = new(big.Int).QuoRem(a, b, new(big.Int))
+	if mod.Sign() != 0 && (mod.Sign() < 0) != (b.Sign() < 0) {
+		mod.Add(mod, b)
+		div.Sub(div, big.NewInt(1))
+	}
+	return
+}
+
+// intPow raises a to the power of b. If fixed is set, the result is computed modulo 2^64.
+func intPow(op Operator, a, b *big.Int, fixed bool) (z *big.Int, err error) {
+	if b.Sign() < 0 {
+		return nil, fmt.Errorf(errNegativeExponent, b)
+	}
+	if fixed {
+		return new(big.Int).Exp(a, b, twoTo64), nil
+	}
+	// 0, 1 and -1 stay small whatever the exponent
+	if a.CmpAbs(big.NewInt(1)) > 0 && (!b.IsInt64() || float64(a.BitLen()-1)*float64(b.Int64()) > maxIntegerBits) {
+		return nil, fmt.Errorf(errIntegerTooLarge, op, maxIntegerBits)
+	}
+	return new(big.Int).Exp(a, b, nil), nil
+}
+
+// intFactorial computes the exact factorial or double factorial of x.
+func intFactorial(op Operator, x *big.Int) (z *big.Int, err error) {
+	step := int64(1)
+	if op.Type() == DoubleFactorial {
+		step = 2
+		if x.Cmp(big.NewInt(-1)) < 0 {
+			return nil, fmt.Errorf(errDoubleFactorialDomain, x)
+		}
+	} else if x.Sign() < 0 {
+		return nil, fmt.Errorf(errFactorialNegativeInt, x)
+	}
+
+	// log2(n!) is below n*log2(n)
+	if !x.IsInt64() || float64(x.Int64())*math.Log2(float64(x.Int64())) > maxIntegerBits*float64(step) {
+		return nil, fmt.Errorf(errIntegerTooLarge, op, maxIntegerBits)
+	}
+
+	n := x.Int64()
+	if n <= 1 {
+		return big.NewInt(1), nil
+	}
+	return productRange(n%step+step, n, step), nil
+}
+
+// productRange multiplies lo, lo+step, ..., hi by splitting the range in halves, which keeps
+// the operands of each multiplication balanced.
+func productRange(lo, hi, step int64) *big.Int {
+	if lo > hi {
+		return big.NewInt(1)
+	}
+	if hi-lo < 8*step {
+		z := big.NewInt(lo)
+		for i := lo + step; i <= hi; i += step {
+			z.Mul(z, big.NewInt(i))
+		}
+		return z
+	}
+	mid := lo + (hi-lo)/(2*step)*step
+	return new(big.Int).Mul(productRange(lo, mid, step), productRange(mid+step, hi, step))
+}
+
+// wrapInt64 wraps x around to the range of int64 like a two's complement machine register.
+func wrapInt64(x *big.Int) *big.Int {
+	if x.IsInt64() {
+		return x
+	}
+	z := new(big.Int).Mod(x, twoTo64)
+	if z.Cmp(twoTo63) >= 0 {
+		z.Sub(z, twoTo64)
+	}
+	return z
+}
+
+// fitsInt64 checks whether x is an integer that an int64 can represent exactly.
+func fitsInt64(x float64) bool {
+	return isInteger(x) && x >= math.MinInt64 && x < math.MaxInt64
+}
+
+// isBitwiseOperator checks whether an operator only accepts integer operands.
+func isBitwiseOperator(typ opType) bool {
+	switch typ {
+	case BitwiseAnd, BitwiseOr, BitwiseXor, BitwiseNot, ShiftLeft, ShiftRight:
+		return true
+	}
+	return false
+}
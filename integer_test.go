@@ -0,0 +1,253 @@
+package yamp
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_evaluator_bitwise(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		want Value
+	}{
+		{"'&' masks bits", "240 & 60", NewNumericValue(48)},
+		{"'|' sets bits", "12 | 3", NewNumericValue(15)},
+		{"'xor' toggles bits", "12 xor 10", NewNumericValue(6)},
+		{"'~' complements all 64 bits", "~0", NewNumericValue(-1)},
+		{"'<<' shifts left", "1 << 4", NewNumericValue(16)},
+		{"'>>' shifts right arithmetically", "-16 >> 2", NewNumericValue(-4)},
+		{"shifting by 64 or more clears the value", "1 << 64", NewNumericValue(0)},
+		{"shifts bind looser than addition", "1 << 2 + 1", NewNumericValue(8)},
+		{"'&' binds tighter than '|'", "1 | 6 & 3", NewNumericValue(3)},
+		{"bitwise operators bind tighter than comparisons", "5 & 4 == 4", NewBooleanValue(true)},
+		{"popcount counts one bits", "popcount(255)", NewNumericValue(8)},
+		{"popcount counts the two's complement bits of negative values", "popcount(-1)", NewNumericValue(64)},
+		{"clz counts leading zero bits", "clz(1)", NewNumericValue(63)},
+		{"'^' is a power by default", "2 ^ 3", NewNumericValue(8)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewExpression(tt.expr).EvaluateValue()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_evaluator_bitwise_typeError(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr error
+	}{
+		{
+			name: "bitwise operators reject fractions",
+			expr: "2.5 & 1",
+			wantErr: TypeError{
+				Message: fmt.Sprintf(errIntegerOperand, "&", 4, "2.5"),
+				Span:    Span{Start: 0, End: 3},
+			},
+		},
+		{
+			name: "bitwise operators reject values outside of int64",
+			expr: "~(2^63)",
+			wantErr: TypeError{
+				Message: fmt.Sprintf(errIntegerOperand, "~", 0, "9.223372036854776e+18"),
+				Span:    Span{Start: 2, End: 6},
+			},
+		},
+		{
+			name: "bitwise operators reject booleans",
+			expr: "(1 < 2) | 1",
+			wantErr: TypeError{
+				Message: fmt.Sprintf(errOperandType, "|", 8, NumericValue, BooleanValue),
+				Span:    Span{Start: 1, End: 6},
+			},
+		},
+		{
+			name: "popcount rejects fractions",
+			expr: "popcount(0.5)",
+			wantErr: TypeError{
+				Message: fmt.Sprintf(errIntegerArgument, 1, "popcount", 0, "0.5"),
+				Span:    Span{Start: 9, End: 12},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewExpression(tt.expr).Evaluate()
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+func Test_evaluator_integerMode(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		mode numberMode
+		vars Variables
+		want string
+	}{
+		{"int64 arithmetic wraps around", "9223372036854775807 + 1", Int64Mode, nil, "-9223372036854775808"},
+		{"int64 powers wrap around", "3 ^ 41", Int64Mode, nil, "-420491770248316829"},
+		{"int64 left shifts drop the high bits", "3 << 63", Int64Mode, nil, "-9223372036854775808"},
+		{"int64 factorials wrap around", "25!", Int64Mode, nil, "7034535277573963776"},
+		{"'/' truncates towards zero", "-7 / 2", Int64Mode, nil, "-3"},
+		{"'mod' follows the modulo mode", "-7 mod 2", Int64Mode, nil, "1"},
+		{"'//' follows the modulo mode", "-7 // 2", Int64Mode, nil, "-4"},
+		{"'rem' takes the sign of the dividend", "-7 rem 2", Int64Mode, nil, "-1"},
+		{"integer variables are accepted", "x << 2", Int64Mode, Variables{"x": 5}, "20"},
+		{"clz uses 64 bits in int64 mode", "clz(255)", Int64Mode, nil, "56"},
+		{"big integers do not overflow", "9223372036854775807 + 1", BigIntMode, nil, "9223372036854775808"},
+		{"big integer literals are exact", "123456789012345678901234567890 - 1", BigIntMode, nil, "123456789012345678901234567889"},
+		{"big integer powers are exact", "2 ^ 100", BigIntMode, nil, "1267650600228229401496703205376"},
+		{"big integer factorials are exact", "25!", BigIntMode, nil, "15511210043330985984000000"},
+		{"big integer double factorials are exact", "15!!", BigIntMode, nil, "2027025"},
+		{"big integer shifts are exact", "1 << 70 >> 68", BigIntMode, nil, "4"},
+		{"big integers complement like infinite two's complement", "~5 & 255", BigIntMode, nil, "250"},
+		{"popcount counts big integer bits", "popcount((1 << 100) - 1)", BigIntMode, nil, "100"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewExpression(tt.expr).EvaluateValueWith(tt.vars, WithNumberMode(tt.mode))
+			assert.NoError(t, err)
+			if assert.NotNil(t, v) {
+				assert.Equal(t, IntegerValue, v.Type())
+				assert.Equal(t, tt.want, v.String())
+			}
+		})
+	}
+}
+
+func Test_evaluator_integerMode_errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		mode    numberMode
+		vars    Variables
+		wantErr error
+	}{
+		{
+			name: "decimal literals are rejected",
+			expr: "1 + 2.5",
+			mode: Int64Mode,
+			wantErr: TypeError{
+				Message: fmt.Sprintf(errIntegerLiteral, "2.5", 4),
+				Span:    Span{Start: 4, End: 7},
+			},
+		},
+		{
+			name: "fractional variables are rejected",
+			expr: "x + 1",
+			mode: BigIntMode,
+			vars: Variables{"x": 0.5},
+			wantErr: TypeError{
+				Message: fmt.Sprintf(errIntegerVariable, "x", 0, 0.5),
+				Span:    Span{Start: 0, End: 1},
+			},
+		},
+		{
+			name: "percentages are rejected",
+			expr: "50%",
+			mode: Int64Mode,
+			wantErr: TypeError{
+				Message: fmt.Sprintf(errIntegerModeOperator, "%", 2),
+				Span:    Span{Start: 2, End: 3},
+			},
+		},
+		{
+			name:    "literals outside of int64 are rejected",
+			expr:    "9223372036854775808",
+			mode:    Int64Mode,
+			wantErr: fmt.Errorf(errInt64Overflow, "9223372036854775808", 0),
+		},
+		{
+			name:    "division by zero is an error",
+			expr:    "1 / 0",
+			mode:    Int64Mode,
+			wantErr: errors.New(errDivisionByZero),
+		},
+		{
+			name:    "negative exponents are rejected",
+			expr:    "2 ^ -1",
+			mode:    BigIntMode,
+			wantErr: fmt.Errorf(errNegativeExponent, "-1"),
+		},
+		{
+			name:    "negative shift counts are rejected",
+			expr:    "1 << -1",
+			mode:    Int64Mode,
+			wantErr: fmt.Errorf(errNegativeShift, "-1"),
+		},
+		{
+			name:    "huge big integer results are rejected",
+			expr:    "1 << 10000000",
+			mode:    BigIntMode,
+			wantErr: fmt.Errorf(errIntegerTooLarge, "<<", maxIntegerBits),
+		},
+		{
+			name:    "clz needs a fixed width",
+			expr:    "clz(1)",
+			mode:    BigIntMode,
+			wantErr: errors.New(errClzWidth),
+		},
+		{
+			name:    "popcount of negative big integers is undefined",
+			expr:    "popcount(-1)",
+			mode:    BigIntMode,
+			wantErr: fmt.Errorf(errPopcountNegative, "-1"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewExpression(tt.expr).EvaluateValueWith(tt.vars, WithNumberMode(tt.mode))
+			if _, ok := tt.wantErr.(TypeError); ok {
+				assert.Equal(t, tt.wantErr, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr.Error())
+			}
+		})
+	}
+}
+
+func Test_evaluator_integerMode_evaluate(t *testing.T) {
+	got, err := NewExpression("255").Evaluate(WithNumberMode(Int64Mode))
+	assert.NoError(t, err)
+	assert.Equal(t, 255.0, got)
+}
+
+func Test_evaluator_dialect(t *testing.T) {
+	reg := NewTokenRegistry(DialectOperators(CDialect), DefaultFunctions())
+
+	got, err := NewExpression("6 ^ 3").Evaluate(WithTokenRegistry(reg))
+	assert.NoError(t, err)
+	assert.Equal(t, 5.0, got)
+
+	got, err = NewExpression("2 ** 3 ** 2").Evaluate(WithTokenRegistry(reg))
+	assert.NoError(t, err)
+	assert.Equal(t, 512.0, got)
+}
+
+func Test_wrapInt64(t *testing.T) {
+	tests := []struct {
+		name string
+		x    *big.Int
+		want int64
+	}{
+		{"values in range are unchanged", big.NewInt(-5), -5},
+		{"2^63 wraps to the minimum", new(big.Int).Set(twoTo63), -1 << 63},
+		{"2^64 wraps to zero", new(big.Int).Set(twoTo64), 0},
+		{"negative values wrap to positive", new(big.Int).Sub(new(big.Int).Neg(twoTo63), big.NewInt(1)), 1<<63 - 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, wrapInt64(tt.x).Int64())
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package yamp
+
+import (
+	"fmt"
+	"math"
+)
+
+// integralDegree is the highest degree of the polynomials that are integrated term by term.
+const integralDegree = 32
+
+// Antiderivative returns an antiderivative of a numeric expression with respect to a variable, such as
+// "x ^ 3 / 3" for "x ^ 2", without a constant of integration. Other variables are kept as they are.
+//
+// Polynomials are integrated, as are powers of linear expressions with constant exponents, such as
+// "(2x + 1) ^ -0.5", and rational functions whose denominator is a power of a linear expression, such as
+// "(x ^ 2 + 1) / (x - 1) ^ 4", along with their sums and constant multiples. No logarithm, exponential
+// or trigonometric function is registered for a result to use, so integrals that need one, like that
+// of "1 / x", are unsupported, as is everything else. Only FloatMode is supported.
+func Antiderivative(expr, variable string, opts ...EvalOption) (Expression, error) {
+	o := newEvalOptions(opts...)
+	root, err := parseNumeric(expr, o)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkNumeric(o, root); err != nil {
+		return nil, err
+	}
+
+	res, err := integrate(root, variable, newEvaluator(nil, o))
+	if err != nil {
+		return nil, err
+	}
+	return NewExpression(formatNode(res)), nil
+}
+
+// integrate returns an antiderivative of a numeric syntax tree with respect to a variable. Constants
+// in the tree are evaluated with ev, which has no variables.
+func integrate(n node, name string, ev *evaluator) (res node, err error) {
+	sp := n.span()
+	x := variableNode{name: name, sp: sp}
+	if !dependsOn(n, name) {
+		return arithmetic(Multiplication, n, x, sp), nil
+	}
+	if p, ok := symbolicPolynomial(n, name, integralDegree, ev.evalOptions, ev.constant); ok {
+		// the integral of c x^k is c x^(k+1) / (k+1)
+		res = constantNode(0, sp)
+		for k := len(p) - 1; k >= 0; k-- {
+			res = arithmetic(Addition, res, monomialIntegral(p[k], x, k+1, sp), sp)
+		}
+		return res, nil
+	}
+
+	if n, ok := n.(operatorNode); ok {
+		return integrateOperator(n, name, ev)
+	}
+	return nil, unsupportedIntegralError(n, name)
+}
+
+func integrateOperator(n operatorNode, name string, ev *evaluator) (res node, err error) {
+	typ := n.op.Type()
+	if (typ == Addition || typ == Subtraction) && ev.percentMode == CalculatorPercent &&
+		isOperatorNodeOf(n.operands[1], Percent) {
+		return nil, unsupportedIntegralError(n, name)
+	}
+
+	sp := n.sp
+	u := n.operands[0]
+	switch typ {
+	case Plus, Minus, Percent, Addition, Subtraction:
+		var a, b node
+		if a, err = integrate(u, name, ev); err != nil {
+			return nil, err
+		}
+		switch typ {
+		case Plus:
+			return a, nil
+		case Minus:
+			return negation(a, sp), nil
+		case Percent:
+			return arithmetic(Division, a, constantNode(100, sp), sp), nil
+		}
+		if b, err = integrate(n.operands[1], name, ev); err != nil {
+			return nil, err
+		}
+		return arithmetic(typ, a, b, sp), nil
+	case Multiplication:
+		// constant factors are taken out of the integral
+		v := n.operands[1]
+		if !dependsOn(u, name) {
+			if res, err = integrate(v, name, ev); err != nil {
+				return nil, err
+			}
+			return arithmetic(Multiplication, u, res, sp), nil
+		}
+		if !dependsOn(v, name) {
+			if res, err = integrate(u, name, ev); err != nil {
+				return nil, err
+			}
+			return arithmetic(Multiplication, res, v, sp), nil
+		}
+	case Division:
+		if !dependsOn(n.operands[1], name) {
+			if res, err = integrate(u, name, ev); err != nil {
+				return nil, err
+			}
+			return arithmetic(Division, res, n.operands[1], sp), nil
+		}
+		return integrateRational(n, name, ev)
+	case Power:
+		a, _, ok := linear(u, name, ev)
+		if !ok || dependsOn(n.operands[1], name) {
+			break
+		}
+		e, ok := ev.constant(n.operands[1])
+		if !ok {
+			break
+		}
+		if e == -1 {
+			return nil, fmt.Errorf(errIntegralLogarithm, n.op, n.opSpan.Start, name)
+		}
+		return powerIntegral(constantNode(1, sp), u, a, e, sp), nil
+	}
+	return nil, unsupportedIntegralError(n, name)
+}
+
+// integrateRational integrates a quotient whose denominator is a constant multiple of a power of a
+// linear expression. The numerator must either be constant, or a polynomial if the power is a positive
+// integer, in which case it is rewritten as a polynomial in the linear expression to be divided term by
+// term.
+func integrateRational(n operatorNode, name string, ev *evaluator) (res node, err error) {
+	sp := n.sp
+	u, v := n.operands[0], n.operands[1]
+	scale, l, a, m, ok := linearPower(v, name, ev)
+	if !ok {
+		return nil, unsupportedIntegralError(n, name)
+	}
+	logError := fmt.Errorf(errIntegralLogarithm, n.op, n.opSpan.Start, name)
+
+	var terms []node
+	if !dependsOn(u, name) {
+		terms = []node{u}
+	} else {
+		p, ok := symbolicPolynomial(u, name, integralDegree, ev.evalOptions, ev.constant)
+		if !ok || m != float64(int(m)) || m < 1 {
+			return nil, unsupportedIntegralError(n, name)
+		}
+		// x = (l - b) / a, where l = a x + b
+		_, b, _ := linear(l, name, ev)
+		shift := []node{arithmetic(Division, negation(b, sp), a, sp), arithmetic(Division, constantNode(1, sp), a, sp)}
+		terms = []node{p[len(p)-1]}
+		for k := len(p) - 2; k >= 0; k-- {
+			if terms, ok = multiplySymbolic(terms, shift, integralDegree, sp); !ok {
+				return nil, unsupportedIntegralError(n, name)
+			}
+			terms = addSymbolic(terms, []node{p[k]}, Addition, sp)
+		}
+	}
+
+	// the integral of c l^j / l^m is c l^(j-m+1) / (a (j-m+1))
+	res = constantNode(0, sp)
+	for j := len(terms) - 1; j >= 0; j-- {
+		c := terms[j]
+		if v, ok := constantValue(c); ok && v == 0 {
+			continue
+		}
+		e := float64(j) - m
+		if e == -1 {
+			return nil, logError
+		}
+		res = arithmetic(Addition, res, powerIntegral(c, l, a, e, sp), sp)
+	}
+	return arithmetic(Division, res, scale, sp), nil
+}
+
+// linear returns the slope and intercept of n if it is a linear expression in the variable.
+func linear(n node, name string, ev *evaluator) (slope, intercept node, ok bool) {
+	p, ok := symbolicPolynomial(n, name, 1, ev.evalOptions, ev.constant)
+	if !ok || len(p) != 2 {
+		return nil, nil, false
+	}
+	return p[1], p[0], true
+}
+
+// linearPower splits n into c l^m, where l is a linear expression in the variable with the given slope,
+// and c and m are constants.
+func linearPower(n node, name string, ev *evaluator) (c, l, slope node, m float64, ok bool) {
+	sp := n.span()
+	if isOperatorNodeOf(n, Multiplication) {
+		u, v := n.(operatorNode).operands[0], n.(operatorNode).operands[1]
+		if !dependsOn(u, name) {
+			u, v = v, u
+		}
+		if dependsOn(v, name) {
+			return nil, nil, nil, 0, false
+		}
+		if c, l, slope, m, ok = linearPower(u, name, ev); !ok {
+			return nil, nil, nil, 0, false
+		}
+		return arithmetic(Multiplication, v, c, sp), l, slope, m, true
+	}
+
+	m = 1
+	if isOperatorNodeOf(n, Power) {
+		e := n.(operatorNode).operands[1]
+		if dependsOn(e, name) {
+			return nil, nil, nil, 0, false
+		}
+		if m, ok = ev.constant(e); !ok {
+			return nil, nil, nil, 0, false
+		}
+		n = n.(operatorNode).operands[0]
+	}
+	if slope, _, ok = linear(n, name, ev); !ok {
+		return nil, nil, nil, 0, false
+	}
+	return constantNode(1, sp), n, slope, m, true
+}
+
+// monomialIntegral builds c x^k / k, the integral of c x^(k-1).
+func monomialIntegral(c, x node, k int, sp Span) node {
+	return powerIntegral(c, x, constantNode(1, sp), float64(k-1), sp)
+}
+
+// powerIntegral builds c l^(e+1) / (a (e+1)), the integral of c l^e for a linear expression l with slope
+// a. Negative powers are written as divisions, and constant coefficients as fractions with small
+// denominators when they are exactly such a fraction as floats, as in "x ^ 3 / 9".
+func powerIntegral(c, l, a node, e float64, sp Span) node {
+	k := e + 1
+	num, den := c, arithmetic(Multiplication, constantNode(k, sp), a, sp)
+	if u, ok := constantValue(c); ok {
+		if v, ok := constantValue(den); ok {
+			p, q := smallFraction(u / v)
+			num, den = constantNode(p, sp), constantNode(q, sp)
+		}
+	}
+	if k < 0 {
+		return fraction(num, arithmetic(Multiplication, den, arithmetic(Power, l, constantNode(-k, sp), sp), sp), sp)
+	}
+	return fraction(arithmetic(Multiplication, num, arithmetic(Power, l, constantNode(k, sp), sp), sp), den, sp)
+}
+
+// maxDenominator is the largest denominator that constant coefficients are written with.
+const maxDenominator = 1000
+
+// smallFraction returns p and q such that p / q is r, with the smallest q up to maxDenominator, or r
+// over 1.
+func smallFraction(r float64) (p, q float64) {
+	for q = 1; q <= maxDenominator; q++ {
+		if p = math.Round(r * q); p/q == r {
+			return p, q
+		}
+	}
+	return r, 1
+}
+
+// fraction builds num / den, moving the sign of a negative constant factor of den to num.
+func fraction(num, den node, sp Span) node {
+	if m, ok := negated(den); ok {
+		num, den = negation(num, sp), m
+	}
+	return arithmetic(Division, num, den, sp)
+}
+
+func unsupportedIntegralError(n node, name string) error {
+	switch n := n.(type) {
+	case operatorNode:
+		return fmt.Errorf(errUnsupportedIntegral, n.op, n.opSpan.Start, name)
+	case callNode:
+		return fmt.Errorf(errUnsupportedIntegral, n.fn, n.fnSpan.Start, name)
+	}
+	return fmt.Errorf(errUnsupportedIntegral, "?", n.span().Start, name)
+}
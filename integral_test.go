@@ -0,0 +1,85 @@
+package yamp
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAntiderivative(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		want string
+	}{
+		{"constants are multiplied by the variable", "y + 3", "(y + 3) * x"},
+		{"polynomials are integrated term by term", "4x^3 - 2x + 1", "x ^ 4 - x ^ 2 + x"},
+		{"coefficients are written as fractions", "-x^2/3 + 0.1x", "-x ^ 3 / 9 + x ^ 2 / 20"},
+		{"coefficients may be variables", "y x^2", "y * x ^ 3 / 3"},
+		{"powers of linear expressions follow the power rule", "(1 - x/4)^1.5", "-8 * (1 - x / 4) ^ 2.5 / 5"},
+		{"negative powers are divisions", "3 / (2x + 1)^2", "-3 / (2 * (2x + 1))"},
+		{"polynomials over powers of linear expressions are divided", "(x^2 + 1) / (x - 1)^4", "-1 / (x - 1) - 1 / (x - 1) ^ 2 - 2 / (3 * (x - 1) ^ 3)"},
+		{"quotients without remainders are polynomials", "(x^2 - 1) / (x - 1)", "(x - 1) ^ 2 / 2 + 2 * (x - 1)"},
+		{"constant factors are taken out", "y * (x + 1)^-0.5 / 2 + 50%", "y * (2 * (x + 1) ^ 0.5) / 2 + 50% * x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Antiderivative(tt.expr, "x")
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tt.want, got.String())
+
+			// the derivative of the result is the integrand
+			o := newEvalOptions()
+			root, err := (&expression{expr: got.String()}).parse(o.reg)
+			if !assert.NoError(t, err) {
+				return
+			}
+			d, err := differentiate(root, "x", o)
+			if !assert.NoError(t, err) {
+				return
+			}
+			for _, x := range []float64{-0.4, 0.5, 1.5, 3} {
+				vars := Variables{"x": x, "y": 3}
+				want, err := NewExpression(tt.expr).EvaluateWith(vars)
+				assert.NoError(t, err)
+				got, err := newEvaluator(vars, o).eval(d)
+				if assert.NoError(t, err) {
+					assert.InDelta(t, want, got.Number(), 1e-9, "x = %v", x)
+				}
+			}
+		})
+	}
+}
+
+func TestAntiderivative_errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		opts    []EvalOption
+		wantErr error
+	}{
+		{"reciprocals need a logarithm", "2 + 1/x", nil, fmt.Errorf(errIntegralLogarithm, "/", 5, "x")},
+		{"reciprocal powers need a logarithm", "(3x - 1)^-1", nil, fmt.Errorf(errIntegralLogarithm, "^", 8, "x")},
+		{"rational functions may need a logarithm", "x / (x + 1)^2", nil, fmt.Errorf(errIntegralLogarithm, "/", 2, "x")},
+		{"products of non-constants are unsupported", "x * (x + 1)^0.5", nil, fmt.Errorf(errUnsupportedIntegral, "*", 2, "x")},
+		{"other denominators are unsupported", "1 / (x^2 + 1)", nil, fmt.Errorf(errUnsupportedIntegral, "/", 2, "x")},
+		{"functions are unsupported", "if(x < 0, -x, x)", nil, fmt.Errorf(errUnsupportedIntegral, "if", 0, "x")},
+		{"relative percentages are unsupported", "x^0.5 + x%", []EvalOption{WithPercentMode(CalculatorPercent)}, fmt.Errorf(errUnsupportedIntegral, "+", 6, "x")},
+		{
+			name:    "the result must be numeric",
+			expr:    "x > 1",
+			wantErr: TypeError{Message: fmt.Sprintf(errResultType, NumericValue, BooleanValue), Span: Span{Start: 0, End: 5}},
+		},
+		{"only FloatMode is supported", "x", []EvalOption{WithNumberMode(BigIntMode)}, errors.New(errCompileNumberMode)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Antiderivative(tt.expr, "x", tt.opts...)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
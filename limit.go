@@ -0,0 +1,440 @@
+package yamp
+
+import (
+	"fmt"
+	"math"
+)
+
+type limitDirection int
+
+// Directions from which a limit is approached
+const (
+	// TwoSided approaches a point from both sides, whose limits must agree. Infinities are approached
+	// from the only side they have.
+	TwoSided limitDirection = iota + 1
+	// FromBelow approaches a point from smaller values.
+	FromBelow
+	// FromAbove approaches a point from larger values.
+	FromAbove
+)
+
+func (d limitDirection) String() string {
+	switch d {
+	case TwoSided:
+		return "from both sides"
+	case FromBelow:
+		return "from below"
+	case FromAbove:
+		return "from above"
+	}
+	return "<?>"
+}
+
+type limitMethod int
+
+// Methods that find the limit of an expression
+const (
+	// Substitution evaluates the expression at the point, where it is continuous.
+	Substitution limitMethod = iota + 1
+	// DominantTerm compares the terms of the highest degree of polynomials and quotients of
+	// polynomials at infinity.
+	DominantTerm
+	// LHopital replaces quotients whose parts both tend to 0 or to infinity by the quotient of their
+	// derivatives, as in L'Hôpital's rule.
+	LHopital
+	// Richardson evaluates the expression ever closer to the point and extrapolates the values with
+	// Richardson's method.
+	Richardson
+)
+
+func (m limitMethod) String() string {
+	switch m {
+	case Substitution:
+		return "substitution"
+	case DominantTerm:
+		return "dominant term"
+	case LHopital:
+		return "L'Hôpital"
+	case Richardson:
+		return "Richardson"
+	}
+	return "<?>"
+}
+
+// LimitResult is the limit of an expression, along with how it was found.
+type LimitResult struct {
+	Value  float64     // Value is the limit, which may be infinite.
+	Method limitMethod // Method is the method that found the limit.
+	// Confidence is 1 for limits found symbolically. For extrapolated limits, it is the number of digits
+	// that the best extrapolations agree to over 15, or for infinite limits, the number of orders of
+	// magnitude by which the last ten samples grew, over 3. It is at most 1.
+	Confidence float64
+}
+
+// Limit finds the limit of an expression as a variable approaches a point, which may be infinite, from
+// the given direction. The other variables of the expression must be given with WithVariables.
+//
+// The limit is found symbolically when possible: by substitution where the expression is continuous,
+// by comparing dominant terms of polynomials at infinity, and by L'Hôpital's rule for quotients of the
+// forms 0/0 and ∞/∞. Otherwise the expression is evaluated ever closer to the point, and the values are
+// extrapolated with Richardson's method, whose confidence is reported. Values that keep growing make
+// the limit infinite. A two-sided limit fails if the limits from both sides differ, and any limit fails
+// if the expression is undefined near the point.
+func Limit(expr, variable string, point float64, direction limitDirection, opts ...NumericOption) (res LimitResult, err error) {
+	o := newNumericOptions(opts...)
+	eo := newEvalOptions(o.evalOptions...)
+	if direction < TwoSided || direction > FromAbove {
+		return LimitResult{}, fmt.Errorf(errLimitDirection, direction)
+	}
+	if math.IsInf(point, 0) && direction != TwoSided && (point > 0) == (direction == FromAbove) {
+		return LimitResult{}, fmt.Errorf(errLimitSide, point, direction)
+	}
+
+	root, err := parseNumeric(expr, eo)
+	if err != nil {
+		return LimitResult{}, err
+	}
+	fs, vars, err := bindFunctions(eo, []string{variable}, o.vars, root)
+	if err != nil {
+		return LimitResult{}, err
+	}
+	if root, err = expandCalculus(root, eo); err != nil {
+		return LimitResult{}, err
+	}
+
+	le := &limitEvaluator{name: variable, point: point, ev: newEvaluator(o.vars, eo), method: Substitution}
+	if v, ok := le.limit(root); ok {
+		return LimitResult{Value: v, Method: le.method, Confidence: 1}, nil
+	}
+
+	f := func(x float64) (float64, error) {
+		vars[0] = x
+		return fs[0](vars)
+	}
+	if math.IsInf(point, 0) || direction != TwoSided {
+		return sideLimit(f, point, direction)
+	}
+	below, err := sideLimit(f, point, FromBelow)
+	if err != nil {
+		return LimitResult{}, err
+	}
+	above, err := sideLimit(f, point, FromAbove)
+	if err != nil {
+		return LimitResult{}, err
+	}
+	return joinSides(below, above, point, o)
+}
+
+// limitDepth is the largest number of times L'Hôpital's rule is applied in a row.
+const limitDepth = 8
+
+// limitDegree is the highest degree of the polynomials whose dominant terms are compared.
+const limitDegree = 32
+
+// limitEvaluator takes limits of syntax trees symbolically, by taking the limits of their operands and
+// combining them where the result is determined.
+type limitEvaluator struct {
+	name   string
+	point  float64
+	ev     *evaluator // the evaluator of the other variables
+	method limitMethod
+	depth  int
+}
+
+// use records that a method was used, keeping the last one of Substitution, DominantTerm and LHopital.
+func (le *limitEvaluator) use(m limitMethod) {
+	if m > le.method {
+		le.method = m
+	}
+}
+
+// limit returns the limit of n, which is known if ok is set.
+func (le *limitEvaluator) limit(n node) (v float64, ok bool) {
+	if !dependsOn(n, le.name) {
+		return le.ev.constant(n)
+	}
+	if math.IsInf(le.point, 0) {
+		if v, ok = le.dominantTerm(n); ok {
+			return v, true
+		}
+	}
+
+	switch n := n.(type) {
+	case variableNode:
+		return le.point, true
+	case operatorNode:
+		return le.limitOperator(n)
+	}
+	return 0, false
+}
+
+func (le *limitEvaluator) limitOperator(n operatorNode) (v float64, ok bool) {
+	typ := n.op.Type()
+	switch typ {
+	case Plus, Minus, Percent, Addition, Subtraction, Multiplication, Division, Power:
+	default:
+		return 0, false
+	}
+	if (typ == Addition || typ == Subtraction) && le.ev.percentMode == CalculatorPercent &&
+		isOperatorNodeOf(n.operands[1], Percent) {
+		return 0, false
+	}
+
+	a, ok := le.limit(n.operands[0])
+	if !ok {
+		return 0, false
+	}
+	switch typ {
+	case Plus:
+		return a, true
+	case Minus:
+		return -a, true
+	case Percent:
+		return a / 100, true
+	}
+	if typ == Power && !dependsOn(n.operands[1], le.name) {
+		return le.limitPower(a, n.operands[1])
+	}
+
+	b, ok := le.limit(n.operands[1])
+	if !ok {
+		return 0, false
+	}
+	switch typ {
+	case Addition:
+		v = a + b
+	case Subtraction:
+		v = a - b
+	case Multiplication:
+		v = a * b
+	case Division:
+		if a == 0 && b == 0 || math.IsInf(a, 0) && math.IsInf(b, 0) {
+			return le.lHopital(n)
+		}
+		if b == 0 {
+			return 0, false // the sign of the infinity depends on the side
+		}
+		v = a / b
+	case Power:
+		// a^b for a varying exponent is only determined for positive bases, and 1^∞ is not
+		if a <= 0 || a == 1 && math.IsInf(b, 0) || math.IsInf(a, 0) && b == 0 {
+			return 0, false
+		}
+		v = math.Pow(a, b)
+	}
+	return v, !math.IsNaN(v)
+}
+
+// limitPower returns the limit of a power with a constant exponent, whose base tends to a.
+func (le *limitEvaluator) limitPower(a float64, exp node) (v float64, ok bool) {
+	e, ok := le.ev.constant(exp)
+	if !ok {
+		return 0, false
+	}
+	if a == 0 && (e < 0 || e != math.Trunc(e)) {
+		// the sign of the infinity, or whether the power is defined, depends on the side
+		return 0, false
+	}
+	v = math.Pow(a, e)
+	return v, !math.IsNaN(v)
+}
+
+// lHopital returns the limit of a quotient whose operands both tend to 0 or to infinity as the limit
+// of the quotient of their derivatives.
+func (le *limitEvaluator) lHopital(n operatorNode) (v float64, ok bool) {
+	if le.depth == limitDepth {
+		return 0, false
+	}
+	du, err := differentiate(n.operands[0], le.name, le.ev.evalOptions)
+	if err != nil {
+		return 0, false
+	}
+	dv, err := differentiate(n.operands[1], le.name, le.ev.evalOptions)
+	if err != nil {
+		return 0, false
+	}
+
+	le.depth++
+	defer func() { le.depth-- }()
+	if v, ok = le.limit(arithmetic(Division, du, dv, n.sp)); ok {
+		le.use(LHopital)
+	}
+	return v, ok
+}
+
+// dominantTerm returns the limit at infinity of a polynomial or a quotient of polynomials, which is set
+// by the terms of the highest degree.
+func (le *limitEvaluator) dominantTerm(n node) (v float64, ok bool) {
+	num, den := n, node(nil)
+	if isOperatorNodeOf(n, Division) {
+		num, den = n.(operatorNode).operands[0], n.(operatorNode).operands[1]
+	}
+	p, ok := le.polynomial(num)
+	if !ok {
+		return 0, false
+	}
+	q := []float64{1}
+	if den != nil {
+		if q, ok = le.polynomial(den); !ok {
+			return 0, false
+		}
+	}
+	if len(p) == 0 {
+		return 0, true
+	}
+	if len(q) == 0 {
+		return 0, false
+	}
+
+	// c x^d, where d may be negative
+	c, d := p[len(p)-1]/q[len(q)-1], len(p)-len(q)
+	switch {
+	case d == 0:
+		v = c
+	case d < 0:
+		v = 0
+	default:
+		v = math.Copysign(math.Inf(1), c*math.Pow(le.point, float64(d%2)))
+	}
+	// the comparison is only needed if terms that tend to infinity meet
+	if np, nq := growingTerms(p), growingTerms(q); np > 1 || nq > 1 || np > 0 && nq > 0 {
+		le.use(DominantTerm)
+	}
+	return v, true
+}
+
+// growingTerms returns the number of terms of a polynomial that tend to infinity with the variable.
+func growingTerms(p []float64) (n int) {
+	for i := 1; i < len(p); i++ {
+		if p[i] != 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// polynomial returns the coefficients of n as a polynomial in the variable, lowest degree first and
+// without trailing zeros.
+func (le *limitEvaluator) polynomial(n node) (coeffs []float64, ok bool) {
+	terms, ok := symbolicPolynomial(n, le.name, limitDegree, le.ev.evalOptions, le.ev.constant)
+	if !ok {
+		return nil, false
+	}
+	coeffs = make([]float64, len(terms))
+	for i, t := range terms {
+		if coeffs[i], ok = le.ev.constant(t); !ok {
+			return nil, false
+		}
+	}
+	for len(coeffs) > 0 && coeffs[len(coeffs)-1] == 0 {
+		coeffs = coeffs[:len(coeffs)-1]
+	}
+	return coeffs, true
+}
+
+const (
+	// limitSamples is the number of times the expression is evaluated on each side of a point.
+	limitSamples = 30
+	// limitColumns is the number of columns of the Richardson table, whose j-th column removes the
+	// terms of the error up to the j-th power of the step.
+	limitColumns = 8
+	// limitGrowth is the number of samples over which values must keep growing for the limit to be
+	// infinite.
+	limitGrowth = 10
+)
+
+// sideLimit finds the limit of f at a point from one side by Richardson extrapolation. The samples are
+// taken at steps h that halve from one eighth of the magnitude of the point, or of 1, and at 1/h for
+// infinite points.
+func sideLimit(f func(float64) (float64, error), point float64, direction limitDirection) (res LimitResult, err error) {
+	at := func(h float64) float64 {
+		if math.IsInf(point, 0) {
+			return math.Copysign(1/h, point)
+		}
+		if direction == FromBelow {
+			return point - h
+		}
+		return point + h
+	}
+	h0 := math.Max(1, math.Abs(point)) / 8
+	if math.IsInf(point, 0) {
+		h0 = 1
+	}
+
+	g := make([]float64, limitSamples)
+	for k := range g {
+		if g[k], err = f(at(h0 / math.Pow(2, float64(k)))); err != nil {
+			return LimitResult{}, err
+		}
+		if math.IsNaN(g[k]) {
+			return LimitResult{}, fmt.Errorf(errLimitUndefined, point, direction)
+		}
+	}
+
+	if v, confidence, ok := divergence(g); ok {
+		return LimitResult{Value: v, Method: Richardson, Confidence: confidence}, nil
+	}
+
+	// r[j] holds the j-th column of the previous row of the table. The error of an entry is estimated
+	// from its neighbors of lower order, and the table stops growing once rounding errors make its
+	// highest orders diverge, as in Ridders' method.
+	r := []float64{g[0]}
+	v, best := g[0], math.Inf(1)
+	for k := 1; k < limitSamples; k++ {
+		row := []float64{g[k]}
+		for j := 1; j <= k && j < limitColumns; j++ {
+			row = append(row, row[j-1]+(row[j-1]-r[j-1])/(math.Pow(2, float64(j))-1))
+			if e := math.Max(math.Abs(row[j]-row[j-1]), math.Abs(row[j]-r[j-1])); e <= best {
+				v, best = row[j], e
+			}
+		}
+		if math.Abs(row[len(row)-1]-r[len(r)-1]) >= 2*best {
+			break
+		}
+		r = row
+	}
+	return LimitResult{Value: v, Method: Richardson, Confidence: confidence(v, best)}, nil
+}
+
+// divergence checks whether the last samples keep growing with the same sign, in which case the limit
+// is infinite.
+func divergence(g []float64) (v, confidence float64, ok bool) {
+	last := g[len(g)-limitGrowth:]
+	for i := 1; i < len(last); i++ {
+		if math.Abs(last[i]) <= math.Abs(last[i-1]) || math.Signbit(last[i]) != math.Signbit(last[0]) {
+			return 0, 0, false
+		}
+	}
+	growth := math.Log10(math.Abs(last[len(last)-1] / last[0]))
+	if last[0] == 0 || growth < math.Log10(4) {
+		return 0, 0, false
+	}
+	return math.Copysign(math.Inf(1), last[0]), math.Min(1, growth/3), true
+}
+
+// confidence returns the number of digits of v that an error estimate leaves, over 15.
+func confidence(v, err float64) float64 {
+	digits := -math.Log10(err / math.Max(1, math.Abs(v)))
+	return math.Max(0, math.Min(1, digits/15))
+}
+
+// joinSides returns the two-sided limit at a point from its one-sided limits, which must agree.
+func joinSides(below, above LimitResult, point float64, o numericOptions) (res LimitResult, err error) {
+	a, b := below.Value, above.Value
+	res = LimitResult{Value: (a + b) / 2, Method: Richardson, Confidence: math.Min(below.Confidence, above.Confidence)}
+	if math.IsInf(a, 0) || math.IsInf(b, 0) {
+		if a != b {
+			return LimitResult{}, fmt.Errorf(errLimitSides, point, a, b)
+		}
+		res.Value = a
+		return res, nil
+	}
+
+	// the sides agree if they are as close as either is accurate, or within the tolerance
+	scale := math.Max(1, math.Max(math.Abs(a), math.Abs(b)))
+	accuracy := math.Pow(10, -15*res.Confidence) * scale
+	if math.Abs(a-b) > math.Max(10*accuracy, o.tolerance*scale) {
+		return LimitResult{}, fmt.Errorf(errLimitSides, point, a, b)
+	}
+	return res, nil
+}
@@ -0,0 +1,101 @@
+package yamp
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimit(t *testing.T) {
+	inf := math.Inf(1)
+	tests := []struct {
+		name       string
+		expr       string
+		point      float64
+		direction  limitDirection
+		opts       []NumericOption
+		want       float64
+		wantMethod limitMethod
+		delta      float64
+	}{
+		{"continuous expressions are substituted", "x^2 + a", 2, TwoSided, []NumericOption{WithVariables(Variables{"a": 1})}, 5, Substitution, 0},
+		{"L'Hôpital's rule resolves 0/0", "(x^2 - 1) / (x - 1)", 1, TwoSided, nil, 2, LHopital, 0},
+		{"L'Hôpital's rule is applied repeatedly", "(x^3 - 3x + 2) / (x - 1)^2", 1, TwoSided, nil, 3, LHopital, 0},
+		{"L'Hôpital's rule resolves ∞/∞", "x^1.5 / (x^2 + 1)", inf, TwoSided, nil, 0, LHopital, 0},
+		{"L'Hôpital's rule works on roots", "((1 + x)^0.5 - 1) / x", 0, TwoSided, nil, 0.5, LHopital, 0},
+		{"quotients of polynomials tend to their leading coefficients", "(2x^2 + 1) / (x^2 - 3)", inf, TwoSided, nil, 2, DominantTerm, 0},
+		{"dominant terms give the sign of infinities", "(x^3 + 1) / (1 - x^2)", -inf, TwoSided, nil, inf, DominantTerm, 0},
+		{"polynomials are dominated by their highest degree", "x - x^2", inf, FromBelow, nil, -inf, DominantTerm, 0},
+		{"reciprocals of infinities vanish", "2^(-x) + 1", inf, TwoSided, nil, 1, Substitution, 0},
+		{"one-sided limits may be infinite", "1 / x", 0, FromBelow, nil, -inf, Richardson, 0},
+		{"two-sided limits may be infinite", "1 / x^2", 0, TwoSided, nil, inf, Richardson, 0},
+		{"functions are extrapolated", "if(x > 0, 1, -1) + x", 0, FromAbove, nil, 1, Richardson, 1e-12},
+		{"removable discontinuities are extrapolated", "if(x == 0, 5, (x^2 + x) / x)", 0, TwoSided, nil, 1, Richardson, 1e-12},
+		{"indeterminate powers are extrapolated", "(1 + x)^(1 / x)", 0, TwoSided, nil, math.E, Richardson, 1e-11},
+		{"limits at infinity are extrapolated in 1/x", "(1 + 1/x)^x", inf, TwoSided, nil, math.E, Richardson, 1e-11},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Limit(tt.expr, "x", tt.point, tt.direction, tt.opts...)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tt.wantMethod, got.Method)
+			if math.IsInf(tt.want, 0) {
+				assert.Equal(t, tt.want, got.Value)
+			} else {
+				assert.InDelta(t, tt.want, got.Value, tt.delta)
+			}
+			if tt.wantMethod == Richardson {
+				assert.True(t, got.Confidence > 0.6, "confidence %v", got.Confidence)
+			} else {
+				assert.Equal(t, 1.0, got.Confidence)
+			}
+		})
+	}
+}
+
+func TestLimit_confidence(t *testing.T) {
+	// the error of the square root is not a power series in the step, which lowers the confidence
+	got, err := Limit("x^0.5", "x", 0, FromAbove)
+	assert.NoError(t, err)
+	assert.InDelta(t, 0, got.Value, 1e-4)
+	assert.True(t, got.Confidence < 0.5, "confidence %v", got.Confidence)
+	assert.True(t, math.Abs(got.Value) < 10*math.Pow(10, -15*got.Confidence), "the confidence is roughly right")
+}
+
+func TestLimit_errors(t *testing.T) {
+	tests := []struct {
+		name      string
+		expr      string
+		point     float64
+		direction limitDirection
+		wantErr   error
+	}{
+		{"the sides of a pole differ", "1 / x", 0, TwoSided, fmt.Errorf(errLimitSides, 0.0, math.Inf(-1), math.Inf(1))},
+		{"the sides of a jump differ", "if(x < 1, 0, 1)", 1, TwoSided, fmt.Errorf(errLimitSides, 1.0, 0.0, 1.0)},
+		{"expressions must be defined near the point", "x^0.5", 0, TwoSided, fmt.Errorf(errLimitUndefined, 0.0, FromBelow)},
+		{"infinity cannot be approached from above", "x", math.Inf(1), FromAbove, fmt.Errorf(errLimitSide, math.Inf(1), FromAbove)},
+		{"directions must be known", "x", 0, 0, fmt.Errorf(errLimitDirection, 0)},
+		{"other variables must be given", "x + y", 0, TwoSided, fmt.Errorf(errUnboundVariable, "y")},
+		{
+			name:      "the expression must be numeric",
+			expr:      "x > 0",
+			point:     0,
+			direction: TwoSided,
+			wantErr:   TypeError{Message: fmt.Sprintf(errResultType, NumericValue, BooleanValue), Span: Span{Start: 0, End: 5}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Limit(tt.expr, "x", tt.point, tt.direction)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+
+	_, err := Limit("x", "x", 0, TwoSided, WithEvalOptions(WithNumberMode(BigIntMode)))
+	assert.Equal(t, errors.New(errCompileNumberMode), err)
+}
@@ -0,0 +1,553 @@
+package yamp
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// LinearSolution is the solution of a system of linear equations. Every solution of the system is Values
+// plus any multiple of each of Directions.
+type LinearSolution struct {
+	Variables  []string    // Variables are the unknowns, in the order they were given.
+	Values     []float64   // Values holds a solution, in which the free variables are 0.
+	Free       []string    // Free lists the variables that may take any value.
+	Directions [][]float64 // Directions[j] holds how much each variable changes per unit of Free[j].
+	Rank       int         // Rank is the number of independent equations.
+	// Exact and ExactDirections hold Values and Directions as fractions when WithExact is given.
+	Exact           []*big.Rat
+	ExactDirections [][]*big.Rat
+}
+
+// String describes the solution with an equation for each variable that is not free, followed by the free
+// variables, as in "x = 3 - 2 * z; y = 1 + z; z free".
+func (s LinearSolution) String() string {
+	free := make(map[string]bool)
+	for _, name := range s.Free {
+		free[name] = true
+	}
+
+	var parts []string
+	for i, name := range s.Variables {
+		if free[name] {
+			continue
+		}
+		var sb strings.Builder
+		sb.WriteString(name + " = ")
+		written := false
+		for j := -1; j < len(s.Free); j++ {
+			text, sign := s.coefficient(i, j)
+			if sign == 0 {
+				continue
+			}
+			switch {
+			case written && sign < 0:
+				sb.WriteString(" - ")
+			case written:
+				sb.WriteString(" + ")
+			case sign < 0:
+				sb.WriteString("-")
+			}
+			written = true
+			switch {
+			case j < 0:
+				sb.WriteString(text)
+			case text == "1":
+				sb.WriteString(s.Free[j])
+			default:
+				sb.WriteString(text + " * " + s.Free[j])
+			}
+		}
+		if !written {
+			sb.WriteString("0")
+		}
+		parts = append(parts, sb.String())
+	}
+	for _, name := range s.Free {
+		parts = append(parts, name+" free")
+	}
+	return strings.Join(parts, "; ")
+}
+
+// coefficient returns the magnitude and the sign of the value of the i-th variable, or of its change per
+// unit of the j-th free variable if j is not negative.
+func (s LinearSolution) coefficient(i, j int) (text string, sign int) {
+	if s.Exact != nil {
+		r := s.Exact[i]
+		if j >= 0 {
+			r = s.ExactDirections[j][i]
+		}
+		return new(big.Rat).Abs(r).RatString(), r.Sign()
+	}
+	v := s.Values[i]
+	if j >= 0 {
+		v = s.Directions[j][i]
+	}
+	switch {
+	case v > 0:
+		sign = 1
+	case v < 0:
+		sign = -1
+	}
+	return strconv.FormatFloat(math.Abs(v), 'g', -1, 64), sign
+}
+
+// SolveLinear solves a system of linear equations in the given variables, separated by ';', such as
+// "2x + 3y = 7; x - y = 1". An equation without '=' is solved for the values that make it zero. The other
+// variables of the system must be given with WithVariables.
+//
+// The coefficients of each variable are read from the equations symbolically, and the system is solved
+// by LU factorization with partial pivoting, in which coefficients within the tolerance of zero, relative
+// to the largest coefficient, are taken to be zero. Systems with fewer independent equations than
+// variables have infinitely many solutions, which are described by the free variables; systems without a
+// solution are reported as errors. With WithExact, the system is solved with fractions instead.
+func SolveLinear(system string, variables []string, opts ...NumericOption) (res LinearSolution, err error) {
+	o := newNumericOptions(opts...)
+	eo := newEvalOptions(o.evalOptions...)
+	if len(variables) == 0 {
+		return LinearSolution{}, errors.New(errNoUnknowns)
+	}
+	unknowns := make(map[string]int)
+	for i, name := range variables {
+		if _, ok := unknowns[name]; ok {
+			return LinearSolution{}, fmt.Errorf(errSolvedTwice, name)
+		}
+		unknowns[name] = i
+	}
+
+	var residuals []node
+	for _, eq := range splitSystem(system) {
+		root, err := parseNumeric(eq, eo)
+		if err != nil {
+			return LinearSolution{}, err
+		}
+		if n, ok := root.(operatorNode); ok && n.op.Type() == Equation {
+			// lhs = rhs is solved as lhs - rhs = 0
+			root = operatorNode{op: NewOperator(Subtraction), opSpan: n.opSpan, operands: n.operands, sp: n.sp}
+		}
+		residuals = append(residuals, root)
+	}
+	if len(residuals) == 0 {
+		return LinearSolution{}, errors.New(errEmptyExpression)
+	}
+	fs, vars, err := bindFunctions(eo, variables, o.vars, residuals...)
+	if err != nil {
+		return LinearSolution{}, err
+	}
+	for i := range residuals {
+		if residuals[i], err = expandCalculus(residuals[i], eo); err != nil {
+			return LinearSolution{}, err
+		}
+	}
+
+	// the residual of an equation is a x + c, where c is its value at 0
+	ev := newEvaluator(o.vars, eo)
+	a := make([][]float64, len(residuals))
+	c := make([]float64, len(residuals))
+	for i := range vars[:len(variables)] {
+		vars[i] = 0
+	}
+	for i, r := range residuals {
+		a[i] = make([]float64, len(variables))
+		for j, name := range variables {
+			p, ok := symbolicPolynomial(r, name, 1, eo, ev.constant)
+			if !ok || len(p) == 2 && dependsOnAny(p[1], variables) {
+				return LinearSolution{}, fmt.Errorf(errNonlinear, r.span().Start, name)
+			}
+			if len(p) < 2 {
+				continue
+			}
+			if a[i][j], ok = ev.constant(p[1]); !ok {
+				return LinearSolution{}, fmt.Errorf(errLinearCoefficient, r.span().Start)
+			}
+		}
+		if c[i], err = fs[i](vars); err != nil {
+			return LinearSolution{}, err
+		}
+		if math.IsNaN(c[i]) || math.IsInf(c[i], 0) {
+			return LinearSolution{}, fmt.Errorf(errLinearCoefficient, r.span().Start)
+		}
+	}
+
+	if o.exact {
+		return solveExact(residuals, variables, unknowns, o.vars, eo)
+	}
+
+	b := make([]float64, len(c))
+	for i := range c {
+		b[i] = -c[i]
+	}
+	f := factorLU(a, o.tolerance)
+	x, ok := f.solve(b, o.tolerance)
+	if !ok {
+		return LinearSolution{}, errors.New(errInconsistent)
+	}
+	res = LinearSolution{Variables: variables, Values: x, Rank: len(f.pivots)}
+	for _, col := range f.free() {
+		d := make([]float64, len(variables))
+		d[col] = 1
+		f.backSubstitute(make([]float64, len(f.pivots)), d)
+		res.Free = append(res.Free, variables[col])
+		res.Directions = append(res.Directions, d)
+	}
+	return res, nil
+}
+
+// splitSystem returns the equations of a system, which are separated by ';'. Each equation is the system
+// with every other rune blanked out, so that the positions in errors are those in the system. Blank
+// equations are left out.
+func splitSystem(system string) (eqs []string) {
+	runes := []rune(system)
+	start := 0
+	for i := 0; i <= len(runes); i++ {
+		if i < len(runes) && runes[i] != ';' {
+			continue
+		}
+		if strings.TrimSpace(string(runes[start:i])) != "" {
+			eq := []rune(strings.Repeat(" ", len(runes)))
+			copy(eq[start:i], runes[start:i])
+			eqs = append(eqs, string(eq))
+		}
+		start = i + 1
+	}
+	return eqs
+}
+
+// dependsOnAny checks whether any of the variables appears in the tree of n.
+func dependsOnAny(n node, names []string) bool {
+	for _, name := range names {
+		if dependsOn(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// luFactor is the LU factorization with partial pivoting of a matrix A, P A = L U, where U is in row
+// echelon form. Columns without a pivot belong to free variables. U is stored on and above its pivots,
+// and the multipliers of L below them.
+type luFactor struct {
+	lu     [][]float64
+	perm   []int // perm[i] is the row of A that is the i-th row of P A.
+	pivots []int // pivots[r] is the column of the pivot of the r-th row of U.
+}
+
+// factorLU factors a matrix, taking entries within tol of zero relative to its largest entry to be zero.
+func factorLU(a [][]float64, tol float64) luFactor {
+	m, n := len(a), len(a[0])
+	f := luFactor{lu: make([][]float64, m), perm: make([]int, m)}
+	scale := 0.0
+	for i, row := range a {
+		f.lu[i] = append([]float64(nil), row...)
+		f.perm[i] = i
+		for _, v := range row {
+			scale = math.Max(scale, math.Abs(v))
+		}
+	}
+
+	lu := f.lu
+	for col, r := 0, 0; col < n && r < m; col++ {
+		p := r
+		for i := r + 1; i < m; i++ {
+			if math.Abs(lu[i][col]) > math.Abs(lu[p][col]) {
+				p = i
+			}
+		}
+		if math.Abs(lu[p][col]) <= tol*scale {
+			continue
+		}
+		lu[r], lu[p] = lu[p], lu[r]
+		f.perm[r], f.perm[p] = f.perm[p], f.perm[r]
+		for i := r + 1; i < m; i++ {
+			k := lu[i][col] / lu[r][col]
+			lu[i][col] = k
+			for j := col + 1; j < n; j++ {
+				lu[i][j] -= k * lu[r][j]
+			}
+		}
+		f.pivots = append(f.pivots, col)
+		r++
+	}
+	return f
+}
+
+// solve returns a solution of A x = b, in which the variables of the columns without a pivot are 0. It
+// fails if the rows of U without a pivot are not matched by zeros within tol, relative to the largest
+// entry of b, which means the system has no solution.
+func (f luFactor) solve(b []float64, tol float64) (x []float64, ok bool) {
+	y := make([]float64, len(b))
+	scale := 1.0
+	for i, p := range f.perm {
+		y[i] = b[p]
+		scale = math.Max(scale, math.Abs(b[p]))
+	}
+	for r, col := range f.pivots {
+		for i := r + 1; i < len(y); i++ {
+			y[i] -= f.lu[i][col] * y[r]
+		}
+	}
+	for _, v := range y[len(f.pivots):] {
+		if math.Abs(v) > tol*scale {
+			return nil, false
+		}
+	}
+
+	x = make([]float64, len(f.lu[0]))
+	f.backSubstitute(y, x)
+	return x, true
+}
+
+// backSubstitute solves U x = y for the variables of the pivot columns, given the others in x.
+func (f luFactor) backSubstitute(y, x []float64) {
+	for r := len(f.pivots) - 1; r >= 0; r-- {
+		col := f.pivots[r]
+		s := y[r]
+		for j := col + 1; j < len(x); j++ {
+			s -= f.lu[r][j] * x[j]
+		}
+		x[col] = s / f.lu[r][col]
+	}
+}
+
+// free returns the columns without a pivot.
+func (f luFactor) free() (cols []int) {
+	r := 0
+	for col := range f.lu[0] {
+		if r < len(f.pivots) && f.pivots[r] == col {
+			r++
+			continue
+		}
+		cols = append(cols, col)
+	}
+	return cols
+}
+
+// solveExact solves a linear system with fractions, by Gaussian elimination.
+func solveExact(residuals []node, variables []string, unknowns map[string]int, vars Variables, o evalOptions) (res LinearSolution, err error) {
+	// the rows are the coefficients of the residuals followed by the opposite of their constant term
+	n := len(variables)
+	rows := make([][]*big.Rat, len(residuals))
+	for i, r := range residuals {
+		if rows[i], err = rationalForm(r, unknowns, vars, o); err != nil {
+			return LinearSolution{}, err
+		}
+		rows[i][n].Neg(rows[i][n])
+	}
+
+	var pivots []int
+	for col, r := 0, 0; col < n && r < len(rows); col++ {
+		p := r
+		for p < len(rows) && rows[p][col].Sign() == 0 {
+			p++
+		}
+		if p == len(rows) {
+			continue
+		}
+		rows[r], rows[p] = rows[p], rows[r]
+		for i := range rows {
+			if i == r || rows[i][col].Sign() == 0 {
+				continue
+			}
+			k := new(big.Rat).Quo(rows[i][col], rows[r][col])
+			for j := col; j <= n; j++ {
+				rows[i][j].Sub(rows[i][j], new(big.Rat).Mul(k, rows[r][j]))
+			}
+		}
+		pivots = append(pivots, col)
+		r++
+	}
+	for _, row := range rows[len(pivots):] {
+		if row[n].Sign() != 0 {
+			return LinearSolution{}, errors.New(errInconsistent)
+		}
+	}
+
+	// every row has a single pivot, so the variables of the pivots follow from the free variables
+	res = LinearSolution{Variables: variables, Rank: len(pivots), Exact: make([]*big.Rat, n)}
+	isPivot := make([]bool, n)
+	for r, col := range pivots {
+		isPivot[col] = true
+		res.Exact[col] = new(big.Rat).Quo(rows[r][n], rows[r][col])
+	}
+	for col := range res.Exact {
+		if res.Exact[col] == nil {
+			res.Exact[col] = new(big.Rat)
+		}
+	}
+	for free := 0; free < n; free++ {
+		if isPivot[free] {
+			continue
+		}
+		d := make([]*big.Rat, n)
+		for col := range d {
+			d[col] = new(big.Rat)
+		}
+		d[free].SetInt64(1)
+		for r, col := range pivots {
+			d[col].Quo(rows[r][free], rows[r][col])
+			d[col].Neg(d[col])
+		}
+		res.Free = append(res.Free, variables[free])
+		res.ExactDirections = append(res.ExactDirections, d)
+	}
+
+	res.Values = rationalFloats(res.Exact)
+	for _, d := range res.ExactDirections {
+		res.Directions = append(res.Directions, rationalFloats(d))
+	}
+	return res, nil
+}
+
+func rationalFloats(rs []*big.Rat) []float64 {
+	vs := make([]float64, len(rs))
+	for i, r := range rs {
+		vs[i], _ = r.Float64()
+	}
+	return vs
+}
+
+// maxExactExponent is the largest magnitude of the integer exponents of powers computed with fractions.
+const maxExactExponent = 1024
+
+// rationalForm returns the coefficients of the unknowns in a linear syntax tree as fractions, followed by
+// its constant term. Numbers are read from their decimal digits, and the values of the other variables
+// from their shortest decimal representation. Operations that are not exact with fractions fail.
+func rationalForm(n node, unknowns map[string]int, vars Variables, o evalOptions) (form []*big.Rat, err error) {
+	form = make([]*big.Rat, len(unknowns)+1)
+	for i := range form {
+		form[i] = new(big.Rat)
+	}
+	constant := form[len(unknowns)]
+
+	switch n := n.(type) {
+	case numberNode:
+		// the digits are only used if they are those of the value
+		if _, ok := constant.SetString(n.symbol); ok {
+			if f, _ := constant.Float64(); f == n.value {
+				return form, nil
+			}
+		}
+		if n.value != math.Trunc(n.value) || math.IsInf(n.value, 0) {
+			return nil, fmt.Errorf(errLinearInexact, n.symbol, n.sp.Start)
+		}
+		constant.SetFloat64(n.value)
+		return form, nil
+	case variableNode:
+		if j, ok := unknowns[n.name]; ok {
+			form[j].SetInt64(1)
+			return form, nil
+		}
+		if _, ok := constant.SetString(strconv.FormatFloat(vars[n.name], 'g', -1, 64)); !ok {
+			return nil, fmt.Errorf(errLinearInexact, n.name, n.sp.Start)
+		}
+		return form, nil
+	case callNode:
+		return nil, fmt.Errorf(errLinearInexact, n.fn, n.fnSpan.Start)
+	}
+
+	op := n.(operatorNode)
+	inexact := fmt.Errorf(errLinearInexact, op.op, op.opSpan.Start)
+	typ := op.op.Type()
+	switch typ {
+	case Plus, Minus, Percent, Addition, Subtraction, Multiplication, Division, Power:
+	default:
+		return nil, inexact
+	}
+	a, err := rationalForm(op.operands[0], unknowns, vars, o)
+	if err != nil {
+		return nil, err
+	}
+	switch typ {
+	case Plus:
+		return a, nil
+	case Minus:
+		return scaleForm(a, big.NewRat(-1, 1)), nil
+	case Percent:
+		return scaleForm(a, big.NewRat(1, 100)), nil
+	}
+
+	right := op.operands[1]
+	relative := o.percentMode == CalculatorPercent && isOperatorNodeOf(right, Percent) && (typ == Addition || typ == Subtraction)
+	if relative {
+		right = right.(operatorNode).operands[0]
+	}
+	b, err := rationalForm(right, unknowns, vars, o)
+	if err != nil {
+		return nil, err
+	}
+	if relative {
+		// a ± b% is a (1 ± b/100)
+		b = scaleForm(b, big.NewRat(1, 100))
+		if typ == Subtraction {
+			b = scaleForm(b, big.NewRat(-1, 1))
+		}
+		b[len(unknowns)].Add(b[len(unknowns)], big.NewRat(1, 1))
+		typ = Multiplication
+	}
+
+	switch typ {
+	case Addition, Subtraction:
+		for i := range form {
+			if typ == Addition {
+				form[i].Add(a[i], b[i])
+			} else {
+				form[i].Sub(a[i], b[i])
+			}
+		}
+		return form, nil
+	case Multiplication:
+		if k, ok := constantForm(b); ok {
+			return scaleForm(a, k), nil
+		}
+		if k, ok := constantForm(a); ok {
+			return scaleForm(b, k), nil
+		}
+	case Division:
+		if k, ok := constantForm(b); ok && k.Sign() != 0 {
+			return scaleForm(a, k.Inv(k)), nil
+		}
+	case Power:
+		e, ok := constantForm(b)
+		if !ok || !e.IsInt() || e.Num().CmpAbs(big.NewInt(maxExactExponent)) > 0 {
+			break
+		}
+		switch k := e.Num().Int64(); {
+		case k == 1:
+			return a, nil
+		case k == 0:
+			constant.SetInt64(1)
+			return form, nil
+		}
+		base, ok := constantForm(a)
+		if !ok || base.Sign() == 0 && e.Sign() < 0 {
+			break
+		}
+		abs := new(big.Int).Abs(e.Num())
+		constant.SetFrac(new(big.Int).Exp(base.Num(), abs, nil), new(big.Int).Exp(base.Denom(), abs, nil))
+		if e.Sign() < 0 {
+			constant.Inv(constant)
+		}
+		return form, nil
+	}
+	return nil, inexact
+}
+
+// constantForm returns the constant term of a form whose coefficients are all zero.
+func constantForm(form []*big.Rat) (*big.Rat, bool) {
+	for _, c := range form[:len(form)-1] {
+		if c.Sign() != 0 {
+			return nil, false
+		}
+	}
+	return new(big.Rat).Set(form[len(form)-1]), true
+}
+
+func scaleForm(form []*big.Rat, k *big.Rat) []*big.Rat {
+	for _, c := range form {
+		c.Mul(c, k)
+	}
+	return form
+}
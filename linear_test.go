@@ -0,0 +1,82 @@
+package yamp
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSolveLinear(t *testing.T) {
+	tests := []struct {
+		name      string
+		system    string
+		variables []string
+		opts      []NumericOption
+		want      string
+		wantRank  int
+	}{
+		{"square systems have a single solution", "2x + 3y = 7; x - y = 1", []string{"x", "y"}, nil, "x = 2; y = 1", 2},
+		{"pivots are swapped in", "y = 2; x + y = 3", []string{"x", "y"}, nil, "x = 1; y = 2", 2},
+		{"equations without '=' are zero", "x - 2y; y - 1", []string{"x", "y"}, nil, "x = 2; y = 1", 2},
+		{"other variables are constants", "a x = 1; y = x / 3", []string{"x", "y"}, []NumericOption{WithVariables(Variables{"a": 0.5})}, "x = 2; y = 0.6666666666666666", 2},
+		{"under-determined systems are parametric", "x + y + z = 3; x - y = 1", []string{"x", "y", "z"}, nil, "x = 2 - 0.5 * z; y = 1 - 0.5 * z; z free", 2},
+		{"dependent equations do not count", "x + y = 1; 2x + 2y = 2", []string{"x", "y"}, nil, "x = 1 - y; y free", 1},
+		{"consistent over-determined systems are solved", "x = 1; y = 2; x + y = 3", []string{"x", "y"}, nil, "x = 1; y = 2", 2},
+		{"blank equations are skipped", "x = 1;; y = x;", []string{"x", "y"}, nil, "x = 1; y = 1", 2},
+		{"fractions are exact", "0.1x + 0.2y = 0.3; x = 3y", []string{"x", "y"}, []NumericOption{WithExact()}, "x = 9/5; y = 3/5", 2},
+		{"exact systems may be parametric", "x + y + z = 3; x - y = 1", []string{"x", "y", "z"}, []NumericOption{WithExact()}, "x = 2 - 1/2 * z; y = 1 - 1/2 * z; z free", 2},
+		{"exact powers and percentages", "x = 2^-3 + 50%; y = a x", []string{"x", "y"}, []NumericOption{WithExact(), WithVariables(Variables{"a": 0.1})}, "x = 5/8; y = 1/16", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SolveLinear(tt.system, tt.variables, tt.opts...)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tt.want, got.String())
+			assert.Equal(t, tt.wantRank, got.Rank)
+			assert.Equal(t, tt.variables, got.Variables)
+			assert.Len(t, got.Directions, len(tt.variables)-tt.wantRank)
+		})
+	}
+}
+
+func TestSolveLinear_exact(t *testing.T) {
+	got, err := SolveLinear("3x = 1; x + y = 0", []string{"x", "y"}, WithExact())
+	if assert.NoError(t, err) {
+		assert.Equal(t, []*big.Rat{big.NewRat(1, 3), big.NewRat(-1, 3)}, got.Exact)
+		assert.InDeltaSlice(t, []float64{1.0 / 3, -1.0 / 3}, got.Values, 1e-15)
+	}
+}
+
+func TestSolveLinear_errors(t *testing.T) {
+	tests := []struct {
+		name      string
+		system    string
+		variables []string
+		opts      []NumericOption
+		wantErr   error
+	}{
+		{"variables are needed", "x = 1", nil, nil, errors.New(errNoUnknowns)},
+		{"variables are solved for once", "x = 1", []string{"x", "x"}, nil, fmt.Errorf(errSolvedTwice, "x")},
+		{"equations are needed", " ; ", []string{"x"}, nil, errors.New(errEmptyExpression)},
+		{"products of unknowns are not linear", "x + y = 1; x y = 2", []string{"x", "y"}, nil, fmt.Errorf(errNonlinear, 11, "x")},
+		{"powers of unknowns are not linear", "x = 1; y^2 = 2", []string{"x", "y"}, nil, fmt.Errorf(errNonlinear, 7, "y")},
+		{"coefficients must be finite", "x * (1/0) = 1", []string{"x"}, nil, fmt.Errorf(errLinearCoefficient, 0)},
+		{"inconsistent systems have no solution", "x + y = 1; 2x + 2y = 3", []string{"x", "y"}, nil, errors.New(errInconsistent)},
+		{"exact inconsistent systems have no solution", "x + y = 1; 2x + 2y = 3", []string{"x", "y"}, []NumericOption{WithExact()}, errors.New(errInconsistent)},
+		{"other variables must be given", "x = 1; y = z", []string{"x", "y"}, nil, fmt.Errorf(errUnboundVariable, "z")},
+		{"positions are those in the system", "x = 1; y = 2 +", []string{"x", "y"}, nil, SyntaxError{Message: fmt.Sprintf(errNoRightOperand, "+", 14), Token: "+", Position: 13}},
+		{"fractional powers are not exact", "x = 2^0.5", []string{"x"}, []NumericOption{WithExact()}, fmt.Errorf(errLinearInexact, "^", 5)},
+		{"functions are not exact", "x = if(1 > 0, 1, 2)", []string{"x"}, []NumericOption{WithExact()}, fmt.Errorf(errLinearInexact, "if", 4)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := SolveLinear(tt.system, tt.variables, tt.opts...)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
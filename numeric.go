@@ -0,0 +1,228 @@
+package yamp
+
+import (
+	"errors"
+	"fmt"
+)
+
+// NumericOption configures the numerical methods that solve equations. Options that do not apply to the
+// method used are ignored.
+type NumericOption func(*numericOptions)
+
+type numericOptions struct {
+	evalOptions   []EvalOption
+	vars          Variables
+	tolerance     float64
+	maxIterations int // 0 picks the default of the method
+	// the interval to search, if hasInterval is set
+	hasInterval  bool
+	lo, hi       float64
+	subdivisions int
+	// options of optimization
+	method      optimizeMethod
+	bounds      map[string]bounds
+	constraints []string
+	// whether linear systems are solved with fractions
+	exact bool
+	// options of differential equations
+	odeMethod odeMethod
+	step      float64
+	event     string
+}
+
+// bounds are the lowest and highest values of a variable.
+type bounds struct {
+	lo, hi float64
+}
+
+func newNumericOptions(opts ...NumericOption) numericOptions {
+	o := numericOptions{tolerance: 1e-10, subdivisions: 100}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithEvalOptions sets how the expression is parsed and evaluated. Only FloatMode is supported.
+func WithEvalOptions(opts ...EvalOption) NumericOption {
+	return func(o *numericOptions) {
+		o.evalOptions = append(o.evalOptions, opts...)
+	}
+}
+
+// WithVariables sets the values of the variables that are not solved for. The value of a variable that
+// is solved for is used as the starting point of iterative methods.
+func WithVariables(vars Variables) NumericOption {
+	return func(o *numericOptions) {
+		o.vars = vars
+	}
+}
+
+// WithTolerance sets the tolerance of iterative methods, relative to the magnitude of the result when it
+// is greater than 1. The default is 1e-10.
+func WithTolerance(tol float64) NumericOption {
+	return func(o *numericOptions) {
+		if tol > 0 {
+			o.tolerance = tol
+		}
+	}
+}
+
+// WithMaxIterations sets the number of iterations after which iterative methods give up. The default is
+// 100, except for Nelder-Mead and BFGS, which take 500 and 100 iterations per variable by default.
+func WithMaxIterations(n int) NumericOption {
+	return func(o *numericOptions) {
+		if n > 0 {
+			o.maxIterations = n
+		}
+	}
+}
+
+// iterations returns the maximum number of iterations of a method whose default is def.
+func (o numericOptions) iterations(def int) int {
+	if o.maxIterations > 0 {
+		return o.maxIterations
+	}
+	return def
+}
+
+// WithInterval restricts the roots found by Solve to the closed interval [lo, hi].
+func WithInterval(lo, hi float64) NumericOption {
+	return func(o *numericOptions) {
+		if lo > hi {
+			lo, hi = hi, lo
+		}
+		o.hasInterval, o.lo, o.hi = true, lo, hi
+	}
+}
+
+// WithSubdivisions sets the number of equal parts the interval is split into when looking for every root
+// in it. Roots closer together than a part may be missed. The default is 100.
+func WithSubdivisions(n int) NumericOption {
+	return func(o *numericOptions) {
+		if n > 0 {
+			o.subdivisions = n
+		}
+	}
+}
+
+// WithMethod sets the method used by Minimize and Maximize.
+func WithMethod(m optimizeMethod) NumericOption {
+	return func(o *numericOptions) {
+		o.method = m
+	}
+}
+
+// WithBounds restricts a variable optimized by Minimize or Maximize to the closed interval [lo, hi]. Either
+// end may be infinite.
+func WithBounds(name string, lo, hi float64) NumericOption {
+	return func(o *numericOptions) {
+		if lo > hi {
+			lo, hi = hi, lo
+		}
+		if o.bounds == nil {
+			o.bounds = make(map[string]bounds)
+		}
+		o.bounds[name] = bounds{lo: lo, hi: hi}
+	}
+}
+
+// WithConstraints adds boolean expressions such as "x + y <= 10" that the result of Minimize and Maximize
+// must satisfy.
+func WithConstraints(exprs ...string) NumericOption {
+	return func(o *numericOptions) {
+		o.constraints = append(o.constraints, exprs...)
+	}
+}
+
+// WithExact makes SolveLinear compute with fractions, reading numbers from their decimal digits, so that
+// the solution is exact. Operations that are not exact with fractions, such as powers with non-integer
+// exponents and function calls, are reported as errors.
+func WithExact() NumericOption {
+	return func(o *numericOptions) {
+		o.exact = true
+	}
+}
+
+// WithODEMethod sets the method used by IntegrateODE.
+func WithODEMethod(m odeMethod) NumericOption {
+	return func(o *numericOptions) {
+		o.odeMethod = m
+	}
+}
+
+// WithStep sets the size of the steps of the fixed-step methods of IntegrateODE, and the size of the
+// first step of the adaptive ones.
+func WithStep(h float64) NumericOption {
+	return func(o *numericOptions) {
+		if h > 0 {
+			o.step = h
+		}
+	}
+}
+
+// WithEvent stops IntegrateODE at the first time an expression of the time and the state variables, such
+// as "y - 1", crosses zero.
+func WithEvent(expr string) NumericOption {
+	return func(o *numericOptions) {
+		o.event = expr
+	}
+}
+
+// parseNumeric parses an expression for a numerical method, which evaluates it in FloatMode.
+func parseNumeric(expr string, o evalOptions) (root node, err error) {
+	if o.numberMode != FloatMode {
+		return nil, errors.New(errCompileNumberMode)
+	}
+	return (&expression{expr: expr}).parse(o.reg)
+}
+
+// bindFunctions compiles numeric syntax trees into functions of the free variables, which take the first
+// slots of vars in order. The other slots hold the values of the remaining variables.
+func bindFunctions(o evalOptions, free []string, values Variables, trees ...node) (fs []numFunc, vars []float64, err error) {
+	c := &compiler{evalOptions: o, slots: make(map[string]int)}
+	for i, name := range free {
+		c.slots[name] = i
+		c.names = append(c.names, name)
+	}
+
+	fs = make([]numFunc, len(trees))
+	for i, n := range trees {
+		var f compiled
+		if f, err = c.compile(n); err != nil {
+			return nil, nil, err
+		}
+		if f.num == nil {
+			return nil, nil, TypeError{
+				Message: fmt.Sprintf(errResultType, NumericValue, BooleanValue),
+				Span:    n.span(),
+			}
+		}
+		fs[i] = f.num
+	}
+
+	vars = make([]float64, len(c.names))
+	for i, name := range c.names {
+		v, ok := values[name]
+		if i >= len(free) && !ok {
+			return nil, nil, fmt.Errorf(errUnboundVariable, name)
+		}
+		vars[i] = v
+	}
+	return fs, vars, nil
+}
+
+// checkNumeric type-checks a syntax tree, whose result must be numeric.
+func checkNumeric(o evalOptions, n node) error {
+	f, err := (&compiler{evalOptions: o, slots: make(map[string]int)}).compile(n)
+	if err != nil {
+		return err
+	}
+	if f.num == nil {
+		return TypeError{
+			Message: fmt.Sprintf(errResultType, NumericValue, BooleanValue),
+			Span:    n.span(),
+		}
+	}
+	return nil
+}
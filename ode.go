@@ -0,0 +1,537 @@
+package yamp
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+type odeMethod int
+
+// Methods that integrate ordinary differential equations
+const (
+	// RK4 takes steps of a fixed size with the classical fourth-order Runge-Kutta method.
+	RK4 odeMethod = iota + 1
+	// DormandPrince adapts the size of its steps to the tolerance, estimating the error of the fifth-order
+	// Dormand-Prince method from its embedded fourth-order solution.
+	DormandPrince
+	// BackwardEuler takes steps of a fixed size with the implicit Euler method, which stays stable on stiff
+	// systems whatever the step, at the cost of being of first order. Each step solves a system with
+	// Newton's method, halving the step when it does not converge.
+	BackwardEuler
+)
+
+func (m odeMethod) String() string {
+	switch m {
+	case RK4:
+		return "RK4"
+	case DormandPrince:
+		return "Dormand-Prince"
+	case BackwardEuler:
+		return "backward Euler"
+	}
+	return "<?>"
+}
+
+// Trajectory is the solution of a system of ordinary differential equations at the times the integrator
+// stepped to.
+type Trajectory struct {
+	Variables []string    // Variables are the state variables, in the order of the equations.
+	T         []float64   // T holds the times, from the first to the last.
+	Y         [][]float64 // Y[i] holds the values of the variables at T[i].
+	// Event tells whether the integration stopped at the last time because the event expression
+	// crossed zero.
+	Event bool
+}
+
+// odeTime is the name of the time variable of differential equations.
+const odeTime = "t"
+
+// odeSteps is the default maximum number of steps of an integration.
+const odeSteps = 100000
+
+// IntegrateODE integrates a system of first-order ordinary differential equations separated by ';', such as
+// "y' = v; v' = -k * y", from t0 to t1. The right-hand sides are expressions of the time t and of the
+// state variables, whose initial values are given in initial. The other variables of the system must be
+// given with WithVariables.
+//
+// The system is integrated with DormandPrince by default, with the tolerance as both the absolute and the
+// relative error allowed on each step. WithODEMethod picks another method, and WithStep sets the size of
+// the steps of the fixed-step methods, which is one thousandth of the interval by default, or the first
+// step of DormandPrince. The integration stops early at the first time the expression given with
+// WithEvent crosses zero, which is located with Brent's method.
+func IntegrateODE(system string, initial Variables, t0, t1 float64, opts ...NumericOption) (res Trajectory, err error) {
+	o := newNumericOptions(opts...)
+	eo := newEvalOptions(o.evalOptions...)
+	method := o.odeMethod
+	if method == 0 {
+		method = DormandPrince
+	}
+	if method < RK4 || method > BackwardEuler {
+		return Trajectory{}, fmt.Errorf(errODEMethod, method)
+	}
+
+	var names []string
+	var rhs []node
+	for _, eq := range splitSystem(system) {
+		name, n, err := parseODE(eq, eo)
+		if err != nil {
+			return Trajectory{}, err
+		}
+		if name == odeTime {
+			return Trajectory{}, fmt.Errorf(errODETime, odeTime)
+		}
+		for _, other := range names {
+			if other == name {
+				return Trajectory{}, fmt.Errorf(errODEVariable, name)
+			}
+		}
+		names, rhs = append(names, name), append(rhs, n)
+	}
+	if len(rhs) == 0 {
+		return Trajectory{}, errors.New(errEmptyExpression)
+	}
+	y := make([]float64, len(names))
+	for i, name := range names {
+		v, ok := initial[name]
+		if !ok {
+			return Trajectory{}, fmt.Errorf(errODEInitial, name)
+		}
+		y[i] = v
+	}
+
+	s, err := newODESystem(names, rhs, method == BackwardEuler, o, eo)
+	if err != nil {
+		return Trajectory{}, err
+	}
+	var event func(t float64, y []float64) (float64, error)
+	if o.event != "" {
+		if event, err = s.bind(o.event, eo); err != nil {
+			return Trajectory{}, err
+		}
+	}
+	return s.integrate(y, t0, t1, method, event, o)
+}
+
+// parseODE parses an equation "y' = expression" into the name of the variable and the expression. The
+// expression is parsed with the rest of the equation blanked out, so that positions are those in the
+// equation.
+func parseODE(eq string, o evalOptions) (name string, rhs node, err error) {
+	runes := []rune(eq)
+	start := len(runes) - len([]rune(strings.TrimLeft(eq, " \t\r\n")))
+	sep := strings.IndexRune(eq, '=')
+	if sep < 0 {
+		return "", nil, fmt.Errorf(errODEEquation, start)
+	}
+	eqIndex := len([]rune(eq[:sep]))
+	lhs := strings.TrimSpace(eq[:sep])
+	if !strings.HasSuffix(lhs, "'") {
+		return "", nil, fmt.Errorf(errODEEquation, start)
+	}
+	v, err := (&expression{expr: lhs[:len(lhs)-1]}).parse(o.reg)
+	if err != nil || !isVariableNode(v) {
+		return "", nil, fmt.Errorf(errODEEquation, start)
+	}
+	name = v.(variableNode).name
+
+	blanked := []rune(strings.Repeat(" ", eqIndex+1) + string(runes[eqIndex+1:]))
+	if rhs, err = parseNumeric(string(blanked), o); err != nil {
+		return "", nil, err
+	}
+	return name, rhs, nil
+}
+
+func isVariableNode(n node) bool {
+	_, ok := n.(variableNode)
+	return ok
+}
+
+// odeSystem evaluates the right-hand sides of a system of differential equations, and their Jacobian.
+type odeSystem struct {
+	names []string
+	vars  Variables
+	fs    []numFunc
+	slots []float64 // the time, the state variables, then the other variables
+	// the derivatives of the right-hand sides by the state variables, row after row, if they could be
+	// computed symbolically
+	jac      []numFunc
+	jacSlots []float64
+}
+
+func newODESystem(names []string, rhs []node, jacobian bool, o numericOptions, eo evalOptions) (s *odeSystem, err error) {
+	free := append([]string{odeTime}, names...)
+	s = &odeSystem{names: names, vars: o.vars}
+	if s.fs, s.slots, err = bindFunctions(eo, free, o.vars, rhs...); err != nil {
+		return nil, err
+	}
+	if !jacobian {
+		return s, nil
+	}
+
+	var ds []node
+	for _, n := range rhs {
+		for _, name := range names {
+			d, err := differentiate(n, name, eo)
+			if err != nil {
+				return s, nil // which is approximated by finite differences
+			}
+			ds = append(ds, d)
+		}
+	}
+	if s.jac, s.jacSlots, err = bindFunctions(eo, free, o.vars, ds...); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// bind compiles an expression of the time and the state variables.
+func (s *odeSystem) bind(expr string, o evalOptions) (func(t float64, y []float64) (float64, error), error) {
+	n, err := parseNumeric(expr, o)
+	if err != nil {
+		return nil, err
+	}
+	fs, slots, err := bindFunctions(o, append([]string{odeTime}, s.names...), s.vars, n)
+	if err != nil {
+		return nil, err
+	}
+	return func(t float64, y []float64) (float64, error) {
+		slots[0] = t
+		copy(slots[1:], y)
+		return fs[0](slots)
+	}, nil
+}
+
+// derivatives returns the right-hand sides at time t and state y.
+func (s *odeSystem) derivatives(t float64, y []float64) (dy []float64, err error) {
+	s.slots[0] = t
+	copy(s.slots[1:], y)
+	dy = make([]float64, len(y))
+	for i, f := range s.fs {
+		if dy[i], err = f(s.slots); err != nil {
+			return nil, err
+		}
+	}
+	return dy, nil
+}
+
+// jacobian returns the derivatives of the right-hand sides by the state variables, approximating them
+// with forward differences if they could not be computed symbolically.
+func (s *odeSystem) jacobian(t float64, y []float64) (j [][]float64, err error) {
+	n := len(y)
+	j = make([][]float64, n)
+	if s.jac != nil {
+		s.jacSlots[0] = t
+		copy(s.jacSlots[1:], y)
+		for r := range j {
+			j[r] = make([]float64, n)
+			for c := range j[r] {
+				if j[r][c], err = s.jac[r*n+c](s.jacSlots); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return j, nil
+	}
+
+	dy, err := s.derivatives(t, y)
+	if err != nil {
+		return nil, err
+	}
+	for r := range j {
+		j[r] = make([]float64, n)
+	}
+	shifted := append([]float64(nil), y...)
+	for c := range y {
+		h := math.Sqrt(epsilon) * math.Max(1, math.Abs(y[c]))
+		shifted[c] = y[c] + h
+		d, err := s.derivatives(t, shifted)
+		if err != nil {
+			return nil, err
+		}
+		shifted[c] = y[c]
+		for r := range j {
+			j[r][c] = (d[r] - dy[r]) / h
+		}
+	}
+	return j, nil
+}
+
+// integrate steps from t0 to t1, recording every step, until the end or an event.
+func (s *odeSystem) integrate(y []float64, t0, t1 float64, method odeMethod, event func(float64, []float64) (float64, error), o numericOptions) (res Trajectory, err error) {
+	res = Trajectory{Variables: s.names, T: []float64{t0}, Y: [][]float64{append([]float64(nil), y...)}}
+	h := o.step
+	if h <= 0 {
+		h = math.Abs(t1-t0) / 1000
+		if method == DormandPrince {
+			h = math.Abs(t1-t0) / 100
+		}
+	}
+	h = math.Copysign(h, t1-t0)
+
+	var g0 float64
+	if event != nil {
+		if g0, err = event(t0, y); err != nil {
+			return Trajectory{}, err
+		}
+	}
+
+	t := t0
+	for steps := 0; t != t1; steps++ {
+		if steps == o.iterations(odeSteps) {
+			return Trajectory{}, fmt.Errorf(errODESteps, steps, t)
+		}
+		if math.Abs(h) <= 16*epsilon*math.Max(1, math.Abs(t)) {
+			return Trajectory{}, fmt.Errorf(errODEStep, t)
+		}
+		last := math.Abs(h) >= math.Abs(t1-t)
+		step := h
+		if last {
+			step = t1 - t
+		}
+
+		y1, next, err := s.step(method, t, step, y, o)
+		if err != nil {
+			return Trajectory{}, err
+		}
+		if y1 == nil {
+			h = next // rejected
+			continue
+		}
+		for _, v := range y1 {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return Trajectory{}, fmt.Errorf(errODENotFinite, t+step)
+			}
+		}
+
+		t1Step := t + step
+		if last {
+			t1Step = t1
+		}
+		if event != nil {
+			g1, err := event(t1Step, y1)
+			if err != nil {
+				return Trajectory{}, err
+			}
+			if g0 != 0 && (g1 == 0 || (g0 < 0) != (g1 < 0)) {
+				return s.locateEvent(res, method, t, step, y, g0, g1, event, o)
+			}
+			if g1 != 0 {
+				g0 = g1
+			}
+		}
+
+		t, y = t1Step, y1
+		res.T, res.Y = append(res.T, t), append(res.Y, y)
+		if method != RK4 {
+			h = next
+		}
+	}
+	return res, nil
+}
+
+// step takes a step of size h from time t and state y. It returns the new state, or nil if the step was
+// rejected, and the size of the next step.
+func (s *odeSystem) step(method odeMethod, t, h float64, y []float64, o numericOptions) (y1 []float64, next float64, err error) {
+	switch method {
+	case RK4:
+		y1, err = s.rk4(t, h, y)
+		return y1, h, err
+	case DormandPrince:
+		y1, e, err := s.dormandPrince(t, h, y)
+		if err != nil {
+			return nil, 0, err
+		}
+		// the root mean square of the error relative to the tolerance
+		var norm float64
+		for i := range y {
+			scale := o.tolerance * (1 + math.Max(math.Abs(y[i]), math.Abs(y1[i])))
+			norm += (e[i] / scale) * (e[i] / scale)
+		}
+		norm = math.Sqrt(norm / float64(len(y)))
+		factor := 5.0
+		if norm > 0 {
+			factor = math.Max(0.2, math.Min(5, 0.9*math.Pow(norm, -0.2)))
+		}
+		if norm > 1 || math.IsNaN(norm) {
+			return nil, h * math.Min(factor, 0.5), nil
+		}
+		return y1, h * factor, nil
+	}
+
+	y1, ok, err := s.backwardEuler(t, h, y, o)
+	if err != nil || !ok {
+		return nil, h / 2, err
+	}
+	return y1, h, nil
+}
+
+// locateEvent finds where the event crosses zero within a step, by taking shorter steps from its start,
+// and ends the trajectory there.
+func (s *odeSystem) locateEvent(res Trajectory, method odeMethod, t, h float64, y []float64, g0, g1 float64, event func(float64, []float64) (float64, error), o numericOptions) (Trajectory, error) {
+	at := func(d float64) (y1 []float64, err error) {
+		switch method {
+		case RK4:
+			return s.rk4(t, d, y)
+		case DormandPrince:
+			y1, _, err = s.dormandPrince(t, d, y)
+			return y1, err
+		}
+		y1, ok, err := s.backwardEuler(t, d, y, o)
+		if err == nil && !ok {
+			err = fmt.Errorf(errODENewton, t+d)
+		}
+		return y1, err
+	}
+
+	d := h
+	if g1 != 0 {
+		g := func(d float64) (float64, error) {
+			y1, err := at(d)
+			if err != nil {
+				return 0, err
+			}
+			return event(t+d, y1)
+		}
+		r, err := brentRoot(g, 0, h, g0, g1, o)
+		if err != nil {
+			return Trajectory{}, err
+		}
+		d = r.X
+	}
+	y1, err := at(d)
+	if err != nil {
+		return Trajectory{}, err
+	}
+	res.T, res.Y, res.Event = append(res.T, t+d), append(res.Y, y1), true
+	return res, nil
+}
+
+// rk4 takes a step with the classical Runge-Kutta method.
+func (s *odeSystem) rk4(t, h float64, y []float64) ([]float64, error) {
+	k1, err := s.derivatives(t, y)
+	if err != nil {
+		return nil, err
+	}
+	k2, err := s.derivatives(t+h/2, axpy(y, h/2, k1))
+	if err != nil {
+		return nil, err
+	}
+	k3, err := s.derivatives(t+h/2, axpy(y, h/2, k2))
+	if err != nil {
+		return nil, err
+	}
+	k4, err := s.derivatives(t+h, axpy(y, h, k3))
+	if err != nil {
+		return nil, err
+	}
+	y1 := make([]float64, len(y))
+	for i := range y {
+		y1[i] = y[i] + h/6*(k1[i]+2*k2[i]+2*k3[i]+k4[i])
+	}
+	return y1, nil
+}
+
+// The Butcher tableau of the Dormand-Prince method: dpC are the nodes, dpA the coefficients of the stages,
+// dpB the weights of the fifth-order solution and dpE the differences with the fourth-order one.
+var (
+	dpC = []float64{0, 1.0 / 5, 3.0 / 10, 4.0 / 5, 8.0 / 9, 1, 1}
+	dpA = [][]float64{
+		{},
+		{1.0 / 5},
+		{3.0 / 40, 9.0 / 40},
+		{44.0 / 45, -56.0 / 15, 32.0 / 9},
+		{19372.0 / 6561, -25360.0 / 2187, 64448.0 / 6561, -212.0 / 729},
+		{9017.0 / 3168, -355.0 / 33, 46732.0 / 5247, 49.0 / 176, -5103.0 / 18656},
+		{35.0 / 384, 0, 500.0 / 1113, 125.0 / 192, -2187.0 / 6784, 11.0 / 84},
+	}
+	dpB = []float64{35.0 / 384, 0, 500.0 / 1113, 125.0 / 192, -2187.0 / 6784, 11.0 / 84, 0}
+	dpE = []float64{71.0 / 57600, 0, -71.0 / 16695, 71.0 / 1920, -17253.0 / 339200, 22.0 / 525, -1.0 / 40}
+)
+
+// dormandPrince takes a step with the Dormand-Prince method, returning the fifth-order solution and an
+// estimate of its error.
+func (s *odeSystem) dormandPrince(t, h float64, y []float64) (y1, e []float64, err error) {
+	k := make([][]float64, len(dpC))
+	for i := range k {
+		yi := append([]float64(nil), y...)
+		for j, a := range dpA[i] {
+			for m := range yi {
+				yi[m] += h * a * k[j][m]
+			}
+		}
+		if k[i], err = s.derivatives(t+dpC[i]*h, yi); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	y1, e = make([]float64, len(y)), make([]float64, len(y))
+	for m := range y {
+		y1[m] = y[m]
+		for i := range k {
+			y1[m] += h * dpB[i] * k[i][m]
+			e[m] += h * dpE[i] * k[i][m]
+		}
+	}
+	return y1, e, nil
+}
+
+// odeNewtonIterations is the maximum number of Newton iterations of an implicit step.
+const odeNewtonIterations = 20
+
+// backwardEuler takes a step with the implicit Euler method, solving y1 = y + h f(t + h, y1) with Newton's
+// method. The Jacobian is factored once, at the start of the step, and the factorization is reused by
+// every iteration. ok is unset if the iterations do not converge.
+func (s *odeSystem) backwardEuler(t, h float64, y []float64, o numericOptions) (y1 []float64, ok bool, err error) {
+	t1 := t + h
+	j, err := s.jacobian(t1, y)
+	if err != nil {
+		return nil, false, err
+	}
+	// the Jacobian of y1 - y - h f(t1, y1) is I - h J
+	for r := range j {
+		for c := range j[r] {
+			j[r][c] *= -h
+		}
+		j[r][r]++
+	}
+	lu := factorLU(j, epsilon)
+	if len(lu.pivots) < len(y) {
+		return nil, false, nil
+	}
+
+	y1 = append([]float64(nil), y...)
+	for i := 0; i < odeNewtonIterations; i++ {
+		f, err := s.derivatives(t1, y1)
+		if err != nil {
+			return nil, false, err
+		}
+		g := make([]float64, len(y))
+		for m := range g {
+			g[m] = -(y1[m] - y[m] - h*f[m])
+		}
+		d, _ := lu.solve(g, math.Inf(1))
+		var norm, size float64
+		for m := range y1 {
+			y1[m] += d[m]
+			norm = math.Max(norm, math.Abs(d[m]))
+			size = math.Max(size, math.Abs(y1[m]))
+		}
+		if math.IsNaN(norm) {
+			return nil, false, nil
+		}
+		if norm <= o.tolerance*(1+size) {
+			return y1, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// axpy returns y + a x.
+func axpy(y []float64, a float64, x []float64) []float64 {
+	res := make([]float64, len(y))
+	for i := range y {
+		res[i] = y[i] + a*x[i]
+	}
+	return res
+}
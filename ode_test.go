@@ -0,0 +1,139 @@
+package yamp
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntegrateODE(t *testing.T) {
+	k := WithVariables(Variables{"k": 2})
+	tests := []struct {
+		name      string
+		system    string
+		initial   Variables
+		t1        float64
+		opts      []NumericOption
+		wantT     float64
+		wantY     []float64
+		delta     float64
+		wantEvent bool
+	}{
+		{"Dormand-Prince adapts its steps", "y' = -k y", Variables{"y": 1}, 1, []NumericOption{k}, 1, []float64{math.Exp(-2)}, 1e-9, false},
+		{"RK4 takes fixed steps", "y' = -k y", Variables{"y": 1}, 1, []NumericOption{k, WithODEMethod(RK4)}, 1, []float64{math.Exp(-2)}, 1e-9, false},
+		{"backward Euler is of first order", "y' = -k y", Variables{"y": 1}, 1, []NumericOption{k, WithODEMethod(BackwardEuler)}, 1, []float64{math.Exp(-2)}, 1e-3, false},
+		{"systems are integrated together", "y' = v; v' = -y", Variables{"y": 1, "v": 0}, math.Pi, nil, math.Pi, []float64{-1, 0}, 1e-8, false},
+		{"the time is a variable", "y' = t", Variables{"y": 0}, -2, nil, -2, []float64{2}, 1e-9, false},
+		{
+			name:    "stiff systems are stable with backward Euler",
+			system:  "y' = -1000 (y - t)",
+			initial: Variables{"y": 0},
+			t1:      1,
+			opts:    []NumericOption{WithODEMethod(BackwardEuler), WithStep(0.01)},
+			wantT:   1,
+			wantY:   []float64{0.999},
+			delta:   1e-6,
+		},
+		{
+			name:      "events stop the integration",
+			system:    "y' = v; v' = -9.81",
+			initial:   Variables{"y": 10, "v": 0},
+			t1:        10,
+			opts:      []NumericOption{WithEvent("y"), WithODEMethod(RK4), WithStep(0.1)},
+			wantT:     math.Sqrt(20 / 9.81),
+			wantY:     []float64{0, -math.Sqrt(2 * 9.81 * 10)},
+			delta:     1e-9,
+			wantEvent: true,
+		},
+		{
+			name:      "events are located within adaptive steps",
+			system:    "y' = v; v' = -y",
+			initial:   Variables{"y": 1, "v": 0},
+			t1:        10,
+			opts:      []NumericOption{WithEvent("y")},
+			wantT:     math.Pi / 2,
+			wantY:     []float64{0, -1},
+			delta:     1e-8,
+			wantEvent: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := IntegrateODE(tt.system, tt.initial, 0, tt.t1, tt.opts...)
+			if !assert.NoError(t, err) {
+				return
+			}
+			last := len(got.T) - 1
+			assert.Equal(t, 0.0, got.T[0])
+			assert.InDelta(t, tt.wantT, got.T[last], 1e-9)
+			assert.InDeltaSlice(t, tt.wantY, got.Y[last], tt.delta)
+			assert.Equal(t, tt.wantEvent, got.Event)
+		})
+	}
+}
+
+func TestIntegrateODE_stiff(t *testing.T) {
+	// explicit methods are unstable on stiff systems with large steps, and adaptive ones take many
+	// steps to stay stable
+	const system = "y' = -1000 (y - t)"
+	rk4, err := IntegrateODE(system, Variables{"y": 0}, 0, 1, WithODEMethod(RK4), WithStep(0.01))
+	if assert.NoError(t, err) {
+		assert.Greater(t, math.Abs(rk4.Y[len(rk4.Y)-1][0]), 1e100)
+	}
+	dp, err := IntegrateODE(system, Variables{"y": 0}, 0, 1, WithTolerance(1e-6))
+	if assert.NoError(t, err) {
+		assert.Greater(t, len(dp.T), 200)
+	}
+}
+
+func TestIntegrateODE_errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		system  string
+		initial Variables
+		opts    []NumericOption
+		wantErr error
+	}{
+		{"equations need a derivative", "y = 2", Variables{"y": 1}, nil, fmt.Errorf(errODEEquation, 0)},
+		{"derivatives are of variables", "y' = 2; 2' = 1", Variables{"y": 1}, nil, fmt.Errorf(errODEEquation, 8)},
+		{"the time has no equation", "t' = 1", Variables{"t": 1}, nil, fmt.Errorf(errODETime, "t")},
+		{"variables have one equation", "y' = 1; y' = 2", Variables{"y": 1}, nil, fmt.Errorf(errODEVariable, "y")},
+		{"initial values are needed", "y' = 1", nil, nil, fmt.Errorf(errODEInitial, "y")},
+		{"equations are needed", " ", nil, nil, errors.New(errEmptyExpression)},
+		{"other variables must be given", "y' = z", Variables{"y": 1}, nil, fmt.Errorf(errUnboundVariable, "z")},
+		{"positions are those in the system", "x' = 1; y' = 2 +", Variables{"x": 0, "y": 1}, nil, SyntaxError{Message: fmt.Sprintf(errNoRightOperand, "+", 16), Token: "+", Position: 15}},
+		{"steps are limited", "y' = 1", Variables{"y": 1}, []NumericOption{WithODEMethod(RK4), WithMaxIterations(10)}, fmt.Errorf(errODESteps, 10, 0.020000000000000004)},
+		{"methods must be known", "y' = 1", Variables{"y": 1}, []NumericOption{WithODEMethod(4)}, fmt.Errorf(errODEMethod, 4)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := IntegrateODE(tt.system, tt.initial, 0, 2, tt.opts...)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+func TestIntegrateODE_failures(t *testing.T) {
+	// where the integration fails depends on rounding, so only the kind of failure is checked
+	tests := []struct {
+		name    string
+		system  string
+		opts    []NumericOption
+		wantErr string
+	}{
+		{"blow-ups shrink the steps too much", "y' = y^2", nil, errODEStep},
+		{"unstable solutions are not finite", "y' = -1000 y", []NumericOption{WithODEMethod(RK4), WithStep(0.01)}, errODENotFinite},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := IntegrateODE(tt.system, Variables{"y": 1}, 0, 2, tt.opts...)
+			if assert.Error(t, err) {
+				assert.True(t, strings.HasPrefix(err.Error(), fmt.Sprintf(tt.wantErr, "")), err.Error())
+			}
+		})
+	}
+}
@@ -4,14 +4,37 @@ type opType int
 
 // Common operator types
 const (
-	Addition       opType = iota + 1 // Addition is the binary addition operator.
-	Subtraction                      // Subtraction is the binary subtraction operator.
-	Multiplication                   // Multiplication is the multiplication operator.
-	Division                         // Division is the division operator.
-	Power                            // Power is the power/exponent operator.
-	Plus                             // Plus is the unary plus sign.
-	Minus                            // Minus is the unary minus sign.
-	Factorial                        // Factorial is the factorial operator.
+	Addition        opType = iota + 1 // Addition is the binary addition operator.
+	Subtraction                       // Subtraction is the binary subtraction operator.
+	Multiplication                    // Multiplication is the multiplication operator.
+	Division                          // Division is the division operator.
+	Power                             // Power is the power/exponent operator.
+	Plus                              // Plus is the unary plus sign.
+	Minus                             // Minus is the unary minus sign.
+	Factorial                         // Factorial is the factorial operator.
+	DoubleFactorial                   // DoubleFactorial is the double factorial operator.
+	Less                              // Less is the less-than comparison operator.
+	LessEqual                         // LessEqual is the less-than-or-equal comparison operator.
+	Greater                           // Greater is the greater-than comparison operator.
+	GreaterEqual                      // GreaterEqual is the greater-than-or-equal comparison operator.
+	Equal                             // Equal is the equality operator.
+	NotEqual                          // NotEqual is the inequality operator.
+	And                               // And is the logical conjunction operator.
+	Or                                // Or is the logical disjunction operator.
+	Not                               // Not is the unary logical negation operator.
+	Conditional                       // Conditional is the '?' part of the ternary conditional operator.
+	ConditionalElse                   // ConditionalElse is the ':' part of the ternary conditional operator.
+	Percent                           // Percent is the postfix percent operator.
+	Modulo                            // Modulo is the modulo operator, whose sign convention is set per evaluation.
+	FloorDivision                     // FloorDivision is the integer division operator paired with Modulo.
+	Remainder                         // Remainder is the truncated remainder operator, which takes the sign of the dividend.
+	BitwiseAnd                        // BitwiseAnd is the bitwise AND operator.
+	BitwiseOr                         // BitwiseOr is the bitwise OR operator.
+	BitwiseXor                        // BitwiseXor is the bitwise exclusive OR operator.
+	BitwiseNot                        // BitwiseNot is the unary bitwise complement operator.
+	ShiftLeft                         // ShiftLeft is the left shift operator.
+	ShiftRight                        // ShiftRight is the arithmetic right shift operator.
+	Equation                          // Equation is the '=' between the two sides of an equation, which can only be solved.
 )
 
 type assoc int
@@ -64,6 +87,52 @@ func (o operator) String() string {
 		return "^"
 	case Factorial:
 		return "!"
+	case DoubleFactorial:
+		return "!!"
+	case Less:
+		return "<"
+	case LessEqual:
+		return "<="
+	case Greater:
+		return ">"
+	case GreaterEqual:
+		return ">="
+	case Equal:
+		return "=="
+	case NotEqual:
+		return "!="
+	case And:
+		return "&&"
+	case Or:
+		return "||"
+	case Not:
+		return "not"
+	case Conditional:
+		return "?"
+	case ConditionalElse:
+		return ":"
+	case Percent:
+		return "%"
+	case Modulo:
+		return "mod"
+	case FloorDivision:
+		return "//"
+	case Remainder:
+		return "rem"
+	case BitwiseAnd:
+		return "&"
+	case BitwiseOr:
+		return "|"
+	case BitwiseXor:
+		return "xor"
+	case BitwiseNot:
+		return "~"
+	case ShiftLeft:
+		return "<<"
+	case ShiftRight:
+		return ">>"
+	case Equation:
+		return "="
 	}
 	return "<?>"
 }
@@ -76,16 +145,38 @@ func (o operator) Type() opType {
 // Precedence implements the Operator interface.
 func (o operator) Precedence() int {
 	switch o.opType {
-	case Addition, Subtraction:
+	case Equation:
+		return 0
+	case Conditional, ConditionalElse:
+		return 1
+	case Or:
 		return 2
-	case Multiplication, Division:
+	case And:
 		return 3
-	case Plus, Minus:
+	case Not:
 		return 4
-	case Power:
+	case Equal, NotEqual:
 		return 5
-	case Factorial:
+	case Less, LessEqual, Greater, GreaterEqual:
 		return 6
+	case BitwiseOr:
+		return 7
+	case BitwiseXor:
+		return 8
+	case BitwiseAnd:
+		return 9
+	case ShiftLeft, ShiftRight:
+		return 10
+	case Addition, Subtraction:
+		return 11
+	case Multiplication, Division, Modulo, FloorDivision, Remainder:
+		return 12
+	case Plus, Minus, BitwiseNot:
+		return 13
+	case Power:
+		return 14
+	case Factorial, DoubleFactorial, Percent:
+		return 15
 	}
 	return 0
 }
@@ -93,9 +184,11 @@ func (o operator) Precedence() int {
 // Associativity implements the Operator interface.
 func (o operator) Associativity() assoc {
 	switch o.opType {
-	case Addition, Subtraction, Multiplication, Division, Factorial:
+	case Addition, Subtraction, Multiplication, Division, Modulo, FloorDivision, Remainder,
+		Factorial, DoubleFactorial, Percent, Less, LessEqual, Greater, GreaterEqual, Equal, NotEqual, And, Or,
+		BitwiseAnd, BitwiseOr, BitwiseXor, ShiftLeft, ShiftRight, Equation:
 		return LeftAssoc
-	case Plus, Minus, Power:
+	case Plus, Minus, Power, Not, BitwiseNot, Conditional, ConditionalElse:
 		return RightAssoc
 	}
 	return LeftAssoc
@@ -104,9 +197,11 @@ func (o operator) Associativity() assoc {
 // Arity implements the Operator interface.
 func (o operator) Arity() arity {
 	switch o.opType {
-	case Addition, Subtraction, Multiplication, Division, Power:
+	case Addition, Subtraction, Multiplication, Division, Modulo, FloorDivision, Remainder, Power,
+		Less, LessEqual, Greater, GreaterEqual, Equal, NotEqual, And, Or, Conditional, ConditionalElse,
+		BitwiseAnd, BitwiseOr, BitwiseXor, ShiftLeft, ShiftRight, Equation:
 		return Binary
-	case Plus, Minus, Factorial:
+	case Plus, Minus, Factorial, DoubleFactorial, Not, Percent, BitwiseNot:
 		return Unary
 	}
 	return Binary
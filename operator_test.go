@@ -23,6 +23,22 @@ func TestNewOperator(t *testing.T) {
 		{"it should correctly create a new Plus operator", args{op: Plus}, operator{Plus}},
 		{"it should correctly create a new Minus operator", args{op: Minus}, operator{Minus}},
 		{"it should correctly create a new Factorial operator", args{op: Factorial}, operator{Factorial}},
+		{"it should correctly create a new DoubleFactorial operator", args{op: DoubleFactorial}, operator{DoubleFactorial}},
+		{"it should correctly create a new Less operator", args{op: Less}, operator{Less}},
+		{"it should correctly create a new LessEqual operator", args{op: LessEqual}, operator{LessEqual}},
+		{"it should correctly create a new Greater operator", args{op: Greater}, operator{Greater}},
+		{"it should correctly create a new GreaterEqual operator", args{op: GreaterEqual}, operator{GreaterEqual}},
+		{"it should correctly create an new Equal operator", args{op: Equal}, operator{Equal}},
+		{"it should correctly create a new NotEqual operator", args{op: NotEqual}, operator{NotEqual}},
+		{"it should correctly create an new And operator", args{op: And}, operator{And}},
+		{"it should correctly create an new Or operator", args{op: Or}, operator{Or}},
+		{"it should correctly create a new Not operator", args{op: Not}, operator{Not}},
+		{"it should correctly create a new Conditional operator", args{op: Conditional}, operator{Conditional}},
+		{"it should correctly create a new ConditionalElse operator", args{op: ConditionalElse}, operator{ConditionalElse}},
+		{"it should correctly create a new Percent operator", args{op: Percent}, operator{Percent}},
+		{"it should correctly create a new Modulo operator", args{op: Modulo}, operator{Modulo}},
+		{"it should correctly create a new FloorDivision operator", args{op: FloorDivision}, operator{FloorDivision}},
+		{"it should correctly create a new Remainder operator", args{op: Remainder}, operator{Remainder}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -48,6 +64,29 @@ func Test_operator_String(t *testing.T) {
 		{"it should return a '+' for a Plus operator", fields{opType: Plus}, "+"},
 		{"it should return a '-' for a Minus operator", fields{opType: Minus}, "-"},
 		{"it should return a '!' for a Factorial operator", fields{opType: Factorial}, "!"},
+		{"it should return a '!!' for a DoubleFactorial operator", fields{opType: DoubleFactorial}, "!!"},
+		{"it should return a '<' for a Less operator", fields{opType: Less}, "<"},
+		{"it should return a '<=' for a LessEqual operator", fields{opType: LessEqual}, "<="},
+		{"it should return a '>' for a Greater operator", fields{opType: Greater}, ">"},
+		{"it should return a '>=' for a GreaterEqual operator", fields{opType: GreaterEqual}, ">="},
+		{"it should return a '==' for an Equal operator", fields{opType: Equal}, "=="},
+		{"it should return a '!=' for a NotEqual operator", fields{opType: NotEqual}, "!="},
+		{"it should return a '&&' for an And operator", fields{opType: And}, "&&"},
+		{"it should return a '||' for an Or operator", fields{opType: Or}, "||"},
+		{"it should return a 'not' for a Not operator", fields{opType: Not}, "not"},
+		{"it should return a '?' for a Conditional operator", fields{opType: Conditional}, "?"},
+		{"it should return a ':' for a ConditionalElse operator", fields{opType: ConditionalElse}, ":"},
+		{"it should return a '%' for a Percent operator", fields{opType: Percent}, "%"},
+		{"it should return a 'mod' for a Modulo operator", fields{opType: Modulo}, "mod"},
+		{"it should return a '//' for a FloorDivision operator", fields{opType: FloorDivision}, "//"},
+		{"it should return a 'rem' for a Remainder operator", fields{opType: Remainder}, "rem"},
+		{"it should return a '&' for a BitwiseAnd operator", fields{opType: BitwiseAnd}, "&"},
+		{"it should return a '|' for a BitwiseOr operator", fields{opType: BitwiseOr}, "|"},
+		{"it should return a 'xor' for a BitwiseXor operator", fields{opType: BitwiseXor}, "xor"},
+		{"it should return a '~' for a BitwiseNot operator", fields{opType: BitwiseNot}, "~"},
+		{"it should return a '<<' for a ShiftLeft operator", fields{opType: ShiftLeft}, "<<"},
+		{"it should return a '>>' for a ShiftRight operator", fields{opType: ShiftRight}, ">>"},
+		{"it should return a '=' for an Equation operator", fields{opType: Equation}, "="},
 		{"it should return a '<?>' for an unknown operator", fields{opType: -1}, "<?>"},
 	}
 	for _, tt := range tests {
@@ -77,6 +116,22 @@ func Test_operator_Type(t *testing.T) {
 		{"it should return the Plus type for a Plus operator", fields{opType: Plus}, Plus},
 		{"it should return the Minus type for a Minus operator", fields{opType: Minus}, Minus},
 		{"it should return the Factorial type for a Factorial operator", fields{opType: Factorial}, Factorial},
+		{"it should return the DoubleFactorial type for a DoubleFactorial operator", fields{opType: DoubleFactorial}, DoubleFactorial},
+		{"it should return the Less type for a Less operator", fields{opType: Less}, Less},
+		{"it should return the LessEqual type for a LessEqual operator", fields{opType: LessEqual}, LessEqual},
+		{"it should return the Greater type for a Greater operator", fields{opType: Greater}, Greater},
+		{"it should return the GreaterEqual type for a GreaterEqual operator", fields{opType: GreaterEqual}, GreaterEqual},
+		{"it should return the Equal type for an Equal operator", fields{opType: Equal}, Equal},
+		{"it should return the NotEqual type for a NotEqual operator", fields{opType: NotEqual}, NotEqual},
+		{"it should return the And type for an And operator", fields{opType: And}, And},
+		{"it should return the Or type for an Or operator", fields{opType: Or}, Or},
+		{"it should return the Not type for a Not operator", fields{opType: Not}, Not},
+		{"it should return the Conditional type for a Conditional operator", fields{opType: Conditional}, Conditional},
+		{"it should return the ConditionalElse type for a ConditionalElse operator", fields{opType: ConditionalElse}, ConditionalElse},
+		{"it should return the Percent type for a Percent operator", fields{opType: Percent}, Percent},
+		{"it should return the Modulo type for a Modulo operator", fields{opType: Modulo}, Modulo},
+		{"it should return the FloorDivision type for a FloorDivision operator", fields{opType: FloorDivision}, FloorDivision},
+		{"it should return the Remainder type for a Remainder operator", fields{opType: Remainder}, Remainder},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -131,6 +186,96 @@ func Test_operator_Precedence(t *testing.T) {
 			type1: Factorial, type2: Power,
 			gt: true,
 		},
+		{
+			name:  "factorial and double factorial should have the same precedence",
+			type1: Factorial, type2: DoubleFactorial,
+			eq: true,
+		},
+		{
+			name:  "modulo, floor division and remainder should have the same precedence as multiplication",
+			type1: Modulo, type2: Multiplication,
+			eq: true,
+		},
+		{
+			name:  "floor division and remainder should have the same precedence as division",
+			type1: FloorDivision, type2: Remainder,
+			eq: true,
+		},
+		{
+			name:  "percent and factorial should have the same precedence",
+			type1: Percent, type2: Factorial,
+			eq: true,
+		},
+		{
+			name:  "comparison operators should have the same precedence",
+			type1: Less, type2: GreaterEqual,
+			eq: true,
+		},
+		{
+			name:  "arithmetic operators should have a higher precedence than comparison operators",
+			type1: Addition, type2: Less,
+			gt: true,
+		},
+		{
+			name:  "shifts should have a lower precedence than addition",
+			type1: Addition, type2: ShiftLeft,
+			gt: true,
+		},
+		{
+			name:  "bitwise AND should have a lower precedence than shifts",
+			type1: ShiftRight, type2: BitwiseAnd,
+			gt: true,
+		},
+		{
+			name:  "bitwise XOR should have a higher precedence than bitwise OR",
+			type1: BitwiseXor, type2: BitwiseOr,
+			gt: true,
+		},
+		{
+			name:  "bitwise operators should have a higher precedence than comparison operators",
+			type1: BitwiseOr, type2: Less,
+			gt: true,
+		},
+		{
+			name:  "bitwise complement should have the same precedence as the sign operators",
+			type1: BitwiseNot, type2: Minus,
+			eq: true,
+		},
+		{
+			name:  "comparison operators should have a higher precedence than equality operators",
+			type1: Less, type2: Equal,
+			gt: true,
+		},
+		{
+			name:  "equality operators should have a higher precedence than logical negation",
+			type1: NotEqual, type2: Not,
+			gt: true,
+		},
+		{
+			name:  "logical negation should have a higher precedence than conjunction",
+			type1: Not, type2: And,
+			gt: true,
+		},
+		{
+			name:  "conjunction should have a higher precedence than disjunction",
+			type1: And, type2: Or,
+			gt: true,
+		},
+		{
+			name:  "disjunction should have a higher precedence than the ternary conditional",
+			type1: Or, type2: Conditional,
+			gt: true,
+		},
+		{
+			name:  "both parts of the ternary conditional should have the same precedence",
+			type1: Conditional, type2: ConditionalElse,
+			eq: true,
+		},
+		{
+			name:  "conditionals should take precedence over equations",
+			type1: ConditionalElse, type2: Equation,
+			gt: true,
+		},
 		{
 			name:  "unknown operators should have the lowest precedence",
 			type1: Addition, type2: -1,
@@ -167,6 +312,26 @@ func Test_operator_Associativity(t *testing.T) {
 		{"a Plus operator is right associative", fields{opType: Plus}, RightAssoc},
 		{"a Minus operator is right associative", fields{opType: Minus}, RightAssoc},
 		{"a Factorial operator is left associative", fields{opType: Factorial}, LeftAssoc},
+		{"a DoubleFactorial operator is left associative", fields{opType: DoubleFactorial}, LeftAssoc},
+		{"a Less operator is left associative", fields{opType: Less}, LeftAssoc},
+		{"a LessEqual operator is left associative", fields{opType: LessEqual}, LeftAssoc},
+		{"a Greater operator is left associative", fields{opType: Greater}, LeftAssoc},
+		{"a GreaterEqual operator is left associative", fields{opType: GreaterEqual}, LeftAssoc},
+		{"an Equal operator is left associative", fields{opType: Equal}, LeftAssoc},
+		{"a NotEqual operator is left associative", fields{opType: NotEqual}, LeftAssoc},
+		{"an And operator is left associative", fields{opType: And}, LeftAssoc},
+		{"an Or operator is left associative", fields{opType: Or}, LeftAssoc},
+		{"a Not operator is right associative", fields{opType: Not}, RightAssoc},
+		{"a Conditional operator is right associative", fields{opType: Conditional}, RightAssoc},
+		{"a ConditionalElse operator is right associative", fields{opType: ConditionalElse}, RightAssoc},
+		{"a Percent operator is left associative", fields{opType: Percent}, LeftAssoc},
+		{"a Modulo operator is left associative", fields{opType: Modulo}, LeftAssoc},
+		{"a FloorDivision operator is left associative", fields{opType: FloorDivision}, LeftAssoc},
+		{"a Remainder operator is left associative", fields{opType: Remainder}, LeftAssoc},
+		{"a BitwiseAnd operator is left associative", fields{opType: BitwiseAnd}, LeftAssoc},
+		{"a ShiftLeft operator is left associative", fields{opType: ShiftLeft}, LeftAssoc},
+		{"a BitwiseNot operator is right associative", fields{opType: BitwiseNot}, RightAssoc},
+		{"an Equation operator is left associative", fields{opType: Equation}, LeftAssoc},
 		{"an unknown operator is by default left associative", fields{opType: -1}, LeftAssoc},
 	}
 	for _, tt := range tests {
@@ -196,6 +361,26 @@ func Test_operator_Arity(t *testing.T) {
 		{"Plus operator is a unary operator", fields{opType: Plus}, Unary},
 		{"Minus operator is a unary operator", fields{opType: Minus}, Unary},
 		{"Factorial operator is a unary operator", fields{opType: Factorial}, Unary},
+		{"DoubleFactorial operator is a unary operator", fields{opType: DoubleFactorial}, Unary},
+		{"Less operator is a binary operator", fields{opType: Less}, Binary},
+		{"LessEqual operator is a binary operator", fields{opType: LessEqual}, Binary},
+		{"Greater operator is a binary operator", fields{opType: Greater}, Binary},
+		{"GreaterEqual operator is a binary operator", fields{opType: GreaterEqual}, Binary},
+		{"Equal operator is a binary operator", fields{opType: Equal}, Binary},
+		{"NotEqual operator is a binary operator", fields{opType: NotEqual}, Binary},
+		{"And operator is a binary operator", fields{opType: And}, Binary},
+		{"Or operator is a binary operator", fields{opType: Or}, Binary},
+		{"Not operator is a unary operator", fields{opType: Not}, Unary},
+		{"Conditional operator is a binary operator", fields{opType: Conditional}, Binary},
+		{"ConditionalElse operator is a binary operator", fields{opType: ConditionalElse}, Binary},
+		{"Percent operator is a unary operator", fields{opType: Percent}, Unary},
+		{"Modulo operator is a binary operator", fields{opType: Modulo}, Binary},
+		{"FloorDivision operator is a binary operator", fields{opType: FloorDivision}, Binary},
+		{"Remainder operator is a binary operator", fields{opType: Remainder}, Binary},
+		{"BitwiseXor operator is a binary operator", fields{opType: BitwiseXor}, Binary},
+		{"ShiftRight operator is a binary operator", fields{opType: ShiftRight}, Binary},
+		{"BitwiseNot operator is a unary operator", fields{opType: BitwiseNot}, Unary},
+		{"Equation operator is a binary operator", fields{opType: Equation}, Binary},
 		{"an unknown operator is by default binary", fields{opType: -1}, Binary},
 	}
 	for _, tt := range tests {
@@ -0,0 +1,830 @@
+package yamp
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+type optimizeMethod int
+
+// Methods that find a minimum or a maximum of an expression
+const (
+	// GoldenSection narrows an interval around the optimum of a single variable by the golden ratio.
+	GoldenSection optimizeMethod = iota + 1
+	// Brent optimizes a single variable by parabolic interpolation, falling back on golden-section steps
+	// whenever interpolation does not shrink the interval fast enough.
+	Brent
+	// NelderMead moves a simplex of points through the space of the variables. It only evaluates the
+	// expression, so it copes with expressions that have no derivative.
+	NelderMead
+	// BFGS follows the gradient, which is computed symbolically when possible and by finite differences
+	// otherwise, and builds an approximation of the curvature from the steps taken.
+	BFGS
+)
+
+func (m optimizeMethod) String() string {
+	switch m {
+	case GoldenSection:
+		return "golden-section"
+	case Brent:
+		return "Brent"
+	case NelderMead:
+		return "Nelder-Mead"
+	case BFGS:
+		return "BFGS"
+	}
+	return "<?>"
+}
+
+// Optimum is a minimum or a maximum of an expression, along with how it was found.
+type Optimum struct {
+	X          Variables      // X holds the values of the optimized variables.
+	Value      float64        // Value is the value of the expression at X.
+	Violation  float64        // Violation is the amount by which X violates the constraints.
+	Method     optimizeMethod // Method is the method that found the optimum.
+	Iterations int            // Iterations is the number of iterations taken, over every penalty round.
+	Converged  bool           // Converged tells whether the tolerance was met and the constraints hold.
+}
+
+// Minimize finds values of variables for which an expression is smallest. The other variables of the
+// expression must be given with WithVariables, which also sets the starting point of the optimized
+// variables. Variables without a starting point start at the middle of their bounds, or at 0.
+//
+// A single variable is optimized with Brent's method by default, in the interval set by WithBounds or,
+// without one, in an interval found by walking downhill from the starting point. Several variables are
+// optimized with BFGS when the expression can be differentiated symbolically, and with Nelder-Mead
+// otherwise. WithMethod picks another method.
+//
+// Variables are kept within the bounds given with WithBounds. The constraints given with WithConstraints
+// are enforced with a quadratic penalty, whose weight grows until they hold within the square root of the
+// tolerance. Strict comparisons are enforced as if they were not strict. Points where the expression
+// fails to evaluate are treated as worse than any other.
+//
+// The result is a local optimum, near the starting point. An optimum that did not converge is still
+// returned, with Converged unset.
+func Minimize(expr string, variables []string, opts ...NumericOption) (res Optimum, err error) {
+	return optimize(expr, variables, 1, opts)
+}
+
+// Maximize finds values of variables for which an expression is largest, like Minimize.
+func Maximize(expr string, variables []string, opts ...NumericOption) (res Optimum, err error) {
+	return optimize(expr, variables, -1, opts)
+}
+
+// penaltyRounds is the number of times the weight of the penalties grows tenfold before giving up on
+// satisfying the constraints.
+const penaltyRounds = 12
+
+// sqrtEpsilon is the square root of epsilon. Near an optimum, an expression is too flat to locate it more
+// precisely than that, relative to its magnitude.
+const sqrtEpsilon = 1.4901161193847656e-8
+
+func optimize(expr string, variables []string, sign float64, opts []NumericOption) (res Optimum, err error) {
+	o := newNumericOptions(opts...)
+	eo := newEvalOptions(o.evalOptions...)
+	if err = checkOptimized(variables, o); err != nil {
+		return Optimum{}, err
+	}
+
+	p, err := newProblem(expr, variables, sign, o, eo)
+	if err != nil {
+		return Optimum{}, err
+	}
+	if res.Method, err = p.method(); err != nil {
+		return Optimum{}, err
+	}
+
+	x := p.start(variables)
+	copy(p.vars, x)
+	if _, err = p.f(p.vars); err != nil {
+		return Optimum{}, err
+	}
+
+	ctol := math.Sqrt(o.tolerance)
+	for round, mu := 0, 1.0; ; round, mu = round+1, mu*10 {
+		p.mu = mu
+		var iterations int
+		var converged bool
+		switch res.Method {
+		case GoldenSection, Brent:
+			x, iterations, converged = p.minimize1D(x[0], res.Method)
+		case NelderMead:
+			x, iterations, converged = p.nelderMead(x)
+		case BFGS:
+			if x, iterations, converged, err = p.bfgs(x); err != nil {
+				return Optimum{}, err
+			}
+		}
+		res.Iterations += iterations
+		res.Violation = p.violation(x)
+		if res.Violation <= ctol || round == penaltyRounds-1 {
+			res.Converged = converged && res.Violation <= ctol
+			break
+		}
+	}
+
+	res.X = make(Variables, len(variables))
+	for i, name := range variables {
+		res.X[name] = x[i]
+	}
+	copy(p.vars, x)
+	if res.Value, err = p.f(p.vars); err != nil {
+		return Optimum{}, err
+	}
+	return res, nil
+}
+
+// checkOptimized checks that the variables to optimize are given once each, and that bounds are only
+// given for them.
+func checkOptimized(variables []string, o numericOptions) error {
+	if len(variables) == 0 {
+		return errors.New(errNoOptimizedVariables)
+	}
+	seen := make(map[string]bool, len(variables))
+	for _, name := range variables {
+		if seen[name] {
+			return fmt.Errorf(errOptimizedTwice, name)
+		}
+		seen[name] = true
+	}
+	for name := range o.bounds {
+		if !seen[name] {
+			return fmt.Errorf(errBoundsVariable, name)
+		}
+	}
+	return nil
+}
+
+// problem is an expression to minimize, plus the penalties of its constraints, as a function of the
+// optimized variables.
+type problem struct {
+	o      numericOptions
+	sign   float64     // sign is -1 to maximize the expression.
+	f      numFunc     // f is the expression.
+	vs     []numFunc   // vs are the violations of the constraints.
+	grad   []numFunc   // grad is the gradient of f, or nil if it cannot be computed symbolically.
+	vgrads [][]numFunc // vgrads are the gradients of vs.
+	vars   []float64
+	bounds []bounds
+	mu     float64 // mu is the weight of the penalties.
+}
+
+func newProblem(expr string, variables []string, sign float64, o numericOptions, eo evalOptions) (p *problem, err error) {
+	root, err := parseNumeric(expr, eo)
+	if err != nil {
+		return nil, err
+	}
+	trees := []node{root}
+	for _, c := range o.constraints {
+		var n node
+		if n, err = parseConstraint(c, eo); err != nil {
+			return nil, err
+		}
+		trees = append(trees, violation(n, eo))
+	}
+
+	// the gradients follow the functions, variable by variable
+	nf := len(trees)
+	for _, n := range trees[:nf] {
+		for _, name := range variables {
+			var d node
+			if d, err = differentiate(n, name, eo); err != nil {
+				break
+			}
+			trees = append(trees, d)
+		}
+		if err != nil {
+			trees = trees[:nf]
+			break
+		}
+	}
+
+	fs, vars, err := bindFunctions(eo, variables, o.vars, trees...)
+	if err != nil {
+		return nil, err
+	}
+	p = &problem{o: o, sign: sign, f: fs[0], vs: fs[1:nf], vars: vars}
+	if len(fs) > nf {
+		n := len(variables)
+		p.grad = fs[nf : nf+n]
+		for i := range p.vs {
+			start := nf + (i+1)*n
+			p.vgrads = append(p.vgrads, fs[start:start+n])
+		}
+	}
+
+	p.bounds = make([]bounds, len(variables))
+	for i, name := range variables {
+		b, ok := o.bounds[name]
+		if !ok {
+			b = bounds{lo: math.Inf(-1), hi: math.Inf(1)}
+		}
+		p.bounds[i] = b
+	}
+	return p, nil
+}
+
+// parseConstraint parses a constraint, which must be a boolean expression.
+func parseConstraint(expr string, o evalOptions) (root node, err error) {
+	if root, err = parseNumeric(expr, o); err != nil {
+		return nil, err
+	}
+	if !isBoolean(root, o) {
+		return nil, TypeError{
+			Message: fmt.Sprintf(errResultType, BooleanValue, NumericValue),
+			Span:    root.span(),
+		}
+	}
+	return root, nil
+}
+
+// isBoolean checks whether a syntax tree compiles to a boolean.
+func isBoolean(n node, o evalOptions) bool {
+	c := &compiler{evalOptions: o, slots: make(map[string]int)}
+	f, err := c.compile(n)
+	return err == nil && f.b != nil
+}
+
+// violation builds a numeric tree that measures how far a boolean tree is from holding, and is zero where
+// it holds. Comparisons are measured by the difference between their sides, conjunctions by the sum of
+// the violations of their operands and disjunctions by the smallest one. Any other boolean expression
+// counts 1 where it does not hold.
+func violation(n node, o evalOptions) node {
+	sp := n.span()
+	if op, ok := n.(operatorNode); ok && len(op.operands) == 2 {
+		a, b := op.operands[0], op.operands[1]
+		switch op.op.Type() {
+		case Less, LessEqual:
+			return positivePart(arithmetic(Subtraction, a, b, sp), sp)
+		case Greater, GreaterEqual:
+			return positivePart(arithmetic(Subtraction, b, a, sp), sp)
+		case Equal:
+			if !isBoolean(a, o) {
+				d := arithmetic(Subtraction, a, b, sp)
+				return conditional(comparison(Greater, d, constantNode(0, sp), sp), d, negation(d, sp), sp)
+			}
+		case And:
+			return arithmetic(Addition, violation(a, o), violation(b, o), sp)
+		case Or:
+			va, vb := violation(a, o), violation(b, o)
+			return conditional(comparison(Less, va, vb, sp), va, vb, sp)
+		}
+	}
+	return conditional(n, constantNode(0, sp), constantNode(1, sp), sp)
+}
+
+// positivePart builds max(d, 0).
+func positivePart(d node, sp Span) node {
+	zero := constantNode(0, sp)
+	return conditional(comparison(Greater, d, zero, sp), d, zero, sp)
+}
+
+func comparison(typ opType, a, b node, sp Span) node {
+	return operatorNode{op: NewOperator(typ), opSpan: sp, operands: []node{a, b}, sp: sp}
+}
+
+// conditional builds cond ? a : b.
+func conditional(cond, a, b node, sp Span) node {
+	return operatorNode{op: NewOperator(ConditionalElse), opSpan: sp, operands: []node{cond, a, b}, sp: sp}
+}
+
+// method returns the method set with WithMethod, or the default one for the problem.
+func (p *problem) method() (m optimizeMethod, err error) {
+	n := len(p.bounds)
+	switch p.o.method {
+	case 0:
+		if n == 1 {
+			return Brent, nil
+		}
+		if p.grad != nil {
+			return BFGS, nil
+		}
+		return NelderMead, nil
+	case GoldenSection, Brent:
+		if n != 1 {
+			return 0, fmt.Errorf(errMethodDimensions, p.o.method, n)
+		}
+	case NelderMead, BFGS:
+	default:
+		return 0, fmt.Errorf(errOptimizeMethod, int(p.o.method))
+	}
+	return p.o.method, nil
+}
+
+// start returns the starting point, within the bounds.
+func (p *problem) start(variables []string) []float64 {
+	x := make([]float64, len(variables))
+	for i, name := range variables {
+		if v, ok := p.o.vars[name]; ok {
+			x[i] = v
+		} else if b := p.bounds[i]; !math.IsInf(b.lo, 0) && !math.IsInf(b.hi, 0) {
+			x[i] = (b.lo + b.hi) / 2
+		}
+	}
+	p.clamp(x)
+	return x
+}
+
+// clamp moves x within the bounds.
+func (p *problem) clamp(x []float64) {
+	for i, b := range p.bounds {
+		x[i] = math.Max(b.lo, math.Min(b.hi, x[i]))
+	}
+}
+
+// value evaluates the expression plus the penalties at x, which is +Inf where they fail to evaluate.
+func (p *problem) value(x []float64) float64 {
+	copy(p.vars, x)
+	f, err := p.f(p.vars)
+	if err != nil || math.IsNaN(f) {
+		return math.Inf(1)
+	}
+	v := p.sign * f
+	for _, g := range p.vs {
+		c, err := g(p.vars)
+		if err != nil || math.IsNaN(c) {
+			return math.Inf(1)
+		}
+		v += p.mu * c * c
+	}
+	return v
+}
+
+// violation returns the sum of the violations of the constraints at x.
+func (p *problem) violation(x []float64) (sum float64) {
+	copy(p.vars, x)
+	for _, g := range p.vs {
+		c, err := g(p.vars)
+		if err != nil || math.IsNaN(c) {
+			return math.Inf(1)
+		}
+		sum += c
+	}
+	return sum
+}
+
+// gradient computes the gradient of value at x into g, symbolically if possible and by central
+// differences otherwise.
+func (p *problem) gradient(x, g []float64) error {
+	if p.grad == nil {
+		for i, xi := range x {
+			h := 6e-6 * math.Max(1, math.Abs(xi))
+			x[i] = xi + h
+			a := p.value(x)
+			x[i] = xi - h
+			b := p.value(x)
+			x[i] = xi
+			g[i] = (a - b) / (2 * h)
+		}
+		return nil
+	}
+
+	copy(p.vars, x)
+	for i, d := range p.grad {
+		v, err := d(p.vars)
+		if err != nil {
+			return err
+		}
+		g[i] = p.sign * v
+	}
+	for j, vf := range p.vs {
+		c, err := vf(p.vars)
+		if err != nil {
+			return err
+		}
+		if c == 0 {
+			continue
+		}
+		for i, d := range p.vgrads[j] {
+			v, err := d(p.vars)
+			if err != nil {
+				return err
+			}
+			g[i] += 2 * p.mu * c * v
+		}
+	}
+	return nil
+}
+
+// minimize1D minimizes a problem of a single variable in its bounds or, if they are not finite, in an
+// interval found by walking downhill from x.
+func (p *problem) minimize1D(x float64, m optimizeMethod) (res []float64, iterations int, converged bool) {
+	lo, hi := p.bounds[0].lo, p.bounds[0].hi
+	if math.IsInf(lo, 0) || math.IsInf(hi, 0) {
+		var ok bool
+		if lo, hi, x, iterations, ok = p.bracket(x); !ok {
+			return []float64{x}, iterations, false
+		}
+	} else if x <= lo || x >= hi {
+		x = lo + goldenFraction*(hi-lo)
+	}
+
+	var n int
+	if m == GoldenSection {
+		x, n, converged = p.goldenSection(lo, hi)
+	} else {
+		x, n, converged = p.brent(lo, hi, x)
+	}
+	return []float64{x}, iterations + n, converged
+}
+
+// goldenFraction is 2 minus the golden ratio, the fraction of an interval that golden-section steps
+// take.
+const goldenFraction = 0.3819660112501051
+
+// goldenRatio is (1 + √5) / 2.
+const goldenRatio = 1.618033988749895
+
+// bracket walks downhill from x in steps that grow by the golden ratio until the value rises again or a
+// bound is reached. It returns an interval that contains a minimum and the lowest point found in it.
+func (p *problem) bracket(x float64) (lo, hi, mid float64, iterations int, ok bool) {
+	f := func(t float64) float64 { return p.value([]float64{t}) }
+	clamp := func(t float64) float64 { return math.Max(p.bounds[0].lo, math.Min(p.bounds[0].hi, t)) }
+
+	h := 0.1 * math.Max(1, math.Abs(x))
+	a, b := x, clamp(x+h)
+	if a == b {
+		b = clamp(x - h)
+	}
+	fa, fb := f(a), f(b)
+	if fb > fa {
+		a, b, fb = b, a, fa
+	}
+	for ; iterations < p.o.iterations(100); iterations++ {
+		c := clamp(b + goldenRatio*(b-a))
+		fc := f(c)
+		if fc >= fb || c == b {
+			return math.Min(a, c), math.Max(a, c), b, iterations, true
+		}
+		a, b, fb = b, c, fc
+	}
+	return 0, 0, b, iterations, false
+}
+
+// goldenSection minimizes a function of one variable between lo and hi by golden-section search.
+func (p *problem) goldenSection(lo, hi float64) (x float64, iterations int, converged bool) {
+	f := func(t float64) float64 { return p.value([]float64{t}) }
+	tol := math.Max(p.o.tolerance, sqrtEpsilon)
+
+	c, d := lo+goldenFraction*(hi-lo), hi-goldenFraction*(hi-lo)
+	fc, fd := f(c), f(d)
+	for ; iterations < p.o.iterations(100); iterations++ {
+		if hi-lo <= tol*math.Max(1, math.Abs(c)) {
+			converged = true
+			break
+		}
+		if fc < fd {
+			hi, d, fd = d, c, fc
+			c = lo + goldenFraction*(hi-lo)
+			fc = f(c)
+		} else {
+			lo, c, fc = c, d, fd
+			d = hi - goldenFraction*(hi-lo)
+			fd = f(d)
+		}
+	}
+	if fc < fd {
+		return c, iterations, converged
+	}
+	return d, iterations, converged
+}
+
+// brent minimizes a function of one variable between a and b with Brent's method, starting from x. It
+// fits a parabola through the three lowest points found, and takes a golden-section step instead whenever
+// the vertex of the parabola falls outside the interval or moves too little.
+func (p *problem) brent(a, b, x float64) (res float64, iterations int, converged bool) {
+	f := func(t float64) float64 { return p.value([]float64{t}) }
+	tol := math.Max(p.o.tolerance, sqrtEpsilon)
+
+	w, v := x, x
+	fx := f(x)
+	fw, fv := fx, fx
+	var d, e float64
+	for ; iterations < p.o.iterations(100); iterations++ {
+		m := (a + b) / 2
+		tol1 := tol*math.Abs(x) + 1e-10*tol
+		tol2 := 2 * tol1
+		if math.Abs(x-m) <= tol2-(b-a)/2 {
+			converged = true
+			break
+		}
+
+		golden := true
+		if math.Abs(e) > tol1 {
+			// parabola through x, w and v
+			r := (x - w) * (fx - fv)
+			q := (x - v) * (fx - fw)
+			s := (x-v)*q - (x-w)*r
+			q = 2 * (q - r)
+			if q > 0 {
+				s = -s
+			}
+			q = math.Abs(q)
+			if math.Abs(s) < math.Abs(q*e/2) && s > q*(a-x) && s < q*(b-x) {
+				e, d = d, s/q
+				golden = false
+				if u := x + d; u-a < tol2 || b-u < tol2 {
+					d = math.Copysign(tol1, m-x)
+				}
+			}
+		}
+		if golden {
+			if x >= m {
+				e = a - x
+			} else {
+				e = b - x
+			}
+			d = goldenFraction * e
+		}
+
+		u := x + d
+		if math.Abs(d) < tol1 {
+			u = x + math.Copysign(tol1, d)
+		}
+		fu := f(u)
+		if fu <= fx {
+			if u >= x {
+				a = x
+			} else {
+				b = x
+			}
+			v, w, x = w, x, u
+			fv, fw, fx = fw, fx, fu
+			continue
+		}
+		if u < x {
+			a = u
+		} else {
+			b = u
+		}
+		if fu <= fw || w == x {
+			v, w = w, u
+			fv, fw = fw, fu
+		} else if fu <= fv || v == x || v == w {
+			v, fv = u, fu
+		}
+	}
+	return x, iterations, converged
+}
+
+// vertex is a point of a Nelder-Mead simplex.
+type vertex struct {
+	x []float64
+	f float64
+}
+
+// nelderMead minimizes a problem with the Nelder-Mead method, starting from a simplex around x.
+func (p *problem) nelderMead(x []float64) (res []float64, iterations int, converged bool) {
+	n := len(x)
+	point := func(x []float64) vertex {
+		p.clamp(x)
+		return vertex{x: x, f: p.value(x)}
+	}
+	// along reflects, expands or contracts the worst vertex through the centroid c by t
+	along := func(c, worst []float64, t float64) vertex {
+		y := make([]float64, n)
+		for i := range y {
+			y[i] = c[i] + t*(c[i]-worst[i])
+		}
+		return point(y)
+	}
+
+	simplex := []vertex{point(append([]float64(nil), x...))}
+	for i := range x {
+		y := append([]float64(nil), x...)
+		h := 0.1 * math.Max(1, math.Abs(x[i]))
+		if y[i] += h; y[i] > p.bounds[i].hi {
+			y[i] = x[i] - h
+		}
+		simplex = append(simplex, point(y))
+	}
+
+	tol := math.Max(p.o.tolerance, sqrtEpsilon)
+	c := make([]float64, n)
+	for ; iterations < p.o.iterations(500*n); iterations++ {
+		sort.SliceStable(simplex, func(i, j int) bool { return simplex[i].f < simplex[j].f })
+		best, worst := simplex[0], simplex[n]
+		if simplexConverged(simplex, tol) {
+			converged = true
+			break
+		}
+
+		for i := range c {
+			c[i] = 0
+			for _, v := range simplex[:n] {
+				c[i] += v.x[i] / float64(n)
+			}
+		}
+		r := along(c, worst.x, 1)
+		switch {
+		case r.f < best.f:
+			if e := along(c, worst.x, 2); e.f < r.f {
+				simplex[n] = e
+			} else {
+				simplex[n] = r
+			}
+			continue
+		case r.f < simplex[n-1].f:
+			simplex[n] = r
+			continue
+		case r.f < worst.f:
+			if k := along(c, worst.x, 0.5); k.f <= r.f {
+				simplex[n] = k
+				continue
+			}
+		default:
+			if k := along(c, worst.x, -0.5); k.f < worst.f {
+				simplex[n] = k
+				continue
+			}
+		}
+
+		// shrink towards the best vertex
+		for _, v := range simplex[1:] {
+			for i := range v.x {
+				v.x[i] = best.x[i] + (v.x[i]-best.x[i])/2
+			}
+		}
+		for i := 1; i <= n; i++ {
+			simplex[i] = point(simplex[i].x)
+		}
+	}
+
+	sort.SliceStable(simplex, func(i, j int) bool { return simplex[i].f < simplex[j].f })
+	return simplex[0].x, iterations, converged
+}
+
+// simplexConverged checks whether every vertex of a sorted simplex is within tol of the best one, both in
+// position and in value.
+func simplexConverged(simplex []vertex, tol float64) bool {
+	best := simplex[0]
+	scale := math.Max(1, maxNorm(best.x))
+	for _, v := range simplex[1:] {
+		if math.Abs(v.f-best.f) > tol*math.Max(1, math.Abs(best.f)) {
+			return false
+		}
+		for i := range v.x {
+			if math.Abs(v.x[i]-best.x[i]) > tol*scale {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// bfgs minimizes a problem with the BFGS method, starting from x. Variables at a bound that the gradient
+// pushes out of it are held there.
+func (p *problem) bfgs(x []float64) (res []float64, iterations int, converged bool, err error) {
+	n := len(x)
+	x = append([]float64(nil), x...)
+	fx := p.value(x)
+	g := make([]float64, n)
+	if err = p.gradient(x, g); err != nil {
+		return nil, 0, false, err
+	}
+
+	// h approximates the inverse of the Hessian
+	h := identity(n)
+	scaled := false
+	loose := math.Sqrt(p.o.tolerance)
+	gtol := p.o.tolerance
+	if p.grad == nil {
+		// finite differences are not more accurate than that
+		gtol = loose
+	}
+	xtol := math.Max(p.o.tolerance, sqrtEpsilon)
+
+	d, xn, gn, s, y := make([]float64, n), make([]float64, n), make([]float64, n), make([]float64, n), make([]float64, n)
+	for ; iterations < p.o.iterations(100*n); iterations++ {
+		if p.projectedNorm(x, g) <= gtol*math.Max(1, math.Abs(fx)) {
+			converged = true
+			break
+		}
+
+		for i := range d {
+			d[i] = 0
+			for j := range g {
+				d[i] -= h[i][j] * g[j]
+			}
+		}
+		p.holdAtBounds(x, g, d)
+		if dot(g, d) >= 0 {
+			// not a descent direction, so start over from steepest descent
+			h, scaled = identity(n), false
+			for i := range d {
+				d[i] = -g[i]
+			}
+			p.holdAtBounds(x, g, d)
+		}
+
+		// backtrack until the value decreases enough
+		var fn float64
+		found := false
+		for t := 1.0; t > 1e-20; t /= 2 {
+			for i := range xn {
+				xn[i] = x[i] + t*d[i]
+			}
+			p.clamp(xn)
+			for i := range s {
+				s[i] = xn[i] - x[i]
+			}
+			if fn = p.value(xn); fn <= fx+1e-4*dot(g, s) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			converged = p.projectedNorm(x, g) <= loose*math.Max(1, math.Abs(fx))
+			break
+		}
+		if err = p.gradient(xn, gn); err != nil {
+			return nil, 0, false, err
+		}
+		for i := range y {
+			y[i] = gn[i] - g[i]
+		}
+		copy(x, xn)
+		copy(g, gn)
+		fx = fn
+		if maxNorm(s) <= xtol*math.Max(1, maxNorm(x)) {
+			iterations++
+			converged = p.projectedNorm(x, g) <= loose*math.Max(1, math.Abs(fx))
+			break
+		}
+
+		sy := dot(s, y)
+		if sy <= 0 {
+			continue
+		}
+		if !scaled {
+			// scale the first approximation to the curvature seen along the first step
+			h = identity(n)
+			for i := range h {
+				h[i][i] = sy / dot(y, y)
+			}
+			scaled = true
+		}
+		updateInverseHessian(h, s, y, sy)
+	}
+	return x, iterations, converged, nil
+}
+
+// holdAtBounds zeroes the components of the direction d of the variables that are at a bound and that the
+// gradient g pushes out of it.
+func (p *problem) holdAtBounds(x, g, d []float64) {
+	for i, b := range p.bounds {
+		if x[i] <= b.lo && g[i] > 0 || x[i] >= b.hi && g[i] < 0 {
+			d[i] = 0
+		}
+	}
+}
+
+// projectedNorm returns the largest component of the gradient g at x, leaving out the variables held at
+// their bounds.
+func (p *problem) projectedNorm(x, g []float64) float64 {
+	d := append([]float64(nil), g...)
+	p.holdAtBounds(x, g, d)
+	return maxNorm(d)
+}
+
+// updateInverseHessian applies the BFGS update for the step s and the change of gradient y to the
+// approximation h of the inverse of the Hessian: h = (I - s yᵀ/sy) h (I - y sᵀ/sy) + s sᵀ/sy.
+func updateInverseHessian(h [][]float64, s, y []float64, sy float64) {
+	n := len(s)
+	hy := make([]float64, n)
+	for i := range hy {
+		hy[i] = dot(h[i], y)
+	}
+	yhy := dot(y, hy)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			h[i][j] += (sy+yhy)*s[i]*s[j]/(sy*sy) - (hy[i]*s[j]+s[i]*hy[j])/sy
+		}
+	}
+}
+
+func identity(n int) [][]float64 {
+	m := make([][]float64, n)
+	for i := range m {
+		m[i] = make([]float64, n)
+		m[i][i] = 1
+	}
+	return m
+}
+
+func dot(a, b []float64) (sum float64) {
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+// maxNorm returns the largest magnitude of the components of a.
+func maxNorm(a []float64) (max float64) {
+	for _, v := range a {
+		max = math.Max(max, math.Abs(v))
+	}
+	return max
+}
@@ -0,0 +1,326 @@
+package yamp
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMinimize(t *testing.T) {
+	xy := []string{"x", "y"}
+	rosenbrock := "(1 - x)^2 + 100(y - x^2)^2"
+	tests := []struct {
+		name       string
+		expr       string
+		variables  []string
+		opts       []NumericOption
+		want       Variables
+		wantValue  float64
+		wantMethod optimizeMethod
+		delta      float64
+	}{
+		{"one variable uses Brent's method", "(x - 2)^2 + 1", []string{"x"}, nil, Variables{"x": 2}, 1, Brent, 1e-7},
+		{
+			name:       "golden-section search",
+			expr:       "(x - 2)^2 + 1",
+			variables:  []string{"x"},
+			opts:       []NumericOption{WithMethod(GoldenSection)},
+			want:       Variables{"x": 2},
+			wantValue:  1,
+			wantMethod: GoldenSection,
+			delta:      1e-7,
+		},
+		{
+			name:       "one variable within bounds",
+			expr:       "x^4 - 2x^2",
+			variables:  []string{"x"},
+			opts:       []NumericOption{WithBounds("x", 0, 3)},
+			want:       Variables{"x": 1},
+			wantValue:  -1,
+			wantMethod: Brent,
+			delta:      1e-7,
+		},
+		{
+			name:       "minima at a bound",
+			expr:       "(x - 2)^2",
+			variables:  []string{"x"},
+			opts:       []NumericOption{WithBounds("x", 5, 3), WithMethod(GoldenSection)},
+			want:       Variables{"x": 3},
+			wantValue:  1,
+			wantMethod: GoldenSection,
+			delta:      1e-7,
+		},
+		{
+			name:       "differentiable expressions of several variables use BFGS",
+			expr:       rosenbrock,
+			variables:  xy,
+			opts:       []NumericOption{WithVariables(Variables{"x": -1.2, "y": 1})},
+			want:       Variables{"x": 1, "y": 1},
+			wantMethod: BFGS,
+			delta:      1e-6,
+		},
+		{
+			name:       "Nelder-Mead",
+			expr:       rosenbrock,
+			variables:  xy,
+			opts:       []NumericOption{WithVariables(Variables{"x": -1.2, "y": 1}), WithMethod(NelderMead)},
+			want:       Variables{"x": 1, "y": 1},
+			wantMethod: NelderMead,
+			delta:      1e-6,
+		},
+		{
+			name:       "other expressions of several variables use Nelder-Mead",
+			expr:       "2^((x - 1)^2 + (y + 2)^2)",
+			variables:  xy,
+			want:       Variables{"x": 1, "y": -2},
+			wantValue:  1,
+			wantMethod: NelderMead,
+			delta:      1e-6,
+		},
+		{
+			name:       "BFGS with numerical gradients",
+			expr:       "2^((x - 1)^2 + (y + 2)^2)",
+			variables:  xy,
+			opts:       []NumericOption{WithMethod(BFGS)},
+			want:       Variables{"x": 1, "y": -2},
+			wantValue:  1,
+			wantMethod: BFGS,
+			delta:      1e-6,
+		},
+		{
+			name:       "several variables within bounds",
+			expr:       "(x - 1)^2 + (y - 2)^2",
+			variables:  xy,
+			opts:       []NumericOption{WithBounds("x", 2, 3)},
+			want:       Variables{"x": 2, "y": 2},
+			wantValue:  1,
+			wantMethod: BFGS,
+			delta:      1e-7,
+		},
+		{
+			name:       "other variables are constants",
+			expr:       "(x - a)^2 + (y - b)^2",
+			variables:  xy,
+			opts:       []NumericOption{WithVariables(Variables{"a": 3, "b": -4})},
+			want:       Variables{"x": 3, "y": -4},
+			wantMethod: BFGS,
+			delta:      1e-7,
+		},
+		{
+			name:       "inequality constraints",
+			expr:       "x^2 + y^2",
+			variables:  xy,
+			opts:       []NumericOption{WithConstraints("x + y >= 2")},
+			want:       Variables{"x": 1, "y": 1},
+			wantValue:  2,
+			wantMethod: BFGS,
+			delta:      1e-4,
+		},
+		{
+			name:       "equality constraints",
+			expr:       "x^2 + y^2",
+			variables:  xy,
+			opts:       []NumericOption{WithConstraints("x - y == 2"), WithMethod(NelderMead)},
+			want:       Variables{"x": 1, "y": -1},
+			wantValue:  2,
+			wantMethod: NelderMead,
+			delta:      1e-4,
+		},
+		{
+			name:       "combined constraints",
+			expr:       "(x - 3)^2",
+			variables:  []string{"x"},
+			opts:       []NumericOption{WithConstraints("x <= 1 || x >= 6", "x > -10 && x != 2")},
+			want:       Variables{"x": 1},
+			wantValue:  4,
+			wantMethod: Brent,
+			delta:      1e-4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Minimize(tt.expr, tt.variables, tt.opts...)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tt.wantMethod, res.Method)
+			assert.True(t, res.Converged)
+			assert.InDelta(t, tt.wantValue, res.Value, tt.delta)
+			for name, want := range tt.want {
+				assert.InDelta(t, want, res.X[name], tt.delta, name)
+			}
+			assert.Len(t, res.X, len(tt.want))
+		})
+	}
+}
+
+func TestMaximize(t *testing.T) {
+	res, err := Maximize("4 - (x - 1)^2", []string{"x"})
+	assert.NoError(t, err)
+	assert.InDelta(t, 1, res.X["x"], 1e-7)
+	assert.InDelta(t, 4, res.Value, 1e-12)
+
+	res, err = Maximize("10 - (x - 3)^2 - (y - 3)^2", []string{"x", "y"}, WithConstraints("x + y <= 4"))
+	assert.NoError(t, err)
+	assert.True(t, res.Converged)
+	assert.InDelta(t, 2, res.X["x"], 1e-4)
+	assert.InDelta(t, 2, res.X["y"], 1e-4)
+	assert.InDelta(t, 8, res.Value, 1e-4)
+}
+
+func TestMinimize_diagnostics(t *testing.T) {
+	res, err := Minimize("x", []string{"x"})
+	assert.NoError(t, err)
+	assert.False(t, res.Converged)
+	assert.Equal(t, 100, res.Iterations)
+
+	res, err = Minimize("(1 - x)^2 + 100(y - x^2)^2", []string{"x", "y"}, WithMaxIterations(5), WithMethod(NelderMead))
+	assert.NoError(t, err)
+	assert.False(t, res.Converged)
+	assert.Equal(t, 5, res.Iterations)
+
+	// constraints that cannot hold
+	res, err = Minimize("x^2", []string{"x"}, WithConstraints("x >= 2", "x <= 1"))
+	assert.NoError(t, err)
+	assert.False(t, res.Converged)
+	assert.InDelta(t, 1.5, res.X["x"], 1e-4)
+	assert.InDelta(t, 1, res.Violation, 1e-4)
+
+	// points where the expression fails are avoided
+	res, err = Minimize("piecewise(x > 0, (x - 1)^2)", []string{"x"}, WithVariables(Variables{"x": 3}))
+	assert.NoError(t, err)
+	assert.True(t, res.Converged)
+	assert.InDelta(t, 1, res.X["x"], 1e-7)
+}
+
+func TestMinimize_errors(t *testing.T) {
+	tests := []struct {
+		name      string
+		expr      string
+		variables []string
+		opts      []NumericOption
+		wantErr   error
+	}{
+		{
+			name:      "syntax errors are reported",
+			expr:      "x + ",
+			variables: []string{"x"},
+			wantErr:   SyntaxError{Message: fmt.Sprintf(errNoRightOperand, "+", 4), Token: "+", Position: 3},
+		},
+		{
+			name:      "the expression must be numeric",
+			expr:      "x > 1",
+			variables: []string{"x"},
+			wantErr:   TypeError{Message: fmt.Sprintf(errResultType, NumericValue, BooleanValue), Span: Span{Start: 0, End: 5}},
+		},
+		{
+			name:      "constraints must be boolean",
+			expr:      "x",
+			variables: []string{"x"},
+			opts:      []NumericOption{WithConstraints("x + 1")},
+			wantErr:   TypeError{Message: fmt.Sprintf(errResultType, BooleanValue, NumericValue), Span: Span{Start: 0, End: 5}},
+		},
+		{
+			name:      "other variables must be given",
+			expr:      "a * x",
+			variables: []string{"x"},
+			wantErr:   fmt.Errorf(errUnboundVariable, "a"),
+		},
+		{
+			name:    "some variable must be optimized",
+			expr:    "1",
+			wantErr: fmt.Errorf(errNoOptimizedVariables),
+		},
+		{
+			name:      "variables are optimized once",
+			expr:      "x",
+			variables: []string{"x", "x"},
+			wantErr:   fmt.Errorf(errOptimizedTwice, "x"),
+		},
+		{
+			name:      "bounds are only given for optimized variables",
+			expr:      "x",
+			variables: []string{"x"},
+			opts:      []NumericOption{WithBounds("y", 0, 1)},
+			wantErr:   fmt.Errorf(errBoundsVariable, "y"),
+		},
+		{
+			name:      "one-dimensional methods",
+			expr:      "x + y",
+			variables: []string{"x", "y"},
+			opts:      []NumericOption{WithMethod(Brent)},
+			wantErr:   fmt.Errorf(errMethodDimensions, Brent, 2),
+		},
+		{
+			name:      "unknown methods",
+			expr:      "x",
+			variables: []string{"x"},
+			opts:      []NumericOption{WithMethod(optimizeMethod(10))},
+			wantErr:   fmt.Errorf(errOptimizeMethod, 10),
+		},
+		{
+			name:      "the starting point must evaluate",
+			expr:      "piecewise(x > 0, x)",
+			variables: []string{"x"},
+			wantErr:   fmt.Errorf(errNoMatchingPiece, "piecewise", 0),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Minimize(tt.expr, tt.variables, tt.opts...)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+
+	_, err := Minimize("x", []string{"x"}, WithEvalOptions(WithNumberMode(Int64Mode)))
+	assert.EqualError(t, err, errCompileNumberMode)
+}
+
+func Test_violation(t *testing.T) {
+	tests := []struct {
+		constraint string
+		x          float64
+		want       float64
+	}{
+		{"x < 1", 3, 2},
+		{"x <= 1", 0, 0},
+		{"x > 1", -1, 2},
+		{"x >= 1", 3, 0},
+		{"x == 1", 3, 2},
+		{"x == 1", -1, 2},
+		{"x >= 1 && x <= 2", 4, 2},
+		{"x <= 1 || x >= 5", 2, 1},
+		{"x <= 1 || x >= 5", 4, 1},
+		{"x != 2", 2, 1},
+		{"(x > 1) == (x > 2)", 1.5, 1},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s at %v", tt.constraint, tt.x), func(t *testing.T) {
+			o := newEvalOptions()
+			n, err := parseConstraint(tt.constraint, o)
+			if !assert.NoError(t, err) {
+				return
+			}
+			fs, vars, err := bindFunctions(o, []string{"x"}, nil, violation(n, o))
+			if !assert.NoError(t, err) {
+				return
+			}
+			vars[0] = tt.x
+			got, err := fs[0](vars)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_updateInverseHessian(t *testing.T) {
+	// the update satisfies the secant equation h y = s
+	h := identity(2)
+	s, y := []float64{1, 2}, []float64{3, 1}
+	updateInverseHessian(h, s, y, dot(s, y))
+	for i := range h {
+		assert.InDelta(t, s[i], dot(h[i], y), 1e-12)
+	}
+	assert.InDelta(t, h[0][1], h[1][0], 1e-12)
+}
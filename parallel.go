@@ -0,0 +1,104 @@
+package yamp
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// parallelShardSize is the number of rows a worker takes at a time.
+const parallelShardSize = batchChunkSize
+
+// EvaluateBatchParallel is like EvaluateBatch, but shards the rows across a pool of goroutines, which
+// is safe because programs are immutable. Each result is written to its own row of out, so the
+// results are in order regardless of scheduling.
+//
+// Errors are reported as with EvaluateBatch: under FailOnError, the returned RowError is that of the
+// first failed row, although rows after it may have been written too, and under the other policies
+// the returned RowErrors hold every failed row. Evaluation stops when ctx is done, in which case the
+// error of ctx is returned and out is only partially written.
+func EvaluateBatchParallel(ctx context.Context, p Program, columns map[string][]float64, out []float64, opts ...BatchOption) error {
+	o := newBatchOptions(opts...)
+
+	cols, err := bindColumns(p, columns, len(out))
+	if err != nil {
+		return err
+	}
+
+	workers := o.workers
+	if shards := (len(out) + parallelShardSize - 1) / parallelShardSize; workers > shards {
+		workers = shards
+	}
+
+	var (
+		next int64 // index of the next shard to take
+		fail = &failures{first: len(out)}
+		wg   sync.WaitGroup
+	)
+	work := func() {
+		defer wg.Done()
+		var be *batchEvaluator
+		if prog, ok := p.(*program); ok {
+			be = newBatchEvaluator(prog, cols)
+		}
+
+		for ctx.Err() == nil {
+			start := int(atomic.AddInt64(&next, 1)-1) * parallelShardSize
+			// shards are taken in order, so no later shard can contain an earlier failure either
+			if start >= len(out) || o.errorPolicy == FailOnError && fail.before(start) {
+				return
+			}
+			end := start + parallelShardSize
+			if end > len(out) {
+				end = len(out)
+			}
+
+			var errs RowErrors
+			if be != nil {
+				errs = be.run(start, out[start:end], o.errorPolicy)
+			} else {
+				errs = runRows(p, cols, start, out[start:end], o.errorPolicy)
+			}
+			fail.record(errs)
+		}
+	}
+
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go work()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	sort.Slice(fail.errs, func(i, j int) bool { return fail.errs[i].Row < fail.errs[j].Row })
+	return batchError(fail.errs, o.errorPolicy)
+}
+
+// failures collects the failed rows of the shards.
+type failures struct {
+	mu    sync.Mutex
+	first int // index of the first failed row
+	errs  RowErrors
+}
+
+// before checks whether a row before the given one failed.
+func (f *failures) before(row int) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.first < row
+}
+
+func (f *failures) record(errs RowErrors) {
+	if len(errs) == 0 {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if errs[0].Row < f.first {
+		f.first = errs[0].Row
+	}
+	f.errs = append(f.errs, errs...)
+}
@@ -0,0 +1,182 @@
+package yamp
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluateBatchParallel(t *testing.T) {
+	rows := 10*parallelShardSize + 7
+	columns := map[string][]float64{"x": make([]float64, rows)}
+	for i := range columns["x"] {
+		columns["x"][i] = float64(i%19 - 4)
+	}
+
+	p, err := Compile("x >= 0 ? x! / (x + 1) : -x")
+	assert.NoError(t, err)
+	bc, err := CompileBytecode("x >= 0 ? x! / (x + 1) : -x")
+	assert.NoError(t, err)
+
+	want := make([]float64, rows)
+	assert.NoError(t, EvaluateBatch(p, columns, want))
+
+	for _, prog := range []Program{p, bc} {
+		for _, workers := range []int{1, 3, 16} {
+			t.Run(fmt.Sprintf("%T with %d workers", prog, workers), func(t *testing.T) {
+				got := make([]float64, rows)
+				err := EvaluateBatchParallel(context.Background(), prog, columns, got, WithWorkers(workers))
+				assert.NoError(t, err)
+				assert.Equal(t, want, got)
+			})
+		}
+	}
+}
+
+func TestEvaluateBatchParallel_errors(t *testing.T) {
+	rows := 8 * parallelShardSize
+	columns := map[string][]float64{"x": make([]float64, rows)}
+	for i := range columns["x"] {
+		columns["x"][i] = 1
+	}
+	// failures in several shards, so that the first one must be picked
+	for _, row := range []int{7*parallelShardSize + 1, 3*parallelShardSize + 5, 5 * parallelShardSize} {
+		columns["x"][row] = -1
+	}
+
+	p, err := Compile("x!")
+	assert.NoError(t, err)
+	bc, err := CompileBytecode("x!")
+	assert.NoError(t, err)
+
+	wantErrs := RowErrors{
+		{Row: 3*parallelShardSize + 5, Err: fmt.Errorf(errFactorialNegativeInt, -1.0)},
+		{Row: 5 * parallelShardSize, Err: fmt.Errorf(errFactorialNegativeInt, -1.0)},
+		{Row: 7*parallelShardSize + 1, Err: fmt.Errorf(errFactorialNegativeInt, -1.0)},
+	}
+
+	t.Run("fail reports the first failed row", func(t *testing.T) {
+		for i := 0; i < 20; i++ {
+			out := make([]float64, rows)
+			err := EvaluateBatchParallel(context.Background(), p, columns, out, WithWorkers(4))
+			assert.Equal(t, RowError{Row: 3*parallelShardSize + 5, Err: fmt.Errorf(errFactorialNegativeInt, -1.0)}, err)
+		}
+	})
+
+	t.Run("NaN marks and reports every failed row", func(t *testing.T) {
+		for _, prog := range []Program{p, bc} {
+			out := make([]float64, rows)
+			err := EvaluateBatchParallel(context.Background(), prog, columns, out, WithWorkers(4), WithErrorPolicy(NaNOnError))
+			assert.Equal(t, wantErrs, err)
+			for i, v := range out {
+				assert.Equal(t, columns["x"][i] < 0, math.IsNaN(v), "row %d", i)
+			}
+		}
+	})
+
+	t.Run("skip reports every failed row", func(t *testing.T) {
+		out := make([]float64, rows)
+		err := EvaluateBatchParallel(context.Background(), p, columns, out, WithWorkers(4), WithErrorPolicy(SkipOnError))
+		assert.Equal(t, wantErrs, err)
+		assert.Equal(t, 0.0, out[3*parallelShardSize+5])
+	})
+
+	t.Run("missing columns are reported", func(t *testing.T) {
+		err := EvaluateBatchParallel(context.Background(), p, nil, make([]float64, 1))
+		assert.Equal(t, fmt.Errorf(errMissingColumn, "x"), err)
+	})
+}
+
+func TestEvaluateBatchParallel_context(t *testing.T) {
+	rows := 4 * parallelShardSize
+	columns := map[string][]float64{"x": make([]float64, rows)}
+	p, err := Compile("x + 1")
+	assert.NoError(t, err)
+
+	t.Run("cancellation stops the evaluation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		out := make([]float64, rows)
+		err := EvaluateBatchParallel(ctx, p, columns, out)
+		assert.Equal(t, context.Canceled, err)
+		assert.Equal(t, make([]float64, rows), out)
+	})
+
+	t.Run("cancellation during the evaluation stops the workers", func(t *testing.T) {
+		rows := 64 * parallelShardSize
+		columns := map[string][]float64{"x": make([]float64, rows)}
+		for i := range columns["x"] {
+			columns["x"][i] = float64(i)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		// cancels while evaluating the third shard
+		p := &cancelingProgram{cancel: cancel, at: 2*parallelShardSize + 10}
+
+		out := make([]float64, rows)
+		err := EvaluateBatchParallel(ctx, p, columns, out, WithWorkers(2))
+		assert.Equal(t, context.Canceled, err)
+
+		// shards that were taken are finished, but no other shard is taken after the cancellation
+		assert.Equal(t, 1.0, out[0])
+		assert.Equal(t, float64(p.at+1), out[p.at])
+		assert.True(t, atomic.LoadInt64(&p.runs) <= int64(5*parallelShardSize), "%d rows ran", p.runs)
+		assert.Equal(t, make([]float64, parallelShardSize), out[rows-parallelShardSize:])
+	})
+
+	t.Run("deadlines stop the evaluation", func(t *testing.T) {
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		defer cancel()
+		err := EvaluateBatchParallel(ctx, p, columns, make([]float64, rows))
+		assert.Equal(t, context.DeadlineExceeded, err)
+	})
+}
+
+// cancelingProgram computes x + 1, and cancels a context when it is run on a given x.
+type cancelingProgram struct {
+	cancel context.CancelFunc
+	at     int
+	runs   int64
+}
+
+func (p *cancelingProgram) Variables() []string {
+	return []string{"x"}
+}
+
+func (p *cancelingProgram) Run(vars []float64) (float64, error) {
+	atomic.AddInt64(&p.runs, 1)
+	if int(vars[0]) == p.at {
+		p.cancel()
+	}
+	return vars[0] + 1, nil
+}
+
+func (p *cancelingProgram) String() string {
+	return "x + 1"
+}
+
+func BenchmarkEvaluateBatchParallel(b *testing.B) {
+	p, err := Compile("x > 0 ? (x^2 + 3x*y - 4) / 7 : -y")
+	if err != nil {
+		b.Fatal(err)
+	}
+	rows := 64 * parallelShardSize
+	columns := map[string][]float64{"x": make([]float64, rows), "y": make([]float64, rows)}
+	for i := 0; i < rows; i++ {
+		columns["x"][i] = float64(i - rows/2)
+		columns["y"][i] = 4
+	}
+	out := make([]float64, rows)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err = EvaluateBatchParallel(context.Background(), p, columns, out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package yamp
+
+import "math"
+
+// symbolicPolynomial returns the coefficients of a syntax tree as a polynomial in the variable, lowest
+// degree first, if it is one of degree at most maxDegree. The coefficients are syntax trees that do not
+// depend on the variable. Exponents must not depend on the variable either, and their value is looked up
+// with exponent.
+func symbolicPolynomial(n node, name string, maxDegree int, o evalOptions, exponent func(node) (float64, bool)) (coeffs []node, ok bool) {
+	if !dependsOn(n, name) {
+		return trimSymbolic([]node{n}), true
+	}
+
+	switch n := n.(type) {
+	case variableNode:
+		if maxDegree < 1 {
+			return nil, false
+		}
+		return []node{constantNode(0, n.sp), constantNode(1, n.sp)}, true
+	case operatorNode:
+		var a, b []node
+		if a, ok = symbolicPolynomial(n.operands[0], name, maxDegree, o, exponent); !ok {
+			return nil, false
+		}
+		sp := n.sp
+		switch n.op.Type() {
+		case Plus:
+			return a, true
+		case Minus:
+			return scaleSymbolic(a, constantNode(-1, sp), sp), true
+		case Percent:
+			return divideSymbolic(a, constantNode(100, sp), sp), true
+		case Addition, Subtraction, Multiplication, Division, Power:
+		default:
+			return nil, false
+		}
+
+		typ := n.op.Type()
+		if o.percentMode == CalculatorPercent && isOperatorNodeOf(n.operands[1], Percent) &&
+			(typ == Addition || typ == Subtraction) {
+			// a ± b% is a (1 ± b/100)
+			pct := n.operands[1].(operatorNode)
+			if b, ok = symbolicPolynomial(pct.operands[0], name, maxDegree, o, exponent); !ok {
+				return nil, false
+			}
+			factor := addSymbolic([]node{constantNode(1, sp)}, divideSymbolic(b, constantNode(100, sp), sp), typ, sp)
+			return multiplySymbolic(a, factor, maxDegree, sp)
+		}
+
+		if b, ok = symbolicPolynomial(n.operands[1], name, maxDegree, o, exponent); !ok {
+			return nil, false
+		}
+		switch typ {
+		case Addition, Subtraction:
+			return addSymbolic(a, b, typ, sp), true
+		case Multiplication:
+			return multiplySymbolic(a, b, maxDegree, sp)
+		case Division:
+			// only division by a constant keeps a polynomial
+			if len(b) != 1 {
+				return nil, false
+			}
+			return divideSymbolic(a, b[0], sp), true
+		}
+
+		// only small non-negative integer exponents keep a polynomial
+		if dependsOn(n.operands[1], name) {
+			return nil, false
+		}
+		exp, ok := exponent(n.operands[1])
+		if !ok || exp != math.Trunc(exp) || exp < 0 || exp > float64(maxDegree) {
+			return nil, false
+		}
+		res := []node{constantNode(1, sp)}
+		for i := 0; i < int(exp); i++ {
+			if res, ok = multiplySymbolic(res, a, maxDegree, sp); !ok {
+				return nil, false
+			}
+		}
+		return res, true
+	}
+	return nil, false
+}
+
+// trimSymbolic drops the coefficients of the highest degrees that are constant zeros.
+func trimSymbolic(p []node) []node {
+	for len(p) > 0 {
+		if v, ok := constantValue(p[len(p)-1]); !ok || v != 0 {
+			break
+		}
+		p = p[:len(p)-1]
+	}
+	return p
+}
+
+func scaleSymbolic(p []node, k node, sp Span) []node {
+	res := make([]node, len(p))
+	for i, c := range p {
+		res[i] = arithmetic(Multiplication, c, k, sp)
+	}
+	return trimSymbolic(res)
+}
+
+func divideSymbolic(p []node, k node, sp Span) []node {
+	res := make([]node, len(p))
+	for i, c := range p {
+		res[i] = arithmetic(Division, c, k, sp)
+	}
+	return trimSymbolic(res)
+}
+
+// addSymbolic adds or subtracts two polynomials, depending on typ.
+func addSymbolic(p, q []node, typ opType, sp Span) []node {
+	n := len(p)
+	if len(q) > n {
+		n = len(q)
+	}
+	res := make([]node, n)
+	for i := range res {
+		a, b := node(constantNode(0, sp)), node(constantNode(0, sp))
+		if i < len(p) {
+			a = p[i]
+		}
+		if i < len(q) {
+			b = q[i]
+		}
+		res[i] = arithmetic(typ, a, b, sp)
+	}
+	return trimSymbolic(res)
+}
+
+// multiplySymbolic multiplies two polynomials, unless the product would be of a higher degree than
+// maxDegree.
+func multiplySymbolic(p, q []node, maxDegree int, sp Span) (res []node, ok bool) {
+	if len(p) == 0 || len(q) == 0 {
+		return nil, true
+	}
+	if len(p)+len(q)-2 > maxDegree {
+		return nil, false
+	}
+	res = make([]node, len(p)+len(q)-1)
+	for i := range res {
+		res[i] = constantNode(0, sp)
+	}
+	for i, a := range p {
+		for j, b := range q {
+			res[i+j] = arithmetic(Addition, res[i+j], arithmetic(Multiplication, a, b, sp), sp)
+		}
+	}
+	return trimSymbolic(res), true
+}
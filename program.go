@@ -0,0 +1,470 @@
+package yamp
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Program is a compiled expression that can be evaluated many times without being parsed again.
+// Programs are immutable and safe for concurrent use.
+type Program interface {
+	// Variables returns the names of the variables in the expression. The value of the i-th
+	// variable is read from the i-th slot of the values passed to Run.
+	Variables() []string
+	// Run evaluates the program with the given variable values, indexed by slot. It does not allocate
+	// unless it returns an error or the expression has sums or products.
+	Run(vars []float64) (float64, error)
+	String() string
+}
+
+var _ Program = (*program)(nil)
+
+type program struct {
+	expr  string
+	names []string
+	run   numFunc
+	// the type-checked syntax tree and options it was compiled with, for batch evaluation
+	tree  node
+	opts  evalOptions
+	slots map[string]int
+}
+
+// Compile parses an expression and compiles it into a Program. Operand types are checked while
+// compiling, so the result must be numeric and the branches of conditionals must have the same type.
+// Only FloatMode is supported.
+func Compile(expr string, opts ...EvalOption) (Program, error) {
+	o := newEvalOptions(opts...)
+	if o.numberMode != FloatMode {
+		return nil, errors.New(errCompileNumberMode)
+	}
+
+	root, err := (&expression{expr: expr}).parse(o.reg)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &compiler{evalOptions: o, slots: make(map[string]int)}
+	f, err := c.compile(root)
+	if err != nil {
+		return nil, err
+	}
+	if f.num == nil {
+		return nil, TypeError{
+			Message: fmt.Sprintf(errResultType, NumericValue, BooleanValue),
+			Span:    root.span(),
+		}
+	}
+	return &program{expr: expr, names: c.names, run: f.num, tree: root, opts: o, slots: c.slots}, nil
+}
+
+// Variables implements the Program interface.
+func (p *program) Variables() []string {
+	return append([]string(nil), p.names...)
+}
+
+// Run implements the Program interface.
+func (p *program) Run(vars []float64) (float64, error) {
+	if len(vars) < len(p.names) {
+		return 0, fmt.Errorf(errSlotCount, len(p.names), len(vars))
+	}
+	return p.run(vars)
+}
+
+func (p *program) String() string {
+	return p.expr
+}
+
+type (
+	numFunc  func(vars []float64) (float64, error)
+	boolFunc func(vars []float64) (bool, error)
+)
+
+// compiled is a compiled node. Exactly one of its functions is set, depending on the node's type.
+type compiled struct {
+	num numFunc
+	b   boolFunc
+}
+
+func (c compiled) typ() valueType {
+	if c.b != nil {
+		return BooleanValue
+	}
+	return NumericValue
+}
+
+// compiler compiles syntax trees into closures, assigning a slot to each variable it encounters.
+type compiler struct {
+	evalOptions
+	slots map[string]int
+	names []string
+	// locals are the indices of the enclosing sums and products, innermost last. They are bound to the
+	// slots after those of the variables.
+	locals []string
+}
+
+func (c *compiler) compile(n node) (res compiled, err error) {
+	switch n := n.(type) {
+	case numberNode:
+		v := n.value
+		return compiled{num: func([]float64) (float64, error) { return v, nil }}, nil
+	case variableNode:
+		for i := len(c.locals) - 1; i >= 0; i-- {
+			if c.locals[i] == n.name {
+				depth := len(c.locals) - i
+				return compiled{num: func(vars []float64) (float64, error) { return vars[len(vars)-depth], nil }}, nil
+			}
+		}
+		slot, ok := c.slots[n.name]
+		if !ok {
+			slot = len(c.names)
+			c.slots[n.name] = slot
+			c.names = append(c.names, n.name)
+		}
+		return compiled{num: func(vars []float64) (float64, error) { return vars[slot], nil }}, nil
+	case operatorNode:
+		return c.compileOperator(n)
+	case callNode:
+		return c.compileCall(n)
+	}
+	return compiled{}, errors.New(errMalformedExpression)
+}
+
+// compileAll compiles the given nodes in order.
+func (c *compiler) compileAll(nodes []node) (res []compiled, err error) {
+	res = make([]compiled, len(nodes))
+	for i, o := range nodes {
+		if res[i], err = c.compile(o); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// checkOperands checks whether compiled operands are of the type the operator expects.
+func checkOperands(n operatorNode, operands []node, args []compiled, want valueType) error {
+	for i, a := range args {
+		if a.typ() != want {
+			return operandTypeError(n, operands[i], want, a.typ())
+		}
+	}
+	return nil
+}
+
+func (c *compiler) compileOperator(n operatorNode) (res compiled, err error) {
+	want := NumericValue
+	switch n.op.Type() {
+	case Equation:
+		return compiled{}, equationError(n)
+	case ConditionalElse:
+		return c.compileConditional(n)
+	case Equal, NotEqual:
+		return c.compileEquality(n)
+	case And, Or, Not:
+		want = BooleanValue
+	case Addition, Subtraction:
+		if c.percentMode == CalculatorPercent && isOperatorNodeOf(n.operands[1], Percent) {
+			return c.compileRelativePercent(n)
+		}
+	}
+
+	args, err := c.compileAll(n.operands)
+	if err != nil {
+		return compiled{}, err
+	}
+	if err = checkOperands(n, n.operands, args, want); err != nil {
+		return compiled{}, err
+	}
+
+	switch n.op.Type() {
+	case And, Or:
+		return compileLogical(n.op.Type(), args[0].b, args[1].b), nil
+	case Not:
+		x := args[0].b
+		return compiled{b: func(vars []float64) (bool, error) {
+			v, err := x(vars)
+			return !v, err
+		}}, nil
+	case Less, LessEqual, Greater, GreaterEqual:
+		typ, l, r := n.op.Type(), args[0].num, args[1].num
+		return compiled{b: func(vars []float64) (bool, error) {
+			a, b, err := evalBoth(vars, l, r)
+			if err != nil {
+				return false, err
+			}
+			return compareFloat(typ, a, b), nil
+		}}, nil
+	}
+
+	op, mode := n.op, c.moduloMode
+	checkInt := isBitwiseOperator(n.op.Type())
+
+	if len(args) == 1 {
+		x := args[0].num
+		return compiled{num: func(vars []float64) (float64, error) {
+			a, err := x(vars)
+			if err != nil {
+				return 0, err
+			}
+			if checkInt && !fitsInt64(a) {
+				return 0, integerOperandError(n, 0, a)
+			}
+			return applyFloat(op, a, 0, mode)
+		}}, nil
+	}
+
+	l, r := args[0].num, args[1].num
+	return compiled{num: func(vars []float64) (float64, error) {
+		a, b, err := evalBoth(vars, l, r)
+		if err != nil {
+			return 0, err
+		}
+		if checkInt {
+			if !fitsInt64(a) {
+				return 0, integerOperandError(n, 0, a)
+			}
+			if !fitsInt64(b) {
+				return 0, integerOperandError(n, 1, b)
+			}
+		}
+		return applyFloat(op, a, b, mode)
+	}}, nil
+}
+
+func evalBoth(vars []float64, l, r numFunc) (a, b float64, err error) {
+	if a, err = l(vars); err != nil {
+		return 0, 0, err
+	}
+	if b, err = r(vars); err != nil {
+		return 0, 0, err
+	}
+	return a, b, nil
+}
+
+func integerOperandError(n operatorNode, i int, v float64) error {
+	return TypeError{
+		Message: fmt.Sprintf(errIntegerOperand, n.op, n.opSpan.Start, NewNumericValue(v)),
+		Span:    n.operands[i].span(),
+	}
+}
+
+// compileLogical compiles '&&' and '||', which only evaluate their right operand when needed.
+func compileLogical(typ opType, l, r boolFunc) compiled {
+	short := typ == Or
+	return compiled{b: func(vars []float64) (bool, error) {
+		a, err := l(vars)
+		if err != nil || a == short {
+			return a, err
+		}
+		return r(vars)
+	}}
+}
+
+// compileRelativePercent compiles "a + b%" and "a - b%" in CalculatorPercent mode.
+func (c *compiler) compileRelativePercent(n operatorNode) (res compiled, err error) {
+	pct := n.operands[1].(operatorNode)
+	operands := []node{n.operands[0], pct.operands[0]}
+	args, err := c.compileAll(operands)
+	if err != nil {
+		return compiled{}, err
+	}
+	if err = checkOperands(n, operands, args, NumericValue); err != nil {
+		return compiled{}, err
+	}
+
+	sign := 1.0
+	if n.op.Type() == Subtraction {
+		sign = -1
+	}
+	l, r := args[0].num, args[1].num
+	return compiled{num: func(vars []float64) (float64, error) {
+		a, b, err := evalBoth(vars, l, r)
+		if err != nil {
+			return 0, err
+		}
+		return a + a*sign*b/100, nil
+	}}, nil
+}
+
+func (c *compiler) compileEquality(n operatorNode) (res compiled, err error) {
+	args, err := c.compileAll(n.operands)
+	if err != nil {
+		return compiled{}, err
+	}
+	if args[0].typ() != args[1].typ() {
+		return compiled{}, TypeError{
+			Message: fmt.Sprintf(errComparedTypes, n.op, n.opSpan.Start, args[0].typ(), args[1].typ()),
+			Span:    n.operands[1].span(),
+		}
+	}
+
+	negate := n.op.Type() == NotEqual
+	if args[0].typ() == BooleanValue {
+		l, r := args[0].b, args[1].b
+		return compiled{b: func(vars []float64) (bool, error) {
+			a, err := l(vars)
+			if err != nil {
+				return false, err
+			}
+			b, err := r(vars)
+			return (a == b) != negate, err
+		}}, nil
+	}
+
+	l, r := args[0].num, args[1].num
+	return compiled{b: func(vars []float64) (bool, error) {
+		a, b, err := evalBoth(vars, l, r)
+		return (a == b) != negate, err
+	}}, nil
+}
+
+func (c *compiler) compileConditional(n operatorNode) (res compiled, err error) {
+	cond, err := c.compile(n.operands[0])
+	if err != nil {
+		return compiled{}, err
+	}
+	if cond.typ() != BooleanValue {
+		return compiled{}, TypeError{
+			Message: fmt.Sprintf(errConditionType, n.opSpan.Start, cond.typ()),
+			Span:    n.operands[0].span(),
+		}
+	}
+
+	branches, err := c.compileBranches(n.operands[1:], NewOperator(Conditional), n.opSpan)
+	if err != nil {
+		return compiled{}, err
+	}
+	return choose([]boolFunc{cond.b}, branches), nil
+}
+
+func (c *compiler) compileCall(n callNode) (res compiled, err error) {
+	switch n.fn.Type() {
+	case Sum, Product:
+		return c.compileSeries(n)
+	case Diff, Integral:
+		return c.compileCalculus(n)
+	case If, Piecewise:
+		// if(a, b, c) has a single condition, and piecewise alternates conditions and values,
+		// optionally ending with a default value
+		var condNodes, valueNodes []node
+		if n.fn.Type() == If {
+			condNodes, valueNodes = n.args[:1], n.args[1:]
+		} else {
+			for i := 0; i+1 < len(n.args); i += 2 {
+				condNodes = append(condNodes, n.args[i])
+				valueNodes = append(valueNodes, n.args[i+1])
+			}
+			if len(n.args)%2 == 1 {
+				valueNodes = append(valueNodes, n.args[len(n.args)-1])
+			}
+		}
+
+		conds := make([]boolFunc, len(condNodes))
+		for i, cn := range condNodes {
+			var cond compiled
+			if cond, err = c.compile(cn); err != nil {
+				return compiled{}, err
+			}
+			if cond.typ() != BooleanValue {
+				return compiled{}, TypeError{
+					Message: fmt.Sprintf(errArgumentType, 2*i+1, n.fn, n.fnSpan.Start, BooleanValue, cond.typ()),
+					Span:    cn.span(),
+				}
+			}
+			conds[i] = cond.b
+		}
+
+		branches, err := c.compileBranches(valueNodes, n.fn, n.fnSpan)
+		if err != nil {
+			return compiled{}, err
+		}
+		if len(branches) == len(conds) {
+			branches = append(branches, noMatchingPiece(n, branches[0].typ()))
+		}
+		return choose(conds, branches), nil
+	case Popcount, Clz:
+		arg, err := c.compile(n.args[0])
+		if err != nil {
+			return compiled{}, err
+		}
+		if arg.typ() != NumericValue {
+			return compiled{}, TypeError{
+				Message: fmt.Sprintf(errArgumentType, 1, n.fn, n.fnSpan.Start, NumericValue, arg.typ()),
+				Span:    n.args[0].span(),
+			}
+		}
+		x, typ := arg.num, n.fn.Type()
+		return compiled{num: func(vars []float64) (float64, error) {
+			a, err := x(vars)
+			if err != nil {
+				return 0, err
+			}
+			if !fitsInt64(a) {
+				return 0, TypeError{
+					Message: fmt.Sprintf(errIntegerArgument, 1, n.fn, n.fnSpan.Start, NewNumericValue(a)),
+					Span:    n.args[0].span(),
+				}
+			}
+			return float64(bitCount64(typ, int64(a))), nil
+		}}, nil
+	}
+	return compiled{}, fmt.Errorf(errUnknownFunction, n.fn)
+}
+
+// compileBranches compiles the values a conditional chooses from, which must have the same type.
+func (c *compiler) compileBranches(nodes []node, tok Token, sp Span) (res []compiled, err error) {
+	if res, err = c.compileAll(nodes); err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(res); i++ {
+		if res[i].typ() != res[0].typ() {
+			return nil, TypeError{
+				Message: fmt.Sprintf(errBranchTypes, tok, sp.Start, res[0].typ(), res[i].typ()),
+				Span:    nodes[i].span(),
+			}
+		}
+	}
+	return res, nil
+}
+
+// choose compiles a chain of conditionals that picks the value after the first true condition,
+// or the last value if none are true.
+func choose(conds []boolFunc, values []compiled) compiled {
+	for i := len(conds) - 1; i >= 0; i-- {
+		cond, then, els := conds[i], values[i], values[i+1]
+		if then.typ() == BooleanValue {
+			values[i] = compiled{b: func(vars []float64) (bool, error) {
+				ok, err := cond(vars)
+				if err != nil {
+					return false, err
+				}
+				if ok {
+					return then.b(vars)
+				}
+				return els.b(vars)
+			}}
+			continue
+		}
+		values[i] = compiled{num: func(vars []float64) (float64, error) {
+			ok, err := cond(vars)
+			if err != nil {
+				return 0, err
+			}
+			if ok {
+				return then.num(vars)
+			}
+			return els.num(vars)
+		}}
+	}
+	return values[0]
+}
+
+func noMatchingPiece(n callNode, typ valueType) compiled {
+	if typ == BooleanValue {
+		return compiled{b: func([]float64) (bool, error) {
+			return false, fmt.Errorf(errNoMatchingPiece, n.fn, n.fnSpan.Start)
+		}}
+	}
+	return compiled{num: func([]float64) (float64, error) {
+		return 0, fmt.Errorf(errNoMatchingPiece, n.fn, n.fnSpan.Start)
+	}}
+}
@@ -0,0 +1,202 @@
+package yamp
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		opts []EvalOption
+		vars Variables
+	}{
+		{"arithmetic follows precedence", "1 + 2 * 3 ^ 2", nil, nil},
+		{"variables are read from their slots", "2x + y / x", nil, Variables{"x": 4, "y": 6}},
+		{"postfix operators are supported", "3! + 4!! + 50%", nil, nil},
+		{"the ternary conditional picks a branch", "x > 1 ? x * 2 : -x", nil, Variables{"x": 3}},
+		{"logical operators combine comparisons", "x > 1 && not (x == 2) || x < 0 ? 1 : 0", nil, Variables{"x": 3}},
+		{"boolean equality is supported", "(x > 1) == (x > 2) ? 1 : 0", nil, Variables{"x": 3}},
+		{"if picks a branch", "if(x < 0, -x, x)", nil, Variables{"x": -5}},
+		{"piecewise falls back to its default", "piecewise(x < 0, -1, x > 10, 1, 0)", nil, Variables{"x": 5}},
+		{"modulo follows the selected mode", "x mod 3 + x // 3", []EvalOption{WithModuloMode(EuclideanModulo)}, Variables{"x": -7}},
+		{"calculator percentages are relative", "x + 10% - 5%", []EvalOption{WithPercentMode(CalculatorPercent)}, Variables{"x": 200}},
+		{"bitwise operators and functions are supported", "(x << 4 | 3) xor ~x & 255 + popcount(x) + clz(x)", nil, Variables{"x": 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := NewExpression(tt.expr).EvaluateWith(tt.vars, tt.opts...)
+			assert.NoError(t, err)
+
+			p, err := Compile(tt.expr, tt.opts...)
+			if !assert.NoError(t, err) {
+				return
+			}
+			slots := make([]float64, len(p.Variables()))
+			for i, name := range p.Variables() {
+				slots[i] = tt.vars[name]
+			}
+			got, err := p.Run(slots)
+			assert.NoError(t, err)
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
+func TestCompile_errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		opts    []EvalOption
+		wantErr error
+	}{
+		{
+			name:    "syntax errors are reported",
+			expr:    "1 +",
+			wantErr: SyntaxError{Message: fmt.Sprintf(errNoRightOperand, "+", 3), Token: "+", Position: 2},
+		},
+		{
+			name: "operand types are checked",
+			expr: "1 + (2 < 3)",
+			wantErr: TypeError{
+				Message: fmt.Sprintf(errOperandType, "+", 2, NumericValue, BooleanValue),
+				Span:    Span{Start: 5, End: 10},
+			},
+		},
+		{
+			name: "branches must have the same type",
+			expr: "x > 0 ? 1 : x > 1",
+			wantErr: TypeError{
+				Message: fmt.Sprintf(errBranchTypes, "?", 6, NumericValue, BooleanValue),
+				Span:    Span{Start: 12, End: 17},
+			},
+		},
+		{
+			name: "conditions of functions must be boolean",
+			expr: "piecewise(x < 0, 1, x, 2)",
+			wantErr: TypeError{
+				Message: fmt.Sprintf(errArgumentType, 3, "piecewise", 0, BooleanValue, NumericValue),
+				Span:    Span{Start: 20, End: 21},
+			},
+		},
+		{
+			name: "the result must be numeric",
+			expr: "x < 1",
+			wantErr: TypeError{
+				Message: fmt.Sprintf(errResultType, NumericValue, BooleanValue),
+				Span:    Span{Start: 0, End: 5},
+			},
+		},
+		{
+			name:    "equations can only be solved",
+			expr:    "2x = 1",
+			wantErr: SyntaxError{Message: fmt.Sprintf(errEquation, 3), Token: "=", Position: 3},
+		},
+		{
+			name:    "integer modes are not supported",
+			expr:    "1",
+			opts:    []EvalOption{WithNumberMode(Int64Mode)},
+			wantErr: errors.New(errCompileNumberMode),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Compile(tt.expr, tt.opts...)
+			assert.Nil(t, p)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+func Test_program_Run_errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		vars    []float64
+		wantErr error
+	}{
+		{
+			name:    "missing slots are reported",
+			expr:    "x + y",
+			vars:    []float64{1},
+			wantErr: fmt.Errorf(errSlotCount, 2, 1),
+		},
+		{
+			name:    "domain errors are reported",
+			expr:    "x!",
+			vars:    []float64{-1},
+			wantErr: fmt.Errorf(errFactorialNegativeInt, -1.0),
+		},
+		{
+			name:    "unmatched pieces are reported",
+			expr:    "piecewise(x > 0, 1)",
+			vars:    []float64{-1},
+			wantErr: fmt.Errorf(errNoMatchingPiece, "piecewise", 0),
+		},
+		{
+			name: "non-integer bitwise operands are reported",
+			expr: "x & 1",
+			vars: []float64{0.5},
+			wantErr: TypeError{
+				Message: fmt.Sprintf(errIntegerOperand, "&", 2, "0.5"),
+				Span:    Span{Start: 0, End: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Compile(tt.expr)
+			if !assert.NoError(t, err) {
+				return
+			}
+			_, err = p.Run(tt.vars)
+			if _, ok := tt.wantErr.(TypeError); ok {
+				assert.Equal(t, tt.wantErr, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr.Error())
+			}
+		})
+	}
+}
+
+func Test_program_Variables(t *testing.T) {
+	p, err := Compile("y * x + y")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"y", "x"}, p.Variables())
+	assert.Equal(t, "y * x + y", p.String())
+
+	// the returned names are a copy
+	p.Variables()[0] = "z"
+	assert.Equal(t, []string{"y", "x"}, p.Variables())
+}
+
+func Test_program_Run_allocs(t *testing.T) {
+	p, err := Compile("x > 0 && y != 2 ? (x^2 + 3x*y - 4) mod 7 + 5! : piecewise(y < 0, -y, x)")
+	assert.NoError(t, err)
+
+	vars := []float64{3, 4}
+	allocs := testing.AllocsPerRun(100, func() {
+		_, _ = p.Run(vars)
+	})
+	assert.Zero(t, allocs)
+}
+
+func BenchmarkProgram_Run(b *testing.B) {
+	p, err := Compile("x > 0 ? (x^2 + 3x*y - 4) / 7 : -y")
+	if err != nil {
+		b.Fatal(err)
+	}
+	vars := []float64{3, 4}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		vars[0] = float64(i)
+		if _, err = p.Run(vars); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
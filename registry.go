@@ -1,6 +1,9 @@
 package yamp
 
-import "unicode"
+import (
+	"unicode"
+	"unicode/utf8"
+)
 
 // IsDigit checks if a given rune is a digit.
 func IsDigit(r rune) bool {
@@ -32,13 +35,40 @@ func IsWhitespace(r rune) bool {
 	return defaultTokenRegistry.IsWhitespace(r)
 }
 
-var defaultTokenRegistry = TokenRegistry{
-	operators: defaultOperators,
+// IsLetter checks if a given rune can start an identifier.
+func IsLetter(r rune) bool {
+	return defaultTokenRegistry.IsLetter(r)
+}
+
+// IsSeparator checks if a given rune is a function argument separator.
+func IsSeparator(r rune) bool {
+	return defaultTokenRegistry.IsSeparator(r)
 }
 
+var defaultTokenRegistry = NewTokenRegistry(defaultOperators, defaultFunctions)
+
 // TokenRegistry maps runes into their respective tokens.
 type TokenRegistry struct {
 	operators OperatorRegistry
+	opTrie    *operatorTrie
+	functions FunctionRegistry
+}
+
+// NewTokenRegistry creates a TokenRegistry for the given operators and functions. Operators registered
+// after the TokenRegistry is created will not be recognized by the tokenizer.
+//
+// To change how a symbol is interpreted, start from DefaultOperators and replace its entry. For example,
+// to read '%' as the modulo operator instead of a percentage:
+//
+//	ops := DefaultOperators()
+//	ops["%"] = []Operator{NewOperator(Modulo)}
+//	reg := NewTokenRegistry(ops, DefaultFunctions())
+func NewTokenRegistry(ops OperatorRegistry, fns FunctionRegistry) TokenRegistry {
+	return TokenRegistry{
+		operators: ops,
+		opTrie:    newOperatorTrie(ops),
+		functions: fns,
+	}
 }
 
 // IsDigit checks if a given rune is a digit.
@@ -48,10 +78,22 @@ func (m TokenRegistry) IsDigit(r rune) bool {
 
 // IsOperator checks if a given rune is an operator.
 func (m TokenRegistry) IsOperator(r rune) bool {
-	_, ok := m.operators.GetOperator(r, nil)
+	_, ok := m.operators.GetOperator(string(r), nil)
 	return ok
 }
 
+// matchOperator returns the longest operator symbol at the start of s, or an empty string if
+// s does not start with an operator.
+func (m TokenRegistry) matchOperator(s string) string {
+	return m.opTrie.longestMatch(s)
+}
+
+// operatorMatchComplete checks whether the longest operator symbol at the start of s is known, that
+// is, whether no longer symbol could match if s were followed by more input.
+func (m TokenRegistry) operatorMatchComplete(s string) bool {
+	return m.opTrie.matchComplete(s)
+}
+
 // IsLeftBracket checks if a given rune is a left parenthesis.
 func (m TokenRegistry) IsLeftBracket(r rune) bool {
 	// TODO: add support for other bracket notations.
@@ -75,32 +117,102 @@ func (m TokenRegistry) IsWhitespace(r rune) bool {
 	return unicode.IsSpace(r)
 }
 
+// IsLetter checks if a given rune can start an identifier. Identifiers continue with letters or digits.
+func (m TokenRegistry) IsLetter(r rune) bool {
+	return unicode.IsLetter(r) || r == '_'
+}
+
+// IsSeparator checks if a given rune is a function argument separator.
+func (m TokenRegistry) IsSeparator(r rune) bool {
+	return r == ','
+}
+
+// IsFunction checks if a given name is a function.
+func (m TokenRegistry) IsFunction(name string) bool {
+	_, ok := m.functions[name]
+	return ok
+}
+
 var defaultOperators = OperatorRegistry{
-	'+': {NewOperator(Plus), NewOperator(Addition)},
-	'-': {NewOperator(Minus), NewOperator(Subtraction)},
-	'*': {NewOperator(Multiplication)},
-	'/': {NewOperator(Division)},
-	'^': {NewOperator(Power)},
-	'!': {NewOperator(Factorial)},
+	"+":   {NewOperator(Plus), NewOperator(Addition)},
+	"-":   {NewOperator(Minus), NewOperator(Subtraction)},
+	"*":   {NewOperator(Multiplication)},
+	"/":   {NewOperator(Division)},
+	"^":   {NewOperator(Power)},
+	"!":   {NewOperator(Factorial)},
+	"!!":  {NewOperator(DoubleFactorial)},
+	"%":   {NewOperator(Percent)},
+	"mod": {NewOperator(Modulo)},
+	"//":  {NewOperator(FloorDivision)},
+	"rem": {NewOperator(Remainder)},
+	"<":   {NewOperator(Less)},
+	"<=":  {NewOperator(LessEqual)},
+	">":   {NewOperator(Greater)},
+	">=":  {NewOperator(GreaterEqual)},
+	"==":  {NewOperator(Equal)},
+	"!=":  {NewOperator(NotEqual)},
+	"&&":  {NewOperator(And)},
+	"||":  {NewOperator(Or)},
+	"not": {NewOperator(Not)},
+	"?":   {NewOperator(Conditional)},
+	":":   {NewOperator(ConditionalElse)},
+	"&":   {NewOperator(BitwiseAnd)},
+	"|":   {NewOperator(BitwiseOr)},
+	"xor": {NewOperator(BitwiseXor)},
+	"~":   {NewOperator(BitwiseNot)},
+	"<<":  {NewOperator(ShiftLeft)},
+	">>":  {NewOperator(ShiftRight)},
+	"=":   {NewOperator(Equation)},
+}
+
+// DefaultOperators returns a copy of the operators recognized by default.
+func DefaultOperators() OperatorRegistry {
+	reg := make(OperatorRegistry, len(defaultOperators))
+	for symbol, ops := range defaultOperators {
+		reg[symbol] = append([]Operator(nil), ops...)
+	}
+	return reg
+}
+
+type dialect int
+
+// Dialects of the operator symbols
+const (
+	// MathDialect reads '^' as exponentiation. This is the default.
+	MathDialect dialect = iota + 1
+	// CDialect reads '^' as bitwise XOR like C-family languages, and '**' as exponentiation.
+	CDialect
+)
+
+// DialectOperators returns a copy of the operators recognized by default, adjusted for the given dialect.
+// Pass them to NewTokenRegistry to evaluate expressions in that dialect.
+func DialectOperators(d dialect) OperatorRegistry {
+	reg := DefaultOperators()
+	if d == CDialect {
+		reg["^"] = []Operator{NewOperator(BitwiseXor)}
+		reg["**"] = []Operator{NewOperator(Power)}
+	}
+	return reg
 }
 
 type (
-	// OperatorRegistry contains a registry of operator runes.
+	// OperatorRegistry contains a registry of operator symbols. A symbol may consist of
+	// multiple runes, in which case the tokenizer picks the longest symbol that matches.
 	// Use make(OperatorRegistry) to create a new OperatorRegistry.
-	OperatorRegistry map[rune][]Operator
+	OperatorRegistry map[string][]Operator
 )
 
-// Register registers a new rune with the given operator token.
-func (reg OperatorRegistry) Register(r rune, op Operator) {
-	reg[r] = append(reg[r], op)
+// Register registers a new symbol with the given operator token.
+func (reg OperatorRegistry) Register(symbol string, op Operator) {
+	reg[symbol] = append(reg[symbol], op)
 }
 
-// GetOperator gets the operator of a rune that matches the given filter(s). Filters are combined using the AND clause.
-// If no filters are given, GetOperator will return the first operator of that rune it encounters in the
+// GetOperator gets the operator of a symbol that matches the given filter(s). Filters are combined using the AND clause.
+// If no filters are given, GetOperator will return the first operator of that symbol it encounters in the
 // registry. If none is found, ok will be false.
-func (reg OperatorRegistry) GetOperator(r rune, filter ...func(Operator) bool) (res Operator, ok bool) {
+func (reg OperatorRegistry) GetOperator(symbol string, filter ...func(Operator) bool) (res Operator, ok bool) {
 Loop:
-	for _, op := range reg[r] {
+	for _, op := range reg[symbol] {
 		if len(filter) == 0 {
 			return op, true
 		}
@@ -119,3 +231,94 @@ Loop:
 
 	return nil, false
 }
+
+var defaultFunctions = FunctionRegistry{
+	"if":        NewFunction(If),
+	"piecewise": NewFunction(Piecewise),
+	"popcount":  NewFunction(Popcount),
+	"clz":       NewFunction(Clz),
+	"sum":       NewFunction(Sum),
+	"Σ":         NewFunction(Sum),
+	"prod":      NewFunction(Product),
+	"Π":         NewFunction(Product),
+	"diff":      NewFunction(Diff),
+	"integrate": NewFunction(Integral),
+}
+
+// DefaultFunctions returns a copy of the functions recognized by default.
+func DefaultFunctions() FunctionRegistry {
+	reg := make(FunctionRegistry, len(defaultFunctions))
+	for name, fn := range defaultFunctions {
+		reg[name] = fn
+	}
+	return reg
+}
+
+// FunctionRegistry contains a registry of function names.
+// Use make(FunctionRegistry) to create a new FunctionRegistry.
+type FunctionRegistry map[string]Function
+
+// Register registers a new name with the given function token.
+func (reg FunctionRegistry) Register(name string, fn Function) {
+	reg[name] = fn
+}
+
+// operatorTrie is a prefix tree of operator symbols, used by the tokenizer to find the longest
+// operator symbol at a given position.
+type operatorTrie struct {
+	children map[rune]*operatorTrie
+	terminal bool
+}
+
+func newOperatorTrie(reg OperatorRegistry) *operatorTrie {
+	root := &operatorTrie{}
+	for symbol := range reg {
+		root.insert(symbol)
+	}
+	return root
+}
+
+func (n *operatorTrie) insert(symbol string) {
+	curr := n
+	for _, r := range symbol {
+		if curr.children == nil {
+			curr.children = make(map[rune]*operatorTrie)
+		}
+		next, ok := curr.children[r]
+		if !ok {
+			next = &operatorTrie{}
+			curr.children[r] = next
+		}
+		curr = next
+	}
+	curr.terminal = true
+}
+
+// longestMatch returns the longest symbol in the trie that is a prefix of s.
+func (n *operatorTrie) longestMatch(s string) string {
+	var length int
+
+	curr := n
+	for i, r := range s {
+		if curr = curr.children[r]; curr == nil {
+			break
+		}
+		if curr.terminal {
+			length = i + utf8.RuneLen(r)
+		}
+	}
+
+	return s[:length]
+}
+
+// matchComplete checks whether s leaves the trie before it ends, so that the longest match in s is
+// also the longest match in any string that starts with s.
+func (n *operatorTrie) matchComplete(s string) bool {
+	curr := n
+	for _, r := range s {
+		if curr = curr.children[r]; curr == nil {
+			return true
+		}
+	}
+	return len(curr.children) == 0
+}
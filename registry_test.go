@@ -8,20 +8,92 @@ import (
 
 func TestOperatorRegistry_GetOperator(t *testing.T) {
 	reg := defaultOperators
-	op, _ := reg.GetOperator('+', IsUnaryOp, IsRightAssocOp)
+	op, _ := reg.GetOperator("+", IsUnaryOp, IsRightAssocOp)
 	assert.Equal(t, NewOperator(Plus), op)
-	op, _ = reg.GetOperator('+', IsBinaryOp)
+	op, _ = reg.GetOperator("+", IsBinaryOp)
 	assert.Equal(t, NewOperator(Addition), op)
-	op, _ = reg.GetOperator('-', IsUnaryOp, IsRightAssocOp)
+	op, _ = reg.GetOperator("-", IsUnaryOp, IsRightAssocOp)
 	assert.Equal(t, NewOperator(Minus), op)
-	op, _ = reg.GetOperator('-', IsBinaryOp)
+	op, _ = reg.GetOperator("-", IsBinaryOp)
 	assert.Equal(t, NewOperator(Subtraction), op)
-	op, _ = reg.GetOperator('*', IsBinaryOp)
+	op, _ = reg.GetOperator("*", IsBinaryOp)
 	assert.Equal(t, NewOperator(Multiplication), op)
-	op, _ = reg.GetOperator('/', IsBinaryOp)
+	op, _ = reg.GetOperator("/", IsBinaryOp)
 	assert.Equal(t, NewOperator(Division), op)
-	op, _ = reg.GetOperator('^', IsBinaryOp)
+	op, _ = reg.GetOperator("^", IsBinaryOp)
 	assert.Equal(t, NewOperator(Power), op)
-	op, _ = reg.GetOperator('!', IsUnaryOp, IsLeftAssocOp)
+	op, _ = reg.GetOperator("!", IsUnaryOp, IsLeftAssocOp)
 	assert.Equal(t, NewOperator(Factorial), op)
+	op, _ = reg.GetOperator("!!", IsUnaryOp, IsLeftAssocOp)
+	assert.Equal(t, NewOperator(DoubleFactorial), op)
+	op, _ = reg.GetOperator("%", IsUnaryOp, IsLeftAssocOp)
+	assert.Equal(t, NewOperator(Percent), op)
+	op, _ = reg.GetOperator("mod", IsBinaryOp)
+	assert.Equal(t, NewOperator(Modulo), op)
+	op, _ = reg.GetOperator("//", IsBinaryOp)
+	assert.Equal(t, NewOperator(FloorDivision), op)
+	op, _ = reg.GetOperator("rem", IsBinaryOp)
+	assert.Equal(t, NewOperator(Remainder), op)
+}
+
+func Test_operatorTrie_longestMatch(t *testing.T) {
+	reg := make(OperatorRegistry)
+	reg.Register("<", NewOperator(Addition))
+	reg.Register("<=", NewOperator(Addition))
+	reg.Register("<<=", NewOperator(Addition))
+	reg.Register("mod", NewOperator(Addition))
+	trie := newOperatorTrie(reg)
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"a single-rune symbol should be matched", "<5", "<"},
+		{"the longest symbol should be preferred", "<=5", "<="},
+		{"the longest symbol should be preferred over multiple shorter ones", "<<=5", "<<="},
+		{"an incomplete symbol should fall back to the longest complete prefix", "<<5", "<"},
+		{"a word symbol should be matched", "mod 5", "mod"},
+		{"an incomplete word symbol should not be matched", "mo", ""},
+		{"no symbol should be matched for unknown input", "#", ""},
+		{"no symbol should be matched for empty input", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, trie.longestMatch(tt.input))
+		})
+	}
+}
+
+func TestTokenRegistry_IsFunction(t *testing.T) {
+	assert.True(t, defaultTokenRegistry.IsFunction("if"))
+	assert.True(t, defaultTokenRegistry.IsFunction("piecewise"))
+	assert.False(t, defaultTokenRegistry.IsFunction("x"))
+}
+
+func TestDefaultOperators(t *testing.T) {
+	reg := DefaultOperators()
+	assert.Equal(t, defaultOperators, reg)
+
+	reg["%"] = []Operator{NewOperator(Modulo)}
+	reg.Register("+", NewOperator(Multiplication))
+	assert.Equal(t, []Operator{NewOperator(Percent)}, defaultOperators["%"])
+	assert.Len(t, defaultOperators["+"], 2)
+}
+
+func TestDialectOperators(t *testing.T) {
+	assert.Equal(t, defaultOperators, DialectOperators(MathDialect))
+
+	reg := DialectOperators(CDialect)
+	assert.Equal(t, []Operator{NewOperator(BitwiseXor)}, reg["^"])
+	assert.Equal(t, []Operator{NewOperator(Power)}, reg["**"])
+	assert.Equal(t, []Operator{NewOperator(Power)}, defaultOperators["^"])
+}
+
+func TestDefaultFunctions(t *testing.T) {
+	reg := DefaultFunctions()
+	assert.Equal(t, defaultFunctions, reg)
+
+	delete(reg, "if")
+	assert.True(t, defaultTokenRegistry.IsFunction("if"))
 }
@@ -0,0 +1,17 @@
+package yamp
+
+type separator int
+
+var _ Token = separator(0)
+
+// ArgSeparator separates the arguments of a function call.
+const ArgSeparator separator = 1
+
+func (s separator) String() string {
+	switch s {
+	case ArgSeparator:
+		return ","
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,560 @@
+package yamp
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// maxSeriesIndex is the largest magnitude of the bounds of sums and products, beyond which consecutive
+// integers cannot be told apart as float64.
+const maxSeriesIndex = 1 << 53
+
+// maxSeriesTerms is the largest number of terms a finite sum or product is evaluated with one by one.
+const maxSeriesTerms = 10000000
+
+// seriesDegree is the highest degree of the polynomial terms that sums add up in closed form.
+const seriesDegree = 10
+
+// Infinite sums take at most infiniteSeriesTerms terms, and extrapolate their partial sums from at most
+// levinTerms of them.
+const (
+	infiniteSeriesTerms = 1000
+	levinTerms          = 40
+)
+
+// seriesTolerance is the relative difference between successive extrapolations of an infinite sum at
+// which it is considered converged.
+const seriesTolerance = 1e-9
+
+// evalSeries evaluates a sum or a product.
+func (ev *evaluator) evalSeries(n callNode) (res Value, err error) {
+	index, body := n.args[0].(variableNode).name, n.args[3]
+	var bounds [2]Value
+	for i := range bounds {
+		if bounds[i], err = ev.eval(n.args[i+1]); err != nil {
+			return nil, err
+		}
+		if bounds[i].Type() == BooleanValue {
+			return nil, TypeError{
+				Message: fmt.Sprintf(errArgumentType, i+2, n.fn, n.fnSpan.Start, NumericValue, BooleanValue),
+				Span:    n.args[i+1].span(),
+			}
+		}
+	}
+
+	// the index shadows any variable of the same name within the body
+	vars := make(Variables, len(ev.vars)+1)
+	for name, v := range ev.vars {
+		vars[name] = v
+	}
+	inner := newEvaluator(vars, ev.evalOptions)
+	term := func(k float64) (Value, error) {
+		vars[index] = k
+		v, err := inner.eval(body)
+		if err != nil {
+			return nil, err
+		}
+		if v.Type() == BooleanValue {
+			return nil, TypeError{
+				Message: fmt.Sprintf(errArgumentType, 4, n.fn, n.fnSpan.Start, NumericValue, BooleanValue),
+				Span:    body.span(),
+			}
+		}
+		return v, nil
+	}
+
+	if ev.numberMode != FloatMode {
+		return ev.evalIntegerSeries(n, bounds, term)
+	}
+	x, err := evalSeries(n, bounds[0].Number(), bounds[1].Number(), ev.seriesForm(n), func(k float64) (float64, error) {
+		v, err := term(k)
+		if err != nil {
+			return 0, err
+		}
+		return v.Number(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return NewNumericValue(x), nil
+}
+
+// seriesForm returns the closed form of a sum, if it has one.
+func (ev *evaluator) seriesForm(n callNode) *seriesForm {
+	shape, ok := analyzeSeries(n, ev.evalOptions, ev.constant)
+	if !ok {
+		return nil
+	}
+	nodes := shape.nodes()
+	values := make([]float64, len(nodes))
+	for i, c := range nodes {
+		if values[i], ok = ev.constant(c); !ok {
+			return nil
+		}
+	}
+	return newSeriesForm(shape, values)
+}
+
+// evalIntegerSeries evaluates a sum or a product term by term in the integer number modes.
+func (ev *evaluator) evalIntegerSeries(n callNode, bounds [2]Value, term func(float64) (Value, error)) (res Value, err error) {
+	var b [2]float64
+	for i, v := range bounds {
+		b[i], _ = new(big.Float).SetInt(v.Int()).Float64()
+		if math.IsInf(b[i], 0) {
+			return nil, fmt.Errorf(errSeriesBound, n.fn, n.fnSpan.Start, v)
+		}
+	}
+	lo, hi := b[0], b[1]
+	if err = checkSeriesBounds(n, lo, hi); err != nil {
+		return nil, err
+	}
+	if hi-lo+1 > maxSeriesTerms {
+		return nil, fmt.Errorf(errSeriesTerms, n.fn, n.fnSpan.Start, hi-lo+1, maxSeriesTerms)
+	}
+
+	op, res := NewOperator(Addition), NewIntegerValue(big.NewInt(0))
+	if n.fn.Type() == Product {
+		op, res = NewOperator(Multiplication), NewIntegerValue(big.NewInt(1))
+	}
+	for k := lo; k <= hi; k++ {
+		var t Value
+		if t, err = term(k); err != nil {
+			return nil, err
+		}
+		if res, err = ev.applyOperator(op, res, t); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// compileSeries compiles a sum or a product. The index is bound to a slot appended after those of the
+// enclosing expression, so the body runs on a copy of the variables with one more slot.
+func (c *compiler) compileSeries(n callNode) (res compiled, err error) {
+	index, body := n.args[0].(variableNode).name, n.args[3]
+	bounds, err := c.compileAll(n.args[1:3])
+	if err != nil {
+		return compiled{}, err
+	}
+	for i, b := range bounds {
+		if b.typ() != NumericValue {
+			return compiled{}, TypeError{
+				Message: fmt.Sprintf(errArgumentType, i+2, n.fn, n.fnSpan.Start, NumericValue, b.typ()),
+				Span:    n.args[i+1].span(),
+			}
+		}
+	}
+
+	c.locals = append(c.locals, index)
+	f, err := c.compile(body)
+	c.locals = c.locals[:len(c.locals)-1]
+	if err != nil {
+		return compiled{}, err
+	}
+	if f.num == nil {
+		return compiled{}, TypeError{
+			Message: fmt.Sprintf(errArgumentType, 4, n.fn, n.fnSpan.Start, NumericValue, BooleanValue),
+			Span:    body.span(),
+		}
+	}
+
+	// the closed form is only known when the exponents of the terms are literals
+	shape, ok := analyzeSeries(n, c.evalOptions, constantValue)
+	var parts []numFunc
+	for _, p := range shape.nodes() {
+		var pf compiled
+		if pf, err = c.compile(p); err != nil || pf.num == nil {
+			ok = false
+			break
+		}
+		parts = append(parts, pf.num)
+	}
+
+	lo, hi, term := bounds[0].num, bounds[1].num, f.num
+	return compiled{num: func(vars []float64) (float64, error) {
+		a, err := lo(vars)
+		if err != nil {
+			return 0, err
+		}
+		b, err := hi(vars)
+		if err != nil {
+			return 0, err
+		}
+
+		var form *seriesForm
+		if ok {
+			values := make([]float64, len(parts))
+			for i, p := range parts {
+				if values[i], err = p(vars); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				form = newSeriesForm(shape, values)
+			}
+		}
+
+		local := make([]float64, len(vars)+1)
+		copy(local, vars)
+		return evalSeries(n, a, b, form, func(k float64) (float64, error) {
+			local[len(vars)] = k
+			return term(local)
+		})
+	}}, nil
+}
+
+// evalSeries evaluates a sum or a product of the terms from lo to hi, with the closed form of the terms
+// if there is one.
+func evalSeries(n callNode, lo, hi float64, form *seriesForm, term func(k float64) (float64, error)) (res float64, err error) {
+	if err = checkSeriesBounds(n, lo, hi); err != nil {
+		return 0, err
+	}
+	product := n.fn.Type() == Product
+	switch {
+	case lo > hi && product:
+		return 1, nil
+	case lo > hi:
+		return 0, nil
+	case form != nil:
+		return form.sum(n, lo, hi)
+	case math.IsInf(hi, 1) && product:
+		return 0, fmt.Errorf(errInfiniteProduct, n.fn, n.fnSpan.Start)
+	case math.IsInf(hi, 1):
+		return infiniteSum(n, lo, term)
+	case hi-lo+1 > maxSeriesTerms:
+		return 0, fmt.Errorf(errSeriesTerms, n.fn, n.fnSpan.Start, hi-lo+1, maxSeriesTerms)
+	}
+
+	if product {
+		res = 1
+		for k := lo; k <= hi; k++ {
+			var t float64
+			if t, err = term(k); err != nil {
+				return 0, err
+			}
+			res *= t
+		}
+		return res, nil
+	}
+	var s compensatedSum
+	for k := lo; k <= hi; k++ {
+		var t float64
+		if t, err = term(k); err != nil {
+			return 0, err
+		}
+		s.add(t)
+	}
+	return s.value(), nil
+}
+
+// checkSeriesBounds checks that the bounds of a sum or a product are integers. The upper bound may also
+// be infinite.
+func checkSeriesBounds(n callNode, lo, hi float64) error {
+	invalid := func(v float64) bool {
+		return math.IsNaN(v) || v != math.Trunc(v) || math.Abs(v) > maxSeriesIndex
+	}
+	if invalid(lo) {
+		return fmt.Errorf(errSeriesBound, n.fn, n.fnSpan.Start, lo)
+	}
+	if invalid(hi) && !math.IsInf(hi, 0) {
+		return fmt.Errorf(errSeriesBound, n.fn, n.fnSpan.Start, hi)
+	}
+	return nil
+}
+
+// infiniteSum adds up the terms from lo on. Unless the terms soon become negligible, the partial sums are
+// extrapolated with Levin's u-transform, which converges much faster than they do for alternating series
+// and for series whose terms decrease like a power of the index. The sum is the first extrapolation that
+// agrees with the two before it to seriesTolerance.
+//
+// Only the first infiniteSeriesTerms terms are taken, so divergence cannot be told apart from slow
+// convergence in general. If no extrapolation settles, the sum is reported as divergent when its last term
+// is not smaller than the largest one, and as unsettled otherwise: that includes divergent sums whose
+// terms shrink, like that of 1/k, as well as convergent ones whose extrapolations lose their precision to
+// rounding before they agree, like that of 1/k^1.01. Terms that are not finite are errors.
+func infiniteSum(n callNode, lo float64, term func(k float64) (float64, error)) (float64, error) {
+	var (
+		s                         compensatedSum
+		terms, partial, estimates []float64
+		largest                   float64
+		start                     int // the first term after the last zero one, from which to extrapolate
+	)
+	for i := 0; i < infiniteSeriesTerms; i++ {
+		t, err := term(lo + float64(i))
+		if err != nil {
+			return 0, err
+		}
+		if math.IsNaN(t) || math.IsInf(t, 0) {
+			return 0, fmt.Errorf(errSeriesTerm, lo+float64(i), n.fn, n.fnSpan.Start, t)
+		}
+		s.add(t)
+		sum := s.value()
+		if i > 0 && math.Abs(t) <= epsilon*math.Abs(sum) && math.Abs(terms[i-1]) <= epsilon*math.Abs(sum) {
+			return sum, nil
+		}
+		terms, partial = append(terms, t), append(partial, sum)
+
+		shrinking := math.Abs(t) < largest
+		largest = math.Max(largest, math.Abs(t))
+		if t == 0 {
+			start, estimates = i+1, estimates[:0]
+		}
+		if i-start < 2 || i-start >= levinTerms || !shrinking {
+			continue
+		}
+
+		e := levinU(terms[start:], partial[start:])
+		if math.IsNaN(e) || math.IsInf(e, 0) {
+			continue
+		}
+		estimates = append(estimates, e)
+		// two successive agreements guard against estimates that meet by chance
+		if k := len(estimates); k >= 3 &&
+			math.Abs(e-estimates[k-2]) <= seriesTolerance*math.Abs(e) &&
+			math.Abs(estimates[k-2]-estimates[k-3]) <= 100*seriesTolerance*math.Abs(e) {
+			return e, nil
+		}
+	}
+	if math.Abs(terms[len(terms)-1]) >= largest {
+		return 0, fmt.Errorf(errSeriesDiverges, n.fn, n.fnSpan.Start)
+	}
+	return 0, fmt.Errorf(errSeriesUnsettled, n.fn, n.fnSpan.Start, infiniteSeriesTerms)
+}
+
+// levinU extrapolates the limit of partial sums from every term with Levin's u-transform:
+//
+//	Σ (-1)^j C(k, j) ((j+1)/(k+1))^(k-1) s_j/w_j  /  Σ (-1)^j C(k, j) ((j+1)/(k+1))^(k-1) / w_j
+//
+// where s_j is the j-th partial sum and w_j = (j+1) a_j for the j-th term a_j.
+func levinU(terms, partial []float64) float64 {
+	k := len(terms) - 1
+	var num, den float64
+	c := 1.0 // (-1)^j C(k, j)
+	for j := 0; j <= k; j++ {
+		w := float64(j+1) * terms[j]
+		r := math.Pow(float64(j+1)/float64(k+1), float64(k-1))
+		num += c * r * partial[j] / w
+		den += c * r / w
+		c = -c * float64(k-j) / float64(j+1)
+	}
+	return num / den
+}
+
+// seriesShape is the shape of the terms of a sum that has a closed form, made of syntax trees that do
+// not depend on the index: either the coefficients of a polynomial in the index, lowest degree first, or
+// c and r of the geometric terms c r^k.
+type seriesShape struct {
+	poly      []node
+	geometric bool
+	c, r      node
+}
+
+// analyzeSeries looks for the shape of the terms of a sum that has a closed form. The value of exponents
+// is looked up with exponent.
+func analyzeSeries(n callNode, o evalOptions, exponent func(node) (float64, bool)) (shape seriesShape, ok bool) {
+	if n.fn.Type() != Sum {
+		return seriesShape{}, false
+	}
+	index, body := n.args[0].(variableNode).name, n.args[3]
+	if shape.poly, ok = symbolicPolynomial(body, index, seriesDegree, o, exponent); ok {
+		return shape, true
+	}
+	if shape.c, shape.r, ok = symbolicGeometric(body, index, o, exponent); ok {
+		shape.geometric = true
+		return shape, true
+	}
+	return seriesShape{}, false
+}
+
+// nodes returns the syntax trees of the shape.
+func (s seriesShape) nodes() []node {
+	if s.geometric {
+		return []node{s.c, s.r}
+	}
+	return s.poly
+}
+
+// symbolicGeometric returns c and r such that a syntax tree is c r^k in the variable k, if it is made of
+// powers whose exponents are linear in k, multiplied or divided by each other or by constants.
+func symbolicGeometric(n node, name string, o evalOptions, exponent func(node) (float64, bool)) (c, r node, ok bool) {
+	op, isOp := n.(operatorNode)
+	if !isOp || !dependsOn(n, name) {
+		return nil, nil, false
+	}
+
+	sp := op.sp
+	factor := func(n node) (c, r node, ok bool) {
+		if !dependsOn(n, name) {
+			return n, constantNode(1, sp), true
+		}
+		return symbolicGeometric(n, name, o, exponent)
+	}
+	switch op.op.Type() {
+	case Plus:
+		return symbolicGeometric(op.operands[0], name, o, exponent)
+	case Minus:
+		if c, r, ok = symbolicGeometric(op.operands[0], name, o, exponent); !ok {
+			return nil, nil, false
+		}
+		return negation(c, sp), r, true
+	case Power:
+		base := op.operands[0]
+		if dependsOn(base, name) {
+			return nil, nil, false
+		}
+		e, ok := symbolicPolynomial(op.operands[1], name, 1, o, exponent)
+		if !ok || len(e) != 2 {
+			return nil, nil, false
+		}
+		return arithmetic(Power, base, e[0], sp), arithmetic(Power, base, e[1], sp), true
+	case Multiplication, Division:
+		ca, ra, aok := factor(op.operands[0])
+		cb, rb, bok := factor(op.operands[1])
+		if !aok || !bok {
+			return nil, nil, false
+		}
+		typ := op.op.Type()
+		return arithmetic(typ, ca, cb, sp), arithmetic(typ, ra, rb, sp), true
+	}
+	return nil, nil, false
+}
+
+// seriesForm is a seriesShape whose syntax trees have been evaluated.
+type seriesForm struct {
+	poly      []float64
+	geometric bool
+	c, r      float64
+}
+
+// newSeriesForm creates the closed form of a shape from the values of its syntax trees, unless some of
+// them are not finite.
+func newSeriesForm(shape seriesShape, values []float64) *seriesForm {
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil
+		}
+	}
+	if shape.geometric {
+		return &seriesForm{geometric: true, c: values[0], r: values[1]}
+	}
+	return &seriesForm{poly: values}
+}
+
+// sum adds up the terms from lo to hi, which are integers with lo <= hi, except that hi may be +Inf.
+// Polynomials are summed with Faulhaber's formula, whose power sums are computed exactly.
+func (f *seriesForm) sum(n callNode, lo, hi float64) (float64, error) {
+	if f.geometric {
+		return f.geometricSum(n, lo, hi)
+	}
+	if math.IsInf(hi, 1) {
+		if len(f.poly) > 0 {
+			return 0, fmt.Errorf(errSeriesDiverges, n.fn, n.fnSpan.Start)
+		}
+		return 0, nil
+	}
+
+	a, _ := big.NewFloat(lo).Int(nil)
+	b, _ := big.NewFloat(hi).Int(nil)
+	var s compensatedSum
+	for p, c := range f.poly {
+		if c != 0 {
+			ps, _ := powerSum(p, a, b).Float64()
+			s.add(c * ps)
+		}
+	}
+	return s.value(), nil
+}
+
+func (f *seriesForm) geometricSum(n callNode, lo, hi float64) (float64, error) {
+	c, r := f.c, f.r
+	switch {
+	case c == 0:
+		return 0, nil
+	case math.IsInf(hi, 1):
+		if math.Abs(r) >= 1 {
+			return 0, fmt.Errorf(errSeriesDiverges, n.fn, n.fnSpan.Start)
+		}
+		return c * math.Pow(r, lo) / (1 - r), nil
+	case r == 1:
+		return c * (hi - lo + 1), nil
+	case r > 0:
+		// r^lo (r^m - 1) / (r - 1) for m terms, which keeps its precision when r is close to 1
+		l := math.Log(r)
+		return c * math.Pow(r, lo) * math.Expm1((hi-lo+1)*l) / math.Expm1(l), nil
+	}
+	return c * (math.Pow(r, lo) - math.Pow(r, hi+1)) / (1 - r), nil
+}
+
+// faulhaber holds the coefficients of the polynomials S_p(n) = 1^p + 2^p + ... + n^p, lowest degree
+// first, for p up to seriesDegree.
+var faulhaber = faulhaberPolynomials(seriesDegree)
+
+// faulhaberPolynomials computes S_p(n) = Σ C(p+1, j) B_j n^(p+1-j) / (p+1) for p up to maxDegree, where
+// B_j are the Bernoulli numbers with B_1 = 1/2.
+func faulhaberPolynomials(maxDegree int) [][]*big.Rat {
+	binomial := func(n, k int) *big.Rat {
+		return new(big.Rat).SetInt(new(big.Int).Binomial(int64(n), int64(k)))
+	}
+
+	// Σ_{j<=m} C(m+1, j) B_j = m + 1
+	bernoulli := make([]*big.Rat, maxDegree+1)
+	for m := range bernoulli {
+		b := big.NewRat(int64(m+1), 1)
+		for j := 0; j < m; j++ {
+			b.Sub(b, new(big.Rat).Mul(binomial(m+1, j), bernoulli[j]))
+		}
+		bernoulli[m] = b.Quo(b, big.NewRat(int64(m+1), 1))
+	}
+
+	polys := make([][]*big.Rat, maxDegree+1)
+	for p := range polys {
+		polys[p] = make([]*big.Rat, p+2)
+		polys[p][0] = new(big.Rat)
+		for j := 0; j <= p; j++ {
+			c := new(big.Rat).Mul(binomial(p+1, j), bernoulli[j])
+			polys[p][p+1-j] = c.Quo(c, big.NewRat(int64(p+1), 1))
+		}
+	}
+	return polys
+}
+
+// powerSum returns lo^p + (lo+1)^p + ... + hi^p for lo <= hi, as S_p(hi) - S_p(lo-1). Since S_p(n) -
+// S_p(n-1) = n^p holds for every integer n, the bounds may be negative.
+func powerSum(p int, lo, hi *big.Int) *big.Rat {
+	eval := func(n *big.Int) *big.Rat {
+		x := new(big.Rat).SetInt(n)
+		coeffs := faulhaber[p]
+		res := new(big.Rat)
+		for i := len(coeffs) - 1; i >= 0; i-- {
+			res.Mul(res, x)
+			res.Add(res, coeffs[i])
+		}
+		return res
+	}
+	below := new(big.Int).Sub(lo, big.NewInt(1))
+	return new(big.Rat).Sub(eval(hi), eval(below))
+}
+
+// compensatedSum adds up floats with Neumaier's summation, which keeps track of the rounding errors of
+// the additions.
+type compensatedSum struct {
+	sum, c float64
+}
+
+func (s *compensatedSum) add(x float64) {
+	t := s.sum + x
+	if math.Abs(s.sum) >= math.Abs(x) {
+		s.c += (s.sum - t) + x
+	} else {
+		s.c += (x - t) + s.sum
+	}
+	s.sum = t
+}
+
+func (s compensatedSum) value() float64 {
+	if math.IsInf(s.sum, 0) || math.IsNaN(s.sum) {
+		return s.sum
+	}
+	return s.sum + s.c
+}
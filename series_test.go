@@ -0,0 +1,152 @@
+package yamp
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_evaluator_series(t *testing.T) {
+	tests := []struct {
+		name  string
+		expr  string
+		vars  Variables
+		want  float64
+		delta float64
+	}{
+		{"sums add up their terms", "sum(k, 1, 10, k^2)", nil, 385, 0},
+		{"products multiply their terms", "prod(k, 1, 5, k)", nil, 120, 0},
+		{"Σ and Π are aliases", "Σ(k, 1, 4, k) + Π(k, 1, 4, k)", nil, 34, 0},
+		{"bounds can be expressions", "sum(k, n - 1, 2n, 1)", Variables{"n": 3}, 5, 0},
+		{"empty sums are zero", "sum(k, 5, 1, k)", nil, 0, 0},
+		{"empty products are one", "prod(k, 5, 1, k)", nil, 1, 0},
+		{"the index shadows variables", "k + sum(k, 1, 3, k)", Variables{"k": 10}, 16, 0},
+		{"sums can be nested", "sum(i, 1, 3, sum(j, i, 3, i j))", nil, 25, 0},
+		{"terms can be any expression", "sum(k, 1, 3, k < 2 ? 1 : k!)", nil, 9, 0},
+		{"polynomials are summed in closed form", "sum(k, 1, 2^40, k)", nil, math.Pow(2, 40) * (math.Pow(2, 40) + 1) / 2, 0},
+		{"power sums may have negative bounds", "sum(k, -3, 2, a k^3 + k)", Variables{"a": 2}, -57, 0},
+		{"geometric sums are summed in closed form", "sum(k, 1, 10^6, 3 / 2^k)", nil, 3, 1e-15},
+		{"geometric ratios can be variables", "sum(k, 2, 4, -x^k)", Variables{"x": 1.0001}, -(1.00020001 + 1.000300030001 + 1.0004000600040001), 1e-12},
+		{"infinite geometric sums converge below a ratio of one", "sum(k, 0, 1/0, x^(2k + 1))", Variables{"x": 0.5}, 2.0 / 3, 1e-15},
+		{"infinite polynomial sums of zero are zero", "sum(k, 1, 1/0, 0k)", nil, 0, 0},
+		{"infinite sums with quickly shrinking terms", "sum(k, 0, 1/0, 1/k!)", nil, math.E, 1e-9},
+		{"infinite sums with slowly shrinking terms are extrapolated", "sum(k, 1, 1/0, 1/k^2)", nil, math.Pi * math.Pi / 6, 1e-9},
+		{"alternating infinite sums are extrapolated", "sum(k, 1, 1/0, (-1)^(k + 1)/k)", nil, math.Ln2, 1e-9},
+		{"extrapolation starts after zero terms", "sum(k, 0, 1/0, k/(k^3 + 1))", nil, 1.1116439382240957, 1e-9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewExpression(tt.expr).EvaluateWith(tt.vars)
+			if assert.NoError(t, err) {
+				assert.InDelta(t, tt.want, got, tt.delta)
+			}
+
+			p, err := Compile(tt.expr)
+			if !assert.NoError(t, err) {
+				return
+			}
+			slots := make([]float64, len(p.Variables()))
+			for i, name := range p.Variables() {
+				slots[i] = tt.vars[name]
+			}
+			got, err = p.Run(slots)
+			if assert.NoError(t, err) {
+				assert.InDelta(t, tt.want, got, tt.delta)
+			}
+		})
+	}
+}
+
+func Test_evaluator_series_errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr error
+	}{
+		{
+			name:    "the index must be a variable",
+			expr:    "sum(2, 1, 3, 4)",
+			wantErr: SyntaxError{Message: fmt.Sprintf(errIndexVariable, "sum", 0), Token: "sum", Position: 4},
+		},
+		{
+			name:    "bounds must be numeric",
+			expr:    "sum(k, 1 < 2, 3, k)",
+			wantErr: TypeError{Message: fmt.Sprintf(errArgumentType, 2, "sum", 0, NumericValue, BooleanValue), Span: Span{Start: 7, End: 12}},
+		},
+		{
+			name:    "terms must be numeric",
+			expr:    "prod(k, 1, 3, k > 1)",
+			wantErr: TypeError{Message: fmt.Sprintf(errArgumentType, 4, "prod", 0, NumericValue, BooleanValue), Span: Span{Start: 14, End: 19}},
+		},
+		{"bounds must be integers", "sum(k, 1.5, 3, k)", fmt.Errorf(errSeriesBound, "sum", 0, 1.5)},
+		{"bounds must be exact as floats", "sum(k, 1, 2^60, 1/k)", fmt.Errorf(errSeriesBound, "sum", 0, math.Pow(2, 60))},
+		{"the lower bound must be finite", "sum(k, -1/0, 1, k)", fmt.Errorf(errSeriesBound, "sum", 0, math.Inf(-1))},
+		{"the number of terms is limited", "sum(k, 1, 10^8, 1/k)", fmt.Errorf(errSeriesTerms, "sum", 0, 1e8, maxSeriesTerms)},
+		{"products cannot be infinite", "prod(k, 1, 1/0, 1 + 1/k^2)", fmt.Errorf(errInfiniteProduct, "prod", 0)},
+		{"the harmonic series does not settle", "sum(k, 1, 1/0, 1/k)", fmt.Errorf(errSeriesUnsettled, "sum", 0, infiniteSeriesTerms)},
+		{"nor do slowly converging series", "sum(k, 1, 1/0, 1/k^1.01)", fmt.Errorf(errSeriesUnsettled, "sum", 0, infiniteSeriesTerms)},
+		{"infinite terms are errors", "sum(k, 0, 1/0, 1/k)", fmt.Errorf(errSeriesTerm, 0.0, "sum", 0, math.Inf(1))},
+		{"undefined terms are errors", "sum(k, 0, 1/0, 0/k)", fmt.Errorf(errSeriesTerm, 0.0, "sum", 0, math.NaN())},
+		{"alternating terms must shrink", "sum(k, 0, 1/0, (-1)^k)", fmt.Errorf(errSeriesDiverges, "sum", 0)},
+		{"infinite polynomial sums diverge", "sum(k, 1, 1/0, k)", fmt.Errorf(errSeriesDiverges, "sum", 0)},
+		{"infinite geometric sums diverge above a ratio of one", "sum(k, 1, 1/0, 2^k)", fmt.Errorf(errSeriesDiverges, "sum", 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewExpression(tt.expr).Evaluate()
+			assert.Equal(t, tt.wantErr, err)
+
+			p, err := Compile(tt.expr)
+			if err == nil {
+				_, err = p.Run(nil)
+			}
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+func Test_evaluator_series_integer(t *testing.T) {
+	got, err := NewExpression("prod(k, 1, 25, k)").EvaluateValue(WithNumberMode(BigIntMode))
+	assert.NoError(t, err)
+	want, _ := new(big.Int).SetString("15511210043330985984000000", 10)
+	assert.Equal(t, NewIntegerValue(want), got)
+
+	// integer sums wrap around in Int64Mode like their additions do
+	got, err = NewExpression("sum(k, 1, 3, 2^62)").EvaluateValue(WithNumberMode(Int64Mode))
+	assert.NoError(t, err)
+	assert.Equal(t, NewIntegerValue(big.NewInt(-1<<62)), got)
+
+	got, err = NewExpression("sum(k, 5, 1, k)").EvaluateValue(WithNumberMode(Int64Mode))
+	assert.NoError(t, err)
+	assert.Equal(t, NewIntegerValue(big.NewInt(0)), got)
+
+	_, err = NewExpression("sum(k, 1, 2^60, k)").EvaluateValue(WithNumberMode(BigIntMode))
+	assert.Equal(t, fmt.Errorf(errSeriesBound, "sum", 0, math.Pow(2, 60)), err)
+}
+
+func Test_powerSum(t *testing.T) {
+	for p := 0; p <= seriesDegree; p++ {
+		for _, r := range [][2]int64{{1, 1}, {0, 7}, {-5, 3}, {-6, -2}} {
+			want := new(big.Int)
+			for k := r[0]; k <= r[1]; k++ {
+				want.Add(want, new(big.Int).Exp(big.NewInt(k), big.NewInt(int64(p)), nil))
+			}
+			got := powerSum(p, big.NewInt(r[0]), big.NewInt(r[1]))
+			assert.Equal(t, new(big.Rat).SetInt(want).String(), got.String(), "p = %d, range %v", p, r)
+		}
+	}
+}
+
+func Test_compensatedSum(t *testing.T) {
+	var s compensatedSum
+	for _, x := range []float64{1, 1e100, 1, -1e100} {
+		s.add(x)
+	}
+	assert.Equal(t, 2.0, s.value())
+
+	s.add(math.Inf(1))
+	assert.Equal(t, math.Inf(1), s.value())
+}
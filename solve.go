@@ -0,0 +1,398 @@
+package yamp
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+type solveMethod int
+
+// Methods that find the roots of an equation
+const (
+	// ClosedForm solves equations that are linear, quadratic or cubic polynomials in the variable exactly.
+	ClosedForm solveMethod = iota + 1
+	// Bracketing finds every root in an interval with Brent's method, starting from the parts of the
+	// interval whose ends have opposite signs.
+	Bracketing
+	// NewtonRaphson follows the derivative of the equation from a starting point. The derivative is
+	// computed symbolically when possible, and by finite differences otherwise.
+	NewtonRaphson
+)
+
+func (m solveMethod) String() string {
+	switch m {
+	case ClosedForm:
+		return "closed form"
+	case Bracketing:
+		return "Brent"
+	case NewtonRaphson:
+		return "Newton-Raphson"
+	}
+	return "<?>"
+}
+
+// Root is a root of an equation, along with how it was found.
+type Root struct {
+	X          float64     // X is the value of the variable.
+	Residual   float64     // Residual is the difference between the sides of the equation at X.
+	Method     solveMethod // Method is the method that found the root.
+	Iterations int         // Iterations is the number of iterations taken, which is 0 for closed forms.
+	Converged  bool        // Converged tells whether the tolerance was met within the maximum number of iterations.
+}
+
+// Solve finds the values of a variable for which both sides of an equation such as "2x^2 = x + 1" are
+// equal. An expression without '=' is solved for the values that make it zero. The other variables of
+// the equation must be given with WithVariables.
+//
+// Linear, quadratic and cubic polynomials are solved in closed form. Otherwise, if WithInterval is given,
+// every root that can be bracketed in the interval is found with Brent's method. Roots where the equation
+// touches zero without crossing it may be missed, and poles where it changes sign are left out. Without
+// an interval, a single root is looked for with Newton's method, starting from the value of the variable
+// given with WithVariables, or 1 by default. A root that did not converge is still returned, with
+// Converged unset.
+//
+// The roots are sorted in increasing order.
+func Solve(equation, variable string, opts ...NumericOption) (roots []Root, err error) {
+	o := newNumericOptions(opts...)
+	eo := newEvalOptions(o.evalOptions...)
+
+	root, err := parseNumeric(equation, eo)
+	if err != nil {
+		return nil, err
+	}
+	residual := root
+	if n, ok := root.(operatorNode); ok && n.op.Type() == Equation {
+		// lhs = rhs is solved as lhs - rhs = 0
+		residual = operatorNode{op: NewOperator(Subtraction), opSpan: n.opSpan, operands: n.operands, sp: n.sp}
+	}
+
+	fs, vars, err := bindFunctions(eo, []string{variable}, o.vars, residual)
+	if err != nil {
+		return nil, err
+	}
+	f := func(x float64) (float64, error) {
+		vars[0] = x
+		return fs[0](vars)
+	}
+
+	if coeffs, ok := polynomial(residual, variable, newEvaluator(o.vars, eo)); ok {
+		if len(coeffs) == 0 {
+			return nil, fmt.Errorf(errIdentity, variable)
+		}
+		return closedFormRoots(coeffs, f, o), nil
+	}
+	if o.hasInterval {
+		return bracketRoots(f, o)
+	}
+
+	root0, ok := o.vars[variable]
+	if !ok {
+		root0 = 1
+	}
+	var df func(x float64) (float64, error)
+	if d, err := differentiate(residual, variable, eo); err == nil {
+		dfs, dvars, err := bindFunctions(eo, []string{variable}, o.vars, d)
+		if err != nil {
+			return nil, err
+		}
+		df = func(x float64) (float64, error) {
+			dvars[0] = x
+			return dfs[0](dvars)
+		}
+	} else {
+		df = centralDifference(f)
+	}
+
+	r, err := newtonRoot(f, df, root0, o)
+	if err != nil {
+		return nil, err
+	}
+	return []Root{r}, nil
+}
+
+// solveIterations is the default maximum number of iterations of root finding methods.
+const solveIterations = 100
+
+// polynomialDegree is the highest degree of the polynomials that are solved in closed form.
+const polynomialDegree = 3
+
+// polynomial returns the coefficients of a syntax tree as a polynomial in the variable, lowest degree
+// first and without trailing zeros, if it is one of degree at most polynomialDegree. Subexpressions that
+// do not depend on the variable are evaluated with ev.
+func polynomial(n node, name string, ev *evaluator) (coeffs []float64, ok bool) {
+	terms, ok := symbolicPolynomial(n, name, polynomialDegree, ev.evalOptions, ev.constant)
+	if !ok {
+		return nil, false
+	}
+	coeffs = make([]float64, len(terms))
+	for i, t := range terms {
+		if coeffs[i], ok = ev.constant(t); !ok {
+			return nil, false
+		}
+	}
+	for len(coeffs) > 0 && coeffs[len(coeffs)-1] == 0 {
+		coeffs = coeffs[:len(coeffs)-1]
+	}
+	return coeffs, true
+}
+
+// constant evaluates a syntax tree that does not depend on the unknown to a finite number.
+func (ev *evaluator) constant(n node) (float64, bool) {
+	v, err := ev.eval(n)
+	if err != nil || v.Type() != NumericValue || math.IsNaN(v.Number()) || math.IsInf(v.Number(), 0) {
+		return 0, false
+	}
+	return v.Number(), true
+}
+
+// closedFormRoots returns the real roots of a polynomial that lie in the interval, if one is given. The
+// residuals are computed with f, which evaluates the equation the polynomial was read from.
+func closedFormRoots(coeffs []float64, f func(float64) (float64, error), o numericOptions) []Root {
+	var xs []float64
+	switch len(coeffs) - 1 {
+	case 1:
+		xs = []float64{-coeffs[0] / coeffs[1]}
+	case 2:
+		xs = quadraticRoots(coeffs[2], coeffs[1], coeffs[0])
+	case 3:
+		xs = cubicRoots(coeffs[3], coeffs[2], coeffs[1], coeffs[0])
+	}
+	sort.Float64s(xs)
+
+	roots := []Root{}
+	for i, x := range xs {
+		if i > 0 && x == xs[i-1] || o.hasInterval && (x < o.lo || x > o.hi) {
+			continue
+		}
+		res, err := f(x)
+		if err != nil {
+			res = math.NaN()
+		}
+		roots = append(roots, Root{X: x, Residual: res, Method: ClosedForm, Converged: true})
+	}
+	return roots
+}
+
+// quadraticRoots returns the real roots of a x^2 + b x + c, avoiding the cancellation of the textbook
+// formula.
+func quadraticRoots(a, b, c float64) []float64 {
+	disc := b*b - 4*a*c
+	switch {
+	case disc < 0:
+		return nil
+	case disc == 0:
+		return []float64{-b / (2 * a)}
+	}
+	q := -(b + math.Copysign(math.Sqrt(disc), b)) / 2
+	if q == 0 {
+		return []float64{0}
+	}
+	return []float64{q / a, c / q}
+}
+
+// cubicRoots returns the real roots of a x^3 + b x^2 + c x + d.
+func cubicRoots(a, b, c, d float64) []float64 {
+	// substituting x = t - b/3a gives the depressed cubic t^3 + p t + q
+	b, c, d = b/a, c/a, d/a
+	shift := b / 3
+	p := c - b*b/3
+	q := 2*b*b*b/27 - b*c/3 + d
+
+	var ts []float64
+	disc := q*q/4 + p*p*p/27
+	if math.Abs(disc) <= 1e-12*math.Max(q*q/4, math.Abs(p*p*p/27)) {
+		// rounding would otherwise split double roots or lose one of them
+		disc = 0
+	}
+	switch {
+	case p == 0 && q == 0:
+		ts = []float64{0}
+	case disc > 0:
+		s := math.Sqrt(disc)
+		ts = []float64{math.Cbrt(-q/2+s) + math.Cbrt(-q/2-s)}
+	case disc == 0:
+		u := math.Cbrt(-q / 2)
+		ts = []float64{2 * u, -u}
+	default:
+		// three real roots, by the trigonometric method
+		r := 2 * math.Sqrt(-p/3)
+		phi := math.Acos(math.Max(-1, math.Min(1, 3*q/(p*r))))
+		for k := 0; k < 3; k++ {
+			ts = append(ts, r*math.Cos(phi/3-2*math.Pi*float64(k)/3))
+		}
+	}
+
+	xs := make([]float64, len(ts))
+	for i, t := range ts {
+		x := t - shift
+		// the substitution loses precision, which a Newton step on the original polynomial recovers
+		if dp := (3*x+2*b)*x + c; dp != 0 {
+			x -= (((x+b)*x+c)*x + d) / dp
+		}
+		xs[i] = x
+	}
+	return xs
+}
+
+// bracketRoots finds the roots of f in the interval of o. The interval is split into parts, and Brent's
+// method is applied to the parts whose ends have opposite signs. Points where f fails or is not finite
+// are skipped, and so are results whose residual is not small, which are poles where f changes sign.
+func bracketRoots(f func(float64) (float64, error), o numericOptions) ([]Root, error) {
+	n := o.subdivisions
+	xs := make([]float64, n+1)
+	ys := make([]float64, n+1)
+	for i := range xs {
+		xs[i] = o.lo + (o.hi-o.lo)*float64(i)/float64(n)
+		if y, err := f(xs[i]); err == nil && !math.IsInf(y, 0) {
+			ys[i] = y
+		} else {
+			ys[i] = math.NaN()
+		}
+	}
+
+	roots := []Root{}
+	for i := range xs {
+		if ys[i] == 0 {
+			roots = append(roots, Root{X: xs[i], Method: Bracketing, Converged: true})
+			continue
+		}
+		if i == n || ys[i+1] == 0 || math.IsNaN(ys[i]) || math.IsNaN(ys[i+1]) || (ys[i] < 0) == (ys[i+1] < 0) {
+			continue
+		}
+
+		r, err := brentRoot(f, xs[i], xs[i+1], ys[i], ys[i+1], o)
+		if err != nil {
+			return nil, err
+		}
+		// a sign change without a root is a pole, near which f grows instead of vanishing, while the
+		// residual of a root shrinks with the tolerance
+		if scale := math.Max(1, math.Max(math.Abs(ys[i]), math.Abs(ys[i+1]))); !(math.Abs(r.Residual) <= math.Sqrt(o.tolerance)*scale) {
+			continue
+		}
+		roots = append(roots, r)
+	}
+	return roots, nil
+}
+
+// brentRoot finds a root of f between a and b, where f has the opposite signs fa and fb, with Brent's
+// method. It combines inverse quadratic interpolation with bisection, which it falls back on whenever
+// interpolation does not shrink the bracket fast enough.
+func brentRoot(f func(float64) (float64, error), a, b, fa, fb float64, o numericOptions) (r Root, err error) {
+	r.Method = Bracketing
+	c, fc := b, fb
+	var d, e float64
+	for r.Iterations = 0; r.Iterations < o.iterations(solveIterations); r.Iterations++ {
+		if fb > 0 && fc > 0 || fb < 0 && fc < 0 {
+			// keep the root between b and c
+			c, fc = a, fa
+			d = b - a
+			e = d
+		}
+		if math.Abs(fc) < math.Abs(fb) {
+			a, b, c = b, c, b
+			fa, fb, fc = fb, fc, fb
+		}
+
+		tol := 2*epsilon*math.Abs(b) + o.tolerance*math.Max(1, math.Abs(b))/2
+		m := (c - b) / 2
+		if math.Abs(m) <= tol || fb == 0 {
+			r.Converged = true
+			break
+		}
+
+		if math.Abs(e) >= tol && math.Abs(fa) > math.Abs(fb) {
+			var p, q float64
+			s := fb / fa
+			if a == c {
+				// secant step
+				p, q = 2*m*s, 1-s
+			} else {
+				// inverse quadratic interpolation
+				t, u := fa/fc, fb/fc
+				p = s * (2*m*t*(t-u) - (b-a)*(u-1))
+				q = (t - 1) * (u - 1) * (s - 1)
+			}
+			if p > 0 {
+				q = -q
+			}
+			p = math.Abs(p)
+			if 2*p < math.Min(3*m*q-math.Abs(tol*q), math.Abs(e*q)) {
+				e, d = d, p/q
+			} else {
+				d, e = m, m
+			}
+		} else {
+			d, e = m, m
+		}
+
+		a, fa = b, fb
+		if math.Abs(d) > tol {
+			b += d
+		} else {
+			b += math.Copysign(tol, m)
+		}
+		if fb, err = f(b); err != nil {
+			return Root{}, err
+		}
+	}
+
+	r.X, r.Residual = b, fb
+	return r, nil
+}
+
+// epsilon is the difference between 1 and the next float64.
+const epsilon = 2.220446049250313e-16
+
+// newtonRoot looks for a root of f with Newton's method, starting from x.
+func newtonRoot(f, df func(float64) (float64, error), x float64, o numericOptions) (r Root, err error) {
+	r.Method = NewtonRaphson
+	for r.Iterations < o.iterations(solveIterations) {
+		var fx, dfx float64
+		if fx, err = f(x); err != nil {
+			return Root{}, err
+		}
+		if fx == 0 {
+			r.Converged = true
+			break
+		}
+		if dfx, err = df(x); err != nil {
+			return Root{}, err
+		}
+		step := fx / dfx
+		if math.IsNaN(step) || math.IsInf(step, 0) {
+			// the derivative vanishes, so there is nowhere to go
+			break
+		}
+
+		x -= step
+		r.Iterations++
+		if math.Abs(step) <= o.tolerance*math.Max(1, math.Abs(x)) {
+			r.Converged = true
+			break
+		}
+	}
+
+	r.X = x
+	if r.Residual, err = f(x); err != nil {
+		return Root{}, err
+	}
+	return r, nil
+}
+
+// centralDifference approximates the derivative of f by central differences, with a step that balances
+// truncation and rounding errors.
+func centralDifference(f func(float64) (float64, error)) func(float64) (float64, error) {
+	return func(x float64) (float64, error) {
+		h := 6e-6 * math.Max(1, math.Abs(x))
+		a, err := f(x + h)
+		if err != nil {
+			return 0, err
+		}
+		b, err := f(x - h)
+		if err != nil {
+			return 0, err
+		}
+		return (a - b) / (2 * h), nil
+	}
+}
@@ -0,0 +1,167 @@
+package yamp
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSolve(t *testing.T) {
+	tests := []struct {
+		name       string
+		equation   string
+		opts       []NumericOption
+		want       []float64
+		wantMethod solveMethod
+	}{
+		{"linear equations are solved in closed form", "2x + 3 = 7", nil, []float64{2}, ClosedForm},
+		{"quadratic equations are solved in closed form", "x^2 = 2", nil, []float64{-math.Sqrt2, math.Sqrt2}, ClosedForm},
+		{"double roots are returned once", "x^2 - 2x + 1", nil, []float64{1}, ClosedForm},
+		{"cubics may have three roots", "(x - 1)(x - 2)(x - 3) = 0", nil, []float64{1, 2, 3}, ClosedForm},
+		{"cubics may have one root", "x^3 + x + 1 = 0", nil, []float64{-0.6823278038280193}, ClosedForm},
+		{"complex roots are left out", "x^2 + 1 = 0", nil, []float64{}, ClosedForm},
+		{"other variables are constants", "a * x = b", []NumericOption{WithVariables(Variables{"a": 2, "b": 5})}, []float64{2.5}, ClosedForm},
+		{"closed forms are restricted to the interval", "x^2 = 4", []NumericOption{WithInterval(0, 10)}, []float64{2}, ClosedForm},
+		{
+			name:       "intervals are searched for every root",
+			equation:   "x^4 - 5x^2 + 4 = 0",
+			opts:       []NumericOption{WithInterval(-3, 3)},
+			want:       []float64{-2, -1, 1, 2},
+			wantMethod: Bracketing,
+		},
+		{
+			name:       "poles are not roots",
+			equation:   "1 / x = 0",
+			opts:       []NumericOption{WithInterval(-1, 2)},
+			want:       []float64{},
+			wantMethod: Bracketing,
+		},
+		{
+			name:       "poles may be sampled",
+			equation:   "1 / x",
+			opts:       []NumericOption{WithInterval(-1, 1)},
+			want:       []float64{},
+			wantMethod: Bracketing,
+		},
+		{"Newton's method starts from 1", "x^4 = 16", nil, []float64{2}, NewtonRaphson},
+		{"Newton's method starts from the given value", "x^4 = 16", []NumericOption{WithVariables(Variables{"x": -1})}, []float64{-2}, NewtonRaphson},
+		{"derivatives are approximated when needed", "2^x = 8", nil, []float64{3}, NewtonRaphson},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roots, err := Solve(tt.equation, "x", tt.opts...)
+			if !assert.NoError(t, err) {
+				return
+			}
+			got := make([]float64, len(roots))
+			for i, r := range roots {
+				got[i] = r.X
+				assert.Equal(t, tt.wantMethod, r.Method)
+				assert.True(t, r.Converged)
+				assert.InDelta(t, 0, r.Residual, 1e-9)
+			}
+			if assert.Len(t, got, len(tt.want)) {
+				assert.InDeltaSlice(t, tt.want, got, 1e-9)
+			}
+		})
+	}
+}
+
+func TestSolve_diagnostics(t *testing.T) {
+	roots, err := Solve("x^4 = 16", "x", WithTolerance(1e-6))
+	assert.NoError(t, err)
+	assert.Len(t, roots, 1)
+	loose := roots[0].Iterations
+
+	roots, err = Solve("x^4 = 16", "x")
+	assert.NoError(t, err)
+	assert.Greater(t, roots[0].Iterations, loose)
+
+	roots, err = Solve("x^4 + 1 = 0", "x", WithMaxIterations(20))
+	assert.NoError(t, err)
+	if assert.Len(t, roots, 1) {
+		assert.False(t, roots[0].Converged)
+		assert.Equal(t, 20, roots[0].Iterations)
+		assert.Equal(t, NewtonRaphson, roots[0].Method)
+	}
+}
+
+func TestSolve_errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		equation string
+		wantErr  error
+	}{
+		{
+			name:     "syntax errors are reported",
+			equation: "x = ",
+			wantErr:  SyntaxError{Message: fmt.Sprintf(errNoRightOperand, "=", 4), Token: "=", Position: 3},
+		},
+		{
+			name:     "equations cannot be nested",
+			equation: "x = (x = 1)",
+			wantErr:  SyntaxError{Message: fmt.Sprintf(errEquation, 7), Token: "=", Position: 7},
+		},
+		{
+			name:     "other variables must be given",
+			equation: "a * x = 1",
+			wantErr:  fmt.Errorf(errUnboundVariable, "a"),
+		},
+		{
+			name:     "identities have no particular roots",
+			equation: "2x - x = x",
+			wantErr:  fmt.Errorf(errIdentity, "x"),
+		},
+		{
+			name:     "the sides must be numeric",
+			equation: "x > 1",
+			wantErr:  TypeError{Message: fmt.Sprintf(errResultType, NumericValue, BooleanValue), Span: Span{Start: 0, End: 5}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roots, err := Solve(tt.equation, "x")
+			assert.Nil(t, roots)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+func TestSolve_evalOptions(t *testing.T) {
+	// in CalculatorPercent mode, x + 10% is 1.1x
+	roots, err := Solve("x + 10% = 11", "x", WithEvalOptions(WithPercentMode(CalculatorPercent)))
+	assert.NoError(t, err)
+	if assert.Len(t, roots, 1) {
+		assert.InDelta(t, 10, roots[0].X, 1e-12)
+	}
+
+	_, err = Solve("x = 1", "x", WithEvalOptions(WithNumberMode(Int64Mode)))
+	assert.EqualError(t, err, errCompileNumberMode)
+}
+
+func Test_expression_Evaluate_equation(t *testing.T) {
+	_, err := NewExpression("1 = 1").Evaluate()
+	assert.Equal(t, SyntaxError{Message: fmt.Sprintf(errEquation, 2), Token: "=", Position: 2}, err)
+}
+
+func Test_cubicRoots(t *testing.T) {
+	tests := []struct {
+		name       string
+		a, b, c, d float64
+		want       []float64
+	}{
+		{"triple roots", 1, -3, 3, -1, []float64{1}},
+		{"a single and a double root", 1, -4, 5, -2, []float64{2, 1}},
+		{"scaled coefficients", -2, 0, 2, 0, []float64{1, 0, -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := cubicRoots(tt.a, tt.b, tt.c, tt.d)
+			if assert.Len(t, got, len(tt.want)) {
+				assert.InDeltaSlice(t, tt.want, got, 1e-6)
+			}
+		})
+	}
+}
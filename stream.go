@@ -0,0 +1,158 @@
+package yamp
+
+import (
+	"io"
+	"unicode/utf8"
+)
+
+// streamChunkSize is the number of bytes read from the input at a time.
+const streamChunkSize = 4096
+
+// StreamTokenizer splits an expression read from an io.Reader into tokens one at a time, without
+// reading the whole expression into memory.
+type StreamTokenizer interface {
+	// Next returns the next token, or io.EOF after the last token. Once Next returns an error, it
+	// keeps returning the same error.
+	Next() (Token, error)
+}
+
+var _ StreamTokenizer = (*streamTokenizer)(nil)
+
+type streamTokenizer struct {
+	r   io.Reader
+	buf []byte // input that has not been scanned yet is kept in buf[:n]
+	n   int
+	// number of bytes to buffer before scanning again
+	want int
+	// offset in the scanned input where the current run of digits ends, if it is known
+	digitsEnd int
+	s         *scanner
+	eof       bool
+	err       error
+	// index of the next token in s.tokens to return
+	next int
+}
+
+// NewStreamTokenizer creates a StreamTokenizer that reads an expression from r.
+func NewStreamTokenizer(r io.Reader) StreamTokenizer {
+	return NewStreamTokenizerWithRegistry(r, defaultTokenRegistry)
+}
+
+// NewStreamTokenizerWithRegistry creates a StreamTokenizer that reads an expression from r and
+// recognizes the tokens in reg.
+func NewStreamTokenizerWithRegistry(r io.Reader, reg TokenRegistry) StreamTokenizer {
+	s := &scanner{reg: reg}
+	s.reset()
+	return &streamTokenizer{r: r, buf: make([]byte, streamChunkSize), want: 1, s: s}
+}
+
+// Next implements the StreamTokenizer interface.
+func (st *streamTokenizer) Next() (Token, error) {
+	for st.next == len(st.s.tokens) {
+		if st.err != nil {
+			return nil, st.err
+		}
+		// tokens that have been returned are no longer needed
+		st.s.tokens, st.s.spans, st.next = st.s.tokens[:0], st.s.spans[:0], 0
+		st.err = st.scanMore()
+	}
+	t := st.s.tokens[st.next]
+	st.next++
+	return t, nil
+}
+
+// scanMore reads more input and scans every rune, word or operator that is complete, so a token is
+// returned once the one after it starts. The rest is kept in the buffer for the next call. The input
+// is only scanned to its end once it has been fully read.
+func (st *streamTokenizer) scanMore() error {
+	// input read before an error is scanned first
+	readErr := st.fill()
+
+	s := st.s
+	s.expr = string(st.buf[:st.n])
+	for s.currOffset < len(s.expr) && (st.eof || st.complete()) {
+		if err := s.step(); err != nil {
+			return err
+		}
+	}
+
+	// slide the unscanned input to the start of the buffer. It is an incomplete rune, word or
+	// operator, so wait for twice as much input before scanning it again, which keeps long words
+	// from being scanned over and over.
+	scanned := s.currOffset
+	st.n = copy(st.buf, st.buf[scanned:st.n])
+	s.symbolOffset -= scanned
+	s.currOffset = 0
+	st.digitsEnd = 0
+	st.want = 2 * st.n
+	if st.want == 0 {
+		st.want = 1
+	}
+
+	if readErr != nil {
+		return readErr
+	}
+	if !st.eof {
+		return nil
+	}
+	if err := s.finish(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// fill reads input until st.want bytes are buffered or the input ends.
+func (st *streamTokenizer) fill() error {
+	for !st.eof && st.n < st.want {
+		if st.n == len(st.buf) {
+			buf := make([]byte, 2*len(st.buf))
+			copy(buf, st.buf[:st.n])
+			st.buf = buf
+		}
+		n, err := st.r.Read(st.buf[st.n:])
+		st.n += n
+		switch err {
+		case nil:
+		case io.EOF:
+			st.eof = true
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// complete checks whether the rune, word or operator at the current offset has been fully read.
+// Operators are complete once the input that follows rules out a longer symbol, so the lookahead
+// is at most the length of the longest symbol in the registry.
+func (st *streamTokenizer) complete() bool {
+	s := st.s
+	rest := s.expr[s.currOffset:]
+	if !utf8.FullRuneInString(rest) {
+		return false
+	}
+
+	r, _ := utf8.DecodeRuneInString(rest)
+	switch {
+	case s.reg.IsDigit(r):
+		// digits are scanned in runs, so that long numbers are not built up from many reads
+		if s.currOffset < st.digitsEnd {
+			return true
+		}
+		for i, r := range rest {
+			if !s.reg.IsDigit(r) {
+				st.digitsEnd = s.currOffset + i
+				return true
+			}
+		}
+		return false
+	case s.reg.IsLetter(r):
+		// the word must be followed by something else
+		return len(s.scanWord()) < len(rest)
+	case s.reg.IsDecimalPoint(r), s.reg.IsLeftBracket(r), s.reg.IsRightBracket(r), s.reg.IsSeparator(r),
+		s.reg.IsWhitespace(r):
+		return true
+	default:
+		return s.reg.operatorMatchComplete(rest)
+	}
+}
@@ -0,0 +1,152 @@
+package yamp
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewStreamTokenizer(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+	}{
+		{"numbers, operators and brackets", "12.5 * (3 - x)!"},
+		{"multi-rune operators", "x <= 2 && y != 3 || z >= 10"},
+		{"word operators and functions", "x mod 3 xor popcount(y) + clz(2)"},
+		{"implicit multiplication", "2x(y + 1)3"},
+		{"numbers separated by whitespace are joined", "1 2 + 3 .5"},
+		{"non-ASCII identifiers", "π^2 + αβ"},
+		{"no whitespace", "12.5*(3-x)!<=2&&y!=3||z>=10"},
+		{"empty expressions", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := NewTokenizer().Tokenize(tt.expr)
+			assert.NoError(t, err)
+
+			// reading a byte at a time splits runes, words and operators across reads
+			got, err := collectTokens(NewStreamTokenizer(iotest.OneByteReader(strings.NewReader(tt.expr))))
+			assert.NoError(t, err)
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
+func TestNewStreamTokenizer_long(t *testing.T) {
+	// a polynomial with tens of thousands of terms spans many reads
+	var sb strings.Builder
+	for i := 0; i < 20000; i++ {
+		sb.WriteString("12.5x^3 - y / 4 + ")
+	}
+	sb.WriteString("1")
+	expr := sb.String()
+
+	want, err := NewTokenizer().Tokenize(expr)
+	assert.NoError(t, err)
+
+	got, err := collectTokens(NewStreamTokenizer(strings.NewReader(expr)))
+	assert.NoError(t, err)
+	assert.Equal(t, want, got)
+}
+
+func TestNewStreamTokenizer_incremental(t *testing.T) {
+	// tokens are returned as soon as the input that follows them is read, even without whitespace.
+	// Only the last operand and the operator before it wait for the end of the input.
+	expr := strings.Repeat("12*x<=y+(3.5)^2||", 500) + "1"
+	want, err := NewTokenizer().Tokenize(expr)
+	assert.NoError(t, err)
+
+	r := &countingReader{r: iotest.OneByteReader(strings.NewReader(expr))}
+	st := NewStreamTokenizer(r)
+	for i, wantToken := range want {
+		got, err := st.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, wantToken, got)
+		if i < len(want)-2 && !assert.Less(t, r.n, len(expr), "token %d was returned after EOF", i) {
+			return
+		}
+	}
+	_, err = st.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestNewStreamTokenizer_errors(t *testing.T) {
+	tests := []struct {
+		name       string
+		r          io.Reader
+		wantTokens []Token
+		wantErr    error
+	}{
+		{
+			name:       "syntax errors are returned after the preceding tokens",
+			r:          iotest.OneByteReader(strings.NewReader("1 + (2 * 3")),
+			wantTokens: []Token{NewNumber("1"), NewOperator(Addition), LeftParen, NewNumber("2"), NewOperator(Multiplication)},
+			wantErr:    SyntaxError{Message: "the '(' at index 4 is missing a matching ')'", Token: "(", Position: 4},
+		},
+		{
+			name:       "errors have the same positions as with Tokenize",
+			r:          iotest.HalfReader(strings.NewReader("12 + 3 $ 4")),
+			wantTokens: []Token{NewNumber("12"), NewOperator(Addition)},
+			wantErr:    SyntaxError{Message: "unknown symbol '$' at index 7", Token: "$", Position: 7},
+		},
+		{
+			name:       "read errors are returned",
+			r:          io.MultiReader(strings.NewReader("1 + "), errReader{errors.New("boom")}),
+			wantTokens: []Token{NewNumber("1")},
+			wantErr:    errors.New("boom"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := NewStreamTokenizer(tt.r)
+			tokens, err := collectTokens(st)
+			assert.Equal(t, tt.wantTokens, tokens)
+			assert.Equal(t, tt.wantErr, err)
+
+			// errors are sticky
+			_, err = st.Next()
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+// collectTokens returns the tokens of a StreamTokenizer until it fails or returns io.EOF.
+func collectTokens(st StreamTokenizer) ([]Token, error) {
+	tokens := []Token{}
+	for {
+		t, err := st.Next()
+		if err == io.EOF {
+			return tokens, nil
+		}
+		if err != nil {
+			return tokens, err
+		}
+		tokens = append(tokens, t)
+	}
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (n int, err error) {
+	n, err = c.r.Read(p)
+	c.n += n
+	return
+}
+
+// errReader fails every read with err.
+type errReader struct {
+	err error
+}
+
+func (e errReader) Read([]byte) (int, error) {
+	return 0, e.err
+}
@@ -0,0 +1,115 @@
+package yamp
+
+import (
+	"fmt"
+	"math"
+)
+
+// seriesNodes is the largest number of nodes of the derivatives that a series is built from, which may
+// grow exponentially with their order.
+const seriesNodes = 1 << 21
+
+// Series returns the Taylor polynomial of a numeric expression in a variable around a point, up to the
+// given order, such as "1 + x + x ^ 2 / 2" for "1 / (1 - x + x ^ 2 / 2)" around 0. Other variables are
+// kept as they are. The remainder order, which is order + 1, is returned too: the difference between the
+// expression and the polynomial vanishes like (x - around) ^ (order + 1).
+//
+// The coefficients are the derivatives of the expression at the point divided by the factorials of their
+// order, and are computed by differentiating the expression symbolically, so the expression must be
+// differentiable as many times as the order. As the derivatives of quotients grow quickly, an error is
+// returned once they become too large to evaluate. Only FloatMode is supported.
+func Series(expr, variable string, around float64, order int, opts ...EvalOption) (res Expression, remainder int, err error) {
+	o := newEvalOptions(opts...)
+	if order < 0 {
+		return nil, 0, fmt.Errorf(errSeriesOrder, order)
+	}
+	if math.IsNaN(around) || math.IsInf(around, 0) {
+		return nil, 0, fmt.Errorf(errSeriesPoint, around)
+	}
+	root, err := parseNumeric(expr, o)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err = checkNumeric(o, root); err != nil {
+		return nil, 0, err
+	}
+	if root, err = expandCalculus(root, o); err != nil {
+		return nil, 0, err
+	}
+
+	sp := root.span()
+	point := constantNode(around, sp)
+	step := arithmetic(Subtraction, variableNode{name: variable, sp: sp}, point, sp)
+	var sum node = constantNode(0, sp)
+	d, factorial := root, 1.0
+	for k := 0; k <= order; k++ {
+		if k > 0 {
+			if d, err = differentiate(d, variable, o); err != nil {
+				return nil, 0, err
+			}
+			if nodeCount(d, seriesNodes) > seriesNodes {
+				return nil, 0, fmt.Errorf(errSeriesSize, k-1)
+			}
+			factorial *= float64(k)
+		}
+		if v, ok := constantValue(d); ok && v == 0 {
+			break // and so are the derivatives of higher orders
+		}
+		c, err := taylorCoefficient(substitute(d, variable, point), k, around, o)
+		if err != nil {
+			return nil, 0, err
+		}
+		sum = arithmetic(Addition, sum, taylorTerm(c, factorial, step, k, sp), sp)
+	}
+	return NewExpression(formatNode(sum)), order + 1, nil
+}
+
+// taylorCoefficient evaluates the k-th derivative at the point, unless it depends on other variables.
+func taylorCoefficient(n node, k int, around float64, o evalOptions) (node, error) {
+	c := &compiler{evalOptions: o, slots: make(map[string]int)}
+	if _, err := c.compile(n); err != nil {
+		return nil, err
+	}
+	if len(c.names) > 0 {
+		return n, nil
+	}
+	v, err := newEvaluator(nil, o).eval(n)
+	if err != nil {
+		return nil, err
+	}
+	if math.IsNaN(v.Number()) || math.IsInf(v.Number(), 0) {
+		return nil, fmt.Errorf(errSeriesUndefined, k, around)
+	}
+	return constantNode(v.Number(), n.span()), nil
+}
+
+// taylorTerm builds c (x - a)^k / k!, writing constant coefficients as fractions with small
+// denominators.
+func taylorTerm(c node, factorial float64, step node, k int, sp Span) node {
+	num, den := c, node(constantNode(factorial, sp))
+	if v, ok := constantValue(c); ok {
+		p, q := smallFraction(v / factorial)
+		num, den = constantNode(p, sp), constantNode(q, sp)
+	}
+	return fraction(arithmetic(Multiplication, num, arithmetic(Power, step, constantNode(float64(k), sp), sp), sp), den, sp)
+}
+
+// nodeCount returns the number of nodes of a syntax tree, or a number larger than limit if there are
+// more.
+func nodeCount(n node, limit int) (count int) {
+	count = 1
+	var children []node
+	switch n := n.(type) {
+	case operatorNode:
+		children = n.operands
+	case callNode:
+		children = n.args
+	}
+	for _, c := range children {
+		if count > limit {
+			break
+		}
+		count += nodeCount(c, limit-count)
+	}
+	return count
+}
@@ -0,0 +1,90 @@
+package yamp
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeries(t *testing.T) {
+	tests := []struct {
+		name   string
+		expr   string
+		around float64
+		order  int
+		want   string
+	}{
+		{"geometric series", "1/(1-x)", 0, 4, "1 + x + x ^ 2 + x ^ 3 + x ^ 4"},
+		{"coefficients are written as fractions", "(1 + x)^0.5", 0, 4, "1 + x / 2 - x ^ 2 / 8 + x ^ 3 / 16 - 5x ^ 4 / 128"},
+		{"terms are powers of the distance to the point", "x^3 - 2x", -2, 3, "-4 + 10 * (x + 2) - 6 * (x + 2) ^ 2 + (x + 2) ^ 3"},
+		{"polynomials end early", "x^3 - 2x", 1, 6, "-1 + (x - 1) + 3 * (x - 1) ^ 2 + (x - 1) ^ 3"},
+		{"zero coefficients are dropped", "1 / (1 - x + x^2/2)", 1, 4, "2 - 2 * (x - 1) ^ 2 + 2 * (x - 1) ^ 4"},
+		{"other variables are kept", "y x^2 + x", 0, 2, "x + y * 2 * x ^ 2 / 2"},
+		{"order 0 is the value at the point", "(x^2 - 1) / (x - 1)", 3, 0, "4"},
+		{"conditionals follow the branch they take", "if(x < 0, -x, x) + x^2", -2, 2, "6 - 5 * (x + 2) + (x + 2) ^ 2"},
+		{"calculus is expanded", "diff(x^4, x)", 0, 5, "4x ^ 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, remainder, err := Series(tt.expr, "x", tt.around, tt.order)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, got.String())
+				assert.Equal(t, tt.order+1, remainder)
+			}
+		})
+	}
+}
+
+func TestSeries_approximation(t *testing.T) {
+	// the error of the polynomial shrinks like the distance to the point to the power of the remainder
+	// order
+	const expr = "(1 + x)^0.5 / (2 - x)"
+	p, remainder, err := Series(expr, "x", 0.5, 3)
+	if !assert.NoError(t, err) {
+		return
+	}
+	errorAt := func(h float64) float64 {
+		vars := Variables{"x": 0.5 + h}
+		want, err := NewExpression(expr).EvaluateWith(vars)
+		assert.NoError(t, err)
+		got, err := p.EvaluateWith(vars)
+		assert.NoError(t, err)
+		return math.Abs(got - want)
+	}
+	ratio := errorAt(0.02) / errorAt(0.01)
+	assert.InDelta(t, math.Pow(2, float64(remainder)), ratio, 1)
+}
+
+func TestSeries_errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		around  float64
+		order   int
+		opts    []EvalOption
+		wantErr error
+	}{
+		{"the order must not be negative", "x", 0, -1, nil, fmt.Errorf(errSeriesOrder, -1)},
+		{"the point must be finite", "x", math.Inf(1), 2, nil, fmt.Errorf(errSeriesPoint, math.Inf(1))},
+		{"the expression must be differentiable", "1 + x^x", 1, 2, nil, fmt.Errorf(errNotDifferentiable, "^", 5, "x")},
+		{"the expression must be defined at the point", "1/(1-x)", 1, 2, nil, fmt.Errorf(errSeriesUndefined, 0, 1.0)},
+		{"and so must its derivatives", "x^0.5", 0, 2, nil, fmt.Errorf(errSeriesUndefined, 1, 0.0)},
+		{"derivatives must not grow too large", "1/(1-x)", 0, 20, nil, fmt.Errorf(errSeriesSize, 9)},
+		{
+			name:    "the result must be numeric",
+			expr:    "x > 1",
+			order:   1,
+			wantErr: TypeError{Message: fmt.Sprintf(errResultType, NumericValue, BooleanValue), Span: Span{Start: 0, End: 5}},
+		},
+		{"only FloatMode is supported", "x", 0, 1, []EvalOption{WithNumberMode(BigIntMode)}, errors.New(errCompileNumberMode)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Series(tt.expr, "x", tt.around, tt.order, tt.opts...)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
@@ -4,3 +4,21 @@ package yamp
 type Token interface {
 	String() string
 }
+
+// Span marks the location of a token or a subexpression within an expression.
+// Start and End are rune indices, where End is exclusive.
+type Span struct {
+	Start int
+	End   int
+}
+
+// union returns the smallest span that covers both s and other.
+func (s Span) union(other Span) Span {
+	if other.Start < s.Start {
+		s.Start = other.Start
+	}
+	if other.End > s.End {
+		s.End = other.End
+	}
+	return s
+}
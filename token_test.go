@@ -43,7 +43,11 @@ func TestIsOperator(t *testing.T) {
 		{"'/' is an operator", args{r: '/'}, true},
 		{"'^' is an operator", args{r: '^'}, true},
 		{"'!' is an operator", args{r: '!'}, true},
-		{"other characters are not an operator", args{r: '?'}, false},
+		{"'<' is an operator", args{r: '<'}, true},
+		{"'?' is an operator", args{r: '?'}, true},
+		{"'%' is an operator", args{r: '%'}, true},
+		{"'&' is the bitwise AND operator", args{r: '&'}, true},
+		{"other characters are not an operator", args{r: '#'}, false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -131,3 +135,62 @@ func TestIsWhitespace(t *testing.T) {
 		})
 	}
 }
+
+func TestSpan_union(t *testing.T) {
+	tests := []struct {
+		name  string
+		s     Span
+		other Span
+		want  Span
+	}{
+		{"disjoint spans should be joined", Span{0, 1}, Span{4, 5}, Span{0, 5}},
+		{"the order of spans should not matter", Span{4, 5}, Span{0, 1}, Span{0, 5}},
+		{"a contained span should not change the span", Span{0, 5}, Span{1, 2}, Span{0, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.s.union(tt.other))
+		})
+	}
+}
+
+func TestIsLetter(t *testing.T) {
+	type args struct {
+		r rune
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{"a latin alphabet should be marked as true", args{'x'}, true},
+		{"a non-latin letter should be marked as true", args{'π'}, true},
+		{"an underscore should be marked as true", args{'_'}, true},
+		{"a digit should be marked as false", args{'1'}, false},
+		{"other characters should be marked as false", args{'+'}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsLetter(tt.args.r))
+		})
+	}
+}
+
+func TestIsSeparator(t *testing.T) {
+	type args struct {
+		r rune
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{"a comma should be marked as true", args{','}, true},
+		{"a semicolon should be marked as false", args{';'}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsSeparator(tt.args.r))
+		})
+	}
+}
@@ -1,10 +1,8 @@
 package yamp
 
 import (
-	"bufio"
-	"bytes"
 	"fmt"
-	"strings"
+	"unicode/utf8"
 )
 
 // Tokenizer is implemented by an expression tokenizer.
@@ -23,329 +21,525 @@ const (
 	tokenBinaryOp
 	tokenLeftUnaryOp
 	tokenRightUnaryOp
+	tokenVariable
+	tokenFunction
+	tokenSeparator
 )
 
 var _ Tokenizer = (*tokenizer)(nil)
 
+// tokenizer holds no state of its own, so it is safe for concurrent use. Each call scans the
+// expression with a new scanner.
 type tokenizer struct {
-	reg        TokenRegistry
-	expr       string
-	sc         *bufio.Scanner
-	tokens     []Token
-	currState  int
-	currSymbol *strings.Builder
-	currIndex  int
-	parenDepth bracketStack
+	reg TokenRegistry
 }
 
-// NewTokenizer creates a new Tokenizer
+// scanner holds the state of a single tokenization. It walks the expression without copying it,
+// so symbols are substrings of the expression. Positions are counted in runes, while offsets are
+// counted in bytes.
+type scanner struct {
+	reg          TokenRegistry
+	expr         string
+	tokens       []Token
+	spans        []Span
+	currState    int
+	currSymbol   string
+	currStart    int
+	currIndex    int
+	symbolOffset int
+	currOffset   int
+	parenDepth   bracketStack
+}
+
+// NewTokenizer creates a new Tokenizer. The Tokenizer is safe for concurrent use.
 func NewTokenizer() Tokenizer {
-	return &tokenizer{
-		// TODO: add registry validation
-		reg:        defaultTokenRegistry,
-		currSymbol: new(strings.Builder),
-	}
+	return newTokenizer(defaultTokenRegistry)
+}
+
+// NewTokenizerWithRegistry creates a new Tokenizer that recognizes the tokens in reg. The Tokenizer is
+// safe for concurrent use.
+func NewTokenizerWithRegistry(reg TokenRegistry) Tokenizer {
+	return newTokenizer(reg)
+}
+
+func newTokenizer(reg TokenRegistry) *tokenizer {
+	// TODO: add registry validation
+	return &tokenizer{reg: reg}
 }
 
 // Tokenize implements the Tokenizer interface
 func (t *tokenizer) Tokenize(expr string) (tokens []Token, err error) {
-	t.initialize(expr)
-	for t.sc.Scan() {
-		if err = t.sc.Err(); err != nil {
+	tokens, _, err = t.tokenize(expr)
+	return
+}
+
+// tokenize splits an expression into tokens, along with the span of each token in the expression.
+func (t *tokenizer) tokenize(expr string) (tokens []Token, spans []Span, err error) {
+	s := &scanner{reg: t.reg}
+	return s.scan(expr)
+}
+
+// scan splits an expression into tokens and their spans.
+func (s *scanner) scan(expr string) (tokens []Token, spans []Span, err error) {
+	s.initialize(expr)
+	for s.currOffset < len(s.expr) {
+		if err = s.step(); err != nil {
 			return
 		}
+	}
+	if err = s.finish(); err != nil {
+		return
+	}
 
-		r := []rune(t.sc.Text())[0]
-		switch {
-		case t.reg.IsDigit(r):
-			if err = t.handleDigit(r); err != nil {
-				return
-			}
-		case t.reg.IsDecimalPoint(r):
-			if err = t.handleDecimalPoint(r); err != nil {
-				return
-			}
-		case t.reg.IsLeftBracket(r):
-			if err = t.handleLeftParen(r); err != nil {
-				return
-			}
-		case t.reg.IsRightBracket(r):
-			if err = t.handleRightParen(r); err != nil {
-				return
-			}
-		case t.reg.IsOperator(r):
-			if err = t.handleOperator(r); err != nil {
-				return
-			}
-		case t.reg.IsWhitespace(r):
-			// ignore whitespace
-		default:
-			err = SyntaxError{
-				Message:  fmt.Sprintf(errUnknownSymbol, string(r), t.currIndex),
-				Token:    string(r),
-				Position: t.currIndex,
+	tokens, spans = s.tokens, s.spans
+	return
+}
+
+// step handles the rune, word or operator at the current offset and moves past it.
+func (s *scanner) step() (err error) {
+	r, size := utf8.DecodeRuneInString(s.expr[s.currOffset:])
+	sym := s.expr[s.currOffset : s.currOffset+size]
+	n := 1
+
+	// a function name can only be followed by its arguments
+	if s.currState == tokenFunction && !s.reg.IsLeftBracket(r) && !s.reg.IsWhitespace(r) {
+		return s.functionCallError()
+	}
+
+	switch {
+	case s.reg.IsDigit(r):
+		err = s.handleDigit(sym)
+	case s.reg.IsDecimalPoint(r):
+		err = s.handleDecimalPoint(sym)
+	case s.reg.IsLeftBracket(r):
+		err = s.handleLeftParen(sym)
+	case s.reg.IsRightBracket(r):
+		err = s.handleRightParen(sym)
+	case s.reg.IsSeparator(r):
+		err = s.handleSeparator(sym)
+	case s.reg.IsWhitespace(r):
+		// ignore whitespace
+	case s.reg.IsLetter(r):
+		word := s.scanWord()
+		if _, ok := s.reg.operators.GetOperator(word); ok {
+			err = s.handleOperator(word)
+		} else {
+			err = s.handleIdentifier(word)
+		}
+		n, size = utf8.RuneCountInString(word), len(word)
+	default:
+		op := s.reg.matchOperator(s.expr[s.currOffset:])
+		if op == "" {
+			return SyntaxError{
+				Message:  fmt.Sprintf(errUnknownSymbol, sym, s.currIndex),
+				Token:    sym,
+				Position: s.currIndex,
 			}
-			return
 		}
-		t.currIndex++
+		err = s.handleOperator(op)
+		n, size = utf8.RuneCountInString(op), len(op)
+	}
+	if err != nil {
+		return
 	}
 
-	// commit last token
-	t.commitCurrentState()
+	s.currIndex += n
+	s.currOffset += size
+	return
+}
 
-	tokens = t.tokens
+// finish validates the state at the end of the expression and commits the last token.
+func (s *scanner) finish() (err error) {
+	if err = s.validateFinalState(); err != nil {
+		return
+	}
+	s.commitCurrentState()
 	return
 }
 
-func (t *tokenizer) handleDigit(r rune) (err error) {
+func (s *scanner) handleDigit(d string) (err error) {
 	// "." => ".5"
-	if t.currState == tokenDecimalPoint {
-		t.currSymbol.WriteRune(r)
-		t.currState = tokenDecimal
+	if s.currState == tokenDecimalPoint {
+		s.extendSymbol(d)
+		s.currState = tokenDecimal
 		return
 	}
 	// "1" => "12", "1.2" => "1.23"
-	if t.currState&(tokenInteger|tokenDecimal) != 0 {
-		t.currSymbol.WriteRune(r)
+	if s.currState&(tokenInteger|tokenDecimal) != 0 {
+		s.extendSymbol(d)
 		return
 	}
 
-	t.commitCurrentState()
+	s.commitCurrentState()
 
-	if t.currState&(tokenRightParen|tokenRightUnaryOp) != 0 {
-		t.appendToken(NewOperator(Multiplication))
+	if s.currState&(tokenRightParen|tokenRightUnaryOp|tokenVariable) != 0 {
+		s.appendToken(NewOperator(Multiplication), Span{Start: s.currIndex, End: s.currIndex})
 	}
-	t.currSymbol.WriteRune(r)
-	t.currState = tokenInteger
+	s.startSymbol(d)
+	s.currState = tokenInteger
 	return
 }
 
-func (t *tokenizer) handleDecimalPoint(r rune) (err error) {
+func (s *scanner) handleDecimalPoint(p string) (err error) {
 	// can't allow multiple decimal points
-	if t.currState&(tokenDecimal|tokenDecimalPoint) != 0 {
+	if s.currState&(tokenDecimal|tokenDecimalPoint) != 0 {
 		return SyntaxError{
 			Message:  errMultipleDecimal,
-			Token:    string(r),
-			Position: t.currIndex,
+			Token:    p,
+			Position: s.currIndex,
 		}
 	}
 
 	// "5" => "5."
-	if t.currState == tokenInteger {
-		t.currSymbol.WriteRune(r)
-		t.currState = tokenDecimal
+	if s.currState == tokenInteger {
+		s.extendSymbol(p)
+		s.currState = tokenDecimal
 		return
 	}
 
-	t.commitCurrentState()
+	s.commitCurrentState()
 
-	// "(5)" => "(5)*.", "5!" => "5!*."
-	if t.currState&(tokenRightParen|tokenRightUnaryOp) != 0 {
-		t.appendToken(NewOperator(Multiplication))
+	// "(5)" => "(5)*.", "5!" => "5!*.", "x" => "x*."
+	if s.currState&(tokenRightParen|tokenRightUnaryOp|tokenVariable) != 0 {
+		s.appendToken(NewOperator(Multiplication), Span{Start: s.currIndex, End: s.currIndex})
 	}
-	t.currSymbol.WriteRune(r)
-	t.currState = tokenDecimalPoint
+	s.startSymbol(p)
+	s.currState = tokenDecimalPoint
 	return
 }
 
-func (t *tokenizer) handleLeftParen(r rune) (err error) {
+func (s *scanner) handleLeftParen(p string) (err error) {
 	// can't allow lone decimal point to be followed by a left parenthesis
-	if t.currState == tokenDecimalPoint {
+	if s.currState == tokenDecimalPoint {
 		return SyntaxError{
-			Message:  fmt.Sprintf(errLoneDecimal, t.currIndex-1),
+			Message:  fmt.Sprintf(errLoneDecimal, s.currIndex-1),
 			Token:    ".",
-			Position: t.currIndex - 1,
+			Position: s.currIndex - 1,
 		}
 	}
 
-	t.commitCurrentState()
+	s.commitCurrentState()
 
-	// "5" => "5*(", "5.4" => "5.4*(", "(5)" => "(5)*(", "5!" => "5!*("
-	if t.currState&(tokenInteger|tokenDecimal|tokenRightParen|tokenRightUnaryOp) != 0 {
-		t.appendToken(NewOperator(Multiplication))
+	// "5" => "5*(", "5.4" => "5.4*(", "(5)" => "(5)*(", "5!" => "5!*(", "x" => "x*("
+	if s.currState&(tokenInteger|tokenDecimal|tokenRightParen|tokenRightUnaryOp|tokenVariable) != 0 {
+		s.appendToken(NewOperator(Multiplication), Span{Start: s.currIndex, End: s.currIndex})
 	}
 
-	t.currSymbol.WriteRune(r)
-	t.currState = tokenLeftParen
 	// TODO: in the future, it may not be only left paren
-	t.parenDepth.increment(t.currIndex, LeftParen)
+	if s.currState == tokenFunction {
+		s.parenDepth.incrementCall(s.currIndex, LeftParen)
+	} else {
+		s.parenDepth.increment(s.currIndex, LeftParen)
+	}
+
+	s.startSymbol(p)
+	s.currState = tokenLeftParen
 	return
 }
 
-func (t *tokenizer) handleRightParen(r rune) (err error) {
+func (s *scanner) handleRightParen(p string) (err error) {
 	// can't allow unmatched parentheses
-	if t.parenDepth.depth() == 0 {
+	if s.parenDepth.depth() == 0 {
 		return SyntaxError{
-			Message:  fmt.Sprintf(errUnmatchedRightParen, t.currIndex),
+			Message:  fmt.Sprintf(errUnmatchedRightParen, s.currIndex),
 			Token:    ")",
-			Position: t.currIndex,
+			Position: s.currIndex,
 		}
 	}
 	// can't allow lone decimal point to be followed by a right parenthesis
-	if t.currState == tokenDecimalPoint {
+	if s.currState == tokenDecimalPoint {
 		return SyntaxError{
-			Message:  fmt.Sprintf(errLoneDecimal, t.currIndex-1),
+			Message:  fmt.Sprintf(errLoneDecimal, s.currIndex-1),
 			Token:    ".",
-			Position: t.currIndex - 1,
+			Position: s.currIndex - 1,
 		}
 	}
 	// can't allow empty parentheses
-	if t.currState == tokenLeftParen {
+	if s.currState == tokenLeftParen {
 		return SyntaxError{
-			Message:  fmt.Sprintf(errEmptyParen, t.currIndex),
+			Message:  fmt.Sprintf(errEmptyParen, s.currIndex),
 			Token:    ")",
-			Position: t.currIndex,
+			Position: s.currIndex,
 		}
 	}
-	// can't allow unfinished operations
-	if t.currState&(tokenLeftUnaryOp|tokenBinaryOp) != 0 {
+	// can't allow an empty last argument
+	if s.currState == tokenSeparator {
 		return SyntaxError{
-			Message:  fmt.Sprintf(errNoRightOperand, t.currSymbol.String(), t.currIndex-1),
-			Token:    t.currSymbol.String(),
-			Position: t.currIndex - 1,
+			Message:  fmt.Sprintf(errEmptyArgument, s.currIndex),
+			Token:    ")",
+			Position: s.currIndex,
 		}
 	}
+	// can't allow unfinished operations
+	if s.currState&(tokenLeftUnaryOp|tokenBinaryOp) != 0 {
+		return s.unfinishedOperationError()
+	}
 
-	t.commitCurrentState()
+	s.commitCurrentState()
 
-	t.currSymbol.WriteRune(r)
-	t.currState = tokenRightParen
+	s.startSymbol(p)
+	s.currState = tokenRightParen
 	// TODO: in the future, it may not be only right paren
-	t.parenDepth.decrement(t.currIndex, RightParen)
+	s.parenDepth.decrement(s.currIndex, RightParen)
 	return
 }
 
-func (t *tokenizer) handleOperator(r rune) (err error) {
+func (s *scanner) handleOperator(op string) (err error) {
 	// can't allow lone decimal point to be followed by operator
-	if t.currState == tokenDecimalPoint {
+	if s.currState == tokenDecimalPoint {
 		return SyntaxError{
-			Message:  fmt.Sprintf(errLoneDecimal, t.currIndex-1),
+			Message:  fmt.Sprintf(errLoneDecimal, s.currIndex-1),
 			Token:    ".",
-			Position: t.currIndex - 1,
+			Position: s.currIndex - 1,
 		}
 	}
 
 	// handle left unary operators
-	_, lunOk := t.reg.operators.GetOperator(r, IsUnaryOp, IsRightAssocOp)
-	if lunOk && t.currState&(tokenNothing|tokenLeftParen|tokenBinaryOp|tokenLeftUnaryOp) != 0 {
-		t.commitCurrentState()
-		t.currState = tokenLeftUnaryOp
-		t.currSymbol.WriteRune(r)
+	_, lunOk := s.reg.operators.GetOperator(op, IsUnaryOp, IsRightAssocOp)
+	if lunOk && s.currState&(tokenNothing|tokenLeftParen|tokenBinaryOp|tokenLeftUnaryOp|tokenSeparator) != 0 {
+		s.commitCurrentState()
+		s.currState = tokenLeftUnaryOp
+		s.startSymbol(op)
 		return
 	}
 
 	// operator is left unary ONLY, but has no right operands.
-	_, binOk := t.reg.operators.GetOperator(r, IsBinaryOp)
-	_, runOk := t.reg.operators.GetOperator(r, IsUnaryOp, IsLeftAssocOp)
+	_, binOk := s.reg.operators.GetOperator(op, IsBinaryOp)
+	_, runOk := s.reg.operators.GetOperator(op, IsUnaryOp, IsLeftAssocOp)
 	if !(binOk || runOk) {
 		return SyntaxError{
-			Message:  fmt.Sprintf(errNoRightOperand, string(r), t.currIndex),
-			Token:    string(r),
-			Position: t.currIndex,
+			Message:  fmt.Sprintf(errNoRightOperand, op, s.currIndex),
+			Token:    op,
+			Position: s.currIndex,
 		}
 	}
 
 	// at this point, operators should require a left operand.
-	if t.currState&(tokenNothing|tokenLeftParen|tokenLeftUnaryOp|tokenBinaryOp) != 0 {
+	if s.currState&(tokenNothing|tokenLeftParen|tokenLeftUnaryOp|tokenBinaryOp|tokenSeparator) != 0 {
 		return SyntaxError{
-			Message:  fmt.Sprintf(errNoLeftOperand, string(r), t.currIndex),
-			Token:    string(r),
-			Position: t.currIndex,
+			Message:  fmt.Sprintf(errNoLeftOperand, op, s.currIndex),
+			Token:    op,
+			Position: s.currIndex,
 		}
 	}
 
-	t.commitCurrentState()
-	t.currSymbol.WriteRune(r)
+	s.commitCurrentState()
+	s.startSymbol(op)
 	if runOk {
-		t.currState = tokenRightUnaryOp
+		s.currState = tokenRightUnaryOp
 	} else {
-		t.currState = tokenBinaryOp
+		s.currState = tokenBinaryOp
 	}
 	return
 }
 
-func (t *tokenizer) commitCurrentState() {
-	x := t.currSymbol.String()
+func (s *scanner) handleIdentifier(name string) (err error) {
+	// can't allow lone decimal point to be followed by an identifier
+	if s.currState == tokenDecimalPoint {
+		return SyntaxError{
+			Message:  fmt.Sprintf(errLoneDecimal, s.currIndex-1),
+			Token:    ".",
+			Position: s.currIndex - 1,
+		}
+	}
+
+	s.commitCurrentState()
 
-	switch t.currState {
+	// "2x" => "2*x", "(5)x" => "(5)*x", "5!x" => "5!*x", "x y" => "x*y"
+	if s.currState&(tokenInteger|tokenDecimal|tokenRightParen|tokenRightUnaryOp|tokenVariable) != 0 {
+		s.appendToken(NewOperator(Multiplication), Span{Start: s.currIndex, End: s.currIndex})
+	}
+
+	s.startSymbol(name)
+	if s.reg.IsFunction(name) {
+		s.currState = tokenFunction
+	} else {
+		s.currState = tokenVariable
+	}
+	return
+}
+
+func (s *scanner) handleSeparator(sep string) (err error) {
+	// can't allow separators outside of function calls
+	if !s.parenDepth.inCall() {
+		return SyntaxError{
+			Message:  fmt.Sprintf(errMisplacedSeparator, s.currIndex),
+			Token:    sep,
+			Position: s.currIndex,
+		}
+	}
+	// can't allow lone decimal point to be followed by a separator
+	if s.currState == tokenDecimalPoint {
+		return SyntaxError{
+			Message:  fmt.Sprintf(errLoneDecimal, s.currIndex-1),
+			Token:    ".",
+			Position: s.currIndex - 1,
+		}
+	}
+	// can't allow empty arguments
+	if s.currState&(tokenLeftParen|tokenSeparator) != 0 {
+		return SyntaxError{
+			Message:  fmt.Sprintf(errEmptyArgument, s.currIndex),
+			Token:    sep,
+			Position: s.currIndex,
+		}
+	}
+	// can't allow unfinished operations
+	if s.currState&(tokenLeftUnaryOp|tokenBinaryOp) != 0 {
+		return s.unfinishedOperationError()
+	}
+
+	s.commitCurrentState()
+
+	s.startSymbol(sep)
+	s.currState = tokenSeparator
+	return
+}
+
+// scanWord returns the word of letters and digits that starts at the current offset.
+func (s *scanner) scanWord() string {
+	_, end := utf8.DecodeRuneInString(s.expr[s.currOffset:])
+	end += s.currOffset
+	for end < len(s.expr) {
+		r, size := utf8.DecodeRuneInString(s.expr[end:])
+		if !s.reg.IsLetter(r) && !s.reg.IsDigit(r) {
+			break
+		}
+		end += size
+	}
+	return s.expr[s.currOffset:end]
+}
+
+// startSymbol starts a new symbol at the current position.
+func (s *scanner) startSymbol(sym string) {
+	s.currSymbol = sym
+	s.currStart = s.currIndex
+	s.symbolOffset = s.currOffset
+}
+
+// extendSymbol appends sym, which is at the current offset, to the current symbol. The symbol stays
+// a substring of the expression unless it is separated from sym by whitespace, as in "1 2", or the
+// expression has been replaced since it started.
+func (s *scanner) extendSymbol(sym string) {
+	end := s.symbolOffset + len(s.currSymbol)
+	if s.symbolOffset >= 0 && end == s.currOffset && end+len(sym) <= len(s.expr) {
+		s.currSymbol = s.expr[s.symbolOffset : end+len(sym)]
+		return
+	}
+	s.currSymbol += sym
+}
+
+func (s *scanner) unfinishedOperationError() error {
+	idx := s.currIndex - utf8.RuneCountInString(s.currSymbol)
+	return SyntaxError{
+		Message:  fmt.Sprintf(errNoRightOperand, s.currSymbol, idx),
+		Token:    s.currSymbol,
+		Position: idx,
+	}
+}
+
+func (s *scanner) functionCallError() error {
+	return SyntaxError{
+		Message:  fmt.Sprintf(errFunctionCall, s.currSymbol, s.currStart),
+		Token:    s.currSymbol,
+		Position: s.currStart,
+	}
+}
+
+func (s *scanner) commitCurrentState() {
+	x := s.currSymbol
+	span := Span{Start: s.currStart, End: s.currStart + utf8.RuneCountInString(x)}
+
+	switch s.currState {
 	case tokenInteger, tokenDecimal:
-		t.appendToken(NewNumber(x))
+		s.appendToken(NewNumber(x), span)
 	case tokenLeftParen:
-		t.appendToken(LeftParen)
+		s.appendToken(LeftParen, span)
 	case tokenRightParen:
-		t.appendToken(RightParen)
+		s.appendToken(RightParen, span)
 	case tokenLeftUnaryOp:
-		r := []rune(x)[0]
-		op, _ := t.reg.operators.GetOperator(r, IsRightAssocOp, IsUnaryOp)
-		t.appendToken(op)
+		op, _ := s.reg.operators.GetOperator(x, IsRightAssocOp, IsUnaryOp)
+		s.appendToken(op, span)
 	case tokenBinaryOp:
-		r := []rune(x)[0]
-		op, _ := t.reg.operators.GetOperator(r, IsBinaryOp)
-		t.appendToken(op)
+		op, _ := s.reg.operators.GetOperator(x, IsBinaryOp)
+		s.appendToken(op, span)
 	case tokenRightUnaryOp:
-		r := []rune(x)[0]
-		op, _ := t.reg.operators.GetOperator(r, IsLeftAssocOp, IsUnaryOp)
-		t.appendToken(op)
+		op, _ := s.reg.operators.GetOperator(x, IsLeftAssocOp, IsUnaryOp)
+		s.appendToken(op, span)
+	case tokenVariable:
+		s.appendToken(NewVariable(x), span)
+	case tokenFunction:
+		s.appendToken(s.reg.functions[x], span)
+	case tokenSeparator:
+		s.appendToken(ArgSeparator, span)
 	}
-	t.currSymbol.Reset()
+	s.currSymbol = ""
 }
 
-func (t *tokenizer) validateFinalState() (err error) {
-	switch t.currState {
+func (s *scanner) validateFinalState() (err error) {
+	switch s.currState {
 	// can't allow lone decimal point as final state
 	case tokenDecimalPoint:
 		return SyntaxError{
-			Message:  fmt.Sprintf(errLoneDecimal, t.currIndex-1),
+			Message:  fmt.Sprintf(errLoneDecimal, s.currIndex-1),
 			Token:    ".",
-			Position: t.currIndex - 1,
+			Position: s.currIndex - 1,
 		}
 	case tokenLeftUnaryOp, tokenBinaryOp:
-		op := t.currSymbol.String()
+		op := s.currSymbol
 		return SyntaxError{
-			Message:  fmt.Sprintf(errNoRightOperand, op, t.currIndex),
+			Message:  fmt.Sprintf(errNoRightOperand, op, s.currIndex),
 			Token:    op,
-			Position: t.currIndex - 1,
+			Position: s.currIndex - 1,
+		}
+	case tokenFunction:
+		return s.functionCallError()
+	case tokenSeparator:
+		return SyntaxError{
+			Message:  fmt.Sprintf(errEmptyArgument, s.currIndex),
+			Token:    ",",
+			Position: s.currIndex,
 		}
 	}
 
-	// check paren depth
-	if t.parenDepth.depth() > 0 {
-		n := len(t.parenDepth.stack)
-		curr := t.parenDepth.depth()
-
-		var idx int
-		for i := n - 1; i >= 0; i-- {
-			if t.parenDepth.stack[i].depth == curr {
-				idx = t.parenDepth.stack[i].index
-				break
-			}
-		}
+	return s.checkParenDepth()
+}
 
+// checkParenDepth returns an error if a bracket is left open.
+func (s *scanner) checkParenDepth() error {
+	if b, ok := s.parenDepth.innermost(); ok {
+		idx := b.index
 		return SyntaxError{
 			Message:  fmt.Sprintf(errUnmatchedLeftParen, idx),
 			Token:    "(",
 			Position: idx,
 		}
 	}
-
-	return
+	return nil
 }
 
-func (t *tokenizer) appendToken(_t Token) {
-	t.tokens = append(t.tokens, _t)
+func (s *scanner) appendToken(_t Token, span Span) {
+	s.tokens = append(s.tokens, _t)
+	s.spans = append(s.spans, span)
 }
 
-func (t *tokenizer) initialize(expr string) {
-	t.reset()
+func (s *scanner) initialize(expr string) {
+	s.reset()
 
-	buf := bytes.NewBufferString(expr)
-	t.sc = bufio.NewScanner(buf)
-	t.sc.Split(bufio.ScanRunes)
+	s.expr = expr
+	// formulas rarely have more than a token per byte, so this usually avoids growing the slices
+	s.tokens = make([]Token, 0, len(expr))
+	s.spans = make([]Span, 0, len(expr))
 }
 
-func (t *tokenizer) reset() {
-	t.currState = tokenNothing
-	t.currIndex = 0
-	t.parenDepth = bracketStack{}
-	t.currSymbol.Reset()
+func (s *scanner) reset() {
+	s.tokens = nil
+	s.spans = nil
+	s.currState = tokenNothing
+	s.currIndex = 0
+	s.currStart = 0
+	s.currOffset = 0
+	s.symbolOffset = 0
+	s.parenDepth = bracketStack{}
+	s.currSymbol = ""
 }
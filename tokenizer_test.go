@@ -3,6 +3,7 @@ package yamp
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -13,6 +14,19 @@ func TestNewTokenizer(t *testing.T) {
 	assert.NotNil(t, tt)
 }
 
+func TestNewTokenizerWithRegistry(t *testing.T) {
+	ops := make(OperatorRegistry)
+	ops.Register("**", NewOperator(Power))
+	tr := NewTokenizerWithRegistry(NewTokenRegistry(ops, nil))
+
+	tokens, err := tr.Tokenize("2**3")
+	assert.NoError(t, err)
+	assert.Equal(t, []Token{NewNumber("2"), NewOperator(Power), NewNumber("3")}, tokens)
+
+	_, err = tr.Tokenize("2^3")
+	assert.EqualError(t, err, fmt.Sprintf(errUnknownSymbol, "^", 1))
+}
+
 func Test_tokenizer_Tokenize(t *testing.T) {
 	type args struct {
 		expr string
@@ -119,6 +133,106 @@ func Test_tokenizer_Tokenize(t *testing.T) {
 				Position: 2,
 			},
 		},
+		{
+			name: "expr #10",
+			args: args{expr: "5!!!+2"},
+			wantTokens: []Token{
+				NewNumber("5"),
+				NewOperator(DoubleFactorial),
+				NewOperator(Factorial),
+				NewOperator(Addition),
+				NewNumber("2"),
+			},
+		},
+		{
+			name: "expr #12",
+			args: args{expr: "2x + if (x, y2, not z)"},
+			wantTokens: []Token{
+				NewNumber("2"),
+				NewOperator(Multiplication),
+				NewVariable("x"),
+				NewOperator(Addition),
+				NewFunction(If),
+				LeftParen,
+				NewVariable("x"),
+				ArgSeparator,
+				NewVariable("y2"),
+				ArgSeparator,
+				NewOperator(Not),
+				NewVariable("z"),
+				RightParen,
+			},
+		},
+		{
+			name:       "expr #13",
+			args:       args{expr: "if + 1"},
+			wantTokens: nil,
+			wantErr: &SyntaxError{
+				Message:  fmt.Sprintf(errFunctionCall, "if", 0),
+				Token:    "if",
+				Position: 0,
+			},
+		},
+		{
+			name:       "expr #14",
+			args:       args{expr: "(1, 2)"},
+			wantTokens: nil,
+			wantErr: &SyntaxError{
+				Message:  fmt.Sprintf(errMisplacedSeparator, 2),
+				Token:    ",",
+				Position: 2,
+			},
+		},
+		{
+			name:       "expr #15",
+			args:       args{expr: "if(1,,2)"},
+			wantTokens: nil,
+			wantErr: &SyntaxError{
+				Message:  fmt.Sprintf(errEmptyArgument, 5),
+				Token:    ",",
+				Position: 5,
+			},
+		},
+		{
+			name:       "expr #16",
+			args:       args{expr: "if(1, (2, 3))"},
+			wantTokens: nil,
+			wantErr: &SyntaxError{
+				Message:  fmt.Sprintf(errMisplacedSeparator, 8),
+				Token:    ",",
+				Position: 8,
+			},
+		},
+		{
+			name:       "expr #17",
+			args:       args{expr: "(()"},
+			wantTokens: nil,
+			wantErr: &SyntaxError{
+				Message:  fmt.Sprintf(errEmptyParen, 2),
+				Token:    ")",
+				Position: 2,
+			},
+		},
+		{
+			name:       "expr #18",
+			args:       args{expr: "((1)"},
+			wantTokens: nil,
+			wantErr: &SyntaxError{
+				Message:  fmt.Sprintf(errUnmatchedLeftParen, 0),
+				Token:    "(",
+				Position: 0,
+			},
+		},
+		{
+			name:       "expr #11",
+			args:       args{expr: "(5 !! +)"},
+			wantTokens: nil,
+			wantErr: &SyntaxError{
+				Message:  fmt.Sprintf(errNoRightOperand, "+", 6),
+				Token:    "+",
+				Position: 6,
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -135,14 +249,134 @@ func Test_tokenizer_Tokenize(t *testing.T) {
 	}
 }
 
-func Test_tokenizer_handleDigit(t *testing.T) {
+func Test_tokenizer_Tokenize_reuse(t *testing.T) {
+	tr := NewTokenizer()
+	_, err := tr.Tokenize("(1 + 2")
+	assert.Error(t, err)
+
+	tokens, err := tr.Tokenize("3x")
+	assert.NoError(t, err)
+	assert.Equal(t, []Token{NewNumber("3"), NewOperator(Multiplication), NewVariable("x")}, tokens)
+}
+
+func Test_tokenizer_Tokenize_concurrent(t *testing.T) {
+	exprs := []string{"12 <= (3)4!", "if(x > 0, -x, 2y)", "1 + (2", "5 mod 3 xor ~x", "clz(2) * .5"}
+	tr := NewTokenizer()
+
+	type result struct {
+		tokens []Token
+		err    error
+	}
+	want := make([]result, len(exprs))
+	for i, expr := range exprs {
+		want[i].tokens, want[i].err = tr.Tokenize(expr)
+	}
+
+	const goroutines = 8
+	var wg sync.WaitGroup
+	got := make([][]result, goroutines)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for n := 0; n < 50; n++ {
+				i := (g + n) % len(exprs)
+				tokens, err := tr.Tokenize(exprs[i])
+				got[g] = append(got[g], result{tokens, err})
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	for g := range got {
+		for n, res := range got[g] {
+			assert.Equal(t, want[(g+n)%len(exprs)], res)
+		}
+	}
+}
+
+func Test_tokenizer_Tokenize_allocs(t *testing.T) {
+	// the token and span slices are allocated once, and only numbers and variables allocate tokens.
+	// Brackets also allocate, to keep track of their nesting. The counts are upper bounds, since they
+	// depend on the compiler.
+	tests := []struct {
+		name string
+		expr string
+		max  float64
+	}{
+		{"long numbers are not copied", "123456789.123456789", 3},
+		{"long names are not copied", "someLongVariableName", 3},
+		{"operators, brackets and whitespace do not allocate", "-  1  +  2 ^ 3  !", 5},
+		{"non-ASCII input is walked without conversion", "π >= 3", 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := NewTokenizer()
+			allocs := testing.AllocsPerRun(100, func() {
+				_, _ = tr.Tokenize(tt.expr)
+			})
+			assert.LessOrEqual(t, allocs, tt.max)
+		})
+	}
+}
+
+func Benchmark_tokenizer_Tokenize(b *testing.B) {
+	benchmarks := []struct {
+		name string
+		expr string
+	}{
+		{"short", "2x + 1"},
+		{"formula", "(x^2 + 3x*y - 4) / 7 + popcount(2)"},
+		{"long", strings.Repeat("12.5x^3 - y / 4 + ", 100) + "1"},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			tr := NewTokenizer()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := tr.Tokenize(bm.expr); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func Test_tokenizer_tokenize(t *testing.T) {
+	tr := newTokenizer(defaultTokenRegistry)
+	tokens, spans, err := tr.tokenize("12 <= (3)4!")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Token{
+		NewNumber("12"),
+		NewOperator(LessEqual),
+		LeftParen,
+		NewNumber("3"),
+		RightParen,
+		NewOperator(Multiplication),
+		NewNumber("4"),
+		NewOperator(Factorial),
+	}, tokens)
+	assert.Equal(t, []Span{
+		{Start: 0, End: 2},
+		{Start: 3, End: 5},
+		{Start: 6, End: 7},
+		{Start: 7, End: 8},
+		{Start: 8, End: 9},
+		{Start: 9, End: 9},
+		{Start: 9, End: 10},
+		{Start: 10, End: 11},
+	}, spans)
+}
+
+func Test_scanner_handleDigit(t *testing.T) {
 	type fields struct {
 		tokens     []Token
 		currState  int
 		currSymbol string
 	}
 	type args struct {
-		r rune
+		r string
 	}
 	tests := []struct {
 		name           string
@@ -156,7 +390,7 @@ func Test_tokenizer_handleDigit(t *testing.T) {
 		{
 			name:           "a digit should append an existing integer",
 			fields:         fields{currState: tokenInteger, currSymbol: "123"},
-			args:           args{r: '4'},
+			args:           args{r: "4"},
 			wantState:      tokenInteger,
 			wantCurrSymbol: "1234",
 			wantErr:        nil,
@@ -164,7 +398,7 @@ func Test_tokenizer_handleDigit(t *testing.T) {
 		{
 			name:           "a digit should append an existing decimal",
 			fields:         fields{currState: tokenDecimal, currSymbol: "1.5"},
-			args:           args{r: '7'},
+			args:           args{r: "7"},
 			wantState:      tokenDecimal,
 			wantCurrSymbol: "1.57",
 			wantErr:        nil,
@@ -172,7 +406,7 @@ func Test_tokenizer_handleDigit(t *testing.T) {
 		{
 			name:           "a digit should convert a decimal point into a decimal",
 			fields:         fields{currState: tokenDecimalPoint, currSymbol: "."},
-			args:           args{r: '5'},
+			args:           args{r: "5"},
 			wantState:      tokenDecimal,
 			wantCurrSymbol: ".5",
 			wantErr:        nil,
@@ -180,7 +414,7 @@ func Test_tokenizer_handleDigit(t *testing.T) {
 		{
 			name:           "a digit at the start should set the current state into an integer",
 			fields:         fields{currState: tokenNothing, currSymbol: ""},
-			args:           args{r: '5'},
+			args:           args{r: "5"},
 			wantState:      tokenInteger,
 			wantCurrSymbol: "5",
 			wantErr:        nil,
@@ -188,7 +422,7 @@ func Test_tokenizer_handleDigit(t *testing.T) {
 		{
 			name:           "a * operator should be inserted between a ')' and a digit",
 			fields:         fields{currState: tokenRightParen, currSymbol: ")"},
-			args:           args{r: '5'},
+			args:           args{r: "5"},
 			wantState:      tokenInteger,
 			wantCurrSymbol: "5",
 			wantErr:        nil,
@@ -197,7 +431,7 @@ func Test_tokenizer_handleDigit(t *testing.T) {
 		{
 			name:           "a * operator should be inserted between a right unary op and a digit",
 			fields:         fields{currState: tokenRightUnaryOp, currSymbol: "!"},
-			args:           args{r: '5'},
+			args:           args{r: "5"},
 			wantState:      tokenInteger,
 			wantCurrSymbol: "5",
 			wantErr:        nil,
@@ -206,7 +440,7 @@ func Test_tokenizer_handleDigit(t *testing.T) {
 		{
 			name:           "a binary operator should be committed before adding a digit",
 			fields:         fields{currState: tokenBinaryOp, currSymbol: "/"},
-			args:           args{r: '5'},
+			args:           args{r: "5"},
 			wantState:      tokenInteger,
 			wantCurrSymbol: "5",
 			wantErr:        nil,
@@ -215,7 +449,7 @@ func Test_tokenizer_handleDigit(t *testing.T) {
 		{
 			name:           "a '(' should be committed before adding a digit",
 			fields:         fields{currState: tokenLeftParen, currSymbol: "("},
-			args:           args{r: '5'},
+			args:           args{r: "5"},
 			wantState:      tokenInteger,
 			wantCurrSymbol: "5",
 			wantErr:        nil,
@@ -224,7 +458,7 @@ func Test_tokenizer_handleDigit(t *testing.T) {
 		{
 			name:           "a left unary operator should be committed before adding a digit",
 			fields:         fields{currState: tokenLeftUnaryOp, currSymbol: "-"},
-			args:           args{r: '5'},
+			args:           args{r: "5"},
 			wantState:      tokenInteger,
 			wantCurrSymbol: "5",
 			wantErr:        nil,
@@ -233,13 +467,11 @@ func Test_tokenizer_handleDigit(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			sb := new(strings.Builder)
-			sb.WriteString(tt.fields.currSymbol)
-			tr := &tokenizer{
+			tr := &scanner{
 				reg:        defaultTokenRegistry,
 				tokens:     tt.fields.tokens,
 				currState:  tt.fields.currState,
-				currSymbol: sb,
+				currSymbol: tt.fields.currSymbol,
 			}
 
 			err := tr.handleDigit(tt.args.r)
@@ -250,20 +482,20 @@ func Test_tokenizer_handleDigit(t *testing.T) {
 				assert.NoError(t, err)
 			}
 			assert.Equal(t, tt.wantState, tr.currState)
-			assert.Equal(t, tt.wantCurrSymbol, tr.currSymbol.String())
+			assert.Equal(t, tt.wantCurrSymbol, tr.currSymbol)
 			assert.Equal(t, tt.wantTokens, tr.tokens)
 		})
 	}
 }
 
-func Test_tokenizer_handleDecimalPoint(t *testing.T) {
+func Test_scanner_handleDecimalPoint(t *testing.T) {
 	type fields struct {
 		tokens     []Token
 		currState  int
 		currSymbol string
 	}
 	type args struct {
-		r rune
+		r string
 	}
 	tests := []struct {
 		name           string
@@ -277,7 +509,7 @@ func Test_tokenizer_handleDecimalPoint(t *testing.T) {
 		{
 			name:           "a decimal point should convert an integer into a decimal",
 			fields:         fields{currState: tokenInteger, currSymbol: "123"},
-			args:           args{r: '.'},
+			args:           args{r: "."},
 			wantState:      tokenDecimal,
 			wantCurrSymbol: "123.",
 			wantErr:        nil,
@@ -285,7 +517,7 @@ func Test_tokenizer_handleDecimalPoint(t *testing.T) {
 		{
 			name:           "multiple decimal points in a decimal should not be allowed",
 			fields:         fields{currState: tokenDecimal, currSymbol: "1.5"},
-			args:           args{r: '.'},
+			args:           args{r: "."},
 			wantState:      tokenDecimal,
 			wantCurrSymbol: "1.5",
 			wantErr: SyntaxError{
@@ -297,7 +529,7 @@ func Test_tokenizer_handleDecimalPoint(t *testing.T) {
 		{
 			name:           "a decimal point should not be followed with another decimal point",
 			fields:         fields{currState: tokenDecimalPoint, currSymbol: "."},
-			args:           args{r: '.'},
+			args:           args{r: "."},
 			wantState:      tokenDecimalPoint,
 			wantCurrSymbol: ".",
 			wantErr: SyntaxError{
@@ -309,7 +541,7 @@ func Test_tokenizer_handleDecimalPoint(t *testing.T) {
 		{
 			name:           "a decimal point at the start should set the current state into a decimal point",
 			fields:         fields{currState: tokenNothing, currSymbol: ""},
-			args:           args{r: '.'},
+			args:           args{r: "."},
 			wantState:      tokenDecimalPoint,
 			wantCurrSymbol: ".",
 			wantErr:        nil,
@@ -317,7 +549,7 @@ func Test_tokenizer_handleDecimalPoint(t *testing.T) {
 		{
 			name:           "a * operator should be inserted between a ')' and a decimal point",
 			fields:         fields{currState: tokenRightParen, currSymbol: ")"},
-			args:           args{r: '.'},
+			args:           args{r: "."},
 			wantState:      tokenDecimalPoint,
 			wantCurrSymbol: ".",
 			wantErr:        nil,
@@ -326,7 +558,7 @@ func Test_tokenizer_handleDecimalPoint(t *testing.T) {
 		{
 			name:           "a * operator should be inserted between a right unary op and a decimal point",
 			fields:         fields{currState: tokenRightUnaryOp, currSymbol: "!"},
-			args:           args{r: '.'},
+			args:           args{r: "."},
 			wantState:      tokenDecimalPoint,
 			wantCurrSymbol: ".",
 			wantErr:        nil,
@@ -335,7 +567,7 @@ func Test_tokenizer_handleDecimalPoint(t *testing.T) {
 		{
 			name:           "a binary operator should be committed before adding a decimal point",
 			fields:         fields{currState: tokenBinaryOp, currSymbol: "/"},
-			args:           args{r: '.'},
+			args:           args{r: "."},
 			wantState:      tokenDecimalPoint,
 			wantCurrSymbol: ".",
 			wantErr:        nil,
@@ -344,7 +576,7 @@ func Test_tokenizer_handleDecimalPoint(t *testing.T) {
 		{
 			name:           "a '(' should be committed before adding a decimal point",
 			fields:         fields{currState: tokenLeftParen, currSymbol: "("},
-			args:           args{r: '.'},
+			args:           args{r: "."},
 			wantState:      tokenDecimalPoint,
 			wantCurrSymbol: ".",
 			wantErr:        nil,
@@ -353,7 +585,7 @@ func Test_tokenizer_handleDecimalPoint(t *testing.T) {
 		{
 			name:           "a left unary operator should be committed before adding a digit",
 			fields:         fields{currState: tokenLeftUnaryOp, currSymbol: "-"},
-			args:           args{r: '.'},
+			args:           args{r: "."},
 			wantState:      tokenDecimalPoint,
 			wantCurrSymbol: ".",
 			wantErr:        nil,
@@ -362,13 +594,11 @@ func Test_tokenizer_handleDecimalPoint(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			sb := new(strings.Builder)
-			sb.WriteString(tt.fields.currSymbol)
-			tr := &tokenizer{
+			tr := &scanner{
 				reg:        defaultTokenRegistry,
 				tokens:     tt.fields.tokens,
 				currState:  tt.fields.currState,
-				currSymbol: sb,
+				currSymbol: tt.fields.currSymbol,
 			}
 
 			err := tr.handleDecimalPoint(tt.args.r)
@@ -379,20 +609,20 @@ func Test_tokenizer_handleDecimalPoint(t *testing.T) {
 				assert.NoError(t, err)
 			}
 			assert.Equal(t, tt.wantState, tr.currState)
-			assert.Equal(t, tt.wantCurrSymbol, tr.currSymbol.String())
+			assert.Equal(t, tt.wantCurrSymbol, tr.currSymbol)
 			assert.Equal(t, tt.wantTokens, tr.tokens)
 		})
 	}
 }
 
-func Test_tokenizer_handleLeftParen(t *testing.T) {
+func Test_scanner_handleLeftParen(t *testing.T) {
 	type fields struct {
 		tokens     []Token
 		currState  int
 		currSymbol string
 	}
 	type args struct {
-		r rune
+		r string
 	}
 	tests := []struct {
 		name               string
@@ -409,7 +639,7 @@ func Test_tokenizer_handleLeftParen(t *testing.T) {
 			fields: fields{
 				currState: tokenNothing,
 			},
-			args:               args{r: '('},
+			args:               args{r: "("},
 			wantState:          tokenLeftParen,
 			wantCurrSymbol:     "(",
 			wantCurrParenDepth: 1,
@@ -422,7 +652,7 @@ func Test_tokenizer_handleLeftParen(t *testing.T) {
 				currState:  tokenInteger,
 				currSymbol: "123",
 			},
-			args:               args{r: '('},
+			args:               args{r: "("},
 			wantState:          tokenLeftParen,
 			wantCurrSymbol:     "(",
 			wantCurrParenDepth: 1,
@@ -435,7 +665,7 @@ func Test_tokenizer_handleLeftParen(t *testing.T) {
 				currState:  tokenDecimalPoint,
 				currSymbol: ".",
 			},
-			args:               args{r: '('},
+			args:               args{r: "("},
 			wantState:          tokenDecimalPoint,
 			wantCurrSymbol:     ".",
 			wantCurrParenDepth: 0,
@@ -452,7 +682,7 @@ func Test_tokenizer_handleLeftParen(t *testing.T) {
 				currState:  tokenDecimal,
 				currSymbol: "1.23",
 			},
-			args:               args{r: '('},
+			args:               args{r: "("},
 			wantState:          tokenLeftParen,
 			wantCurrSymbol:     "(",
 			wantCurrParenDepth: 1,
@@ -465,7 +695,7 @@ func Test_tokenizer_handleLeftParen(t *testing.T) {
 				currState:  tokenLeftParen,
 				currSymbol: "(",
 			},
-			args:               args{r: '('},
+			args:               args{r: "("},
 			wantState:          tokenLeftParen,
 			wantCurrSymbol:     "(",
 			wantCurrParenDepth: 1,
@@ -478,7 +708,7 @@ func Test_tokenizer_handleLeftParen(t *testing.T) {
 				currState:  tokenRightParen,
 				currSymbol: ")",
 			},
-			args:               args{r: '('},
+			args:               args{r: "("},
 			wantState:          tokenLeftParen,
 			wantCurrSymbol:     "(",
 			wantCurrParenDepth: 1,
@@ -491,7 +721,7 @@ func Test_tokenizer_handleLeftParen(t *testing.T) {
 				currState:  tokenBinaryOp,
 				currSymbol: "/",
 			},
-			args:               args{r: '('},
+			args:               args{r: "("},
 			wantState:          tokenLeftParen,
 			wantCurrSymbol:     "(",
 			wantCurrParenDepth: 1,
@@ -504,7 +734,7 @@ func Test_tokenizer_handleLeftParen(t *testing.T) {
 				currState:  tokenLeftUnaryOp,
 				currSymbol: "+",
 			},
-			args:               args{r: '('},
+			args:               args{r: "("},
 			wantState:          tokenLeftParen,
 			wantCurrSymbol:     "(",
 			wantCurrParenDepth: 1,
@@ -517,7 +747,7 @@ func Test_tokenizer_handleLeftParen(t *testing.T) {
 				currState:  tokenRightUnaryOp,
 				currSymbol: "!",
 			},
-			args:               args{r: '('},
+			args:               args{r: "("},
 			wantState:          tokenLeftParen,
 			wantCurrSymbol:     "(",
 			wantCurrParenDepth: 1,
@@ -527,13 +757,11 @@ func Test_tokenizer_handleLeftParen(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			sb := new(strings.Builder)
-			sb.WriteString(tt.fields.currSymbol)
-			tr := &tokenizer{
+			tr := &scanner{
 				reg:        defaultTokenRegistry,
 				tokens:     tt.fields.tokens,
 				currState:  tt.fields.currState,
-				currSymbol: sb,
+				currSymbol: tt.fields.currSymbol,
 			}
 
 			err := tr.handleLeftParen(tt.args.r)
@@ -544,14 +772,14 @@ func Test_tokenizer_handleLeftParen(t *testing.T) {
 				assert.NoError(t, err)
 			}
 			assert.Equal(t, tt.wantState, tr.currState)
-			assert.Equal(t, tt.wantCurrSymbol, tr.currSymbol.String())
+			assert.Equal(t, tt.wantCurrSymbol, tr.currSymbol)
 			assert.Equal(t, tt.wantTokens, tr.tokens)
 			assert.Equal(t, tt.wantCurrParenDepth, tr.parenDepth.depth())
 		})
 	}
 }
 
-func Test_tokenizer_handleRightParen(t *testing.T) {
+func Test_scanner_handleRightParen(t *testing.T) {
 	type fields struct {
 		tokens     []Token
 		currState  int
@@ -559,7 +787,7 @@ func Test_tokenizer_handleRightParen(t *testing.T) {
 		parenDepth bracketStack
 	}
 	type args struct {
-		r rune
+		r string
 	}
 	tests := []struct {
 		name               string
@@ -579,7 +807,7 @@ func Test_tokenizer_handleRightParen(t *testing.T) {
 				currSymbol: "1",
 				parenDepth: bracketStack{stack: []bracketDepth{{0, 1, LeftParen}}},
 			},
-			args:               args{r: ')'},
+			args:               args{r: ")"},
 			wantState:          tokenRightParen,
 			wantCurrSymbol:     ")",
 			wantCurrParenDepth: 0,
@@ -594,7 +822,7 @@ func Test_tokenizer_handleRightParen(t *testing.T) {
 				currSymbol: "1.5",
 				parenDepth: bracketStack{stack: []bracketDepth{{0, 1, LeftParen}}},
 			},
-			args:               args{r: ')'},
+			args:               args{r: ")"},
 			wantState:          tokenRightParen,
 			wantCurrSymbol:     ")",
 			wantCurrParenDepth: 0,
@@ -609,7 +837,7 @@ func Test_tokenizer_handleRightParen(t *testing.T) {
 				currSymbol: "1",
 				parenDepth: bracketStack{stack: nil},
 			},
-			args:               args{r: ')'},
+			args:               args{r: ")"},
 			wantState:          tokenInteger,
 			wantCurrSymbol:     "1",
 			wantCurrParenDepth: 0,
@@ -628,7 +856,7 @@ func Test_tokenizer_handleRightParen(t *testing.T) {
 				currSymbol: ".",
 				parenDepth: bracketStack{stack: []bracketDepth{{0, 1, LeftParen}}},
 			},
-			args:               args{r: ')'},
+			args:               args{r: ")"},
 			wantState:          tokenDecimalPoint,
 			wantCurrSymbol:     ".",
 			wantCurrParenDepth: 1,
@@ -647,7 +875,7 @@ func Test_tokenizer_handleRightParen(t *testing.T) {
 				currSymbol: "(",
 				parenDepth: bracketStack{stack: []bracketDepth{{0, 1, LeftParen}}},
 			},
-			args:               args{r: ')'},
+			args:               args{r: ")"},
 			wantState:          tokenLeftParen,
 			wantCurrSymbol:     "(",
 			wantCurrParenDepth: 1,
@@ -666,7 +894,7 @@ func Test_tokenizer_handleRightParen(t *testing.T) {
 				currSymbol: ")",
 				parenDepth: bracketStack{stack: []bracketDepth{{0, 1, LeftParen}}},
 			},
-			args:               args{r: ')'},
+			args:               args{r: ")"},
 			wantState:          tokenRightParen,
 			wantCurrSymbol:     ")",
 			wantCurrParenDepth: 0,
@@ -681,7 +909,7 @@ func Test_tokenizer_handleRightParen(t *testing.T) {
 				currSymbol: "*",
 				parenDepth: bracketStack{stack: []bracketDepth{{0, 1, LeftParen}}},
 			},
-			args:               args{r: ')'},
+			args:               args{r: ")"},
 			wantState:          tokenBinaryOp,
 			wantCurrSymbol:     "*",
 			wantCurrParenDepth: 1,
@@ -700,7 +928,7 @@ func Test_tokenizer_handleRightParen(t *testing.T) {
 				currSymbol: "-",
 				parenDepth: bracketStack{stack: []bracketDepth{{0, 1, LeftParen}}},
 			},
-			args:               args{r: ')'},
+			args:               args{r: ")"},
 			wantState:          tokenLeftUnaryOp,
 			wantCurrSymbol:     "-",
 			wantCurrParenDepth: 1,
@@ -719,7 +947,7 @@ func Test_tokenizer_handleRightParen(t *testing.T) {
 				currSymbol: "!",
 				parenDepth: bracketStack{stack: []bracketDepth{{0, 1, LeftParen}}},
 			},
-			args:               args{r: ')'},
+			args:               args{r: ")"},
 			wantState:          tokenRightParen,
 			wantCurrSymbol:     ")",
 			wantCurrParenDepth: 0,
@@ -729,14 +957,11 @@ func Test_tokenizer_handleRightParen(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			sb := new(strings.Builder)
-			sb.WriteString(tt.fields.currSymbol)
-
-			tr := &tokenizer{
+			tr := &scanner{
 				reg:        defaultTokenRegistry,
 				tokens:     tt.fields.tokens,
 				currState:  tt.fields.currState,
-				currSymbol: sb,
+				currSymbol: tt.fields.currSymbol,
 				parenDepth: tt.fields.parenDepth,
 			}
 
@@ -747,14 +972,14 @@ func Test_tokenizer_handleRightParen(t *testing.T) {
 				assert.NoError(t, err)
 			}
 			assert.Equal(t, tt.wantState, tr.currState)
-			assert.Equal(t, tt.wantCurrSymbol, tr.currSymbol.String())
+			assert.Equal(t, tt.wantCurrSymbol, tr.currSymbol)
 			assert.Equal(t, tt.wantTokens, tr.tokens)
 			assert.Equal(t, tt.wantCurrParenDepth, tr.parenDepth.depth())
 		})
 	}
 }
 
-func Test_tokenizer_handleOperator(t *testing.T) {
+func Test_scanner_handleOperator(t *testing.T) {
 	type fields struct {
 		tokens     []Token
 		currState  int
@@ -762,7 +987,7 @@ func Test_tokenizer_handleOperator(t *testing.T) {
 		parenDepth bracketStack
 	}
 	type args struct {
-		r rune
+		op string
 	}
 	tests := []struct {
 		name               string
@@ -782,7 +1007,7 @@ func Test_tokenizer_handleOperator(t *testing.T) {
 				currSymbol: "",
 				parenDepth: bracketStack{stack: nil},
 			},
-			args:               args{r: '-'},
+			args:               args{op: "-"},
 			wantState:          tokenLeftUnaryOp,
 			wantCurrSymbol:     "-",
 			wantCurrParenDepth: 0,
@@ -797,7 +1022,7 @@ func Test_tokenizer_handleOperator(t *testing.T) {
 				currSymbol: "",
 				parenDepth: bracketStack{stack: nil},
 			},
-			args:               args{r: '*'},
+			args:               args{op: "*"},
 			wantState:          tokenNothing,
 			wantCurrSymbol:     "",
 			wantCurrParenDepth: 0,
@@ -816,7 +1041,7 @@ func Test_tokenizer_handleOperator(t *testing.T) {
 				currSymbol: "",
 				parenDepth: bracketStack{stack: nil},
 			},
-			args:               args{r: '!'},
+			args:               args{op: "!"},
 			wantState:          tokenNothing,
 			wantCurrSymbol:     "",
 			wantCurrParenDepth: 0,
@@ -835,7 +1060,7 @@ func Test_tokenizer_handleOperator(t *testing.T) {
 				currSymbol: "1",
 				parenDepth: bracketStack{stack: nil},
 			},
-			args:               args{r: '-'},
+			args:               args{op: "-"},
 			wantState:          tokenBinaryOp,
 			wantCurrSymbol:     "-",
 			wantCurrParenDepth: 0,
@@ -850,7 +1075,7 @@ func Test_tokenizer_handleOperator(t *testing.T) {
 				currSymbol: "1",
 				parenDepth: bracketStack{stack: nil},
 			},
-			args:               args{r: '*'},
+			args:               args{op: "*"},
 			wantState:          tokenBinaryOp,
 			wantCurrSymbol:     "*",
 			wantCurrParenDepth: 0,
@@ -865,7 +1090,7 @@ func Test_tokenizer_handleOperator(t *testing.T) {
 				currSymbol: "1",
 				parenDepth: bracketStack{stack: nil},
 			},
-			args:               args{r: '!'},
+			args:               args{op: "!"},
 			wantState:          tokenRightUnaryOp,
 			wantCurrSymbol:     "!",
 			wantCurrParenDepth: 0,
@@ -880,7 +1105,7 @@ func Test_tokenizer_handleOperator(t *testing.T) {
 				currSymbol: ".",
 				parenDepth: bracketStack{stack: nil},
 			},
-			args:               args{r: '-'},
+			args:               args{op: "-"},
 			wantState:          tokenDecimalPoint,
 			wantCurrSymbol:     ".",
 			wantCurrParenDepth: 0,
@@ -899,7 +1124,7 @@ func Test_tokenizer_handleOperator(t *testing.T) {
 				currSymbol: ".",
 				parenDepth: bracketStack{stack: nil},
 			},
-			args:               args{r: '*'},
+			args:               args{op: "*"},
 			wantState:          tokenDecimalPoint,
 			wantCurrSymbol:     ".",
 			wantCurrParenDepth: 0,
@@ -918,7 +1143,7 @@ func Test_tokenizer_handleOperator(t *testing.T) {
 				currSymbol: ".",
 				parenDepth: bracketStack{stack: nil},
 			},
-			args:               args{r: '!'},
+			args:               args{op: "!"},
 			wantState:          tokenDecimalPoint,
 			wantCurrSymbol:     ".",
 			wantCurrParenDepth: 0,
@@ -937,7 +1162,7 @@ func Test_tokenizer_handleOperator(t *testing.T) {
 				currSymbol: "1.5",
 				parenDepth: bracketStack{stack: nil},
 			},
-			args:               args{r: '-'},
+			args:               args{op: "-"},
 			wantState:          tokenBinaryOp,
 			wantCurrSymbol:     "-",
 			wantCurrParenDepth: 0,
@@ -952,7 +1177,7 @@ func Test_tokenizer_handleOperator(t *testing.T) {
 				currSymbol: "1.5",
 				parenDepth: bracketStack{stack: nil},
 			},
-			args:               args{r: '*'},
+			args:               args{op: "*"},
 			wantState:          tokenBinaryOp,
 			wantCurrSymbol:     "*",
 			wantCurrParenDepth: 0,
@@ -967,7 +1192,7 @@ func Test_tokenizer_handleOperator(t *testing.T) {
 				currSymbol: "1.5",
 				parenDepth: bracketStack{stack: nil},
 			},
-			args:               args{r: '!'},
+			args:               args{op: "!"},
 			wantState:          tokenRightUnaryOp,
 			wantCurrSymbol:     "!",
 			wantCurrParenDepth: 0,
@@ -982,7 +1207,7 @@ func Test_tokenizer_handleOperator(t *testing.T) {
 				currSymbol: "(",
 				parenDepth: bracketStack{stack: []bracketDepth{{0, 1, LeftParen}}},
 			},
-			args:               args{r: '-'},
+			args:               args{op: "-"},
 			wantState:          tokenLeftUnaryOp,
 			wantCurrSymbol:     "-",
 			wantCurrParenDepth: 1,
@@ -997,7 +1222,7 @@ func Test_tokenizer_handleOperator(t *testing.T) {
 				currSymbol: "(",
 				parenDepth: bracketStack{stack: []bracketDepth{{0, 1, LeftParen}}},
 			},
-			args:               args{r: '*'},
+			args:               args{op: "*"},
 			wantState:          tokenLeftParen,
 			wantCurrSymbol:     "(",
 			wantCurrParenDepth: 1,
@@ -1016,7 +1241,7 @@ func Test_tokenizer_handleOperator(t *testing.T) {
 				currSymbol: "(",
 				parenDepth: bracketStack{stack: []bracketDepth{{0, 1, LeftParen}}},
 			},
-			args:               args{r: '!'},
+			args:               args{op: "!"},
 			wantState:          tokenLeftParen,
 			wantCurrSymbol:     "(",
 			wantCurrParenDepth: 1,
@@ -1035,7 +1260,7 @@ func Test_tokenizer_handleOperator(t *testing.T) {
 				currSymbol: ")",
 				parenDepth: bracketStack{stack: nil},
 			},
-			args:               args{r: '-'},
+			args:               args{op: "-"},
 			wantState:          tokenBinaryOp,
 			wantCurrSymbol:     "-",
 			wantCurrParenDepth: 0,
@@ -1050,7 +1275,7 @@ func Test_tokenizer_handleOperator(t *testing.T) {
 				currSymbol: ")",
 				parenDepth: bracketStack{stack: nil},
 			},
-			args:               args{r: '*'},
+			args:               args{op: "*"},
 			wantState:          tokenBinaryOp,
 			wantCurrSymbol:     "*",
 			wantCurrParenDepth: 0,
@@ -1065,7 +1290,7 @@ func Test_tokenizer_handleOperator(t *testing.T) {
 				currSymbol: ")",
 				parenDepth: bracketStack{stack: nil},
 			},
-			args:               args{r: '!'},
+			args:               args{op: "!"},
 			wantState:          tokenRightUnaryOp,
 			wantCurrSymbol:     "!",
 			wantCurrParenDepth: 0,
@@ -1080,7 +1305,7 @@ func Test_tokenizer_handleOperator(t *testing.T) {
 				currSymbol: "*",
 				parenDepth: bracketStack{stack: nil},
 			},
-			args:               args{r: '-'},
+			args:               args{op: "-"},
 			wantState:          tokenLeftUnaryOp,
 			wantCurrSymbol:     "-",
 			wantCurrParenDepth: 0,
@@ -1095,7 +1320,7 @@ func Test_tokenizer_handleOperator(t *testing.T) {
 				currSymbol: "*",
 				parenDepth: bracketStack{stack: nil},
 			},
-			args:               args{r: '/'},
+			args:               args{op: "/"},
 			wantState:          tokenBinaryOp,
 			wantCurrSymbol:     "*",
 			wantCurrParenDepth: 0,
@@ -1114,7 +1339,7 @@ func Test_tokenizer_handleOperator(t *testing.T) {
 				currSymbol: "*",
 				parenDepth: bracketStack{stack: nil},
 			},
-			args:               args{r: '!'},
+			args:               args{op: "!"},
 			wantState:          tokenBinaryOp,
 			wantCurrSymbol:     "*",
 			wantCurrParenDepth: 0,
@@ -1133,7 +1358,7 @@ func Test_tokenizer_handleOperator(t *testing.T) {
 				currSymbol: "-",
 				parenDepth: bracketStack{stack: nil},
 			},
-			args:               args{r: '+'},
+			args:               args{op: "+"},
 			wantState:          tokenLeftUnaryOp,
 			wantCurrSymbol:     "+",
 			wantCurrParenDepth: 0,
@@ -1148,7 +1373,7 @@ func Test_tokenizer_handleOperator(t *testing.T) {
 				currSymbol: "-",
 				parenDepth: bracketStack{stack: nil},
 			},
-			args:               args{r: '*'},
+			args:               args{op: "*"},
 			wantState:          tokenLeftUnaryOp,
 			wantCurrSymbol:     "-",
 			wantCurrParenDepth: 0,
@@ -1167,7 +1392,7 @@ func Test_tokenizer_handleOperator(t *testing.T) {
 				currSymbol: "-",
 				parenDepth: bracketStack{stack: nil},
 			},
-			args:               args{r: '!'},
+			args:               args{op: "!"},
 			wantState:          tokenLeftUnaryOp,
 			wantCurrSymbol:     "-",
 			wantCurrParenDepth: 0,
@@ -1186,7 +1411,7 @@ func Test_tokenizer_handleOperator(t *testing.T) {
 				currSymbol: "!",
 				parenDepth: bracketStack{stack: nil},
 			},
-			args:               args{r: '+'},
+			args:               args{op: "+"},
 			wantState:          tokenBinaryOp,
 			wantCurrSymbol:     "+",
 			wantCurrParenDepth: 0,
@@ -1201,7 +1426,7 @@ func Test_tokenizer_handleOperator(t *testing.T) {
 				currSymbol: "!",
 				parenDepth: bracketStack{stack: nil},
 			},
-			args:               args{r: '*'},
+			args:               args{op: "*"},
 			wantState:          tokenBinaryOp,
 			wantCurrSymbol:     "*",
 			wantCurrParenDepth: 0,
@@ -1216,7 +1441,7 @@ func Test_tokenizer_handleOperator(t *testing.T) {
 				currSymbol: "!",
 				parenDepth: bracketStack{stack: nil},
 			},
-			args:               args{r: '!'},
+			args:               args{op: "!"},
 			wantState:          tokenRightUnaryOp,
 			wantCurrSymbol:     "!",
 			wantCurrParenDepth: 0,
@@ -1226,32 +1451,168 @@ func Test_tokenizer_handleOperator(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			sb := new(strings.Builder)
-			sb.WriteString(tt.fields.currSymbol)
-
-			tr := &tokenizer{
+			tr := &scanner{
 				reg:        defaultTokenRegistry,
 				tokens:     tt.fields.tokens,
 				currState:  tt.fields.currState,
-				currSymbol: sb,
+				currSymbol: tt.fields.currSymbol,
 				parenDepth: tt.fields.parenDepth,
 			}
 
-			err := tr.handleOperator(tt.args.r)
+			err := tr.handleOperator(tt.args.op)
 			if tt.wantErr != nil {
 				assert.EqualError(t, err, tt.wantErr.Error())
 			} else {
 				assert.NoError(t, err)
 			}
 			assert.Equal(t, tt.wantState, tr.currState)
-			assert.Equal(t, tt.wantCurrSymbol, tr.currSymbol.String())
+			assert.Equal(t, tt.wantCurrSymbol, tr.currSymbol)
 			assert.Equal(t, tt.wantTokens, tr.tokens)
 			assert.Equal(t, tt.wantCurrParenDepth, tr.parenDepth.depth())
 		})
 	}
 }
 
-func Test_tokenizer_commitCurrentState(t *testing.T) {
+func Test_scanner_handleIdentifier(t *testing.T) {
+	tests := []struct {
+		name       string
+		currState  int
+		currSymbol string
+		ident      string
+		wantState  int
+		wantTokens []Token
+		wantErr    error
+	}{
+		{
+			name:      "an unknown name should be a variable",
+			currState: tokenNothing,
+			ident:     "x",
+			wantState: tokenVariable,
+		},
+		{
+			name:      "a registered function name should be a function",
+			currState: tokenNothing,
+			ident:     "piecewise",
+			wantState: tokenFunction,
+		},
+		{
+			name:       "a * operator should be inserted between a number and an identifier",
+			currState:  tokenInteger,
+			currSymbol: "2",
+			ident:      "x",
+			wantState:  tokenVariable,
+			wantTokens: []Token{NewNumber("2"), NewOperator(Multiplication)},
+		},
+		{
+			name:       "a * operator should be inserted between two variables",
+			currState:  tokenVariable,
+			currSymbol: "x",
+			ident:      "if",
+			wantState:  tokenFunction,
+			wantTokens: []Token{NewVariable("x"), NewOperator(Multiplication)},
+		},
+		{
+			name:       "a binary operator should be committed before an identifier",
+			currState:  tokenBinaryOp,
+			currSymbol: "+",
+			ident:      "x",
+			wantState:  tokenVariable,
+			wantTokens: []Token{NewOperator(Addition)},
+		},
+		{
+			name:       "a lone decimal point must not be followed by an identifier",
+			currState:  tokenDecimalPoint,
+			currSymbol: ".",
+			ident:      "x",
+			wantState:  tokenDecimalPoint,
+			wantErr:    SyntaxError{Message: fmt.Sprintf(errLoneDecimal, -1)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := &scanner{
+				reg:        defaultTokenRegistry,
+				currState:  tt.currState,
+				currSymbol: tt.currSymbol,
+			}
+
+			err := tr.handleIdentifier(tt.ident)
+			if tt.wantErr != nil {
+				assert.EqualError(t, err, tt.wantErr.Error())
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantState, tr.currState)
+			assert.Equal(t, tt.ident, tr.currSymbol)
+			assert.Equal(t, tt.wantTokens, tr.tokens)
+		})
+	}
+}
+
+func Test_scanner_handleSeparator(t *testing.T) {
+	call := bracketStack{}
+	call.incrementCall(2, LeftParen)
+
+	tests := []struct {
+		name       string
+		currState  int
+		currSymbol string
+		parenDepth bracketStack
+		wantTokens []Token
+		wantErr    error
+	}{
+		{
+			name:       "a separator should commit the previous argument",
+			currState:  tokenInteger,
+			currSymbol: "1",
+			parenDepth: call,
+			wantTokens: []Token{NewNumber("1")},
+		},
+		{
+			name:       "a separator must be inside a function call",
+			currState:  tokenInteger,
+			currSymbol: "1",
+			parenDepth: bracketStack{stack: []bracketDepth{{0, 1, LeftParen}}},
+			wantErr:    SyntaxError{Message: fmt.Sprintf(errMisplacedSeparator, 0)},
+		},
+		{
+			name:       "a separator must not follow the opening parenthesis",
+			currState:  tokenLeftParen,
+			currSymbol: "(",
+			parenDepth: call,
+			wantErr:    SyntaxError{Message: fmt.Sprintf(errEmptyArgument, 0)},
+		},
+		{
+			name:       "a separator must not follow an unfinished operation",
+			currState:  tokenBinaryOp,
+			currSymbol: "*",
+			parenDepth: call,
+			wantErr:    SyntaxError{Message: fmt.Sprintf(errNoRightOperand, "*", -1)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := &scanner{
+				reg:        defaultTokenRegistry,
+				currState:  tt.currState,
+				currSymbol: tt.currSymbol,
+				parenDepth: tt.parenDepth,
+			}
+
+			err := tr.handleSeparator(",")
+			if tt.wantErr != nil {
+				assert.EqualError(t, err, tt.wantErr.Error())
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tokenSeparator, tr.currState)
+			assert.Equal(t, ",", tr.currSymbol)
+			assert.Equal(t, tt.wantTokens, tr.tokens)
+		})
+	}
+}
+
+func Test_scanner_commitCurrentState(t *testing.T) {
 	type fields struct {
 		currState  int
 		currSymbol string
@@ -1352,24 +1713,21 @@ func Test_tokenizer_commitCurrentState(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			sb := new(strings.Builder)
-			sb.WriteString(tt.fields.currSymbol)
-
-			tr := &tokenizer{
+			tr := &scanner{
 				reg:        defaultTokenRegistry,
 				currState:  tt.fields.currState,
-				currSymbol: sb,
+				currSymbol: tt.fields.currSymbol,
 			}
 			tr.commitCurrentState()
 
 			// always empty after state commit
-			assert.Equal(t, tr.currSymbol.Len(), 0)
+			assert.Equal(t, len(tr.currSymbol), 0)
 			assert.Equal(t, tt.wantTokens, tr.tokens)
 		})
 	}
 }
 
-func Test_tokenizer_validateFinalState(t *testing.T) {
+func Test_scanner_validateFinalState(t *testing.T) {
 	type fields struct {
 		currState  int
 		currSymbol string
@@ -1435,13 +1793,10 @@ func Test_tokenizer_validateFinalState(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			sb := new(strings.Builder)
-			sb.WriteString(tt.fields.currSymbol)
-
-			tr := &tokenizer{
+			tr := &scanner{
 				reg:        defaultTokenRegistry,
 				currState:  tt.fields.currState,
-				currSymbol: sb,
+				currSymbol: tt.fields.currSymbol,
 				parenDepth: tt.fields.parenDepth,
 			}
 
@@ -1455,20 +1810,21 @@ func Test_tokenizer_validateFinalState(t *testing.T) {
 	}
 }
 
-func Test_tokenizer_reset(t *testing.T) {
-	sb := new(strings.Builder)
-	sb.WriteString("abcde")
-
-	tt := &tokenizer{
+func Test_scanner_reset(t *testing.T) {
+	tt := &scanner{
+		tokens:     []Token{LeftParen, NewNumber("1")},
+		spans:      []Span{{Start: 0, End: 1}, {Start: 1, End: 2}},
 		currState:  tokenRightParen,
 		currIndex:  10,
 		parenDepth: bracketStack{stack: []bracketDepth{{0, 1, LeftParen}}},
-		currSymbol: sb,
+		currSymbol: "abcde",
 	}
 	tt.reset()
 
+	assert.Empty(t, tt.tokens)
+	assert.Empty(t, tt.spans)
 	assert.Equal(t, tokenNothing, tt.currState)
 	assert.Equal(t, 0, tt.currIndex)
 	assert.Equal(t, 0, tt.parenDepth.depth())
-	assert.Equal(t, 0, tt.currSymbol.Len())
+	assert.Equal(t, 0, len(tt.currSymbol))
 }
@@ -0,0 +1,93 @@
+package yamp
+
+import (
+	"math/big"
+	"strconv"
+)
+
+type valueType int
+
+// Types of values an expression can evaluate to
+const (
+	NumericValue valueType = iota + 1 // NumericValue represents a floating point number.
+	BooleanValue                      // BooleanValue represents a boolean.
+	IntegerValue                      // IntegerValue represents an integer in Int64Mode or BigIntMode.
+)
+
+func (t valueType) String() string {
+	switch t {
+	case NumericValue:
+		return "numeric"
+	case BooleanValue:
+		return "boolean"
+	case IntegerValue:
+		return "integer"
+	}
+	return "<?>"
+}
+
+// Value represents the result of evaluating an expression, which is either numeric, integer or boolean.
+type Value interface {
+	Type() valueType // Type returns the value's type.
+	Number() float64 // Number returns the numerical value, rounded for large integers. It is 0 for boolean values.
+	Int() *big.Int   // Int returns the integer value. It is nil for non-integer values and must not be modified.
+	Bool() bool      // Bool returns the boolean value. It is false for non-boolean values.
+	String() string
+}
+
+var _ Value = (*value)(nil)
+
+type value struct {
+	valueType valueType
+	num       float64
+	i         *big.Int
+	b         bool
+}
+
+// NewNumericValue creates a new numeric Value.
+func NewNumericValue(num float64) Value {
+	return value{valueType: NumericValue, num: num}
+}
+
+// NewIntegerValue creates a new integer Value. The Value takes ownership of i.
+func NewIntegerValue(i *big.Int) Value {
+	num, _ := new(big.Float).SetInt(i).Float64()
+	return value{valueType: IntegerValue, num: num, i: i}
+}
+
+// NewBooleanValue creates a new boolean Value.
+func NewBooleanValue(b bool) Value {
+	return value{valueType: BooleanValue, b: b}
+}
+
+// Type implements the Value interface.
+func (v value) Type() valueType {
+	return v.valueType
+}
+
+// Number implements the Value interface.
+func (v value) Number() float64 {
+	return v.num
+}
+
+// Int implements the Value interface.
+func (v value) Int() *big.Int {
+	return v.i
+}
+
+// Bool implements the Value interface.
+func (v value) Bool() bool {
+	return v.b
+}
+
+func (v value) String() string {
+	switch v.valueType {
+	case NumericValue:
+		return strconv.FormatFloat(v.num, 'g', -1, 64)
+	case BooleanValue:
+		return strconv.FormatBool(v.b)
+	case IntegerValue:
+		return v.i.String()
+	}
+	return "<?>"
+}
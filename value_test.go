@@ -0,0 +1,70 @@
+package yamp
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_valueType_String(t *testing.T) {
+	tests := []struct {
+		name string
+		t    valueType
+		want string
+	}{
+		{"it should return 'numeric' for a NumericValue", NumericValue, "numeric"},
+		{"it should return 'boolean' for a BooleanValue", BooleanValue, "boolean"},
+		{"it should return 'integer' for an IntegerValue", IntegerValue, "integer"},
+		{"it should return '<?>' for an unknown value type", -1, "<?>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.t.String())
+		})
+	}
+}
+
+func TestNewNumericValue(t *testing.T) {
+	v := NewNumericValue(1.5)
+	assert.Equal(t, NumericValue, v.Type())
+	assert.Equal(t, 1.5, v.Number())
+	assert.Equal(t, false, v.Bool())
+}
+
+func TestNewIntegerValue(t *testing.T) {
+	v := NewIntegerValue(big.NewInt(-7))
+	assert.Equal(t, IntegerValue, v.Type())
+	assert.Equal(t, -7.0, v.Number())
+	assert.Equal(t, "-7", v.Int().String())
+	assert.Equal(t, false, v.Bool())
+}
+
+func TestNewBooleanValue(t *testing.T) {
+	v := NewBooleanValue(true)
+	assert.Equal(t, BooleanValue, v.Type())
+	assert.Equal(t, 0.0, v.Number())
+	assert.Equal(t, true, v.Bool())
+}
+
+func Test_value_String(t *testing.T) {
+	tests := []struct {
+		name string
+		v    Value
+		want string
+	}{
+		{"it should format integers without a decimal point", NewNumericValue(5), "5"},
+		{"it should format decimals in the shortest form", NewNumericValue(0.1), "0.1"},
+		{"it should format infinities", NewNumericValue(math.Inf(-1)), "-Inf"},
+		{"it should format integers exactly", NewIntegerValue(new(big.Int).Lsh(big.NewInt(1), 70)), "1180591620717411303424"},
+		{"it should format true", NewBooleanValue(true), "true"},
+		{"it should format false", NewBooleanValue(false), "false"},
+		{"it should return '<?>' for an unknown value type", value{}, "<?>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.v.String())
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package yamp
+
+// Variable represents a named value that is resolved when an expression is evaluated.
+type Variable interface {
+	Token
+	// Name returns the name of the variable.
+	Name() string
+}
+
+var _ Variable = (*variable)(nil)
+
+type variable struct {
+	name string
+}
+
+// NewVariable creates a new Variable.
+func NewVariable(name string) Variable {
+	return variable{name: name}
+}
+
+func (v variable) String() string {
+	return v.name
+}
+
+// Name implements the Variable interface.
+func (v variable) Name() string {
+	return v.name
+}
+
+// Variables maps variable names into their values.
+type Variables map[string]float64
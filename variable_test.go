@@ -0,0 +1,14 @@
+package yamp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewVariable(t *testing.T) {
+	v := NewVariable("x")
+	assert.Equal(t, variable{name: "x"}, v)
+	assert.Equal(t, "x", v.Name())
+	assert.Equal(t, "x", v.String())
+}
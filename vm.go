@@ -0,0 +1,219 @@
+package yamp
+
+import "fmt"
+
+// vmStackSize is the stack size the virtual machine can use without allocating.
+const vmStackSize = 32
+
+// stackEffect returns how many values an instruction pops from and pushes onto the stack.
+func (in instruction) stackEffect() (pops, pushes int) {
+	switch in.code {
+	case opConst, opLoad:
+		return 0, 1
+	case opApply:
+		if in.op.Arity() == Unary {
+			return 1, 1
+		}
+		return 2, 1
+	case opCompare, opRelPercent:
+		return 2, 1
+	case opNot, opPopcount, opClz:
+		return 1, 1
+	case opJumpIfFalse:
+		return 1, 0
+	}
+	return 0, 0
+}
+
+// verify checks that the instructions are well-formed, so that running them never reads outside
+// of the constants, variables or stack, and computes the stack size they need. Jumps may only
+// go forward, which guarantees that programs terminate.
+func (b *bytecode) verify() error {
+	invalid := func(pc int, format string, args ...interface{}) error {
+		return fmt.Errorf(errBytecodeFormat, fmt.Sprintf("instruction %d: ", pc)+fmt.Sprintf(format, args...))
+	}
+
+	// depth[pc] is the stack depth before running the instruction at pc, or -1 if unknown yet
+	depth := make([]int, len(b.code)+1)
+	for i := range depth {
+		depth[i] = -1
+	}
+	depth[0] = 0
+	merge := func(pc, target, d int) error {
+		if target <= pc || target > len(b.code) {
+			return invalid(pc, "jump target %d out of range", target)
+		}
+		if depth[target] >= 0 && depth[target] != d {
+			return invalid(pc, "inconsistent stack depth at jump target %d", target)
+		}
+		depth[target] = d
+		return nil
+	}
+
+	b.maxStack = 0
+	for pc, in := range b.code {
+		d := depth[pc]
+		if d < 0 {
+			return invalid(pc, "unreachable")
+		}
+
+		switch in.code {
+		case opConst:
+			if in.arg < 0 || in.arg >= len(b.consts) {
+				return invalid(pc, "constant %d out of range", in.arg)
+			}
+		case opLoad:
+			if in.arg < 0 || in.arg >= len(b.names) {
+				return invalid(pc, "variable slot %d out of range", in.arg)
+			}
+		case opApply, opCompare:
+			if in.op == nil {
+				return invalid(pc, "unknown operator %d", in.arg)
+			}
+			if cmp := isComparison(in.op.Type()); cmp && in.code == opApply {
+				return invalid(pc, "%s is a comparison", in.op)
+			} else if !cmp && in.code == opCompare {
+				return invalid(pc, "%s is not a comparison", in.op)
+			}
+		case opRelPercent:
+			if in.arg != 1 && in.arg != -1 {
+				return invalid(pc, "invalid sign %d", in.arg)
+			}
+		case opNot, opPopcount, opClz, opJump, opJumpIfFalse, opNoMatch:
+		default:
+			return invalid(pc, "unknown opcode %d", in.code)
+		}
+
+		pops, pushes := in.stackEffect()
+		if d < pops {
+			return invalid(pc, "stack underflow")
+		}
+		d += pushes - pops
+		if d > b.maxStack {
+			b.maxStack = d
+		}
+
+		var err error
+		switch in.code {
+		case opJump:
+			err = merge(pc, in.arg, d)
+		case opJumpIfFalse:
+			if err = merge(pc, in.arg, d); err == nil {
+				err = merge(pc, pc+1, d)
+			}
+		case opNoMatch:
+		default:
+			err = merge(pc, pc+1, d)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if depth[len(b.code)] != 1 {
+		return fmt.Errorf(errBytecodeFormat, "the program does not leave exactly one result")
+	}
+	return nil
+}
+
+// Run implements the Program interface.
+func (b *bytecode) Run(vars []float64) (float64, error) {
+	if len(vars) < len(b.names) {
+		return 0, fmt.Errorf(errSlotCount, len(b.names), len(vars))
+	}
+
+	var buf [vmStackSize]float64
+	stack := buf[:0]
+	if b.maxStack > len(buf) {
+		stack = make([]float64, 0, b.maxStack)
+	}
+
+	for pc := 0; pc < len(b.code); pc++ {
+		in := &b.code[pc]
+		switch in.code {
+		case opConst:
+			stack = append(stack, b.consts[in.arg])
+		case opLoad:
+			stack = append(stack, vars[in.arg])
+		case opApply:
+			var a, c float64
+			top := len(stack) - 1
+			if in.op.Arity() == Unary {
+				a = stack[top]
+			} else {
+				a, c = stack[top-1], stack[top]
+				stack = stack[:top]
+				top--
+			}
+			if isBitwiseOperator(in.op.Type()) {
+				if err := checkInt64Operands(in, a, c); err != nil {
+					return 0, err
+				}
+			}
+			res, err := applyFloat(in.op, a, c, b.moduloMode)
+			if err != nil {
+				return 0, err
+			}
+			stack[top] = res
+		case opCompare:
+			top := len(stack) - 1
+			stack[top-1] = boolToFloat(compareFloat(in.op.Type(), stack[top-1], stack[top]))
+			stack = stack[:top]
+		case opNot:
+			top := len(stack) - 1
+			stack[top] = boolToFloat(stack[top] == 0)
+		case opRelPercent:
+			top := len(stack) - 1
+			a, c := stack[top-1], stack[top]
+			stack[top-1] = a + a*float64(in.arg)*c/100
+			stack = stack[:top]
+		case opPopcount, opClz:
+			top := len(stack) - 1
+			a := stack[top]
+			if !fitsInt64(a) {
+				return 0, TypeError{
+					Message: fmt.Sprintf(errIntegerArgument, 1, in.code, in.sp.Start, NewNumericValue(a)),
+					Span:    in.sp,
+				}
+			}
+			fn := Popcount
+			if in.code == opClz {
+				fn = Clz
+			}
+			stack[top] = float64(bitCount64(fn, int64(a)))
+		case opJump:
+			pc = in.arg - 1
+		case opJumpIfFalse:
+			top := len(stack) - 1
+			if stack[top] == 0 {
+				pc = in.arg - 1
+			}
+			stack = stack[:top]
+		case opNoMatch:
+			return 0, fmt.Errorf(errNoMatchingPiece, "piecewise", in.sp.Start)
+		}
+	}
+	return stack[0], nil
+}
+
+// checkInt64Operands checks the operands of a bitwise operator. Unary operators ignore c.
+func checkInt64Operands(in *instruction, a, c float64) error {
+	v := a
+	if fitsInt64(a) {
+		if in.op.Arity() == Unary || fitsInt64(c) {
+			return nil
+		}
+		v = c
+	}
+	return TypeError{
+		Message: fmt.Sprintf(errIntegerOperand, in.op, in.sp.Start, NewNumericValue(v)),
+		Span:    in.sp,
+	}
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,110 @@
+package yamp
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_bytecode_Run_errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		vars    []float64
+		wantErr error
+	}{
+		{
+			name:    "missing slots are reported",
+			expr:    "x + y",
+			vars:    []float64{1},
+			wantErr: fmt.Errorf(errSlotCount, 2, 1),
+		},
+		{
+			name:    "domain errors are reported",
+			expr:    "x!",
+			vars:    []float64{-1},
+			wantErr: fmt.Errorf(errFactorialNegativeInt, -1.0),
+		},
+		{
+			name:    "unmatched pieces are reported",
+			expr:    "piecewise(x > 0, 1) + 1",
+			vars:    []float64{-1},
+			wantErr: fmt.Errorf(errNoMatchingPiece, "piecewise", 0),
+		},
+		{
+			name: "non-integer bitwise operands are reported",
+			expr: "1 & x",
+			vars: []float64{0.5},
+			wantErr: TypeError{
+				Message: fmt.Sprintf(errIntegerOperand, "&", 2, "0.5"),
+				Span:    Span{Start: 2, End: 3},
+			},
+		},
+		{
+			name: "non-integer popcount arguments are reported",
+			expr: "popcount(x)",
+			vars: []float64{0.5},
+			wantErr: TypeError{
+				Message: fmt.Sprintf(errIntegerArgument, 1, "popcount", 0, "0.5"),
+				Span:    Span{Start: 0, End: 8},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := CompileBytecode(tt.expr)
+			if !assert.NoError(t, err) {
+				return
+			}
+			_, err = b.Run(tt.vars)
+			if _, ok := tt.wantErr.(TypeError); ok {
+				assert.Equal(t, tt.wantErr, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr.Error())
+			}
+		})
+	}
+}
+
+func Test_bytecode_Run_deepStack(t *testing.T) {
+	// right associative powers keep every operand on the stack
+	expr := "1"
+	for i := 0; i < vmStackSize; i++ {
+		expr += "^1"
+	}
+	b, err := CompileBytecode(expr)
+	assert.NoError(t, err)
+	assert.Greater(t, b.(*bytecode).maxStack, vmStackSize)
+
+	got, err := b.Run(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, got)
+}
+
+func Test_bytecode_Run_allocs(t *testing.T) {
+	b, err := CompileBytecode("x > 0 && y != 2 ? (x^2 + 3x*y - 4) mod 7 + 5! : piecewise(y < 0, -y, x)")
+	assert.NoError(t, err)
+
+	vars := []float64{3, 4}
+	allocs := testing.AllocsPerRun(100, func() {
+		_, _ = b.Run(vars)
+	})
+	assert.Zero(t, allocs)
+}
+
+func BenchmarkBytecode_Run(b *testing.B) {
+	bc, err := CompileBytecode("x > 0 ? (x^2 + 3x*y - 4) / 7 : -y")
+	if err != nil {
+		b.Fatal(err)
+	}
+	vars := []float64{3, 4}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		vars[0] = float64(i)
+		if _, err = bc.Run(vars); err != nil {
+			b.Fatal(err)
+		}
+	}
+}